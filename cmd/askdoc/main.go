@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/liliang-cn/askdoc/internal/api"
+	"github.com/liliang-cn/askdoc/internal/api/middleware"
 	"github.com/liliang-cn/askdoc/internal/config"
 	"github.com/liliang-cn/askdoc/internal/repository"
 	"github.com/liliang-cn/askdoc/internal/service"
@@ -38,7 +39,12 @@ func main() {
 	}
 	defer logger.Sync()
 
-	// Initialize database (for collections, sites, sessions - documents are in rago)
+	// Ensure data directories exist and are writable
+	if err := cfg.EnsureDataDirs(); err != nil {
+		logger.Fatal("Failed to prepare data directories", zap.Error(err))
+	}
+
+	// Initialize database (for collections, sites, sessions and document status - documents are in rago)
 	db, err := repository.NewDB(cfg.Database.Path)
 	if err != nil {
 		logger.Fatal("Failed to initialize database", zap.Error(err))
@@ -47,8 +53,15 @@ func main() {
 
 	// Initialize repositories
 	collectionRepo := repository.NewCollectionRepository(db)
+	documentRepo := repository.NewDocumentRepository(db)
 	siteRepo := repository.NewSiteRepository(db)
 	sessionRepo := repository.NewSessionRepository(db)
+	settingsRepo := repository.NewSettingsRepository(db)
+
+	// A bad prompt template is a config error, not a reason to run without RAG
+	if err := service.ValidatePromptTemplate(cfg.RAG.PromptTemplate); err != nil {
+		logger.Fatal("Invalid configuration", zap.Error(err))
+	}
 
 	// Initialize Orchestrator Service (integrates rago for RAG and document storage)
 	orchestrator, err := service.NewOrchestratorService(cfg)
@@ -59,7 +72,9 @@ func main() {
 
 	// Initialize services
 	adminService := service.NewAdminService(
+		cfg,
 		collectionRepo,
+		documentRepo,
 		siteRepo,
 		sessionRepo,
 		orchestrator,
@@ -67,14 +82,29 @@ func main() {
 
 	ingestService := service.NewIngestService(
 		collectionRepo,
+		documentRepo,
 		cfg,
 		orchestrator,
 	)
+	// Document listings page through the metadata DB's records
+	if err := ingestService.RecordDocuments(context.Background()); err != nil {
+		logger.Warn("Failed to record documents in the metadata DB", zap.Error(err))
+	}
+	// Pick up documents the previous run stopped before ingesting
+	if err := ingestService.ResumeIngestion(context.Background()); err != nil {
+		logger.Warn("Failed to resume interrupted ingestion", zap.Error(err))
+	}
+
+	// Purge documents past storage.trash_retention from the trash
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	defer stopSweep()
+	go adminService.SweepTrash(sweepCtx)
 
 	chatService := service.NewChatService(
 		cfg,
 		siteRepo,
 		sessionRepo,
+		collectionRepo,
 		orchestrator,
 	)
 
@@ -85,10 +115,38 @@ func main() {
 		chatService,
 	)
 
+	apiKeyService, err := service.NewAPIKeyService(cfg, settingsRepo)
+	if err != nil {
+		logger.Fatal("Failed to load admin API key", zap.Error(err))
+	}
+
+	requestsPerHour := 0
+	if cfg.RateLimit.Enabled {
+		requestsPerHour = cfg.RateLimit.RequestsPerHour
+	}
+
+	// Cancelled on shutdown to close open SSE streams
+	streamsCtx, closeStreams := context.WithCancel(context.Background())
+
+	healthService := service.NewHealthService(db, orchestrator)
+
 	// Setup router
-	router := api.SetupRouter(adminService, ingestService, widgetService, api.RouterConfig{
-		APIKey:       cfg.Admin.APIKey,
-		AllowOrigins: []string{"*"},
+	router := api.SetupRouter(adminService, ingestService, chatService, widgetService, apiKeyService, healthService, api.RouterConfig{
+		StaticMaxAge:      cfg.Server.StaticMaxAge,
+		Shutdown:          streamsCtx,
+		MaxStreamsPerSite: cfg.RateLimit.MaxStreamsPerSite,
+		MaxStreams:        cfg.RateLimit.MaxStreams,
+		RequestsPerHour:   requestsPerHour,
+		MetricsEnabled:    cfg.Server.MetricsEnabled,
+		TrustedProxies:    cfg.Server.TrustedProxies,
+
+		MaxRequestBody:     cfg.Storage.MaxRequestBody,
+		MaxMultipartMemory: cfg.Storage.MaxMultipartMemory,
+
+		SSEHeartbeatInterval: cfg.Server.SSEHeartbeatInterval,
+
+		AdminCORS:  corsPolicy(cfg.CORS.Admin),
+		WidgetCORS: corsPolicy(cfg.CORS.Widget),
 	})
 
 	// Create HTTP server
@@ -96,9 +154,10 @@ func main() {
 		Addr:         cfg.Address(),
 		Handler:      router,
 		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		WriteTimeout: cfg.WriteTimeout(),
 		IdleTimeout:  120 * time.Second,
 	}
+	srv.RegisterOnShutdown(closeStreams)
 
 	// Start server in goroutine
 	go func() {
@@ -117,13 +176,22 @@ func main() {
 	<-quit
 
 	logger.Info("Shutting down server...")
+	stopSweep()
 
 	// Graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal("Server forced to shutdown", zap.Error(err))
+		logger.Error("Server forced to shutdown", zap.Error(err))
+	}
+
+	// Drain background ingestion before closing the stores. Documents still
+	// queued at the deadline stay pending and are ingested on the next start.
+	ingestCtx, cancelIngest := context.WithTimeout(context.Background(), cfg.Ingest.ShutdownTimeout)
+	defer cancelIngest()
+	if err := ingestService.Shutdown(ingestCtx); err != nil {
+		logger.Warn("Ingestion did not finish before shutdown", zap.Error(err))
 	}
 
 	// Close orchestrator
@@ -134,6 +202,17 @@ func main() {
 	logger.Info("Server exited")
 }
 
+// corsPolicy converts a configured CORS policy for the router
+func corsPolicy(c config.CORSPolicyConfig) middleware.CORSPolicy {
+	return middleware.CORSPolicy{
+		AllowOrigins:     c.AllowOrigins,
+		AllowMethods:     c.AllowMethods,
+		AllowHeaders:     c.AllowHeaders,
+		MaxAge:           c.MaxAge,
+		AllowCredentials: c.AllowCredentials,
+	}
+}
+
 func printBanner() {
 	banner := `
    ___   _____  _____
@@ -1,12 +1,24 @@
 package admin
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/liliang-cn/askdoc/internal/domain"
+	"github.com/liliang-cn/askdoc/internal/metrics"
 	"github.com/liliang-cn/askdoc/internal/service"
 )
 
@@ -14,33 +26,62 @@ import (
 type Handler struct {
 	adminService  *service.AdminService
 	ingestService *service.IngestService
+	chatService   *service.ChatService
+	apiKeyService *service.APIKeyService
 }
 
 // NewHandler creates a new admin handler
-func NewHandler(adminService *service.AdminService, ingestService *service.IngestService) *Handler {
+func NewHandler(
+	adminService *service.AdminService,
+	ingestService *service.IngestService,
+	chatService *service.ChatService,
+	apiKeyService *service.APIKeyService,
+) *Handler {
 	return &Handler{
 		adminService:  adminService,
 		ingestService: ingestService,
+		chatService:   chatService,
+		apiKeyService: apiKeyService,
 	}
 }
 
-// RegisterRoutes registers admin routes
-func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
+// RegisterRoutes registers admin routes; streams wrap the SSE routes
+func (h *Handler) RegisterRoutes(r *gin.RouterGroup, streams ...gin.HandlerFunc) {
 	collections := r.Group("/collections")
 	{
 		collections.POST("", h.CreateCollection)
 		collections.GET("", h.ListCollections)
+		collections.POST("/import", h.ImportCollection)
 		collections.GET("/:id", h.GetCollection)
 		collections.PUT("/:id", h.UpdateCollection)
 		collections.DELETE("/:id", h.DeleteCollection)
+		collections.POST("/:id/merge", h.MergeCollections)
+		collections.GET("/:id/export", h.ExportCollection)
 		collections.POST("/:id/documents", h.UploadDocument)
+		collections.POST("/:id/documents/base64", h.UploadDocumentBase64)
+		collections.POST("/:id/documents/batch", h.UploadDocumentsBatch)
+		collections.POST("/:id/ingest-url", h.IngestURL)
+		collections.POST("/:id/faq", h.IngestFAQ)
 		collections.GET("/:id/documents", h.ListDocuments)
 	}
 
 	documents := r.Group("/documents")
 	{
+		documents.POST("", h.UploadDocumentByName)
+		documents.GET("", h.ListAllDocuments)
+		documents.GET("/trash", h.ListTrash)
+		documents.POST("/trash/purge", h.PurgeTrash)
 		documents.GET("/:id", h.GetDocument)
+		documents.GET("/:id/status", h.GetDocumentStatus)
+		documents.GET("/:id/download", h.DownloadDocument)
 		documents.DELETE("/:id", h.DeleteDocument)
+		documents.POST("/:id/restore", h.RestoreDocument)
+		documents.POST("/:id/publish", h.PublishDocument)
+		documents.POST("/:id/reingest", h.ReingestDocument)
+		documents.POST("/:id/retry", h.RetryDocument)
+		documents.POST("/:id/summarize", h.SummarizeDocument)
+		documents.PUT("/:id/tags", h.SetDocumentTags)
+		documents.POST("/:id/move", h.MoveDocument)
 	}
 
 	sites := r.Group("/sites")
@@ -50,9 +91,32 @@ func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 		sites.GET("/:id", h.GetSite)
 		sites.PUT("/:id", h.UpdateSite)
 		sites.DELETE("/:id", h.DeleteSite)
+		sites.POST("/:id/chat", h.ChatSite)
 	}
 
+	sessions := r.Group("/sessions")
+	{
+		sessions.GET("", h.ListSessions)
+		sessions.GET("/active", h.ListActiveSessions)
+		sessions.GET("/:id", h.GetSession)
+		sessions.POST("/:id/messages/:message_id/verify", h.VerifyAnswer)
+	}
+
+	ingest := r.Group("/ingest")
+	{
+		ingest.POST("/preview", h.PreviewIngest)
+		ingest.GET("/jobs/:job_id", h.GetIngestJob)
+		ingest.GET("/stream/:job_id", append(slices.Clone(streams), h.StreamIngestJob)...)
+	}
+
+	r.GET("/embeddings/export", h.ExportEmbeddings)
 	r.GET("/stats", h.GetStats)
+	r.GET("/stats/gaps", h.GetQuestionGaps)
+	r.GET("/analytics", h.GetAnalytics)
+	r.GET("/analytics/questions", h.GetTopQuestions)
+	r.GET("/feedback", h.ListFeedback)
+	r.POST("/rotate-key", h.RotateKey)
+	r.POST("/storage/reencrypt", h.ReencryptStorage)
 }
 
 // Collection handlers
@@ -66,6 +130,10 @@ func (h *Handler) CreateCollection(c *gin.Context) {
 
 	collection, err := h.adminService.CreateCollection(c.Request.Context(), &req)
 	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -74,13 +142,54 @@ func (h *Handler) CreateCollection(c *gin.Context) {
 }
 
 func (h *Handler) ListCollections(c *gin.Context) {
-	collections, err := h.adminService.ListCollections(c.Request.Context())
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	if format := listFormat(c); format != gin.MIMEJSON {
+		h.streamCollections(c, format, c.Query("q"))
+		return
+	}
+
+	result, err := h.adminService.ListCollections(c.Request.Context(), c.Query("q"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// streamCollections writes every collection matching query as CSV or NDJSON
+func (h *Handler) streamCollections(c *gin.Context, format, query string) {
+	result, err := h.adminService.ListCollections(c.Request.Context(), query, 1, exportPageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"collections": collections})
+	w := newListWriter(c, format, collectionColumns)
+	for page := 1; ; page++ {
+		for _, col := range result.Items {
+			if err := w.Write(collectionRecord(col), col); err != nil {
+				return
+			}
+		}
+		w.Flush()
+		if page*exportPageSize >= result.Total {
+			return
+		}
+		if result, err = h.adminService.ListCollections(c.Request.Context(), query, page+1, exportPageSize); err != nil {
+			w.Fail(err)
+			return
+		}
+	}
 }
 
 func (h *Handler) GetCollection(c *gin.Context) {
@@ -98,6 +207,64 @@ func (h *Handler) GetCollection(c *gin.Context) {
 	c.JSON(http.StatusOK, collection)
 }
 
+// ExportCollection streams a zip archive of a collection: its settings, the
+// original uploads and a manifest of document metadata
+func (h *Handler) ExportCollection(c *gin.Context) {
+	collection, err := h.adminService.GetCollection(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if collection == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.zip", collection.Name, time.Now().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Status(http.StatusOK)
+
+	if err := h.ingestService.ExportCollection(c.Request.Context(), collection, c.Writer); err != nil {
+		// Headers are already sent; the archive is left without its central
+		// directory, so clients see it as corrupt
+		log.Printf("[Admin] Exporting collection %s failed: %v", collection.ID, err)
+	}
+}
+
+// ImportCollection recreates a collection from an export archive uploaded
+// as the file field, reporting the outcome of each document
+func (h *Handler) ImportCollection(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer src.Close()
+
+	result, err := h.ingestService.ImportCollection(c.Request.Context(), src, file.Size)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
 func (h *Handler) UpdateCollection(c *gin.Context) {
 	id := c.Param("id")
 	var req domain.UpdateCollectionRequest
@@ -112,6 +279,10 @@ func (h *Handler) UpdateCollection(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
 			return
 		}
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -129,19 +300,65 @@ func (h *Handler) DeleteCollection(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "collection deleted"})
 }
 
+func (h *Handler) MergeCollections(c *gin.Context) {
+	id := c.Param("id")
+	var req domain.MergeCollectionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	collection, err := h.adminService.MergeCollections(c.Request.Context(), id, req.SourceID)
+	if err != nil {
+		if err == domain.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
 // Document handlers
 
 func (h *Handler) UploadDocument(c *gin.Context) {
 	collectionID := c.Param("id")
 
-	// Get file from form
-	file, err := c.FormFile("file")
+	file, metadata, ok := uploadForm(c)
+	if !ok {
+		return
+	}
+
+	// Upload document
+	document, err := h.ingestService.UploadDocument(c.Request.Context(), collectionID, file, metadata, c.PostForm("visibility"), c.PostForm("on_duplicate"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		uploadError(c, err, gin.H{})
+		return
+	}
+
+	c.JSON(uploadStatus(document), document)
+}
+
+// UploadDocumentsBatch uploads every files[] part of a multipart form to a
+// collection; the metadata, tags and visibility fields apply to all of them
+func (h *Handler) UploadDocumentsBatch(c *gin.Context) {
+	form, err := c.MultipartForm()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "multipart form is required"})
 		return
 	}
 
-	// Parse metadata if provided
 	metadata := make(map[string]any)
 	if metaStr := c.PostForm("metadata"); metaStr != "" {
 		if err := json.Unmarshal([]byte(metaStr), &metadata); err != nil {
@@ -149,145 +366,1168 @@ func (h *Handler) UploadDocument(c *gin.Context) {
 			return
 		}
 	}
+	if tags := c.PostForm("tags"); tags != "" {
+		metadata[domain.MetadataKeyTags] = tags
+	}
 
-	// Upload document
-	document, err := h.ingestService.UploadDocument(c.Request.Context(), collectionID, file, metadata)
+	documents, err := h.ingestService.UploadDocuments(c.Request.Context(), c.Param("id"), form.File["files[]"], metadata, c.PostForm("visibility"), c.PostForm("on_duplicate"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+		case errors.Is(err, domain.ErrDuplicate):
+			uploadError(c, err, gin.H{"documents": documents})
+		case errors.Is(err, domain.ErrFileTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "documents": documents})
+		}
 		return
 	}
 
-	c.JSON(http.StatusCreated, document)
+	c.JSON(http.StatusCreated, gin.H{"documents": documents, "total": len(documents)})
 }
 
-func (h *Handler) ListDocuments(c *gin.Context) {
-	collectionID := c.Param("id")
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-
-	if page < 1 {
-		page = 1
+// UploadDocumentByName uploads a document to the collection named by the
+// "collection" form field; with ?create=true a missing collection is created
+func (h *Handler) UploadDocumentByName(c *gin.Context) {
+	file, metadata, ok := uploadForm(c)
+	if !ok {
+		return
 	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 20
+	create, _ := strconv.ParseBool(c.Query("create"))
+
+	collection, created, err := h.adminService.CollectionByName(c.Request.Context(), c.PostForm("collection"), create)
+	if err != nil {
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
 	}
 
-	result, err := h.adminService.ListDocuments(c.Request.Context(), collectionID, page, pageSize)
+	document, err := h.ingestService.UploadDocument(c.Request.Context(), collection.ID, file, metadata, c.PostForm("visibility"), c.PostForm("on_duplicate"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		uploadError(c, err, gin.H{"collection": collection, "collection_created": created})
 		return
 	}
 
-	c.JSON(http.StatusOK, result)
+	c.JSON(uploadStatus(document), gin.H{"document": document, "collection": collection, "collection_created": created})
 }
 
-func (h *Handler) GetDocument(c *gin.Context) {
-	id := c.Param("id")
-	document, err := h.adminService.GetDocument(c.Request.Context(), id)
+// uploadForm reads the file and metadata of a multipart upload, writing the
+// error response itself when they are missing or invalid
+func uploadForm(c *gin.Context) (*multipart.FileHeader, map[string]any, bool) {
+	// Get file from form; parts beyond the router's MaxMultipartMemory are
+	// already on disk, and the service streams the file into storage
+	file, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	if document == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
-		return
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return nil, nil, false
 	}
 
-	c.JSON(http.StatusOK, document)
+	// Parse metadata if provided
+	metadata := make(map[string]any)
+	if metaStr := c.PostForm("metadata"); metaStr != "" {
+		if err := json.Unmarshal([]byte(metaStr), &metadata); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid metadata JSON"})
+			return nil, nil, false
+		}
+	}
+	if tags := c.PostForm("tags"); tags != "" {
+		metadata[domain.MetadataKeyTags] = tags
+	}
+	return file, metadata, true
 }
 
-func (h *Handler) DeleteDocument(c *gin.Context) {
-	id := c.Param("id")
-	if err := h.adminService.DeleteDocument(c.Request.Context(), id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+// uploadError writes the response to a rejected upload, adding the error to
+// body: 413 when the file exceeds storage.max_file_size, 409 with the ID of
+// the existing document for a duplicate, 400 otherwise
+func uploadError(c *gin.Context, err error, body gin.H) {
+	body["error"] = err.Error()
+	var duplicate *domain.DuplicateDocumentError
+	switch {
+	case errors.As(err, &duplicate):
+		body["existing_document_id"] = duplicate.ExistingID
+		c.JSON(http.StatusConflict, body)
+	case errors.Is(err, domain.ErrFileTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, body)
+	default:
+		c.JSON(http.StatusBadRequest, body)
 	}
+}
 
-	c.JSON(http.StatusOK, gin.H{"message": "document deleted"})
+// uploadStatus is 200 for an upload answered with an existing document
+// (on_duplicate=existing) and 201 for one that was stored
+func uploadStatus(document *domain.Document) int {
+	if document.Duplicate {
+		return http.StatusOK
+	}
+	return http.StatusCreated
 }
 
-// Site handlers
+// withTags adds the tags of a JSON upload request to its metadata
+func withTags(metadata map[string]any, tags []string) map[string]any {
+	if len(tags) == 0 {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]any)
+	}
+	metadata[domain.MetadataKeyTags] = tags
+	return metadata
+}
 
-func (h *Handler) CreateSite(c *gin.Context) {
-	var req domain.CreateSiteRequest
+// UploadDocumentBase64 uploads a document sent as base64 in a JSON body
+func (h *Handler) UploadDocumentBase64(c *gin.Context) {
+	var req domain.Base64DocumentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	site, err := h.adminService.CreateSite(c.Request.Context(), &req)
+	content, err := base64.StdEncoding.DecodeString(req.ContentBase64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid content_base64"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, site)
+	document, err := h.ingestService.UploadDocumentContent(c.Request.Context(), c.Param("id"), req.Filename, content, withTags(req.Metadata, req.Tags), req.Visibility, req.OnDuplicate)
+	if err != nil {
+		uploadError(c, err, gin.H{})
+		return
+	}
+
+	c.JSON(uploadStatus(document), document)
 }
 
-func (h *Handler) ListSites(c *gin.Context) {
-	sites, err := h.adminService.ListSites(c.Request.Context())
+// IngestURL fetches a web page and ingests its readable text
+func (h *Handler) IngestURL(c *gin.Context) {
+	var req domain.IngestURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	document, err := h.ingestService.IngestURL(c.Request.Context(), c.Param("id"), req.URL, withTags(req.Metadata, req.Tags))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, domain.ErrFetchFailed):
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"sites": sites})
+	c.JSON(http.StatusCreated, document)
 }
 
-func (h *Handler) GetSite(c *gin.Context) {
-	id := c.Param("id")
-	site, err := h.adminService.GetSite(c.Request.Context(), id)
+// IngestFAQ indexes a JSON array of {question, answer} pairs
+func (h *Handler) IngestFAQ(c *gin.Context) {
+	var pairs []domain.FAQPair
+	if err := c.ShouldBindJSON(&pairs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	documents, err := h.ingestService.IngestFAQ(c.Request.Context(), c.Param("id"), pairs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+		case errors.Is(err, domain.ErrFileTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "documents": documents})
+		}
 		return
 	}
-	if site == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "site not found"})
+
+	c.JSON(http.StatusCreated, gin.H{"documents": documents, "total": len(documents)})
+}
+
+func (h *Handler) ListDocuments(c *gin.Context) {
+	collectionID := c.Param("id")
+	cursor, page, pageSize := documentPageParams(c)
+
+	if format := listFormat(c); format != gin.MIMEJSON {
+		h.streamDocuments(c, format, collectionID, c.Query("tag"))
 		return
 	}
 
-	c.JSON(http.StatusOK, site)
+	result, err := h.adminService.ListDocuments(c.Request.Context(), collectionID, c.Query("tag"), cursor, page, pageSize)
+	if err != nil {
+		writeListError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
 }
 
-func (h *Handler) UpdateSite(c *gin.Context) {
-	id := c.Param("id")
-	var req domain.UpdateSiteRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+// documentPageParams reads the pagination of a document listing: ?cursor
+// (the next_cursor of the previous page), or ?page for offset pagination,
+// and ?page_size. Page is 0 unless ?page is given.
+func documentPageParams(c *gin.Context) (cursor string, page, pageSize int) {
+	cursor = c.Query("cursor")
+	if v, ok := c.GetQuery("page"); ok && cursor == "" {
+		if page, _ = strconv.Atoi(v); page < 1 {
+			page = 1
+		}
+	}
+	pageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+	return cursor, page, pageSize
+}
+
+// writeListError reports a failed listing: 400 for an invalid request such
+// as a stale cursor, 500 otherwise
+func writeListError(c *gin.Context, err error) {
+	if errors.Is(err, domain.ErrInvalidRequest) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
 
-	site, err := h.adminService.UpdateSite(c.Request.Context(), id, &req)
+// ListAllDocuments lists documents across collections, newest first
+// (order=asc for oldest first), optionally filtered by status
+func (h *Handler) ListAllDocuments(c *gin.Context) {
+	cursor, page, pageSize := documentPageParams(c)
+
+	status := c.Query("status")
+	switch status {
+	case "", domain.DocumentStatusPending, domain.DocumentStatusProcessing, domain.DocumentStatusReady, domain.DocumentStatusFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, processing, ready or failed"})
+		return
+	}
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+
+	result, err := h.adminService.ListAllDocuments(c.Request.Context(), status, order == "asc", cursor, page, pageSize)
 	if err != nil {
-		if err == domain.ErrNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "site not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeListError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, site)
+	c.JSON(http.StatusOK, result)
 }
 
-func (h *Handler) DeleteSite(c *gin.Context) {
-	id := c.Param("id")
-	if err := h.adminService.DeleteSite(c.Request.Context(), id); err != nil {
+// streamDocuments writes every document of a collection, or those tagged
+// tag, as CSV or NDJSON
+func (h *Handler) streamDocuments(c *gin.Context, format, collectionID, tag string) {
+	result, err := h.adminService.ListDocuments(c.Request.Context(), collectionID, tag, "", 0, exportPageSize)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "site deleted"})
+	w := newListWriter(c, format, documentColumns)
+	for {
+		for _, doc := range result.Documents {
+			if err := w.Write(documentRecord(doc), doc); err != nil {
+				return
+			}
+		}
+		w.Flush()
+		if result.NextCursor == "" {
+			return
+		}
+		if result, err = h.adminService.ListDocuments(c.Request.Context(), collectionID, tag, result.NextCursor, 0, exportPageSize); err != nil {
+			w.Fail(err)
+			return
+		}
+	}
 }
 
-// Stats handler
-
-func (h *Handler) GetStats(c *gin.Context) {
-	stats, err := h.adminService.GetStats(c.Request.Context())
+func (h *Handler) GetDocument(c *gin.Context) {
+	id := c.Param("id")
+	document, err := h.adminService.GetDocument(c.Request.Context(), id)
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if document == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, document)
+}
+
+// DownloadDocument sends the original uploaded file of a document
+func (h *Handler) DownloadDocument(c *gin.Context) {
+	document, content, err := h.ingestService.DocumentFile(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		case errors.Is(err, domain.ErrSourceMissing):
+			c.JSON(http.StatusNotFound, gin.H{"error": "the original file of this document is no longer stored"})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	filename := filepath.Base(document.Filename)
+	if contentType := mime.TypeByExtension(filepath.Ext(filename)); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	http.ServeContent(c.Writer, c.Request, filename, document.CreatedAt, bytes.NewReader(content))
+}
+
+// GetDocumentStatus reports ingestion progress for polling after an upload
+func (h *Handler) GetDocumentStatus(c *gin.Context) {
+	status, err := h.ingestService.DocumentStatus(c.Request.Context(), c.Param("id"))
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// DeleteDocument moves a document to the trash, or deletes it for good with
+// ?permanent=true
+func (h *Handler) DeleteDocument(c *gin.Context) {
+	id := c.Param("id")
+	permanent, _ := strconv.ParseBool(c.Query("permanent"))
+	if err := h.adminService.DeleteDocument(c.Request.Context(), id, permanent); err != nil {
+		if err == domain.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if permanent {
+		c.JSON(http.StatusOK, gin.H{"message": "document deleted"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "document moved to trash"})
+}
+
+// RestoreDocument takes a document out of the trash
+func (h *Handler) RestoreDocument(c *gin.Context) {
+	document, err := h.adminService.RestoreDocument(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == domain.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, document)
+}
+
+// ListTrash lists the documents in the trash, most recently deleted first
+func (h *Handler) ListTrash(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	result, err := h.adminService.ListTrash(c.Request.Context(), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// PurgeTrash permanently deletes the documents in the trash, only those
+// deleted at least ?older_than ago (e.g. 168h) when given
+func (h *Handler) PurgeTrash(c *gin.Context) {
+	var olderThan time.Duration
+	if v := c.Query("older_than"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "older_than must be a non-negative duration, e.g. 168h"})
+			return
+		}
+		olderThan = d
+	}
+
+	purged, err := h.adminService.PurgeTrash(c.Request.Context(), olderThan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
+
+// PublishDocument makes a draft document available to chat retrieval
+func (h *Handler) PublishDocument(c *gin.Context) {
+	document, err := h.adminService.PublishDocument(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		if err == domain.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, document)
+}
+
+// MoveDocument moves a document with its chunks and stored file to another collection
+func (h *Handler) MoveDocument(c *gin.Context) {
+	var req domain.MoveDocumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	document, err := h.adminService.MoveDocument(c.Request.Context(), c.Param("id"), req.TargetCollectionID)
+	if err != nil {
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, document)
+}
+
+// SetDocumentTags replaces the tags of a document
+func (h *Handler) SetDocumentTags(c *gin.Context) {
+	var req domain.DocumentTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	document, err := h.adminService.SetDocumentTags(c.Request.Context(), c.Param("id"), req.Tags)
+	if err != nil {
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, document)
+}
+
+// SummarizeDocument returns a summary of a document of the requested length
+func (h *Handler) SummarizeDocument(c *gin.Context) {
+	var req domain.SummarizeDocumentRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	summary, err := h.adminService.SummarizeDocument(c.Request.Context(), c.Param("id"), req.Length)
+	if err != nil {
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, domain.ErrLLMUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// ReingestDocument re-chunks and re-embeds a document from its stored original
+func (h *Handler) ReingestDocument(c *gin.Context) {
+	document, err := h.ingestService.ReingestDocument(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		case err == domain.ErrSourceMissing:
+			c.JSON(http.StatusGone, gin.H{"error": "the original file of this document is no longer stored; upload it again"})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, document)
+}
+
+// RetryDocument re-attempts the ingestion of a failed document
+func (h *Handler) RetryDocument(c *gin.Context) {
+	document, err := h.ingestService.RetryDocument(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "document not found"})
+		case err == domain.ErrSourceMissing:
+			c.JSON(http.StatusGone, gin.H{"error": "the original file of this document is no longer stored; upload it again"})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, document)
+}
+
+// ExportEmbeddings streams chunk vectors as JSON lines. Use ?after=<seq> from
+// the last received line to resume, and ?limit= to page.
+func (h *Handler) ExportEmbeddings(c *gin.Context) {
+	collectionID := c.Query("collection_id")
+	after, _ := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "0"))
+
+	if collectionID != "" {
+		collection, err := h.adminService.GetCollection(c.Request.Context(), collectionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if collection == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	enc := json.NewEncoder(c.Writer)
+	count := 0
+	err := h.adminService.ExportEmbeddings(c.Request.Context(), collectionID, after, limit, func(rec *domain.EmbeddingRecord) error {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+		if count++; count%100 == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// Headers are already sent, so report the failure as a final line
+		enc.Encode(gin.H{"error": err.Error()})
+	}
+	c.Writer.Flush()
+}
+
+// Ingest job handlers
+
+// PreviewIngest splits an uploaded file or text into the chunks ingestion
+// would store, without embedding or storing them, so chunk_size and
+// chunk_overlap can be tuned first
+func (h *Handler) PreviewIngest(c *gin.Context) {
+	var req domain.IngestPreviewRequest
+	if err := c.ShouldBind(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var file *multipart.FileHeader
+	if c.ContentType() == gin.MIMEMultipartPOSTForm {
+		file, _ = c.FormFile("file")
+	}
+
+	preview, err := h.ingestService.PreviewChunks(c.Request.Context(), file, req.Text, req.ChunkSize, req.ChunkOverlap)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrFileTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+func (h *Handler) GetIngestJob(c *gin.Context) {
+	job, ok := h.ingestService.GetJob(c.Param("job_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// StreamIngestJob streams a job's progress events over SSE, replaying events
+// that happened before the client connected
+func (h *Handler) StreamIngestJob(c *gin.Context) {
+	history, events, cancel, ok := h.ingestService.SubscribeJob(c.Param("job_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	metrics.ActiveStreams.Inc(metrics.StreamIngestJob)
+	defer metrics.ActiveStreams.Dec(metrics.StreamIngestJob)
+
+	for _, ev := range history {
+		writeJobEvent(c.Writer, ev)
+	}
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			writeJobEvent(w, ev)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func writeJobEvent(w io.Writer, ev domain.JobEvent) {
+	data, _ := json.Marshal(ev)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, string(data))
+}
+
+// Site handlers
+
+func (h *Handler) CreateSite(c *gin.Context) {
+	var req domain.CreateSiteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	site, err := h.adminService.CreateSite(c.Request.Context(), &req)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, site)
+}
+
+func (h *Handler) ListSites(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	result, err := h.adminService.ListSites(c.Request.Context(), c.Query("q"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) GetSite(c *gin.Context) {
+	id := c.Param("id")
+	site, err := h.adminService.GetSite(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if site == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "site not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, site)
+}
+
+func (h *Handler) UpdateSite(c *gin.Context) {
+	id := c.Param("id")
+	var req domain.UpdateSiteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	site, err := h.adminService.UpdateSite(c.Request.Context(), id, &req)
+	if err != nil {
+		if err == domain.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "site not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, site)
+}
+
+func (h *Handler) DeleteSite(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.adminService.DeleteSite(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "site deleted"})
+}
+
+// ChatSite asks a question through a site's configuration. Unlike widget
+// requests, it may select any configured model.
+func (h *Handler) ChatSite(c *gin.Context) {
+	var req domain.ChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Admin = true
+
+	resp, err := h.chatService.Chat(c.Request.Context(), c.Param("id"), &req)
+	if err != nil {
+		if err == domain.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "site or session not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if domain.IsTimeout(err) {
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for name, value := range resp.Diagnostics.Headers() {
+		c.Header(name, value)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// Session handlers
+
+func (h *Handler) ListSessions(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	if format := listFormat(c); format != gin.MIMEJSON {
+		h.streamSessions(c, format)
+		return
+	}
+
+	result, err := h.adminService.ListSessions(c.Request.Context(), c.Query("site_id"), c.Query("external_user_id"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ListActiveSessions lists sessions updated within ?window (default 5m)
+func (h *Handler) ListActiveSessions(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	window, err := time.ParseDuration(c.DefaultQuery("window", "5m"))
+	if err != nil || window <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "window must be a positive duration, e.g. 5m"})
+		return
+	}
+
+	result, err := h.adminService.ListActiveSessions(c.Request.Context(), window, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// streamSessions writes every matching session as CSV or NDJSON
+func (h *Handler) streamSessions(c *gin.Context, format string) {
+	siteID, externalUserID := c.Query("site_id"), c.Query("external_user_id")
+	result, err := h.adminService.ListSessions(c.Request.Context(), siteID, externalUserID, 1, exportPageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	w := newListWriter(c, format, sessionColumns)
+	for page := 1; ; page++ {
+		for _, session := range result.Sessions {
+			if err := w.Write(sessionRecord(session), session); err != nil {
+				return
+			}
+		}
+		w.Flush()
+		if page*exportPageSize >= result.Total {
+			return
+		}
+		if result, err = h.adminService.ListSessions(c.Request.Context(), siteID, externalUserID, page+1, exportPageSize); err != nil {
+			w.Fail(err)
+			return
+		}
+	}
+}
+
+func (h *Handler) GetSession(c *gin.Context) {
+	id := c.Param("id")
+	session, err := h.adminService.GetSession(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// VerifyAnswer promotes an assistant answer, with the question it replied
+// to, into a verified FAQ entry in the requested collection
+func (h *Handler) VerifyAnswer(c *gin.Context) {
+	var req domain.VerifyAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pair, err := h.adminService.VerifiedAnswer(c.Request.Context(), c.Param("id"), c.Param("message_id"), req.Answer)
+	if err != nil {
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	documents, err := h.ingestService.IngestFAQ(c.Request.Context(), req.CollectionID, []domain.FAQPair{*pair})
+	if err != nil {
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, documents[0])
+}
+
+// Stats handler
+
+func (h *Handler) GetStats(c *gin.Context) {
+	stats, err := h.adminService.GetStats(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	stats.IngestQueued, stats.IngestRunning = h.ingestService.QueueDepth()
 
 	c.JSON(http.StatusOK, stats)
 }
+
+// GetQuestionGaps lists frequently asked questions the assistant could not
+// answer, optionally for one ?site_id
+func (h *Handler) GetQuestionGaps(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	report, err := h.adminService.QuestionGaps(c.Request.Context(), c.Query("site_id"), limit)
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "site not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// analyticsRange is the default range of GetAnalytics
+const analyticsRange = 30 * 24 * time.Hour
+
+// GetAnalytics returns chat volume over time between ?from and ?to (dates or
+// RFC 3339 times, the last 30 days by default) in ?granularity buckets (day,
+// week or month); ?by_site=true adds a per-site breakdown
+func (h *Handler) GetAnalytics(c *gin.Context) {
+	from, to, ok := analyticsTimeRange(c)
+	if !ok {
+		return
+	}
+	bySite, _ := strconv.ParseBool(c.Query("by_site"))
+
+	result, err := h.adminService.Analytics(c.Request.Context(), from, to, c.DefaultQuery("granularity", domain.GranularityDay), bySite)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetTopQuestions lists the questions users asked most between ?from and ?to
+// (as for GetAnalytics), similar wordings grouped, optionally for one ?site_id
+func (h *Handler) GetTopQuestions(c *gin.Context) {
+	from, to, ok := analyticsTimeRange(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+
+	report, err := h.adminService.TopQuestions(c.Request.Context(), c.Query("site_id"), from, to, limit)
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "site not found"})
+		return
+	}
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// analyticsTimeRange reads the ?from and ?to range of an analytics request,
+// responding with 400 and returning false when either is invalid
+func analyticsTimeRange(c *gin.Context) (from, to time.Time, ok bool) {
+	to = time.Now()
+	if v := c.Query("to"); v != "" {
+		t, err := parseAnalyticsTime(v, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be a date (2006-01-02) or an RFC 3339 time"})
+			return from, to, false
+		}
+		to = t
+	}
+	from = to.Add(-analyticsRange)
+	if v := c.Query("from"); v != "" {
+		t, err := parseAnalyticsTime(v, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be a date (2006-01-02) or an RFC 3339 time"})
+			return from, to, false
+		}
+		from = t
+	}
+	return from, to, true
+}
+
+// parseAnalyticsTime reads an analytics range bound in local time. A date as
+// the end of the range includes that whole day.
+func parseAnalyticsTime(v string, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.Local(), nil
+}
+
+// ListFeedback lists answer ratings, optionally filtered by ?site_id and ?rating
+func (h *Handler) ListFeedback(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	result, err := h.adminService.ListFeedback(c.Request.Context(), c.Query("site_id"), c.Query("rating"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Key handler
+
+// RotateKey replaces the admin API key with the provided or a generated key
+func (h *Handler) RotateKey(c *gin.Context) {
+	var req struct {
+		Key string `json:"key"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	rotation, err := h.apiKeyService.Rotate(req.Key)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rotation)
+}
+
+// Storage handler
+
+// ReencryptStorage re-encrypts stored uploads with the current
+// storage.encryption_key, e.g. after a key rotation
+func (h *Handler) ReencryptStorage(c *gin.Context) {
+	result, err := h.ingestService.ReencryptFiles(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
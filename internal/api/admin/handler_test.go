@@ -0,0 +1,85 @@
+package admin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/liliang-cn/askdoc/internal/api/middleware"
+	"github.com/liliang-cn/askdoc/internal/config"
+	"github.com/liliang-cn/askdoc/internal/domain"
+	"github.com/liliang-cn/askdoc/internal/repository"
+	"github.com/liliang-cn/askdoc/internal/service"
+)
+
+func TestUploadDocumentBase64(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := repository.NewDB(filepath.Join(t.TempDir(), "askdoc.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	collectionRepo := repository.NewCollectionRepository(db)
+	cfg := &config.Config{
+		Storage: config.StorageConfig{Documents: t.TempDir(), MaxFileSize: 64},
+		Ingest:  config.IngestConfig{Concurrency: 1},
+	}
+	ingestService := service.NewIngestService(collectionRepo, repository.NewDocumentRepository(db), cfg, nil)
+	defer ingestService.Shutdown(context.Background())
+	collection := &domain.Collection{Name: "docs"}
+	if err := collectionRepo.Create(collection); err != nil {
+		t.Fatalf("failed to create collection: %v", err)
+	}
+
+	r := gin.New()
+	group := r.Group("/api/admin", middleware.LimitBody(256))
+	NewHandler(nil, ingestService, nil, nil).RegisterRoutes(group)
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/collections/"+collection.ID+"/documents/base64", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	encode := func(content string) string {
+		return base64.StdEncoding.EncodeToString([]byte(content))
+	}
+
+	content := "Rotate the agent token monthly."
+	w := post(`{"filename":"tokens.md","content_base64":"` + encode(content) + `"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload: status %d: %s", w.Code, w.Body)
+	}
+	var doc domain.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	stored, err := ingestService.ReadStoredFile(ingestService.GetStoragePath(&doc))
+	if err != nil || string(stored) != content {
+		t.Errorf("stored file = %q, %v; want the decoded content", stored, err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"invalid base64", `{"filename":"bad.md","content_base64":"not base64!"}`, http.StatusBadRequest},
+		{"missing filename", `{"content_base64":"` + encode(content) + `"}`, http.StatusBadRequest},
+		{"file over max_file_size", `{"filename":"big.md","content_base64":"` + encode(strings.Repeat("a", 65)) + `"}`, http.StatusRequestEntityTooLarge},
+		{"body over max_request_body", `{"filename":"huge.md","content_base64":"` + encode(strings.Repeat("a", 300)) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := post(tt.body); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package admin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// Streamed list formats selected through the Accept header
+const (
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+// exportPageSize is how many rows a streamed list fetches and flushes at a time
+const exportPageSize = 100
+
+// listFormat returns the negotiated list format; JSON unless the client asks
+// for CSV or NDJSON
+func listFormat(c *gin.Context) string {
+	switch c.NegotiateFormat(gin.MIMEJSON, mimeCSV, mimeNDJSON) {
+	case mimeCSV:
+		return mimeCSV
+	case mimeNDJSON:
+		return mimeNDJSON
+	default:
+		return gin.MIMEJSON
+	}
+}
+
+// listWriter streams list rows as CSV or NDJSON. Streamed lists contain every
+// row; page and page_size only apply to JSON.
+type listWriter struct {
+	c    *gin.Context
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+// newListWriter sends the headers and, for CSV, the column row
+func newListWriter(c *gin.Context, format string, columns []string) *listWriter {
+	c.Header("Content-Type", format)
+	c.Status(http.StatusOK)
+
+	w := &listWriter{c: c}
+	if format == mimeCSV {
+		w.csv = csv.NewWriter(c.Writer)
+		w.csv.Write(columns)
+	} else {
+		w.json = json.NewEncoder(c.Writer)
+	}
+	return w
+}
+
+// Write emits one row: record for CSV, v for NDJSON
+func (w *listWriter) Write(record []string, v any) error {
+	if w.csv != nil {
+		return w.csv.Write(record)
+	}
+	return w.json.Encode(v)
+}
+
+// Flush pushes buffered rows to the client
+func (w *listWriter) Flush() {
+	if w.csv != nil {
+		w.csv.Flush()
+	}
+	w.c.Writer.Flush()
+}
+
+// Fail reports an error after the headers were sent, as a final row
+func (w *listWriter) Fail(err error) {
+	if w.csv != nil {
+		w.csv.Write([]string{"error", err.Error()})
+	} else {
+		w.json.Encode(gin.H{"error": err.Error()})
+	}
+	w.Flush()
+}
+
+var collectionColumns = []string{"id", "name", "description", "document_count", "version", "created_at", "updated_at"}
+
+func collectionRecord(col *domain.Collection) []string {
+	return []string{
+		col.ID,
+		col.Name,
+		col.Description,
+		strconv.Itoa(col.DocumentCount),
+		strconv.FormatInt(col.Version, 10),
+		formatTime(col.CreatedAt),
+		formatTime(col.UpdatedAt),
+	}
+}
+
+var documentColumns = []string{"id", "collection_id", "filename", "file_type", "file_size", "status", "chunk_count", "error", "created_at", "tags"}
+
+func documentRecord(doc *domain.Document) []string {
+	return []string{
+		doc.ID,
+		doc.CollectionID,
+		doc.Filename,
+		doc.FileType,
+		strconv.FormatInt(doc.FileSize, 10),
+		doc.Status,
+		strconv.Itoa(doc.ChunkCount),
+		doc.Error,
+		formatTime(doc.CreatedAt),
+		strings.Join(doc.Tags, ","),
+	}
+}
+
+var sessionColumns = []string{"id", "site_id", "external_user_id", "created_at", "updated_at"}
+
+func sessionRecord(session *domain.Session) []string {
+	return []string{
+		session.ID,
+		session.SiteID,
+		session.ExternalUserID,
+		formatTime(session.CreatedAt),
+		formatTime(session.UpdatedAt),
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
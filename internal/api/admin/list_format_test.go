@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/liliang-cn/askdoc/internal/config"
+	"github.com/liliang-cn/askdoc/internal/domain"
+	"github.com/liliang-cn/askdoc/internal/repository"
+	"github.com/liliang-cn/askdoc/internal/service"
+)
+
+func TestListCollectionsFormats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := repository.NewDB(filepath.Join(t.TempDir(), "askdoc.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	collectionRepo := repository.NewCollectionRepository(db)
+	adminService := service.NewAdminService(&config.Config{}, collectionRepo, repository.NewDocumentRepository(db),
+		repository.NewSiteRepository(db), repository.NewSessionRepository(db), nil)
+
+	// More than a page, so streamed lists must page through all of them
+	total := exportPageSize + 20
+	want := make(map[string]bool, total)
+	for i := 0; i < total; i++ {
+		col := &domain.Collection{Name: fmt.Sprintf("docs-%03d", i)}
+		if err := collectionRepo.Create(col); err != nil {
+			t.Fatalf("failed to create collection: %v", err)
+		}
+		want[col.Name] = true
+	}
+
+	r := gin.New()
+	NewHandler(adminService, nil, nil, nil).RegisterRoutes(r.Group("/api/admin"))
+	list := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/collections", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Accept %q: status %d: %s", accept, w.Code, w.Body)
+		}
+		return w
+	}
+	checkNames := func(format string, names []string) {
+		t.Helper()
+		seen := make(map[string]bool, len(names))
+		for _, name := range names {
+			if !want[name] || seen[name] {
+				t.Errorf("%s: unexpected or repeated collection %q", format, name)
+			}
+			seen[name] = true
+		}
+		if len(seen) != total {
+			t.Errorf("%s listed %d collections, want %d", format, len(seen), total)
+		}
+	}
+
+	t.Run("json", func(t *testing.T) {
+		w := list("")
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, gin.MIMEJSON) {
+			t.Errorf("Content-Type = %q, want JSON", ct)
+		}
+		var page domain.CollectionListResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if page.Total != total || len(page.Items) != 20 {
+			t.Errorf("JSON page has %d of %d collections, want 20 of %d", len(page.Items), page.Total, total)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		w := list("text/csv")
+		if ct := w.Header().Get("Content-Type"); ct != mimeCSV {
+			t.Errorf("Content-Type = %q, want %s", ct, mimeCSV)
+		}
+		records, err := csv.NewReader(w.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("invalid CSV: %v", err)
+		}
+		if strings.Join(records[0], ",") != strings.Join(collectionColumns, ",") {
+			t.Errorf("CSV header = %v, want %v", records[0], collectionColumns)
+		}
+		var names []string
+		for _, record := range records[1:] {
+			names = append(names, record[1])
+		}
+		checkNames("CSV", names)
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		w := list("application/x-ndjson")
+		if ct := w.Header().Get("Content-Type"); ct != mimeNDJSON {
+			t.Errorf("Content-Type = %q, want %s", ct, mimeNDJSON)
+		}
+		var names []string
+		for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+			var col domain.Collection
+			if err := json.Unmarshal([]byte(line), &col); err != nil {
+				t.Fatalf("invalid NDJSON line %q: %v", line, err)
+			}
+			names = append(names, col.Name)
+		}
+		checkNames("NDJSON", names)
+	})
+}
@@ -7,11 +7,17 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// KeyValidator checks API keys
+type KeyValidator interface {
+	Enabled() bool
+	Valid(key string) bool
+}
+
 // Auth returns an API key authentication middleware
-func Auth(apiKey string) gin.HandlerFunc {
+func Auth(keys KeyValidator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Skip auth if no API key configured
-		if apiKey == "" {
+		if !keys.Enabled() {
 			c.Next()
 			return
 		}
@@ -26,7 +32,7 @@ func Auth(apiKey string) gin.HandlerFunc {
 			}
 		}
 
-		if key != apiKey {
+		if !keys.Valid(key) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			c.Abort()
 			return
@@ -1,34 +1,108 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// CORS returns a CORS middleware
-func CORS(allowOrigins []string) gin.HandlerFunc {
+// CORSPolicy is the CORS policy of a group of routes; empty method and
+// header lists fall back to the defaults below
+type CORSPolicy struct {
+	// AllowOrigins lists the allowed origins, "*" for any. SiteCORS ignores
+	// it and allows each site's registered domain instead.
+	AllowOrigins []string
+	AllowMethods []string
+	AllowHeaders []string
+	MaxAge       time.Duration // how long browsers may cache a preflight
+	// AllowCredentials is only sent to an origin allowed by name, never to
+	// one let in by "*"
+	AllowCredentials bool
+}
+
+// CORS policy defaults
+var (
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	defaultCORSHeaders = []string{"Content-Type", "Authorization", "X-API-Key", "X-Widget-Key"}
+)
+
+// corsHeaders are the response headers of a policy, joined once
+type corsHeaders struct {
+	methods, headers, maxAge string
+	credentials              bool
+}
+
+func newCORSHeaders(policy CORSPolicy) corsHeaders {
+	methods, headers := policy.AllowMethods, policy.AllowHeaders
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	return corsHeaders{
+		methods:     strings.Join(methods, ", "),
+		headers:     strings.Join(headers, ", "),
+		maxAge:      strconv.Itoa(int(policy.MaxAge.Seconds())),
+		credentials: policy.AllowCredentials,
+	}
+}
+
+// CORS returns a CORS middleware. An origin in the policy's list is echoed
+// back (with credentials if allowed); any other origin gets "*" when the
+// list has it.
+func CORS(policy CORSPolicy) gin.HandlerFunc {
+	headers := newCORSHeaders(policy)
+	wildcard := slices.Contains(policy.AllowOrigins, "*")
 	return func(c *gin.Context) {
 		origin := c.GetHeader("Origin")
+		c.Header("Vary", "Origin")
 
-		// Check if origin is allowed
-		allowed := false
-		for _, o := range allowOrigins {
-			if o == "*" || o == origin {
-				allowed = true
-				break
-			}
+		switch {
+		case origin != "" && slices.Contains(policy.AllowOrigins, origin):
+			headers.set(c, origin, headers.credentials)
+		case wildcard:
+			headers.set(c, "*", false)
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
 		}
 
-		if allowed {
-			if origin != "" {
-				c.Header("Access-Control-Allow-Origin", origin)
-			} else {
-				c.Header("Access-Control-Allow-Origin", "*")
+		c.Next()
+	}
+}
+
+// SiteOrigins checks whether a site accepts browser requests from an origin
+type SiteOrigins interface {
+	SiteAllowsOrigin(siteID, origin string) bool
+}
+
+// SiteCORS is the widget CORS policy: cross-origin requests must come from
+// the domain registered for the site in the route's site_id, and get the
+// methods, headers and max-age of policy. Same-origin requests (e.g. the
+// admin UI's test chat) and requests without an Origin header are let
+// through.
+func SiteCORS(sites SiteOrigins, policy CORSPolicy) gin.HandlerFunc {
+	headers := newCORSHeaders(policy)
+	return func(c *gin.Context) {
+		c.Header("Vary", "Origin")
+		origin := c.GetHeader("Origin")
+		if origin != "" && !sameOrigin(c, origin) {
+			if !sites.SiteAllowsOrigin(c.Param("site_id"), origin) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": fmt.Sprintf("origin %s is not registered for this site; add it as the site's domain", origin),
+				})
+				return
 			}
-			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
-			c.Header("Access-Control-Max-Age", "86400")
+			headers.set(c, origin, headers.credentials)
 		}
 
 		if c.Request.Method == http.MethodOptions {
@@ -39,3 +113,20 @@ func CORS(allowOrigins []string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+func (h corsHeaders) set(c *gin.Context, origin string, credentials bool) {
+	c.Header("Access-Control-Allow-Origin", origin)
+	c.Header("Access-Control-Allow-Methods", h.methods)
+	c.Header("Access-Control-Allow-Headers", h.headers)
+	c.Header("Access-Control-Expose-Headers", "X-AskDoc-Sources-Count, X-AskDoc-Top-Score, X-AskDoc-Retrieval-Ms, X-AskDoc-Generation-Ms, Retry-After")
+	c.Header("Access-Control-Max-Age", h.maxAge)
+	if credentials {
+		c.Header("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// sameOrigin reports whether origin is the host the request was sent to
+func sameOrigin(c *gin.Context, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && u.Host == c.Request.Host
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// RateLimitStore holds the token buckets behind RateLimit. The in-memory
+// store suits a single server; a shared store (e.g. Redis) can implement the
+// same interface for several.
+type RateLimitStore interface {
+	// Take removes a token from key's bucket, which holds up to capacity
+	// tokens and refills capacity tokens per window. When the bucket is empty
+	// it reports false and how long until the next token is available.
+	Take(key string, capacity int, window time.Duration) (bool, time.Duration)
+}
+
+// SiteLimits looks up a site's own requests-per-hour limit (0 for none)
+type SiteLimits interface {
+	SiteRateLimit(siteID string) int
+}
+
+// MemoryRateLimitStore is an in-process RateLimitStore
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time // time.Now, replaced in tests
+}
+
+type tokenBucket struct {
+	tokens   float64
+	capacity int
+	window   time.Duration
+	updated  time.Time
+}
+
+// rateLimitSweepInterval is how often full buckets are dropped so idle
+// clients don't accumulate
+const rateLimitSweepInterval = time.Minute
+
+// NewMemoryRateLimitStore creates an in-memory rate limit store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Take implements RateLimitStore
+func (s *MemoryRateLimitStore) Take(key string, capacity int, window time.Duration) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= rateLimitSweepInterval {
+		s.sweep(now)
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(capacity), updated: now}
+		s.buckets[key] = b
+	}
+	// A changed limit (e.g. a site's rate_limit was edited) applies right away
+	b.capacity, b.window = capacity, window
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	perToken := window / time.Duration(capacity)
+	return false, time.Duration((1 - b.tokens) * float64(perToken))
+}
+
+// sweep drops buckets that have refilled completely
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.capacity) {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated)
+	b.updated = now
+	b.tokens = min(float64(b.capacity), b.tokens+elapsed.Hours()/b.window.Hours()*float64(b.capacity))
+}
+
+// RateLimit limits each client IP to requestsPerHour requests, rejecting the
+// rest with 429 and a Retry-After header. On routes with a site_id path
+// parameter the bucket is per site and IP, and a site's own limit from sites
+// (if non-nil and positive) replaces requestsPerHour. A requestsPerHour of 0
+// disables the limit.
+func RateLimit(store RateLimitStore, requestsPerHour int, sites SiteLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := requestsPerHour
+		key := "ip:" + c.ClientIP()
+		if siteID := c.Param("site_id"); siteID != "" {
+			key = "site:" + siteID + ":" + key
+			if sites != nil {
+				if siteLimit := sites.SiteRateLimit(siteID); siteLimit > 0 {
+					limit = siteLimit
+				}
+			}
+		}
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		ok, retryAfter := store.Take(key, limit, time.Hour)
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": domain.ErrRateLimited.Error()})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type siteLimits map[string]int
+
+func (l siteLimits) SiteRateLimit(siteID string) int { return l[siteID] }
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type request struct {
+		after      time.Duration // clock advance before the request
+		site       string
+		ip         string
+		status     int
+		retryAfter string
+	}
+	tests := []struct {
+		name     string
+		perHour  int
+		requests []request
+	}{
+		{
+			name:    "429 with Retry-After once the limit is used",
+			perHour: 2,
+			requests: []request{
+				{site: "docs", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "docs", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "docs", ip: "10.0.0.1", status: http.StatusTooManyRequests, retryAfter: "1800"},
+				{after: 10 * time.Minute, site: "docs", ip: "10.0.0.1", status: http.StatusTooManyRequests, retryAfter: "1200"},
+			},
+		},
+		{
+			name:    "buckets are per site and IP",
+			perHour: 1,
+			requests: []request{
+				{site: "docs", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "docs", ip: "10.0.0.2", status: http.StatusOK},
+				{site: "blog", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "docs", ip: "10.0.0.1", status: http.StatusTooManyRequests, retryAfter: "3600"},
+			},
+		},
+		{
+			name:    "a site's own limit replaces the default",
+			perHour: 1,
+			requests: []request{
+				{site: "busy", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "busy", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "busy", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "busy", ip: "10.0.0.1", status: http.StatusTooManyRequests, retryAfter: "1200"},
+			},
+		},
+		{
+			name:    "tokens refill over the window",
+			perHour: 2,
+			requests: []request{
+				{site: "docs", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "docs", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "docs", ip: "10.0.0.1", status: http.StatusTooManyRequests, retryAfter: "1800"},
+				{after: 30 * time.Minute, site: "docs", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "docs", ip: "10.0.0.1", status: http.StatusTooManyRequests, retryAfter: "1800"},
+				{after: 2 * time.Hour, site: "docs", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "docs", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "docs", ip: "10.0.0.1", status: http.StatusTooManyRequests, retryAfter: "1800"},
+			},
+		},
+		{
+			name:    "0 disables the limit",
+			perHour: 0,
+			requests: []request{
+				{site: "docs", ip: "10.0.0.1", status: http.StatusOK},
+				{site: "docs", ip: "10.0.0.1", status: http.StatusOK},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+			store := NewMemoryRateLimitStore()
+			store.now = func() time.Time { return now }
+			store.lastSweep = now
+
+			r := gin.New()
+			r.POST("/chat/:site_id", RateLimit(store, tt.perHour, siteLimits{"busy": 3}), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			for i, req := range tt.requests {
+				now = now.Add(req.after)
+				w := httptest.NewRecorder()
+				httpReq := httptest.NewRequest(http.MethodPost, "/chat/"+req.site, nil)
+				httpReq.RemoteAddr = req.ip + ":1234"
+				r.ServeHTTP(w, httpReq)
+
+				if w.Code != req.status {
+					t.Errorf("request %d: status = %d, want %d", i, w.Code, req.status)
+				}
+				if got := w.Header().Get("Retry-After"); got != req.retryAfter {
+					t.Errorf("request %d: Retry-After = %q, want %q", i, got, req.retryAfter)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CloseOnShutdown cancels a long-lived request (SSE stream) when the shutdown
+// context is done, so server shutdown isn't held open by connected clients
+func CloseOnShutdown(shutdown context.Context) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if shutdown == nil {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		stop := context.AfterFunc(shutdown, cancel)
+		defer stop()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// NoWriteDeadline lifts the server's write timeout for a long-lived request
+// (SSE stream), which would otherwise cut the stream off mid-answer. Streams
+// are bounded by rag.stream_timeout and CloseOnShutdown instead.
+func NoWriteDeadline() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+			log.Printf("[Stream] Clearing the write deadline failed: %v", err)
+		}
+		c.Next()
+	}
+}
+
+// StreamLimiter caps the number of concurrently open SSE streams per site and
+// across the server; a limit of 0 disables that cap
+type StreamLimiter struct {
+	mu      sync.Mutex
+	perSite int
+	total   int
+	open    map[string]int
+	count   int
+}
+
+// NewStreamLimiter creates a stream limiter
+func NewStreamLimiter(perSite, total int) *StreamLimiter {
+	return &StreamLimiter{
+		perSite: perSite,
+		total:   total,
+		open:    make(map[string]int),
+	}
+}
+
+// Acquire reserves a stream slot for siteID, reporting false when a cap is reached
+func (l *StreamLimiter) Acquire(siteID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.total > 0 && l.count >= l.total {
+		return false
+	}
+	if l.perSite > 0 && l.open[siteID] >= l.perSite {
+		return false
+	}
+	l.open[siteID]++
+	l.count++
+	return true
+}
+
+// Release frees a slot reserved by Acquire
+func (l *StreamLimiter) Release(siteID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.open[siteID] <= 1 {
+		delete(l.open, siteID)
+	} else {
+		l.open[siteID]--
+	}
+	if l.count > 0 {
+		l.count--
+	}
+}
+
+// LimitStreams rejects a stream with 429 when the site (from the site_id
+// path parameter) or the server already has the maximum number open. The slot
+// is released when the handler returns, i.e. when the stream ends or the
+// client disconnects.
+func LimitStreams(limiter *StreamLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		siteID := c.Param("site_id")
+		if !limiter.Acquire(siteID) {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "too many open streams"})
+			return
+		}
+		defer limiter.Release(siteID)
+		c.Next()
+	}
+}
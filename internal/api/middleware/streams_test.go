@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNoWriteDeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// The stream writes an event every 50ms for 300ms, well past the
+	// server's 100ms write timeout
+	stream := func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		for i := 0; i < 6; i++ {
+			c.Writer.WriteString("data: tick\n\n")
+			c.Writer.Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+		c.Writer.WriteString("data: done\n\n")
+	}
+
+	tests := []struct {
+		name     string
+		handlers []gin.HandlerFunc
+		complete bool
+	}{
+		{"write timeout cuts the stream", []gin.HandlerFunc{stream}, false},
+		{"deadline lifted", []gin.HandlerFunc{NoWriteDeadline(), stream}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/stream", tt.handlers...)
+			srv := httptest.NewUnstartedServer(r)
+			srv.Config.WriteTimeout = 100 * time.Millisecond
+			srv.Start()
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL + "/stream")
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if got := strings.HasSuffix(string(body), "data: done\n\n"); got != tt.complete {
+				t.Errorf("stream complete = %v, want %v (body %q)", got, tt.complete, body)
+			}
+		})
+	}
+}
+
+func TestLimitStreams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// A stream stays open until the channel named by its ?id is closed
+	var mu sync.Mutex
+	release := make(map[string]chan struct{})
+	started := make(chan struct{})
+	r := gin.New()
+	r.GET("/stream/:site_id", LimitStreams(NewStreamLimiter(2, 3)), func(c *gin.Context) {
+		mu.Lock()
+		done := release[c.Query("id")]
+		mu.Unlock()
+		started <- struct{}{}
+		<-done
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	get := func(siteID, id string) int {
+		resp, err := http.Get(srv.URL + "/stream/" + siteID + "?id=" + id)
+		if err != nil {
+			t.Errorf("request failed: %v", err)
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// open starts a stream and waits until its handler runs; the returned
+	// channel gets its status once the stream is closed
+	open := func(siteID, id string) <-chan int {
+		mu.Lock()
+		release[id] = make(chan struct{})
+		mu.Unlock()
+		status := make(chan int, 1)
+		go func() { status <- get(siteID, id) }()
+		select {
+		case <-started:
+		case code := <-status:
+			t.Fatalf("stream %s ended early with %d", id, code)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("stream %s did not start", id)
+		}
+		return status
+	}
+	closeStream := func(id string, status <-chan int) {
+		mu.Lock()
+		close(release[id])
+		mu.Unlock()
+		if code := <-status; code != http.StatusOK {
+			t.Errorf("stream %s status = %d, want 200", id, code)
+		}
+	}
+
+	a1 := open("a", "a1")
+	a2 := open("a", "a2")
+	if code := get("a", "a3"); code != http.StatusTooManyRequests {
+		t.Errorf("third stream for a site with a limit of 2: status %d, want 429", code)
+	}
+	b1 := open("b", "b1")
+	if code := get("b", "b2"); code != http.StatusTooManyRequests {
+		t.Errorf("fourth stream with a server limit of 3: status %d, want 429", code)
+	}
+
+	// Closing a stream frees its slot for the site and the server
+	closeStream("a1", a1)
+	a3 := open("a", "a3")
+
+	for id, status := range map[string]<-chan int{"a2": a2, "a3": a3, "b1": b1} {
+		closeStream(id, status)
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SiteKeys checks the key a widget sends for a site
+type SiteKeys interface {
+	ValidSiteKey(siteID, key string) bool
+}
+
+// WidgetKey rejects widget requests whose X-Widget-Key header doesn't match
+// the site's public key. Sites without a key stay public.
+func WidgetKey(sites SiteKeys) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		siteID := c.Param("site_id")
+		if siteID != "" && !sites.ValidSiteKey(siteID, c.GetHeader("X-Widget-Key")) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
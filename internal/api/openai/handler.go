@@ -0,0 +1,225 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/liliang-cn/askdoc/internal/domain"
+	"github.com/liliang-cn/askdoc/internal/metrics"
+	"github.com/liliang-cn/askdoc/internal/service"
+)
+
+// Headers selecting the site (instead of the model field) and continuing an
+// AskDoc session
+const (
+	siteHeader    = "X-AskDoc-Site-ID"
+	sessionHeader = "X-AskDoc-Session-ID"
+)
+
+// Handler serves an OpenAI-compatible chat completions API, so OpenAI
+// clients can use AskDoc as a RAG backend. Each site is exposed as a model.
+type Handler struct {
+	adminService *service.AdminService
+	chatService  *service.ChatService
+}
+
+// NewHandler creates a new OpenAI-compatible handler
+func NewHandler(adminService *service.AdminService, chatService *service.ChatService) *Handler {
+	return &Handler{adminService: adminService, chatService: chatService}
+}
+
+// RegisterRoutes registers the OpenAI-compatible routes; streams wrap the
+// completions route, which streams when asked to
+func (h *Handler) RegisterRoutes(r *gin.RouterGroup, streams ...gin.HandlerFunc) {
+	r.GET("/models", h.ListModels)
+	r.POST("/chat/completions", append(slices.Clone(streams), h.ChatCompletions)...)
+}
+
+// ListModels lists the sites as models
+func (h *Handler) ListModels(c *gin.Context) {
+	sites, err := h.adminService.ListSites(c.Request.Context(), "", 1, 0)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	models := make([]domain.OpenAIModel, 0, len(sites.Items))
+	for _, site := range sites.Items {
+		models = append(models, domain.OpenAIModel{
+			ID:      site.ID,
+			Object:  "model",
+			Created: site.CreatedAt.Unix(),
+			OwnedBy: "askdoc",
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": models})
+}
+
+// ChatCompletions answers the last user message of an OpenAI chat request
+// from the site named by the X-AskDoc-Site-ID header or the model field.
+// Earlier messages are not replayed; send X-AskDoc-Session-ID (returned as
+// session_id) to continue a conversation with its history.
+func (h *Handler) ChatCompletions(c *gin.Context) {
+	var req domain.OpenAIChatRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	siteID := c.GetHeader(siteHeader)
+	if siteID == "" {
+		siteID = req.Model
+	}
+	if siteID == "" {
+		writeError(c, http.StatusBadRequest, "model must name a site (or set "+siteHeader+")")
+		return
+	}
+	message, err := req.LastUserMessage()
+	if err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chatReq := &domain.ChatRequest{
+		SessionID:      c.GetHeader(sessionHeader),
+		Message:        message,
+		ExternalUserID: req.User,
+		Admin:          true,
+	}
+	if err := chatReq.Validate(); err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	model := req.Model
+	if model == "" {
+		model = siteID
+	}
+	if req.Stream {
+		h.streamCompletion(c, siteID, model, chatReq)
+		return
+	}
+
+	resp, err := h.chatService.Chat(c.Request.Context(), siteID, chatReq)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+
+	for name, value := range resp.Diagnostics.Headers() {
+		c.Header(name, value)
+	}
+	stop := "stop"
+	c.JSON(http.StatusOK, domain.OpenAIChatResponse{
+		ID:      completionID(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []domain.OpenAIChoice{{
+			Message:      &domain.OpenAIChatMessage{Role: "assistant", Content: domain.OpenAIContent(resp.Answer)},
+			FinishReason: &stop,
+		}},
+		Sources:   resp.Sources,
+		SessionID: resp.SessionID,
+	})
+}
+
+// streamCompletion streams an answer as OpenAI chat.completion.chunk events,
+// ending with data: [DONE]. Sources ride on the final chunk.
+func (h *Handler) streamCompletion(c *gin.Context, siteID, model string, req *domain.ChatRequest) {
+	stream, err := h.chatService.ChatStream(c.Request.Context(), siteID, req)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	metrics.ActiveStreams.Inc(metrics.StreamOpenAI)
+	defer metrics.ActiveStreams.Dec(metrics.StreamOpenAI)
+
+	id := completionID()
+	created := time.Now().Unix()
+	send := func(chunk domain.OpenAIChatResponse) {
+		chunk.ID, chunk.Object, chunk.Created, chunk.Model = id, "chat.completion.chunk", created, model
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+	}
+	delta := func(msg domain.OpenAIChatMessage) domain.OpenAIChatResponse {
+		return domain.OpenAIChatResponse{Choices: []domain.OpenAIChoice{{Delta: &msg}}}
+	}
+
+	send(delta(domain.OpenAIChatMessage{Role: "assistant"}))
+	var sources []domain.Source
+	var sessionID string
+	for {
+		select {
+		case chunk, ok := <-stream:
+			if !ok {
+				return
+			}
+			switch chunk.Type {
+			case "session":
+				sessionID = chunk.SessionID
+			case "content":
+				send(delta(domain.OpenAIChatMessage{Content: domain.OpenAIContent(chunk.Content)}))
+			case "sources":
+				sources = chunk.Sources
+			case "error":
+				data, _ := json.Marshal(gin.H{"error": gin.H{"message": chunk.Content, "type": "server_error"}})
+				fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+				c.Writer.Flush()
+				return
+			case "done":
+				stop := "stop"
+				send(domain.OpenAIChatResponse{
+					Choices:   []domain.OpenAIChoice{{Delta: &domain.OpenAIChatMessage{}, FinishReason: &stop}},
+					Sources:   sources,
+					SessionID: sessionID,
+				})
+				fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+				c.Writer.Flush()
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// writeChatError maps a chat error to an OpenAI error response
+func writeChatError(c *gin.Context, err error) {
+	switch {
+	case err == domain.ErrNotFound:
+		writeError(c, http.StatusNotFound, "site or session not found")
+	case errors.Is(err, domain.ErrInvalidRequest):
+		writeError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, domain.ErrLLMUnavailable):
+		writeError(c, http.StatusServiceUnavailable, err.Error())
+	case domain.IsTimeout(err):
+		writeError(c, http.StatusGatewayTimeout, err.Error())
+	default:
+		writeError(c, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// writeError writes an error in OpenAI's format
+func writeError(c *gin.Context, status int, message string) {
+	errType := "invalid_request_error"
+	if status >= http.StatusInternalServerError {
+		errType = "server_error"
+	}
+	c.JSON(status, gin.H{"error": gin.H{"message": message, "type": errType}})
+}
+
+func completionID() string {
+	return "chatcmpl-" + uuid.New().String()
+}
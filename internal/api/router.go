@@ -1,50 +1,136 @@
 package api
 
 import (
+	"context"
+	"log"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/liliang-cn/askdoc/internal/api/admin"
 	"github.com/liliang-cn/askdoc/internal/api/middleware"
+	"github.com/liliang-cn/askdoc/internal/api/openai"
 	"github.com/liliang-cn/askdoc/internal/api/widget"
+	"github.com/liliang-cn/askdoc/internal/metrics"
 	"github.com/liliang-cn/askdoc/internal/service"
 )
 
 // RouterConfig holds configuration for the router
 type RouterConfig struct {
-	APIKey       string
-	AllowOrigins []string
+	// AdminCORS is the CORS policy of the admin and OpenAI-compatible APIs;
+	// WidgetCORS that of the widget API, which only accepts the origin of
+	// each site's registered domain
+	AdminCORS    middleware.CORSPolicy
+	WidgetCORS   middleware.CORSPolicy
+	StaticMaxAge time.Duration // Cache-Control max-age for static assets
+	// Shutdown is cancelled when the server starts shutting down; open SSE
+	// streams are closed so they don't hold up shutdown
+	Shutdown context.Context
+	// MaxStreamsPerSite and MaxStreams cap concurrently open widget SSE
+	// streams per site and in total; 0 means unlimited
+	MaxStreamsPerSite int
+	MaxStreams        int
+	// MaxRequestBody caps admin request bodies (0 means unlimited);
+	// MaxMultipartMemory is how much of a multipart upload is held in memory
+	// before the rest spills to temp files (0 keeps gin's default)
+	MaxRequestBody     int64
+	MaxMultipartMemory int64
+	// RequestsPerHour limits widget chat requests per site and client IP;
+	// a site's own rate_limit overrides it and 0 disables limiting
+	RequestsPerHour int
+	// RateLimitStore holds the rate limit buckets (in memory when nil)
+	RateLimitStore middleware.RateLimitStore
+	// MetricsEnabled serves Prometheus metrics at /metrics
+	MetricsEnabled bool
+	// SSEHeartbeatInterval is how often idle widget chat streams get a
+	// heartbeat comment; 0 disables it
+	SSEHeartbeatInterval time.Duration
+	// TrustedProxies may set the client IP through X-Forwarded-For and
+	// X-Real-IP; with none, forwarded headers are ignored
+	TrustedProxies []string
+}
+
+// newEngine creates the Gin engine with the server-wide settings. Rate limits
+// are keyed by ClientIP, so forwarded headers are only believed from the
+// configured proxies.
+func newEngine(cfg RouterConfig) *gin.Engine {
+	r := gin.New()
+	// The proxies were validated by config.Load
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("[Router] invalid trusted proxies: %v", err)
+	}
+	if cfg.MaxMultipartMemory > 0 {
+		r.MaxMultipartMemory = cfg.MaxMultipartMemory
+	}
+	return r
 }
 
 // SetupRouter sets up the Gin router
 func SetupRouter(
 	adminService *service.AdminService,
 	ingestService *service.IngestService,
+	chatService *service.ChatService,
 	widgetService *service.WidgetService,
+	apiKeyService *service.APIKeyService,
+	healthService *service.HealthService,
 	cfg RouterConfig,
 ) *gin.Engine {
-	r := gin.New()
-	r.Use(gin.Recovery())
+	r := newEngine(cfg)
+	r.Use(gin.Recovery(), middleware.Metrics())
 
-	// CORS middleware
-	r.Use(middleware.CORS(cfg.AllowOrigins))
-
-	// Health check
+	// Liveness: the process is up
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// Readiness: the database, vector store and LLM endpoint all respond
+	r.GET("/health/ready", func(c *gin.Context) {
+		ready := healthService.Ready(c.Request.Context())
+		if !ready.Ready {
+			c.JSON(503, ready)
+			return
+		}
+		c.JSON(200, ready)
+	})
+
+	if cfg.MetricsEnabled {
+		r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	}
+
 	// Static files (admin UI, widget)
-	SetupStaticRoutes(r)
+	SetupStaticRoutes(r, cfg.StaticMaxAge)
+
+	streams := []gin.HandlerFunc{middleware.CloseOnShutdown(cfg.Shutdown), middleware.NoWriteDeadline()}
 
-	// Widget API (public, based on site_id)
-	widgetHandler := widget.NewHandler(widgetService)
+	// Widget API (public, based on site_id; sites with a public key require X-Widget-Key)
+	widgetHandler := widget.NewHandler(widgetService, cfg.SSEHeartbeatInterval)
 	widgetGroup := r.Group("/api/widget")
-	widgetHandler.RegisterRoutes(widgetGroup)
+	widgetGroup.Use(middleware.SiteCORS(widgetService, cfg.WidgetCORS), middleware.WidgetKey(widgetService))
+	var chat []gin.HandlerFunc
+	if cfg.RequestsPerHour > 0 {
+		store := cfg.RateLimitStore
+		if store == nil {
+			store = middleware.NewMemoryRateLimitStore()
+		}
+		chat = append(chat, middleware.RateLimit(store, cfg.RequestsPerHour, widgetService))
+	}
+	streamLimiter := middleware.NewStreamLimiter(cfg.MaxStreamsPerSite, cfg.MaxStreams)
+	widgetHandler.RegisterRoutes(widgetGroup, chat, append(streams, middleware.LimitStreams(streamLimiter))...)
 
 	// Admin API (requires API key)
-	adminHandler := admin.NewHandler(adminService, ingestService)
+	adminHandler := admin.NewHandler(adminService, ingestService, chatService, apiKeyService)
 	adminGroup := r.Group("/api/admin")
-	adminGroup.Use(middleware.Auth(cfg.APIKey))
-	adminHandler.RegisterRoutes(adminGroup)
+	adminGroup.Use(middleware.CORS(cfg.AdminCORS))
+	adminGroup.OPTIONS("/*path") // answered by the CORS middleware
+	adminGroup.Use(middleware.Auth(apiKeyService), middleware.LimitBody(cfg.MaxRequestBody))
+	adminHandler.RegisterRoutes(adminGroup, streams...)
+
+	// OpenAI-compatible API (requires API key, sent as a Bearer token)
+	openaiHandler := openai.NewHandler(adminService, chatService)
+	openaiGroup := r.Group("/v1")
+	openaiGroup.Use(middleware.CORS(cfg.AdminCORS))
+	openaiGroup.OPTIONS("/*path") // answered by the CORS middleware
+	openaiGroup.Use(middleware.Auth(apiKeyService), middleware.LimitBody(cfg.MaxRequestBody))
+	openaiHandler.RegisterRoutes(openaiGroup, streams...)
 
 	return r
 }
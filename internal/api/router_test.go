@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/liliang-cn/askdoc/internal/api/middleware"
+)
+
+// Rate limit buckets follow X-Forwarded-For only from trusted proxies, so a
+// client can't get a fresh bucket by rotating the header
+func TestRateLimitForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type request struct {
+		peer      string
+		forwarded string
+		status    int
+	}
+	tests := []struct {
+		name     string
+		proxies  []string
+		requests []request
+	}{
+		{
+			name: "spoofed headers from an untrusted peer share its bucket",
+			requests: []request{
+				{peer: "203.0.113.7", forwarded: "10.0.0.1", status: http.StatusOK},
+				{peer: "203.0.113.7", forwarded: "10.0.0.2", status: http.StatusTooManyRequests},
+				{peer: "203.0.113.7", status: http.StatusTooManyRequests},
+			},
+		},
+		{
+			name:    "a trusted proxy reports each client",
+			proxies: []string{"192.0.2.0/24"},
+			requests: []request{
+				{peer: "192.0.2.10", forwarded: "10.0.0.1", status: http.StatusOK},
+				{peer: "192.0.2.10", forwarded: "10.0.0.2", status: http.StatusOK},
+				{peer: "192.0.2.11", forwarded: "10.0.0.1", status: http.StatusTooManyRequests},
+				{peer: "203.0.113.7", forwarded: "10.0.0.3", status: http.StatusOK},
+				{peer: "203.0.113.7", forwarded: "10.0.0.4", status: http.StatusTooManyRequests},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newEngine(RouterConfig{TrustedProxies: tt.proxies})
+			r.POST("/chat/:site_id", middleware.RateLimit(middleware.NewMemoryRateLimitStore(), 1, nil), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			for i, req := range tt.requests {
+				httpReq := httptest.NewRequest(http.MethodPost, "/chat/docs", nil)
+				httpReq.RemoteAddr = req.peer + ":1234"
+				if req.forwarded != "" {
+					httpReq.Header.Set("X-Forwarded-For", req.forwarded)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httpReq)
+				if w.Code != req.status {
+					t.Errorf("request %d: status = %d, want %d", i, w.Code, req.status)
+				}
+			}
+		})
+	}
+}
@@ -1,9 +1,17 @@
 package api
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"embed"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,12 +19,28 @@ import (
 // StaticFS holds the embedded static files
 var StaticFS embed.FS
 
-// SetupStaticRoutes sets up routes for serving static files
-func SetupStaticRoutes(r *gin.Engine) error {
+// staticModTime stands in for the embedded files' modification time, which
+// embed.FS does not record; assets only change with a new binary
+var staticModTime = time.Now().UTC().Truncate(time.Second)
+
+// staticAsset is an embedded file with its content hash
+type staticAsset struct {
+	content []byte
+	hash    string // hex SHA-256 prefix, used as ETag and version
+}
+
+var (
+	staticAssetsMu sync.Mutex
+	staticAssets   = make(map[string]*staticAsset)
+)
+
+// SetupStaticRoutes sets up routes for serving static files. Assets are cached
+// for maxAge; a request carrying ?v=<content hash> is cached as immutable, and
+// HTML entry points are always revalidated.
+func SetupStaticRoutes(r *gin.Engine, maxAge time.Duration) error {
 	// Serve Widget
 	r.GET("/widget.js", func(c *gin.Context) {
-		c.Header("Content-Type", "application/javascript")
-		c.FileFromFS("static/widget.js", http.FS(StaticFS))
+		serveStaticFile(c, "static/widget.js", maxAge)
 	})
 
 	// Serve admin UI - use single catch-all route that handles all /admin/* paths
@@ -30,34 +54,68 @@ func SetupStaticRoutes(r *gin.Engine) error {
 		if path == "" || path == "/" {
 			path = "index.html"
 		}
-		serveAdminFile(c, path)
+		serveStaticFile(c, "static/admin/"+path, maxAge)
 	})
 
 	return nil
 }
 
-func serveAdminFile(c *gin.Context, filename string) {
-	fullPath := "static/admin/" + filename
-
-	file, err := StaticFS.Open(fullPath)
+// serveStaticFile serves an embedded file with Cache-Control, ETag and
+// Last-Modified headers; conditional requests get 304 Not Modified
+func serveStaticFile(c *gin.Context, fullPath string, maxAge time.Duration) {
+	asset, err := loadStaticAsset(fullPath)
 	if err != nil {
 		c.String(http.StatusNotFound, "File not found")
 		return
 	}
-	defer file.Close()
-
-	content, err := io.ReadAll(file)
-	if err != nil {
-		c.String(http.StatusInternalServerError, "Failed to read file")
-		return
-	}
 
 	contentType := "text/html; charset=utf-8"
-	if len(filename) > 3 && filename[len(filename)-3:] == ".js" {
+	switch path.Ext(fullPath) {
+	case ".js":
 		contentType = "application/javascript"
-	} else if len(filename) > 4 && filename[len(filename)-4:] == ".css" {
+	case ".css":
 		contentType = "text/css"
 	}
 
-	c.Data(http.StatusOK, contentType, content)
+	switch {
+	case contentType == "text/html; charset=utf-8":
+		c.Header("Cache-Control", "no-cache")
+	case c.Query("v") == asset.hash:
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("ETag", `"`+asset.hash+`"`)
+
+	http.ServeContent(c.Writer, c.Request, path.Base(fullPath), staticModTime, bytes.NewReader(asset.content))
+}
+
+// loadStaticAsset reads and hashes an embedded file once
+func loadStaticAsset(fullPath string) (*staticAsset, error) {
+	staticAssetsMu.Lock()
+	defer staticAssetsMu.Unlock()
+
+	if asset, ok := staticAssets[fullPath]; ok {
+		return asset, nil
+	}
+
+	if strings.Contains(fullPath, "..") {
+		return nil, fmt.Errorf("invalid path: %s", fullPath)
+	}
+	file, err := StaticFS.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(content)
+	asset := &staticAsset{content: content, hash: hex.EncodeToString(sum[:8])}
+	staticAssets[fullPath] = asset
+	return asset, nil
 }
@@ -3,6 +3,7 @@ const API_BASE = '/api/admin';
 let apiKey = '';
 let currentCollectionId = null;
 let currentChatSiteId = null;
+let currentChatSiteKey = null;
 
 // Initialize
 document.addEventListener('DOMContentLoaded', () => {
@@ -55,6 +56,17 @@ async function api(method, path, body = null) {
   return res.json();
 }
 
+// Fetches every page of a paginated list endpoint, optionally filtered by q
+async function fetchAllPages(path, q = '') {
+  const filter = q ? '&q=' + encodeURIComponent(q) : '';
+  let items = [];
+  for (let page = 1; ; page++) {
+    const data = await api('GET', path + '?page=' + page + '&page_size=100' + filter);
+    items = items.concat(data.items || []);
+    if (items.length >= data.total || !data.items || data.items.length === 0) return items;
+  }
+}
+
 // Stats
 async function loadStats() {
   try {
@@ -71,13 +83,15 @@ async function loadStats() {
 // Collections
 async function loadCollections() {
   try {
-    const data = await api('GET', '/collections');
+    const q = document.getElementById('collectionSearch').value.trim();
+    const collections = await fetchAllPages('/collections', q);
     const list = document.getElementById('collections-list');
-    if (!data.collections || data.collections.length === 0) {
-      list.innerHTML = '<tr><td colspan="5" class="text-center text-muted">No collections yet</td></tr>';
+    if (collections.length === 0) {
+      const empty = q ? 'No matching collections' : 'No collections yet';
+      list.innerHTML = `<tr><td colspan="5" class="text-center text-muted">${empty}</td></tr>`;
       return;
     }
-    list.innerHTML = data.collections.map(c => `
+    list.innerHTML = collections.map(c => `
       <tr>
         <td style="font-size:12px;font-family:monospace;color:#6b7280;max-width:120px;overflow:hidden;text-overflow:ellipsis;white-space:nowrap;cursor:pointer" title="${c.id}" onclick="navigator.clipboard.writeText('${c.id}');this.style.color='#10b981';setTimeout(()=>this.style.color='#6b7280',800)">${c.id.slice(0,8)}…</td>
         <td><strong>${escapeHtml(c.name)}</strong></td>
@@ -94,15 +108,24 @@ async function loadCollections() {
   }
 }
 
+// Reloads a list shortly after the user stops typing in its search box
+let searchTimer;
+function searchList(load) {
+  clearTimeout(searchTimer);
+  searchTimer = setTimeout(load, 250);
+}
+
 async function createCollection() {
   const name = document.getElementById('collectionName').value.trim();
   const description = document.getElementById('collectionDescription').value.trim();
+  const strip_html_boilerplate = document.getElementById('collectionStripHTML').checked;
   if (!name) return alert('Name is required');
   try {
-    await api('POST', '/collections', { name, description });
+    await api('POST', '/collections', { name, description, strip_html_boilerplate });
     closeModal('createCollectionModal');
     document.getElementById('collectionName').value = '';
     document.getElementById('collectionDescription').value = '';
+    document.getElementById('collectionStripHTML').checked = false;
     loadCollections();
     loadStats();
   } catch (e) {
@@ -124,19 +147,21 @@ async function deleteCollection(id) {
 // Sites
 async function loadSites() {
   try {
-    const data = await api('GET', '/sites');
+    const q = document.getElementById('siteSearch').value.trim();
+    const sites = await fetchAllPages('/sites', q);
     const list = document.getElementById('sites-list');
-    if (!data.sites || data.sites.length === 0) {
-      list.innerHTML = '<tr><td colspan="4" class="text-center text-muted">No sites yet</td></tr>';
+    if (sites.length === 0) {
+      const empty = q ? 'No matching sites' : 'No sites yet';
+      list.innerHTML = `<tr><td colspan="4" class="text-center text-muted">${empty}</td></tr>`;
       return;
     }
-    list.innerHTML = data.sites.map(s => `
+    list.innerHTML = sites.map(s => `
       <tr>
         <td><strong>${escapeHtml(s.name)}</strong></td>
         <td>${escapeHtml(s.domain)}</td>
         <td>${s.collection_ids.length} collections</td>
         <td style="white-space: nowrap;">
-          <button class="btn btn-primary" onclick="openChat('${s.id}', '${escapeHtml(s.name)}')">Chat</button>
+          <button class="btn btn-primary" onclick="openChat('${s.id}', '${escapeHtml(s.name)}', '${escapeHtml(s.public_key || '')}')">Chat</button>
           <button class="btn btn-secondary" onclick="viewSite('${s.id}')">Embed</button>
           <button class="btn btn-danger" onclick="deleteSite('${s.id}')">Delete</button>
         </td>
@@ -183,7 +208,8 @@ async function viewSite(id) {
     const site = await api('GET', '/sites/' + id);
     const embedCode = `<script>
   window.AskDocConfig = {
-    siteId: '${site.id}',
+    siteId: '${site.id}',${site.public_key ? `
+    widgetKey: '${site.public_key}',` : ''}
     serverUrl: '${window.location.origin}'
   };
 <\/script>
@@ -378,9 +404,9 @@ async function loadDocuments(collectionId) {
       return `
         <tr>
           <td>${escapeHtml(d.filename)}</td>
-          <td><span class="status ${statusClass}">${d.status}</span></td>
+          <td><span class="status ${statusClass}">${d.status}</span>${d.visibility === 'draft' ? ' <span class="status status-pending">draft</span>' : ''}</td>
           <td>${d.chunk_count || 0}</td>
-          <td><button class="btn btn-danger" onclick="deleteDocument('${d.id}')">Delete</button></td>
+          <td>${d.visibility === 'draft' ? `<button class="btn btn-primary" onclick="publishDocument('${d.id}')">Publish</button> ` : ''}<button class="btn btn-danger" onclick="deleteDocument('${d.id}')">Delete</button></td>
         </tr>
       `;
     }).join('');
@@ -401,9 +427,19 @@ async function deleteDocument(id) {
   }
 }
 
+async function publishDocument(id) {
+  try {
+    await api('POST', '/documents/' + id + '/publish');
+    loadDocuments(currentCollectionId);
+  } catch (e) {
+    alert('Failed to publish: ' + e.message);
+  }
+}
+
 // Chat
-function openChat(siteId, siteName) {
+function openChat(siteId, siteName, siteKey) {
   currentChatSiteId = siteId;
+  currentChatSiteKey = siteKey;
   document.getElementById('chatModalTitle').textContent = siteName;
   document.getElementById('chatMessages').innerHTML = '';
   document.getElementById('chatInput').value = '';
@@ -438,9 +474,11 @@ async function sendChat() {
   let collectedSources = null;
 
   try {
+    const headers = { 'Content-Type': 'application/json' };
+    if (currentChatSiteKey) headers['X-Widget-Key'] = currentChatSiteKey;
     const response = await fetch('/api/widget/chat/' + currentChatSiteId + '/stream', {
       method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
+      headers,
       body: JSON.stringify({ message })
     });
 
@@ -486,7 +524,7 @@ async function sendChat() {
       collectedSources.forEach((src) => {
         sourcesHtml += `
           <div class="chat-source-item">
-            <span class="chat-source-filename">${escapeHtml(src.filename || src.document_id)}</span>
+            <span class="chat-source-filename">${escapeHtml(src.label || src.filename || src.document_id)}</span>
             <span class="chat-source-score">Score: ${src.score ? src.score.toFixed(3) : 'N/A'}</span>
             <div class="chat-source-content">${escapeHtml(src.content.substring(0, 200))}${src.content.length > 200 ? '...' : ''}</div>
           </div>`;
@@ -531,12 +569,12 @@ async function showCreateSiteModal() {
   openModal('createSiteModal');
   document.getElementById('siteName').focus();
   try {
-    const data = await api('GET', '/collections');
-    if (!data.collections || data.collections.length === 0) {
+    const collections = await fetchAllPages('/collections');
+    if (collections.length === 0) {
       container.innerHTML = '<span style="color:#9ca3af">No collections available. Create one first.</span>';
       return;
     }
-    container.innerHTML = data.collections.map(c => `
+    container.innerHTML = collections.map(c => `
       <label style="display:flex;align-items:center;gap:8px;padding:6px 4px;cursor:pointer;border-bottom:1px solid #f3f4f6">
         <input type="checkbox" value="${c.id}" style="width:16px;height:16px">
         <span><strong>${escapeHtml(c.name)}</strong> <span style="color:#9ca3af;font-size:12px">(${c.id.slice(0,8)}… · ${c.document_count} docs)</span></span>
@@ -7,6 +7,7 @@
  *   <script>
  *     window.AskDocConfig = {
  *       siteId: 'your-site-id',
+ *       widgetKey: 'site-public-key', // only when the site has a public key
  *       serverUrl: 'https://your-server.com',
  *       primaryColor: '#3b82f6',
  *       position: 'bottom-right',
@@ -30,13 +31,20 @@
 
   // API Client with SSE streaming
   class APIClient {
-    constructor(baseUrl, siteId) {
+    constructor(baseUrl, siteId, widgetKey) {
       this.baseUrl = baseUrl.replace(/\/$/, '');
       this.siteId = siteId;
+      this.widgetKey = widgetKey;
+    }
+
+    headers(extra = {}) {
+      return this.widgetKey ? { ...extra, 'X-Widget-Key': this.widgetKey } : extra;
     }
 
     async getConfig() {
-      const response = await fetch(`${this.baseUrl}/api/widget/config/${this.siteId}`);
+      const response = await fetch(`${this.baseUrl}/api/widget/config/${this.siteId}`, {
+        headers: this.headers(),
+      });
       if (!response.ok) {
         throw new Error(`Failed to get config: ${response.status}`);
       }
@@ -46,7 +54,7 @@
     async chatStream(request, onChunk) {
       const response = await fetch(`${this.baseUrl}/api/widget/chat/${this.siteId}/stream`, {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: this.headers({ 'Content-Type': 'application/json' }),
         body: JSON.stringify(request),
       });
 
@@ -89,7 +97,7 @@
     constructor(config) {
       this.config = config;
       const serverUrl = config.serverUrl || this.detectServerUrl();
-      this.api = new APIClient(serverUrl, config.siteId);
+      this.api = new APIClient(serverUrl, config.siteId, config.widgetKey);
       this.widgetConfig = null;
       this.sessionId = null;
       this.container = null;
@@ -201,10 +209,12 @@
       // Create assistant message container
       this.currentAssistantMsg = this.createAssistantMessage();
       this.currentSources = [];
+      this.currentDisclaimer = '';
+      this.currentSuggestions = [];
 
       try {
         await this.api.chatStream(
-          { session_id: this.sessionId, message },
+          { session_id: this.sessionId, message, clean_sources: true },
           (chunk) => this.handleChunk(chunk)
         );
       } catch (error) {
@@ -215,6 +225,12 @@
       if (this.currentSources.length > 0) {
         this.addSourcesToMessage();
       }
+      if (this.currentDisclaimer) {
+        this.addDisclaimerToMessage();
+      }
+      if (this.currentSuggestions.length > 0) {
+        this.addSuggestionsToMessage();
+      }
 
       this.setStreaming(false);
       this.currentAssistantMsg = null;
@@ -235,6 +251,12 @@
         case 'sources':
           this.currentSources = chunk.sources || [];
           break;
+        case 'disclaimer':
+          this.currentDisclaimer = chunk.content || '';
+          break;
+        case 'suggestions':
+          this.currentSuggestions = chunk.suggestions || [];
+          break;
         case 'done':
           this.removeThinking();
           break;
@@ -284,6 +306,35 @@
       }
     }
 
+    addDisclaimerToMessage() {
+      if (!this.currentAssistantMsg) return;
+      const disclaimer = document.createElement('div');
+      disclaimer.className = 'askdoc-disclaimer';
+      disclaimer.textContent = this.currentDisclaimer;
+      this.currentAssistantMsg.appendChild(disclaimer);
+      this.scrollToBottom();
+    }
+
+    addSuggestionsToMessage() {
+      if (!this.currentAssistantMsg) return;
+      const container = document.createElement('div');
+      container.className = 'askdoc-suggestions';
+      for (const question of this.currentSuggestions) {
+        const btn = document.createElement('button');
+        btn.type = 'button';
+        btn.className = 'askdoc-suggestion';
+        btn.textContent = question;
+        btn.addEventListener('click', () => {
+          if (this.isStreaming) return;
+          this.input.value = question;
+          this.sendMessage();
+        });
+        container.appendChild(btn);
+      }
+      this.currentAssistantMsg.appendChild(container);
+      this.scrollToBottom();
+    }
+
     addSourcesToMessage() {
       if (!this.currentAssistantMsg || this.currentSources.length === 0) return;
 
@@ -312,7 +363,7 @@
         item.innerHTML = `
           <div class="askdoc-source-header">
             <span class="askdoc-source-num">${idx + 1}</span>
-            <span class="askdoc-source-name">${this.escapeHtml(src.filename || src.document_id || 'Unknown')}</span>
+            <span class="askdoc-source-name">${this.escapeHtml(src.label || src.filename || src.document_id || 'Unknown')}</span>
             <span class="askdoc-source-score">${src.score ? (src.score * 100).toFixed(0) + '%' : ''}</span>
           </div>
           <div class="askdoc-source-content">${this.escapeHtml(src.content?.substring(0, 150) || '')}${src.content?.length > 150 ? '...' : ''}</div>
@@ -521,6 +572,29 @@
         #askdoc-widget .askdoc-error { color: #dc2626; }
 
         /* Sources */
+        #askdoc-widget .askdoc-disclaimer {
+          margin-top: 10px;
+          font-size: 11px;
+          color: #94a3b8;
+        }
+        #askdoc-widget .askdoc-suggestions {
+          margin-top: 10px;
+          display: flex;
+          flex-wrap: wrap;
+          gap: 6px;
+        }
+        #askdoc-widget .askdoc-suggestion {
+          font: inherit;
+          font-size: 12px;
+          padding: 4px 10px;
+          border: 1px solid var(--askdoc-primary);
+          border-radius: 12px;
+          background: transparent;
+          color: var(--askdoc-primary);
+          cursor: pointer;
+          text-align: left;
+        }
+        #askdoc-widget .askdoc-suggestion:hover { background: #f1f5f9; }
         #askdoc-widget .askdoc-sources {
           margin-top: 14px;
           padding-top: 14px;
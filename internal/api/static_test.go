@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStaticCacheHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	if err := SetupStaticRoutes(r, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	get := func(url string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/widget.js", nil)
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Fatalf("GET /widget.js: status %d, %d bytes", w.Code, w.Body.Len())
+	}
+	etag := w.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) || len(etag) < 3 {
+		t.Fatalf("ETag = %q, want a quoted content hash", etag)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("Cache-Control = %q, want public, max-age=3600", got)
+	}
+	if w.Header().Get("Last-Modified") == "" {
+		t.Error("Last-Modified missing")
+	}
+
+	w = get("/widget.js", http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("GET /widget.js with a matching If-None-Match: status %d, %d bytes; want 304 without a body", w.Code, w.Body.Len())
+	}
+	w = get("/widget.js", http.Header{"If-None-Match": {`"stale"`}})
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /widget.js with a stale If-None-Match: status %d, want 200", w.Code)
+	}
+
+	// A request for the current version is cached for good
+	w = get("/widget.js?v="+strings.Trim(etag, `"`), nil)
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=31536000, immutable" {
+		t.Errorf("versioned Cache-Control = %q, want immutable", got)
+	}
+
+	// HTML entry points are always revalidated
+	w = get("/admin/", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /admin/: status %d", w.Code)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("admin index Cache-Control = %q, want no-cache", got)
+	}
+}
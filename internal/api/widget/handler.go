@@ -2,30 +2,43 @@ package widget
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/liliang-cn/askdoc/internal/domain"
+	"github.com/liliang-cn/askdoc/internal/metrics"
 	"github.com/liliang-cn/askdoc/internal/service"
 )
 
 // Handler handles widget API requests
 type Handler struct {
 	widgetService *service.WidgetService
+	heartbeat     time.Duration // idle time before a chat stream gets a heartbeat; 0 disables
 }
 
 // NewHandler creates a new widget handler
-func NewHandler(widgetService *service.WidgetService) *Handler {
-	return &Handler{widgetService: widgetService}
+func NewHandler(widgetService *service.WidgetService, heartbeat time.Duration) *Handler {
+	return &Handler{widgetService: widgetService, heartbeat: heartbeat}
 }
 
-// RegisterRoutes registers widget routes
-func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
+// RegisterRoutes registers widget routes; streams wrap the SSE routes
+func (h *Handler) RegisterRoutes(r *gin.RouterGroup, chat []gin.HandlerFunc, streams ...gin.HandlerFunc) {
 	r.GET("/config/:site_id", h.GetConfig)
-	r.POST("/chat/:site_id", h.Chat)
-	r.POST("/chat/:site_id/stream", h.ChatStream)
+	r.POST("/chat/:site_id", append(slices.Clone(chat), h.Chat)...)
+	r.POST("/chat/:site_id/stream", append(append(slices.Clone(chat), streams...), h.ChatStream)...)
+	r.POST("/chat/:site_id/feedback", append(slices.Clone(chat), h.Feedback)...)
+	r.GET("/chat/:site_id/sessions/:session_id", append(slices.Clone(chat), h.GetSession)...)
+
+	// CORS preflights, answered by the group's CORS middleware
+	for _, path := range []string{"/config/:site_id", "/chat/:site_id", "/chat/:site_id/stream",
+		"/chat/:site_id/feedback", "/chat/:site_id/sessions/:session_id"} {
+		r.OPTIONS(path)
+	}
 }
 
 // GetConfig returns the widget configuration for a site
@@ -59,16 +72,75 @@ func (h *Handler) Chat(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	resp, err := h.widgetService.Chat(c.Request.Context(), siteID, &req)
 	if err != nil {
+		if err == domain.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "site or session not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidRequest) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if domain.IsTimeout(err) {
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	for name, value := range resp.Diagnostics.Headers() {
+		c.Header(name, value)
+	}
 	c.JSON(http.StatusOK, resp)
 }
 
+// GetSession returns a session's messages so the widget can restore a conversation
+func (h *Handler) GetSession(c *gin.Context) {
+	sessionID := c.Param("session_id")
+	messages, err := h.widgetService.SessionHistory(c.Request.Context(), c.Param("site_id"), sessionID)
+	if err == domain.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"session_id": sessionID, "messages": messages})
+}
+
+// Feedback rates an assistant answer by its message_id
+func (h *Handler) Feedback(c *gin.Context) {
+	var req domain.FeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	feedback, err := h.widgetService.Feedback(c.Request.Context(), c.Param("site_id"), &req)
+	if err != nil {
+		switch {
+		case err == domain.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		case errors.Is(err, domain.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, feedback)
+}
+
 // ChatStream handles a streaming chat message (SSE)
 func (h *Handler) ChatStream(c *gin.Context) {
 	siteID := c.Param("site_id")
@@ -78,33 +150,65 @@ func (h *Handler) ChatStream(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Set SSE headers
 	c.Header("Content-Type", "text/event-stream")
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
-	c.Header("Access-Control-Allow-Origin", "*")
+	metrics.ActiveStreams.Inc(metrics.StreamChat)
+	defer metrics.ActiveStreams.Dec(metrics.StreamChat)
 
 	stream, err := h.widgetService.ChatStream(c.Request.Context(), siteID, &req)
 	if err != nil {
 		writeSSE(c.Writer, "error", err.Error())
+		c.Writer.Flush()
 		return
 	}
 
-	// Use gin.Stream for SSE
-	c.Stream(func(w io.Writer) bool {
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+	h.relayStream(c, stream)
+}
+
+// relayStream writes stream's chunks as SSE events. It blocks until the next
+// chunk arrives, the stream ends, or the client goes away, and flushes after
+// each event so chunks reach the browser immediately. While no chunk comes, a
+// heartbeat comment keeps proxies from closing the idle connection.
+func (h *Handler) relayStream(c *gin.Context, stream <-chan domain.StreamChunk) {
+	var ticker *time.Ticker
+	var heartbeat <-chan time.Time
+	if h.heartbeat > 0 {
+		ticker = time.NewTicker(h.heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	for {
 		select {
 		case chunk, ok := <-stream:
 			if !ok {
-				return false // End stream
+				return
 			}
 			data, _ := json.Marshal(chunk)
-			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", chunk.Type, string(data))
-			return true
-		default:
-			return true // Keep stream open
+			writeSSE(c.Writer, chunk.Type, string(data))
+			c.Writer.Flush()
+			if ticker != nil {
+				ticker.Reset(h.heartbeat)
+			}
+		case <-heartbeat:
+			// Browsers' EventSource parsers ignore comment lines
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			// Client went away or the server is shutting down
+			writeSSE(c.Writer, "error", "stream closed")
+			c.Writer.Flush()
+			return
 		}
-	})
+	}
 }
 
 func writeSSE(w io.Writer, eventType, data string) {
@@ -0,0 +1,61 @@
+package widget
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/liliang-cn/askdoc/internal/api/middleware"
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// A stream that stays silent longer than the server's write timeout, as a
+// slow LLM does, is kept open by heartbeats and still delivers its answer
+func TestRelayStreamOutlivesWriteTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &Handler{heartbeat: 50 * time.Millisecond}
+
+	r := gin.New()
+	r.GET("/stream", middleware.NoWriteDeadline(), func(c *gin.Context) {
+		stream := make(chan domain.StreamChunk)
+		go func() {
+			defer close(stream)
+			time.Sleep(400 * time.Millisecond)
+			stream <- domain.StreamChunk{Type: "content", Content: "late answer"}
+			stream <- domain.StreamChunk{Type: "done"}
+		}()
+		c.Header("Content-Type", "text/event-stream")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+		h.relayStream(c, stream)
+	})
+	srv := httptest.NewUnstartedServer(r)
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/stream")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("stream cut after %s: %v", time.Since(start), err)
+	}
+
+	if n := strings.Count(string(body), ": heartbeat\n\n"); n < 3 {
+		t.Errorf("got %d heartbeats, want at least 3 (body %q)", n, body)
+	}
+	if !strings.Contains(string(body), `"content":"late answer"`) {
+		t.Errorf("answer missing from stream: %q", body)
+	}
+	if !strings.HasSuffix(string(body), "event: done\ndata: {\"type\":\"done\"}\n\n") {
+		t.Errorf("stream did not end with done: %q", body)
+	}
+}
@@ -1,20 +1,33 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/liliang-cn/askdoc/internal/domain"
 	"github.com/spf13/viper"
 )
 
 // Config holds all configuration for AskDoc
 type Config struct {
+	DataDir   string          `mapstructure:"data_dir"`
 	Server    ServerConfig    `mapstructure:"server"`
 	Admin     AdminConfig     `mapstructure:"admin"`
 	Database  DatabaseConfig  `mapstructure:"database"`
 	Storage   StorageConfig   `mapstructure:"storage"`
 	RAG       RAGConfig       `mapstructure:"rag"`
 	LLM       LLMConfig       `mapstructure:"llm"`
+	OCR       OCRConfig       `mapstructure:"ocr"`
+	Ingest    IngestConfig    `mapstructure:"ingest"`
+	Cache     CacheConfig     `mapstructure:"cache"`
 	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	CORS      CORSConfig      `mapstructure:"cors"`
 }
 
 // ServerConfig holds server configuration
@@ -22,11 +35,24 @@ type ServerConfig struct {
 	Host    string `mapstructure:"host"`
 	Port    int    `mapstructure:"port"`
 	BaseURL string `mapstructure:"base_url"`
+
+	StaticMaxAge   time.Duration `mapstructure:"static_max_age"`  // browser/CDN cache lifetime for widget and admin assets
+	MetricsEnabled bool          `mapstructure:"metrics_enabled"` // serve Prometheus metrics at /metrics
+
+	// SSEHeartbeatInterval is how often an idle widget chat stream gets a
+	// comment line so proxies don't close it; 0 disables heartbeats
+	SSEHeartbeatInterval time.Duration `mapstructure:"sse_heartbeat_interval"`
+
+	// TrustedProxies are the IPs or CIDRs of reverse proxies whose
+	// X-Forwarded-For and X-Real-IP headers give the client IP; with none,
+	// the client IP is always the connection's peer address
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // AdminConfig holds admin authentication configuration
 type AdminConfig struct {
-	APIKey string `mapstructure:"api_key"`
+	APIKey         string        `mapstructure:"api_key"`
+	KeyGracePeriod time.Duration `mapstructure:"key_grace_period"` // old key lifetime after a rotation
 }
 
 // DatabaseConfig holds database configuration
@@ -36,30 +62,289 @@ type DatabaseConfig struct {
 
 // StorageConfig holds document storage configuration
 type StorageConfig struct {
-	Documents string `mapstructure:"documents"`
+	Documents          string `mapstructure:"documents"`
+	MaxFileSize        int64  `mapstructure:"max_file_size"`        // bytes per uploaded file; 0 means unlimited
+	MaxRequestBody     int64  `mapstructure:"max_request_body"`     // bytes per admin request body; 0 means unlimited
+	MaxMultipartMemory int64  `mapstructure:"max_multipart_memory"` // multipart bytes buffered in memory before spilling to temp files
+	MaxBatchFiles      int    `mapstructure:"max_batch_files"`      // files per batch upload; 0 means unlimited
+	MaxBatchSize       int64  `mapstructure:"max_batch_size"`       // total bytes per batch upload; 0 means unlimited
+
+	// EncryptionKey is a base64 AES-256 key; when set, stored uploads are
+	// encrypted. PreviousEncryptionKeys still decrypt files written before a
+	// rotation until they are re-encrypted.
+	EncryptionKey          string   `mapstructure:"encryption_key"`
+	PreviousEncryptionKeys []string `mapstructure:"previous_encryption_keys"`
+
+	// TrashRetention is how long deleted documents stay restorable before
+	// they are purged; 0 keeps them until purged through the API
+	TrashRetention time.Duration `mapstructure:"trash_retention"`
+}
+
+// EncryptionKeyEnv overrides storage.encryption_key, keeping the key out of
+// the config file
+const EncryptionKeyEnv = "ASKDOC_STORAGE_ENCRYPTION_KEY"
+
+// DecodeEncryptionKey decodes a base64 storage encryption key
+func DecodeEncryptionKey(key string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(raw))
+	}
+	return raw, nil
 }
 
 // RAGConfig holds RAG configuration
 type RAGConfig struct {
-	DBPath       string `mapstructure:"db_path"`
-	IndexType    string `mapstructure:"index_type"`
-	ChunkSize    int    `mapstructure:"chunk_size"`
-	ChunkOverlap int    `mapstructure:"chunk_overlap"`
+	DBPath              string `mapstructure:"db_path"`
+	IndexType           string `mapstructure:"index_type"`
+	DistanceMetric      string `mapstructure:"distance_metric"`      // cosine, dot or euclidean
+	NormalizeEmbeddings bool   `mapstructure:"normalize_embeddings"` // L2-normalize query and document embeddings
+	ChunkSize           int    `mapstructure:"chunk_size"`
+	ChunkOverlap        int    `mapstructure:"chunk_overlap"`
+	TopK                int    `mapstructure:"top_k"`                // chunks retrieved per question; chat requests may override up to domain.MaxTopK
+	SearchMode          string `mapstructure:"search_mode"`          // vector, or hybrid to fuse vector and keyword rankings
+	SummarizeAfter      int    `mapstructure:"summarize_after"`      // unsummarized messages before older turns are condensed (0 disables)
+	SummaryKeepRecent   int    `mapstructure:"summary_keep_recent"`  // most recent messages always kept verbatim
+	HistoryTurns        int    `mapstructure:"history_turns"`        // prior question/answer turns sent with a question (0 sends none)
+	HistoryTokenBudget  int    `mapstructure:"history_token_budget"` // approximate tokens of prior turns; oldest are dropped first (0 = unbounded)
+	QueryRewrite        bool   `mapstructure:"query_rewrite"`        // rewrite follow-ups into standalone queries before retrieval
+	NormalizeQuestions  bool   `mapstructure:"normalize_questions"`  // trim, collapse whitespace and strip trailing punctuation before embedding and cache lookup
+	NormalizeLowercase  bool   `mapstructure:"normalize_lowercase"`  // also lowercase normalized questions
+	DefaultCollection   string `mapstructure:"default_collection"`   // shared collection for sites with use_default_collection and no content of their own
+	DocumentSummaries   bool   `mapstructure:"document_summaries"`   // summarize documents at ingest and retrieve by summary too
+	SuggestFollowups    bool   `mapstructure:"suggest_followups"`    // propose follow-up questions after each answer (one extra LLM call)
+
+	// PromptTemplate replaces the answer prompt: a text/template using
+	// {{.Context}} and {{.Question}} (empty keeps the built-in prompt)
+	PromptTemplate string `mapstructure:"prompt_template"`
+
+	// GapScoreThreshold records answered questions whose best source scored
+	// below it as content gaps (0 records only no-answer and fallback turns)
+	GapScoreThreshold float64 `mapstructure:"gap_score_threshold"`
+
+	// Retrieval gate: answer only when at least MinSources distinct documents
+	// have a chunk scoring MinScore or higher
+	MinScore   float64 `mapstructure:"min_score"`
+	MinSources int     `mapstructure:"min_sources"`
+
+	// Per-stage limits for a chat turn (0 disables); ChatTimeout bounds the whole turn
+	EmbedTimeout      time.Duration `mapstructure:"embed_timeout"`
+	SearchTimeout     time.Duration `mapstructure:"search_timeout"`
+	GenerationTimeout time.Duration `mapstructure:"generation_timeout"`
+	ChatTimeout       time.Duration `mapstructure:"chat_timeout"`
+	// StreamTimeout bounds a streamed chat turn in place of ChatTimeout
+	StreamTimeout time.Duration `mapstructure:"stream_timeout"`
+
+	Rerank RerankConfig `mapstructure:"rerank"`
+}
+
+// RerankConfig holds the optional rerank step, which reorders retrieved
+// chunks with a rerank model served by a /rerank endpoint (Cohere/Jina style)
+type RerankConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Model      string        `mapstructure:"model"`
+	BaseURL    string        `mapstructure:"base_url"`   // defaults to llm.generation.base_url
+	APIKey     string        `mapstructure:"api_key"`    // defaults to llm.generation.api_key
+	Candidates int           `mapstructure:"candidates"` // chunks fetched before reranking down to top_k
+	Timeout    time.Duration `mapstructure:"timeout"`
 }
 
 // LLMConfig holds LLM provider configuration
 type LLMConfig struct {
-	Provider       string `mapstructure:"provider"`
-	BaseURL        string `mapstructure:"base_url"`
-	APIKey         string `mapstructure:"api_key"`
-	EmbeddingModel string `mapstructure:"embedding_model"`
-	LLMModel       string `mapstructure:"llm_model"`
+	Provider       string   `mapstructure:"provider"`
+	BaseURL        string   `mapstructure:"base_url"`
+	APIKey         string   `mapstructure:"api_key"`
+	EmbeddingModel string   `mapstructure:"embedding_model"`
+	LLMModel       string   `mapstructure:"llm_model"`
+	Models         []string `mapstructure:"models"` // extra models a chat request may select
+	// The circuit breaker opens after BreakerThreshold consecutive LLM
+	// failures (0 disables it) and probes the backend every BreakerCooldown.
+	// With BreakerFallback, chats are answered from keyword search while open.
+	BreakerThreshold int           `mapstructure:"breaker_threshold"`
+	BreakerCooldown  time.Duration `mapstructure:"breaker_cooldown"`
+	BreakerFallback  bool          `mapstructure:"breaker_fallback"`
+	// Embedding and Generation may point embedding and answer generation at
+	// different endpoints. Unset fields fall back to the flat fields above
+	// (embedding_model and llm_model for the model); Load fills them in.
+	Embedding  ProviderConfig `mapstructure:"embedding"`
+	Generation ProviderConfig `mapstructure:"generation"`
+}
+
+// ProviderConfig is the endpoint and model of one LLM provider
+type ProviderConfig struct {
+	Provider string `mapstructure:"provider"`
+	BaseURL  string `mapstructure:"base_url"` // defaults to the provider's public API
+	APIKey   string `mapstructure:"api_key"`
+	Model    string `mapstructure:"model"`
+}
+
+// LLM providers accepted in llm.provider
+const (
+	ProviderOllama    = "ollama"
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderGemini    = "gemini"
+)
+
+// providerBaseURLs are the OpenAI-compatible endpoints used when base_url is
+// not set
+var providerBaseURLs = map[string]string{
+	ProviderOllama:    "http://localhost:11434/v1",
+	ProviderOpenAI:    "https://api.openai.com/v1",
+	ProviderAnthropic: "https://api.anthropic.com/v1",
+	ProviderGemini:    "https://generativelanguage.googleapis.com/v1beta/openai",
+}
+
+// applyDefaults resolves the embedding and generation endpoints. A block
+// naming another provider doesn't inherit llm.base_url or llm.api_key. The
+// flat model fields are set from the blocks, so both forms read the same.
+func (c *LLMConfig) applyDefaults() {
+	if c.BaseURL == "" {
+		c.BaseURL = providerBaseURLs[c.Provider]
+	}
+	c.Embedding = c.resolve(c.Embedding)
+	c.Generation = c.resolve(c.Generation)
+
+	if c.Embedding.Model == "" {
+		c.Embedding.Model = c.EmbeddingModel
+	}
+	c.EmbeddingModel = c.Embedding.Model
+	if c.Generation.Model == "" {
+		c.Generation.Model = c.LLMModel
+	}
+	c.LLMModel = c.Generation.Model
+}
+
+func (c *LLMConfig) resolve(p ProviderConfig) ProviderConfig {
+	if p.Provider == "" || p.Provider == c.Provider {
+		p.Provider = c.Provider
+		if p.BaseURL == "" {
+			p.BaseURL = c.BaseURL
+		}
+		if p.APIKey == "" {
+			p.APIKey = c.APIKey
+		}
+	}
+	if p.BaseURL == "" {
+		p.BaseURL = providerBaseURLs[p.Provider]
+	}
+	return p
+}
+
+// validateEndpoint checks the resolved embedding or generation endpoint has
+// what its provider needs
+func (c *LLMConfig) validateEndpoint(role string, p ProviderConfig) error {
+	key := func(field string) string {
+		if p.Provider == c.Provider {
+			return fmt.Sprintf("llm.%s (or llm.%s.%s)", field, role, field)
+		}
+		return fmt.Sprintf("llm.%s.%s", role, field)
+	}
+
+	switch p.Provider {
+	case ProviderOllama:
+	case ProviderOpenAI:
+		// OpenAI-compatible servers elsewhere may not need a key
+		if p.APIKey == "" && p.BaseURL == providerBaseURLs[ProviderOpenAI] {
+			return fmt.Errorf("%s is required for provider openai", key("api_key"))
+		}
+	case ProviderAnthropic, ProviderGemini:
+		if p.APIKey == "" {
+			return fmt.Errorf("%s is required for provider %s", key("api_key"), p.Provider)
+		}
+	default:
+		return fmt.Errorf("invalid %s %q: must be ollama, openai, anthropic or gemini", key("provider"), p.Provider)
+	}
+	if role == "embedding" && p.Provider == ProviderAnthropic {
+		return fmt.Errorf("provider anthropic has no embeddings API: set llm.embedding.provider to another provider")
+	}
+	if p.Model == "" {
+		flat := "llm_model"
+		if role == "embedding" {
+			flat = "embedding_model"
+		}
+		return fmt.Errorf("llm.%s.model (or llm.%s) is required", role, flat)
+	}
+	return nil
+}
+
+// HasModel reports whether model is the default LLM model or one of llm.models
+func (c LLMConfig) HasModel(model string) bool {
+	if model == c.LLMModel {
+		return true
+	}
+	for _, m := range c.Models {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// IngestConfig holds document ingestion configuration
+type IngestConfig struct {
+	// MaxAttempts bounds tries per document; transient failures are retried
+	// after RetryBackoff, doubling each time
+	MaxAttempts  int           `mapstructure:"max_attempts"`
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+	// ShareIdentical reuses the chunks of an already ingested document with
+	// the same content instead of embedding it again for another collection
+	ShareIdentical bool `mapstructure:"share_identical"`
+	// Concurrency is the number of documents ingested at once; further
+	// uploads wait in a queue
+	Concurrency int `mapstructure:"concurrency"`
+	// ShutdownTimeout bounds how long shutdown waits for queued and running
+	// ingestions before cancelling them
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+}
+
+// OCRConfig holds image text extraction configuration
+type OCRConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	Command   string `mapstructure:"command"`   // tesseract-compatible CLI
+	Languages string `mapstructure:"languages"` // e.g. "eng+deu"
+}
+
+// CacheConfig holds answer cache configuration
+type CacheConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	TTL        time.Duration `mapstructure:"ttl"`
+	MaxEntries int           `mapstructure:"max_entries"`
 }
 
 // RateLimitConfig holds rate limiting configuration
 type RateLimitConfig struct {
+	// RequestsPerHour limits widget chat requests per site and client IP; a
+	// site's own rate_limit takes precedence
 	Enabled         bool `mapstructure:"enabled"`
 	RequestsPerHour int  `mapstructure:"requests_per_hour"`
+	// MaxStreamsPerSite and MaxStreams cap concurrently open SSE chat streams
+	// per site and across the server; 0 means unlimited
+	MaxStreamsPerSite int `mapstructure:"max_streams_per_site"`
+	MaxStreams        int `mapstructure:"max_streams"`
+}
+
+// CORSConfig holds the CORS policies of the admin API (also used by the
+// OpenAI-compatible API) and of the widget API
+type CORSConfig struct {
+	Admin  CORSPolicyConfig `mapstructure:"admin"`
+	Widget CORSPolicyConfig `mapstructure:"widget"`
+}
+
+// CORSPolicyConfig is the CORS policy of a group of routes
+type CORSPolicyConfig struct {
+	// AllowOrigins lists the origins allowed to call the API, "*" for any.
+	// The widget API ignores it: each site allows its registered domain.
+	AllowOrigins []string      `mapstructure:"allow_origins"`
+	AllowMethods []string      `mapstructure:"allow_methods"`
+	AllowHeaders []string      `mapstructure:"allow_headers"`
+	MaxAge       time.Duration `mapstructure:"max_age"` // preflight cache lifetime
+	// AllowCredentials lets browsers send cookies and auth headers; only
+	// for a concrete origin list
+	AllowCredentials bool `mapstructure:"allow_credentials"`
 }
 
 // Load loads configuration from YAML file
@@ -92,35 +377,253 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	cfg.applyDataDir()
+	cfg.LLM.applyDefaults()
+
+	if key := os.Getenv(EncryptionKeyEnv); key != "" {
+		cfg.Storage.EncryptionKey = key
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
 	return &cfg, nil
 }
 
+// Vector distance metrics accepted in rag.distance_metric
+const (
+	DistanceCosine    = "cosine"
+	DistanceDot       = "dot"
+	DistanceEuclidean = "euclidean"
+)
+
+// validate rejects option values that would otherwise fail at first use
+func (c *Config) validate() error {
+	switch c.RAG.DistanceMetric {
+	case DistanceCosine, DistanceDot, DistanceEuclidean:
+	default:
+		return fmt.Errorf("invalid rag.distance_metric %q: must be cosine, dot or euclidean", c.RAG.DistanceMetric)
+	}
+	switch c.RAG.SearchMode {
+	case domain.SearchModeVector, domain.SearchModeHybrid:
+	default:
+		return fmt.Errorf("invalid rag.search_mode %q: must be vector or hybrid", c.RAG.SearchMode)
+	}
+	if err := c.LLM.validateEndpoint("embedding", c.LLM.Embedding); err != nil {
+		return err
+	}
+	if err := c.LLM.validateEndpoint("generation", c.LLM.Generation); err != nil {
+		return err
+	}
+	if c.Ingest.Concurrency < 1 {
+		return fmt.Errorf("invalid ingest.concurrency %d: must be at least 1", c.Ingest.Concurrency)
+	}
+	if c.RAG.Rerank.Enabled && c.RAG.Rerank.Model == "" {
+		return fmt.Errorf("rag.rerank.model is required when rag.rerank.enabled is set")
+	}
+	if c.Storage.EncryptionKey != "" {
+		if _, err := DecodeEncryptionKey(c.Storage.EncryptionKey); err != nil {
+			return fmt.Errorf("invalid storage.encryption_key: %w", err)
+		}
+	}
+	for name, policy := range map[string]CORSPolicyConfig{"admin": c.CORS.Admin, "widget": c.CORS.Widget} {
+		if policy.MaxAge < 0 {
+			return fmt.Errorf("invalid cors.%s.max_age %s: must not be negative", name, policy.MaxAge)
+		}
+	}
+	if c.CORS.Admin.AllowCredentials && slices.Contains(c.CORS.Admin.AllowOrigins, "*") {
+		return fmt.Errorf("cors.admin.allow_credentials requires a list of origins instead of \"*\"")
+	}
+	if c.Server.SSEHeartbeatInterval < 0 {
+		return fmt.Errorf("invalid server.sse_heartbeat_interval %s: must not be negative", c.Server.SSEHeartbeatInterval)
+	}
+	for i, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return fmt.Errorf("invalid server.trusted_proxies[%d] %q: not an IP or CIDR", i, proxy)
+			}
+		}
+	}
+	if c.Storage.TrashRetention < 0 {
+		return fmt.Errorf("invalid storage.trash_retention %s: must not be negative", c.Storage.TrashRetention)
+	}
+	for i, key := range c.Storage.PreviousEncryptionKeys {
+		if _, err := DecodeEncryptionKey(key); err != nil {
+			return fmt.Errorf("invalid storage.previous_encryption_keys[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// applyDataDir derives any data path that wasn't set explicitly from DataDir
+func (c *Config) applyDataDir() {
+	if c.Database.Path == "" {
+		c.Database.Path = filepath.Join(c.DataDir, "askdoc.db")
+	}
+	if c.Storage.Documents == "" {
+		c.Storage.Documents = filepath.Join(c.DataDir, "documents")
+	}
+	if c.RAG.DBPath == "" {
+		c.RAG.DBPath = filepath.Join(c.DataDir, "rag.db")
+	}
+}
+
+// EnsureDataDirs creates the data directories and verifies they are writable
+func (c *Config) EnsureDataDirs() error {
+	dirs := []string{
+		c.DataDir,
+		filepath.Dir(c.Database.Path),
+		c.Storage.Documents,
+		filepath.Dir(c.RAG.DBPath),
+	}
+
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if dir == "" || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create data directory %s: %w", dir, err)
+		}
+
+		probe, err := os.CreateTemp(dir, ".askdoc-write-check-*")
+		if err != nil {
+			return fmt.Errorf("data directory %s is not writable: %w", dir, err)
+		}
+		probe.Close()
+		os.Remove(probe.Name())
+	}
+
+	return nil
+}
+
 func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.host", "0.0.0.0")
 	v.SetDefault("server.port", 43510)
 	v.SetDefault("server.base_url", "http://localhost:43510")
+	v.SetDefault("server.static_max_age", "1h")
+	v.SetDefault("server.metrics_enabled", true)
+	v.SetDefault("server.sse_heartbeat_interval", "15s")
+	v.SetDefault("server.trusted_proxies", []string{})
 
 	v.SetDefault("admin.api_key", "")
+	v.SetDefault("admin.key_grace_period", "5m")
 
-	v.SetDefault("database.path", "./data/askdoc.db")
-	v.SetDefault("storage.documents", "./data/documents")
+	// database.path, storage.documents and rag.db_path default to
+	// locations under data_dir (see applyDataDir)
+	v.SetDefault("data_dir", "./data")
+
+	v.SetDefault("storage.max_file_size", 50<<20)
+	v.SetDefault("storage.max_request_body", 100<<20)
+	v.SetDefault("storage.max_multipart_memory", 8<<20)
+	v.SetDefault("storage.max_batch_files", 100)
+	v.SetDefault("storage.max_batch_size", 100<<20)
+	v.SetDefault("storage.encryption_key", "")
+	v.SetDefault("storage.trash_retention", 30*24*time.Hour)
 
-	v.SetDefault("rag.db_path", "./data/rag.db")
 	v.SetDefault("rag.index_type", "hnsw")
+	v.SetDefault("rag.distance_metric", DistanceCosine)
+	v.SetDefault("rag.normalize_embeddings", false)
 	v.SetDefault("rag.chunk_size", 1000)
 	v.SetDefault("rag.chunk_overlap", 200)
+	v.SetDefault("rag.top_k", 5)
+	v.SetDefault("rag.search_mode", domain.SearchModeVector)
+	v.SetDefault("rag.rerank.enabled", false)
+	v.SetDefault("rag.rerank.model", "")
+	v.SetDefault("rag.rerank.base_url", "")
+	v.SetDefault("rag.rerank.api_key", "")
+	v.SetDefault("rag.rerank.candidates", 20)
+	v.SetDefault("rag.rerank.timeout", "10s")
+	v.SetDefault("rag.summarize_after", 20)
+	v.SetDefault("rag.summary_keep_recent", 6)
+	v.SetDefault("rag.history_turns", 10)
+	v.SetDefault("rag.history_token_budget", 2000)
+	v.SetDefault("rag.query_rewrite", false)
+	v.SetDefault("rag.normalize_questions", true)
+	v.SetDefault("rag.normalize_lowercase", false)
+	v.SetDefault("rag.default_collection", "")
+	v.SetDefault("rag.document_summaries", false)
+	v.SetDefault("rag.suggest_followups", false)
+	v.SetDefault("rag.prompt_template", "")
+	v.SetDefault("rag.gap_score_threshold", 0.0)
+	v.SetDefault("rag.min_score", 0.0)
+	v.SetDefault("rag.min_sources", 1)
+	v.SetDefault("rag.embed_timeout", "10s")
+	v.SetDefault("rag.search_timeout", "10s")
+	v.SetDefault("rag.generation_timeout", "60s")
+	v.SetDefault("rag.chat_timeout", "90s")
+	v.SetDefault("rag.stream_timeout", "120s")
 
 	v.SetDefault("llm.provider", "ollama")
-	v.SetDefault("llm.base_url", "http://localhost:11434/v1")
 	v.SetDefault("llm.api_key", "")
 	v.SetDefault("llm.embedding_model", "nomic-embed-text")
 	v.SetDefault("llm.llm_model", "qwen2.5:7b")
+	v.SetDefault("llm.breaker_threshold", 5)
+	v.SetDefault("llm.breaker_cooldown", "30s")
+	v.SetDefault("llm.breaker_fallback", false)
+
+	v.SetDefault("ingest.max_attempts", 3)
+	v.SetDefault("ingest.retry_backoff", "5s")
+	v.SetDefault("ingest.share_identical", false)
+	v.SetDefault("ingest.concurrency", 4)
+	v.SetDefault("ingest.shutdown_timeout", "30s")
+
+	v.SetDefault("ocr.enabled", false)
+	v.SetDefault("ocr.command", "tesseract")
+	v.SetDefault("ocr.languages", "eng")
+
+	v.SetDefault("cache.enabled", true)
+	v.SetDefault("cache.ttl", "1h")
+	v.SetDefault("cache.max_entries", 1000)
 
 	v.SetDefault("rate_limit.enabled", true)
 	v.SetDefault("rate_limit.requests_per_hour", 100)
+	v.SetDefault("rate_limit.max_streams_per_site", 20)
+	v.SetDefault("rate_limit.max_streams", 500)
+
+	v.SetDefault("cors.admin.allow_origins", []string{"*"})
+	v.SetDefault("cors.admin.allow_methods", []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"})
+	v.SetDefault("cors.admin.allow_headers", []string{"Content-Type", "Authorization", "X-API-Key"})
+	v.SetDefault("cors.admin.max_age", "24h")
+	v.SetDefault("cors.admin.allow_credentials", false)
+	v.SetDefault("cors.widget.allow_methods", []string{"GET", "POST", "OPTIONS"})
+	v.SetDefault("cors.widget.allow_headers", []string{"Content-Type", "X-Widget-Key"})
+	v.SetDefault("cors.widget.max_age", "24h")
+	v.SetDefault("cors.widget.allow_credentials", false)
 }
 
 // Address returns the server address
 func (c *Config) Address() string {
 	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
 }
+
+// Bounds on the server's write timeout: no shorter than the baseline, and a
+// little longer than the slowest chat turn so its 504 still reaches the client
+const (
+	minWriteTimeout   = 30 * time.Second
+	writeTimeoutGrace = 5 * time.Second
+)
+
+// WriteTimeout returns the HTTP server write timeout, derived from the
+// longest a non-streamed chat turn may take: rag.chat_timeout, or the sum of
+// the stage timeouts when that is disabled. It returns 0 (no timeout) when
+// neither bounds the turn. Streams lift the deadline themselves.
+func (c *Config) WriteTimeout() time.Duration {
+	longest := c.RAG.ChatTimeout
+	if longest <= 0 {
+		if c.RAG.EmbedTimeout <= 0 || c.RAG.SearchTimeout <= 0 || c.RAG.GenerationTimeout <= 0 {
+			return 0
+		}
+		longest = c.RAG.EmbedTimeout + c.RAG.SearchTimeout + c.RAG.GenerationTimeout
+		if c.RAG.Rerank.Enabled {
+			if c.RAG.Rerank.Timeout <= 0 {
+				return 0
+			}
+			longest += c.RAG.Rerank.Timeout
+		}
+	}
+	return max(minWriteTimeout, longest+writeTimeoutGrace)
+}
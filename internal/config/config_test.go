@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		rag  RAGConfig
+		want time.Duration
+	}{
+		{"defaults", RAGConfig{EmbedTimeout: 10 * time.Second, SearchTimeout: 10 * time.Second, GenerationTimeout: 60 * time.Second, ChatTimeout: 90 * time.Second}, 95 * time.Second},
+		{"short chat timeout keeps the baseline", RAGConfig{ChatTimeout: 10 * time.Second}, 30 * time.Second},
+		{"stage sum without chat timeout", RAGConfig{EmbedTimeout: 10 * time.Second, SearchTimeout: 10 * time.Second, GenerationTimeout: 60 * time.Second}, 85 * time.Second},
+		{"rerank adds its timeout", RAGConfig{EmbedTimeout: 10 * time.Second, SearchTimeout: 10 * time.Second, GenerationTimeout: 60 * time.Second, Rerank: RerankConfig{Enabled: true, Timeout: 20 * time.Second}}, 105 * time.Second},
+		{"unbounded generation", RAGConfig{EmbedTimeout: 10 * time.Second, SearchTimeout: 10 * time.Second}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{RAG: tt.rag}
+			if got := cfg.WriteTimeout(); got != tt.want {
+				t.Errorf("WriteTimeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDataDir(t *testing.T) {
+	dataDir := t.TempDir()
+	tests := []struct {
+		name                    string
+		yaml                    string
+		database, docs, vectors string
+	}{
+		{
+			name:     "derived from data_dir",
+			yaml:     "data_dir: " + dataDir + "\n",
+			database: filepath.Join(dataDir, "askdoc.db"),
+			docs:     filepath.Join(dataDir, "documents"),
+			vectors:  filepath.Join(dataDir, "rag.db"),
+		},
+		{
+			name: "explicit paths win",
+			yaml: "data_dir: " + dataDir + "\n" +
+				"database:\n  path: /srv/meta/askdoc.db\n" +
+				"storage:\n  documents: /srv/uploads\n" +
+				"rag:\n  db_path: /srv/vectors/rag.db\n",
+			database: "/srv/meta/askdoc.db",
+			docs:     "/srv/uploads",
+			vectors:  "/srv/vectors/rag.db",
+		},
+		{
+			name:     "only some paths explicit",
+			yaml:     "data_dir: " + dataDir + "\n" + "database:\n  path: /srv/meta/askdoc.db\n",
+			database: "/srv/meta/askdoc.db",
+			docs:     filepath.Join(dataDir, "documents"),
+			vectors:  filepath.Join(dataDir, "rag.db"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := Load(path)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Database.Path != tt.database {
+				t.Errorf("database.path = %q, want %q", cfg.Database.Path, tt.database)
+			}
+			if cfg.Storage.Documents != tt.docs {
+				t.Errorf("storage.documents = %q, want %q", cfg.Storage.Documents, tt.docs)
+			}
+			if cfg.RAG.DBPath != tt.vectors {
+				t.Errorf("rag.db_path = %q, want %q", cfg.RAG.DBPath, tt.vectors)
+			}
+		})
+	}
+}
@@ -1,13 +1,48 @@
 package domain
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Limits on caller-supplied session identity
+const (
+	MaxExternalUserIDLength = 256
+	MaxSessionMetadataBytes = 4096
+)
+
+// Limits on retrieval metadata filters
+const (
+	MaxFilters           = 10
+	MaxFilterValueLength = 256
+)
+
+// Retrieval modes: vector ranks chunks by embedding similarity, hybrid fuses
+// that ranking with keyword matches
+const (
+	SearchModeVector = "vector"
+	SearchModeHybrid = "hybrid"
+)
+
+// MaxTopK caps the chunks a chat request may ask to retrieve
+const MaxTopK = 20
+
+// filterKeyRe matches metadata keys usable in retrieval filters
+var filterKeyRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
 
 // Session represents a chat session
 type Session struct {
-	ID        string    `json:"id"`
-	SiteID    string    `json:"site_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              string         `json:"id"`
+	SiteID          string         `json:"site_id"`
+	Summary         string         `json:"summary,omitempty"`          // running summary of older turns
+	SummarizedCount int            `json:"summarized_count,omitempty"` // messages folded into Summary
+	ExternalUserID  string         `json:"external_user_id,omitempty"` // host application's user ID
+	Metadata        map[string]any `json:"metadata,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
 }
 
 // Message represents a chat message
@@ -18,41 +53,364 @@ type Message struct {
 	Content   string    `json:"content"`
 	Sources   []Source  `json:"sources,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// Language is the language code detected from a user message, empty
+	// when it couldn't be told
+	Language string `json:"language,omitempty"`
 }
 
 // Source represents a citation source
 type Source struct {
 	DocumentID string  `json:"document_id"`
 	Filename   string  `json:"filename"`
+	Label      string  `json:"label"` // human-readable citation, e.g. "Installation Guide, §2.3 Proxy"
 	Content    string  `json:"content"`
+	RawContent string  `json:"raw_content,omitempty"` // stored chunk text, set when Content is cleaned
+	Language   string  `json:"language,omitempty"`    // syntax highlighting hint when the content is code
 	Score      float64 `json:"score"`
+
+	// Where the passage is in its document, when known: the PDF page it
+	// starts on and the heading of its section
+	Page    int    `json:"page,omitempty"`
+	Section string `json:"section,omitempty"`
 }
 
+// Chat modes: fast does a single retrieval and generation, agent routes the
+// turn through the rago agent for multi-step reasoning and session memory
+const (
+	ChatModeFast  = "fast"
+	ChatModeAgent = "agent"
+)
+
 // ChatRequest is the request to send a chat message
 type ChatRequest struct {
 	SessionID string `json:"session_id,omitempty"`
 	Message   string `json:"message" binding:"required"`
+	// CleanSources returns source content as plain text, with the stored text in raw_content
+	CleanSources bool `json:"clean_sources,omitempty"`
+	// ExternalUserID and SessionMetadata link the session to the host application
+	ExternalUserID  string         `json:"external_user_id,omitempty"`
+	SessionMetadata map[string]any `json:"session_metadata,omitempty"`
+	// Model selects a generation model; widget requests are limited to the site's allowed_models
+	Model string `json:"model,omitempty"`
+	// Filters restricts retrieval to chunks whose metadata has each key set to the given value
+	Filters map[string]string `json:"filters,omitempty"`
+	// Mode is "fast" (default) or "agent"
+	Mode string `json:"mode,omitempty"`
+	// TopK overrides rag.top_k for this request; values above MaxTopK are clamped
+	TopK int `json:"top_k,omitempty"`
+	// SearchMode overrides rag.search_mode: "vector" or "hybrid"
+	SearchMode string `json:"search_mode,omitempty"`
+	// MinScore overrides rag.min_score for this request; answers are not cached
+	MinScore *float64 `json:"min_score,omitempty"`
+	// Admin marks requests from the admin API, which may use any configured model
+	Admin bool `json:"-"`
+}
+
+// Validate checks the caller-supplied session identity against size limits
+// and the chat mode and filters
+func (r *ChatRequest) Validate() error {
+	if len(r.ExternalUserID) > MaxExternalUserIDLength {
+		return fmt.Errorf("%w: external_user_id exceeds %d characters", ErrInvalidRequest, MaxExternalUserIDLength)
+	}
+	if r.SessionMetadata != nil {
+		data, err := json.Marshal(r.SessionMetadata)
+		if err != nil {
+			return fmt.Errorf("%w: invalid session_metadata: %v", ErrInvalidRequest, err)
+		}
+		if len(data) > MaxSessionMetadataBytes {
+			return fmt.Errorf("%w: session_metadata exceeds %d bytes", ErrInvalidRequest, MaxSessionMetadataBytes)
+		}
+	}
+	if r.TopK < 0 {
+		return fmt.Errorf("%w: top_k must not be negative", ErrInvalidRequest)
+	}
+	if r.MinScore != nil && *r.MinScore < 0 {
+		return fmt.Errorf("%w: min_score must not be negative", ErrInvalidRequest)
+	}
+	switch r.SearchMode {
+	case "", SearchModeVector, SearchModeHybrid:
+	default:
+		return fmt.Errorf("%w: search_mode must be %q or %q", ErrInvalidRequest, SearchModeVector, SearchModeHybrid)
+	}
+	switch r.Mode {
+	case "", ChatModeFast:
+	case ChatModeAgent:
+		// The agent runs on llm.llm_model with its own retrieval
+		if r.Model != "" || len(r.Filters) > 0 {
+			return fmt.Errorf("%w: model and filters are not supported in agent mode", ErrInvalidRequest)
+		}
+	default:
+		return fmt.Errorf("%w: mode must be %q or %q", ErrInvalidRequest, ChatModeFast, ChatModeAgent)
+	}
+	return ValidateFilters(r.Filters)
+}
+
+// ValidateFilters checks retrieval filter keys and values against the limits
+func ValidateFilters(filters map[string]string) error {
+	if len(filters) > MaxFilters {
+		return fmt.Errorf("%w: at most %d filters are allowed", ErrInvalidRequest, MaxFilters)
+	}
+	for key, value := range filters {
+		if !filterKeyRe.MatchString(key) {
+			return fmt.Errorf("%w: invalid filter key %q", ErrInvalidRequest, key)
+		}
+		if len(value) > MaxFilterValueLength {
+			return fmt.Errorf("%w: filter %q exceeds %d characters", ErrInvalidRequest, key, MaxFilterValueLength)
+		}
+	}
+	return nil
+}
+
+// ValidateFilterableKeys checks that a site's filterable keys are usable as filter keys
+func ValidateFilterableKeys(keys []string) error {
+	for _, key := range keys {
+		if !filterKeyRe.MatchString(key) {
+			return fmt.Errorf("%w: invalid filterable key %q", ErrInvalidRequest, key)
+		}
+	}
+	return nil
+}
+
+// SessionListResponse is the response for listing sessions
+type SessionListResponse struct {
+	Sessions []*Session `json:"sessions"`
+	Total    int        `json:"total"`
+	Page     int        `json:"page"`
+	PageSize int        `json:"page_size"`
+}
+
+// ActiveSession is a session with recent activity and its message stats
+type ActiveSession struct {
+	ID             string     `json:"id"`
+	SiteID         string     `json:"site_id"`
+	SiteName       string     `json:"site_name,omitempty"`
+	ExternalUserID string     `json:"external_user_id,omitempty"`
+	MessageCount   int        `json:"message_count"`
+	LastMessageAt  *time.Time `json:"last_message_at,omitempty"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// ActiveSessionListResponse is the response for listing active sessions;
+// Total is the number of conversations active within Window
+type ActiveSessionListResponse struct {
+	Sessions []*ActiveSession `json:"sessions"`
+	Total    int              `json:"total"`
+	Window   string           `json:"window"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+}
+
+// Reasons a question is counted as a content gap
+const (
+	GapReasonNoAnswer = "no_answer" // retrieval found too little to answer from
+	GapReasonFallback = "fallback"  // answered from keyword search or not at all while the LLM was down
+	GapReasonLowScore = "low_score" // best source scored below rag.gap_score_threshold
+)
+
+// UnansweredQuestion is a question the assistant could not answer well
+type UnansweredQuestion struct {
+	ID        string    `json:"id"`
+	SiteID    string    `json:"site_id"`
+	SessionID string    `json:"session_id,omitempty"`
+	Question  string    `json:"question"`
+	Reason    string    `json:"reason"`
+	TopScore  float64   `json:"top_score"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// QuestionGap groups similar unanswered questions; Question is the most
+// recently asked wording
+type QuestionGap struct {
+	Question    string    `json:"question"`
+	Count       int       `json:"count"`
+	Variants    []string  `json:"variants,omitempty"` // other distinct wordings
+	Reasons     []string  `json:"reasons"`
+	LastAskedAt time.Time `json:"last_asked_at"`
+}
+
+// GapReport lists content gaps, most frequently asked first
+type GapReport struct {
+	SiteID string         `json:"site_id,omitempty"`
+	Gaps   []*QuestionGap `json:"gaps"`
+	Total  int            `json:"total"` // unanswered questions considered
+}
+
+// AskedQuestion is a user message of a site's session
+type AskedQuestion struct {
+	Question  string
+	SiteID    string
+	CreatedAt time.Time
+}
+
+// TopQuestion is a group of similar questions users asked
+type TopQuestion struct {
+	Question    string    `json:"question"` // latest wording
+	Count       int       `json:"count"`
+	Variants    []string  `json:"variants,omitempty"` // other distinct wordings
+	LastAskedAt time.Time `json:"last_asked_at"`
+}
+
+// TopQuestionsReport lists what users asked, most frequently asked first
+type TopQuestionsReport struct {
+	SiteID    string         `json:"site_id,omitempty"`
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Questions []*TopQuestion `json:"questions"`
+	Total     int            `json:"total"` // user messages considered
+}
+
+// Feedback ratings on an assistant answer
+const (
+	FeedbackRatingUp   = "up"
+	FeedbackRatingDown = "down"
+)
+
+// MaxFeedbackCommentLength limits the free-text comment left with a rating
+const MaxFeedbackCommentLength = 2000
+
+// Feedback is a widget user's rating of an assistant answer
+type Feedback struct {
+	ID        string    `json:"id"`
+	SiteID    string    `json:"site_id"`
+	SessionID string    `json:"session_id"`
+	MessageID string    `json:"message_id"`
+	Rating    string    `json:"rating"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FeedbackRequest rates an assistant answer by the message_id returned with it
+type FeedbackRequest struct {
+	MessageID string `json:"message_id" binding:"required"`
+	Rating    string `json:"rating" binding:"required"`
+	Comment   string `json:"comment,omitempty"`
+}
+
+// Validate checks the rating and comment length
+func (r *FeedbackRequest) Validate() error {
+	if r.Rating != FeedbackRatingUp && r.Rating != FeedbackRatingDown {
+		return fmt.Errorf("%w: rating must be %q or %q", ErrInvalidRequest, FeedbackRatingUp, FeedbackRatingDown)
+	}
+	if len(r.Comment) > MaxFeedbackCommentLength {
+		return fmt.Errorf("%w: comment exceeds %d characters", ErrInvalidRequest, MaxFeedbackCommentLength)
+	}
+	return nil
+}
+
+// FeedbackListResponse is the response for listing feedback
+type FeedbackListResponse struct {
+	Feedback []*Feedback `json:"feedback"`
+	Total    int         `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+}
+
+// SessionDetail is a session together with its messages
+type SessionDetail struct {
+	*Session
+	Messages []*Message `json:"messages"`
 }
 
 // ChatResponse is the response from a chat message
 type ChatResponse struct {
 	SessionID string   `json:"session_id"`
+	MessageID string   `json:"message_id,omitempty"` // the assistant message, for feedback
 	Answer    string   `json:"answer"`
 	Sources   []Source `json:"sources,omitempty"`
+	// Disclaimer is the site's disclaimer; KnowledgeCutoff is the date of the
+	// latest ingested document in the site's collections
+	Disclaimer      string `json:"disclaimer,omitempty"`
+	KnowledgeCutoff string `json:"knowledge_cutoff,omitempty"`
+	// SuggestedQuestions are follow-ups the user might ask next (rag.suggest_followups)
+	SuggestedQuestions []string `json:"suggested_questions,omitempty"`
+	// Diagnostics are sent as response headers rather than in the body
+	Diagnostics *RetrievalDiagnostics `json:"-"`
+}
+
+// RetrievalDiagnostics are lightweight stats about how a chat turn was answered
+type RetrievalDiagnostics struct {
+	SourcesCount int
+	TopScore     float64
+	RetrievalMs  int64 // embedding and vector search
+	GenerationMs int64 // answer generation
+}
+
+// Headers returns the diagnostics as X-AskDoc-* response headers
+func (d *RetrievalDiagnostics) Headers() map[string]string {
+	if d == nil {
+		return nil
+	}
+	return map[string]string{
+		"X-AskDoc-Sources-Count": strconv.Itoa(d.SourcesCount),
+		"X-AskDoc-Top-Score":     strconv.FormatFloat(d.TopScore, 'f', 4, 64),
+		"X-AskDoc-Retrieval-Ms":  strconv.FormatInt(d.RetrievalMs, 10),
+		"X-AskDoc-Generation-Ms": strconv.FormatInt(d.GenerationMs, 10),
+	}
 }
 
 // StreamChunk represents a chunk in SSE stream
 type StreamChunk struct {
-	Type      string   `json:"type"` // thinking, content, sources, done, error
-	Content   string   `json:"content,omitempty"`
-	Sources   []Source `json:"sources,omitempty"`
-	SessionID string   `json:"session_id,omitempty"`
+	Type            string   `json:"type"` // thinking, content, sources, disclaimer, suggestions, done, error
+	Content         string   `json:"content,omitempty"`
+	Sources         []Source `json:"sources,omitempty"`
+	SessionID       string   `json:"session_id,omitempty"`
+	MessageID       string   `json:"message_id,omitempty"`       // set on the done chunk: the stored assistant message
+	KnowledgeCutoff string   `json:"knowledge_cutoff,omitempty"` // set on disclaimer chunks
+	Suggestions     []string `json:"suggestions,omitempty"`      // set on suggestions chunks
 }
 
 // Stats represents system statistics
 type Stats struct {
-	TotalDocuments  int `json:"total_documents"`
+	TotalDocuments   int `json:"total_documents"`
 	TotalCollections int `json:"total_collections"`
-	TotalSites      int `json:"total_sites"`
-	TotalChats      int `json:"total_chats"`
+	TotalSites       int `json:"total_sites"`
+	TotalChats       int `json:"total_chats"`
+
+	// Ingestions waiting for a worker and running
+	IngestQueued  int `json:"ingest_queued"`
+	IngestRunning int `json:"ingest_running"`
+}
+
+// Analytics time bucket sizes
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// ActivityCount is the chat activity of one site in one time bucket
+type ActivityCount struct {
+	Bucket   string
+	SiteID   string
+	SiteName string
+	Messages int
+	Sessions int
+}
+
+// AnalyticsPoint is the chat activity in one time bucket
+type AnalyticsPoint struct {
+	Bucket   string `json:"bucket"`   // 2006-01-02 for days and weeks (their Monday), 2006-01 for months
+	Messages int    `json:"messages"` // user messages
+	Sessions int    `json:"sessions"` // sessions started
+}
+
+// SiteAnalytics is one site's share of the chat activity
+type SiteAnalytics struct {
+	SiteID   string           `json:"site_id"`
+	SiteName string           `json:"site_name,omitempty"`
+	Messages int              `json:"messages"`
+	Sessions int              `json:"sessions"`
+	Series   []AnalyticsPoint `json:"series"`
+}
+
+// Analytics is the chat activity over a time range
+type Analytics struct {
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Granularity string           `json:"granularity"`
+	Messages    int              `json:"messages"`
+	Sessions    int              `json:"sessions"`
+	Series      []AnalyticsPoint `json:"series"`
+	Sites       []*SiteAnalytics `json:"sites,omitempty"` // most messages first, when requested
 }
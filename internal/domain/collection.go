@@ -1,6 +1,13 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxSynonymGroups limits the size of a collection's synonym map
+const MaxSynonymGroups = 500
 
 // Collection represents a document collection
 type Collection struct {
@@ -9,20 +16,80 @@ type Collection struct {
 	Description   string         `json:"description,omitempty"`
 	Metadata      map[string]any `json:"metadata,omitempty"`
 	DocumentCount int            `json:"document_count"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
+	Version       int64          `json:"version"` // bumped whenever a document in the collection changes
+	// StripHTMLBoilerplate ingests only the main content of HTML documents
+	StripHTMLBoilerplate bool `json:"strip_html_boilerplate"`
+	// Synonyms maps a term to its aliases (e.g. "SSO": ["single sign-on"]).
+	// A question using any of them is expanded with the others before keyword
+	// retrieval, and before embedding too when EmbedSynonyms is set.
+	Synonyms      map[string][]string `json:"synonyms,omitempty"`
+	EmbedSynonyms bool                `json:"embed_synonyms"`
+	// ChunkSize and ChunkOverlap override rag.chunk_size and
+	// rag.chunk_overlap for documents ingested into the collection
+	ChunkSize    *int `json:"chunk_size,omitempty"`
+	ChunkOverlap *int `json:"chunk_overlap,omitempty"`
+	// LastIngestedAt is when the most recent document was ingested
+	LastIngestedAt *time.Time `json:"last_ingested_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// CollectionListResponse is the response for listing collections
+type CollectionListResponse struct {
+	Items    []*Collection `json:"items"`
+	Total    int           `json:"total"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
 }
 
 // CreateCollectionRequest is the request to create a collection
 type CreateCollectionRequest struct {
-	Name        string         `json:"name" binding:"required"`
-	Description string         `json:"description,omitempty"`
-	Metadata    map[string]any `json:"metadata,omitempty"`
+	Name                 string              `json:"name" binding:"required"`
+	Description          string              `json:"description,omitempty"`
+	Metadata             map[string]any      `json:"metadata,omitempty"`
+	StripHTMLBoilerplate bool                `json:"strip_html_boilerplate,omitempty"`
+	Synonyms             map[string][]string `json:"synonyms,omitempty"`
+	EmbedSynonyms        bool                `json:"embed_synonyms,omitempty"`
+	ChunkSize            *int                `json:"chunk_size,omitempty"`
+	ChunkOverlap         *int                `json:"chunk_overlap,omitempty"`
 }
 
 // UpdateCollectionRequest is the request to update a collection
 type UpdateCollectionRequest struct {
-	Name        string         `json:"name,omitempty"`
-	Description string         `json:"description,omitempty"`
-	Metadata    map[string]any `json:"metadata,omitempty"`
+	Name                 string         `json:"name,omitempty"`
+	Description          string         `json:"description,omitempty"`
+	Metadata             map[string]any `json:"metadata,omitempty"`
+	StripHTMLBoilerplate *bool          `json:"strip_html_boilerplate,omitempty"`
+	// Synonyms replaces the synonym map; an empty object clears it
+	Synonyms      map[string][]string `json:"synonyms,omitempty"`
+	EmbedSynonyms *bool               `json:"embed_synonyms,omitempty"`
+	// ChunkSize and ChunkOverlap set the collection's overrides; a negative
+	// value clears one. Documents already ingested keep their chunks until
+	// they are reingested.
+	ChunkSize    *int `json:"chunk_size,omitempty"`
+	ChunkOverlap *int `json:"chunk_overlap,omitempty"`
+}
+
+// ValidateSynonyms checks that a synonym map has no empty terms and is
+// within MaxSynonymGroups
+func ValidateSynonyms(synonyms map[string][]string) error {
+	if len(synonyms) > MaxSynonymGroups {
+		return fmt.Errorf("%w: at most %d synonym entries are allowed", ErrInvalidRequest, MaxSynonymGroups)
+	}
+	for term, aliases := range synonyms {
+		if strings.TrimSpace(term) == "" {
+			return fmt.Errorf("%w: synonym terms must not be empty", ErrInvalidRequest)
+		}
+		for _, alias := range aliases {
+			if strings.TrimSpace(alias) == "" {
+				return fmt.Errorf("%w: synonyms of %q must not be empty", ErrInvalidRequest, term)
+			}
+		}
+	}
+	return nil
+}
+
+// MergeCollectionsRequest is the request to merge a collection into another
+type MergeCollectionsRequest struct {
+	SourceID string `json:"source_id" binding:"required"`
 }
@@ -1,6 +1,11 @@
 package domain
 
-import "time"
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
 
 // Document status constants (stored in rago metadata)
 const (
@@ -10,6 +15,24 @@ const (
 	DocumentStatusFailed     = "failed"
 )
 
+// Document visibility; draft documents are excluded from chat retrieval
+const (
+	DocumentVisibilityPublished = "published"
+	DocumentVisibilityDraft     = "draft"
+)
+
+// ParseVisibility validates a requested visibility; empty means published
+func ParseVisibility(v string) (string, error) {
+	switch v {
+	case "", DocumentVisibilityPublished:
+		return DocumentVisibilityPublished, nil
+	case DocumentVisibilityDraft:
+		return DocumentVisibilityDraft, nil
+	default:
+		return "", fmt.Errorf("%w: visibility must be %q or %q", ErrInvalidRequest, DocumentVisibilityDraft, DocumentVisibilityPublished)
+	}
+}
+
 // DocumentMetadata keys stored in rago's document metadata
 const (
 	MetadataKeyCollectionID = "collection_id"
@@ -19,8 +42,143 @@ const (
 	MetadataKeyStatus       = "status"
 	MetadataKeyChunkCount   = "chunk_count"
 	MetadataKeyError        = "error"
+	MetadataKeyAttempts     = "attempts"
+	MetadataKeyVisibility   = "visibility"
+	MetadataKeyType         = "type"
+	MetadataKeyFAQQuestion  = "faq_question"
+	MetadataKeyFAQAnswer    = "faq_answer"
+
+	// Provenance of FAQ entries promoted from a chat answer
+	MetadataKeyVerified        = "verified"
+	MetadataKeySourceSessionID = "source_session_id"
+	MetadataKeySourceMessageID = "source_message_id"
+
+	// Citation labels: the document title and the heading of a chunk's section
+	MetadataKeyTitle   = "title"
+	MetadataKeySection = "section"
+
+	// Identical uploads shared across collections (ingest.share_identical):
+	// the SHA-256 of a document's content, the document whose chunks a copy
+	// uses, and on those chunks the other collections they belong to
+	MetadataKeyContentHash       = "content_hash"
+	MetadataKeySharedFrom        = "shared_from"
+	MetadataKeySharedCollections = "shared_collections"
+
+	// The page a document was fetched from (POST .../ingest-url)
+	MetadataKeySourceURL = "source_url"
+
+	// Document tags, stored comma-separated like shared_collections
+	MetadataKeyTags = "tags"
+
+	// CSV and JSON uploads: the columns or fields to ingest (upload
+	// metadata), the malformed rows skipped, and the row a chunk starts in
+	MetadataKeyFields      = "fields"
+	MetadataKeySkippedRows = "skipped_rows"
+	MetadataKeyRow         = "row"
+
+	// PDF uploads: the page a chunk starts on
+	MetadataKeyPage = "page"
+
+	// Summaries written for readers (POST /documents/:id/summarize), by
+	// length; cleared when the document is reingested
+	MetadataKeySummaries = "summaries"
+
+	// Documents in the trash: when they were deleted (RFC 3339), set on the
+	// document and on its chunks
+	MetadataKeyDeletedAt = "deleted_at"
+
+	// The chunk size and overlap a document was last split with: its
+	// collection's overrides or rag.chunk_size and rag.chunk_overlap
+	MetadataKeyChunkSize    = "chunk_size"
+	MetadataKeyChunkOverlap = "chunk_overlap"
+)
+
+// Tag limits
+const (
+	MaxTags      = 20
+	MaxTagLength = 50
 )
 
+// NormalizeTags trims, lowercases, dedupes and sorts tags, rejecting empty
+// tags, commas and tag sets beyond the limits
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		switch {
+		case tag == "":
+			return nil, fmt.Errorf("%w: tags must not be empty", ErrInvalidRequest)
+		case strings.Contains(tag, ","):
+			return nil, fmt.Errorf("%w: tag %q must not contain a comma", ErrInvalidRequest, tag)
+		case len(tag) > MaxTagLength:
+			return nil, fmt.Errorf("%w: tag %q exceeds %d characters", ErrInvalidRequest, tag, MaxTagLength)
+		}
+		normalized = append(normalized, tag)
+	}
+	slices.Sort(normalized)
+	normalized = slices.Compact(normalized)
+	if len(normalized) > MaxTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidRequest, MaxTags)
+	}
+	return normalized, nil
+}
+
+// ParseTags reads the tags of document or chunk metadata
+func ParseTags(metadata map[string]any) []string {
+	joined, _ := metadata[MetadataKeyTags].(string)
+	if joined == "" {
+		return nil
+	}
+	return strings.Split(joined, ",")
+}
+
+// HasTag reports whether metadata carries tag, ignoring case
+func HasTag(metadata map[string]any, tag string) bool {
+	return slices.Contains(ParseTags(metadata), strings.ToLower(strings.TrimSpace(tag)))
+}
+
+// DocumentTypeFAQ marks a document holding a single question/answer pair
+const DocumentTypeFAQ = "faq"
+
+// What an upload does when its collection already has a document with the
+// same content
+const (
+	OnDuplicateReject   = "reject"   // fail with a DuplicateDocumentError
+	OnDuplicateExisting = "existing" // return the existing document
+	OnDuplicateAllow    = "allow"    // store the upload anyway
+)
+
+// ParseOnDuplicate validates a requested duplicate handling; empty means reject
+func ParseOnDuplicate(v string) (string, error) {
+	switch v {
+	case "", OnDuplicateReject:
+		return OnDuplicateReject, nil
+	case OnDuplicateExisting, OnDuplicateAllow:
+		return v, nil
+	default:
+		return "", fmt.Errorf("%w: on_duplicate must be %q, %q or %q", ErrInvalidRequest,
+			OnDuplicateReject, OnDuplicateExisting, OnDuplicateAllow)
+	}
+}
+
+// DuplicateDocumentError rejects an upload whose content is already in the
+// collection as document ExistingID
+type DuplicateDocumentError struct {
+	ExistingID string
+}
+
+func (e *DuplicateDocumentError) Error() string {
+	return fmt.Sprintf("%v: the collection already has this file as document %s", ErrDuplicate, e.ExistingID)
+}
+
+func (e *DuplicateDocumentError) Unwrap() error {
+	return ErrDuplicate
+}
+
+// ChunkTypeSummary marks the embedded summary of a document (MetadataKeyType
+// of a chunk), used to find documents by overall topic
+const ChunkTypeSummary = "summary"
+
 // Document represents a document (API response type, backed by rago storage)
 type Document struct {
 	ID           string         `json:"id"`
@@ -29,11 +187,25 @@ type Document struct {
 	FileType     string         `json:"file_type"`
 	FileSize     int64          `json:"file_size"`
 	Status       string         `json:"status"`
+	Visibility   string         `json:"visibility"` // draft or published
+	Tags         []string       `json:"tags,omitempty"`
 	ChunkCount   int            `json:"chunk_count"`
 	Metadata     map[string]any `json:"metadata,omitempty"`
 	Error        string         `json:"error,omitempty"`
+	Attempts     int            `json:"attempts,omitempty"` // ingestion attempts, including retries
+	JobID        string         `json:"job_id,omitempty"`   // ingest job tracking this upload
+	ContentHash  string         `json:"content_hash,omitempty"`
+	SharedFrom   string         `json:"shared_from,omitempty"` // document whose chunks this copy uses
+	DeletedAt    *time.Time     `json:"deleted_at,omitempty"`  // set while the document is in the trash
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at,omitempty"`
+
+	// CollectionName is filled in by listings that span collections
+	CollectionName string `json:"collection_name,omitempty"`
+
+	// Duplicate is set when an upload returned this existing document instead
+	// of storing the same content again (on_duplicate=existing)
+	Duplicate bool `json:"duplicate,omitempty"`
 }
 
 // CreateDocumentRequest is the request to upload a document
@@ -42,10 +214,143 @@ type CreateDocumentRequest struct {
 	Metadata     map[string]any `form:"metadata"`
 }
 
-// DocumentListResponse is the response for listing documents
+// Base64DocumentRequest uploads a document as JSON, for clients that can't
+// send multipart form data
+type Base64DocumentRequest struct {
+	Filename      string         `json:"filename" binding:"required"`
+	ContentBase64 string         `json:"content_base64" binding:"required"`
+	Metadata      map[string]any `json:"metadata,omitempty"`
+	Visibility    string         `json:"visibility,omitempty"` // draft or published (default)
+	Tags          []string       `json:"tags,omitempty"`
+	OnDuplicate   string         `json:"on_duplicate,omitempty"` // reject (default), existing or allow
+}
+
+// IngestURLRequest fetches a web page and ingests its readable text
+type IngestURLRequest struct {
+	URL      string         `json:"url" binding:"required"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+	Tags     []string       `json:"tags,omitempty"`
+}
+
+// MoveDocumentRequest moves a document to another collection
+type MoveDocumentRequest struct {
+	TargetCollectionID string `json:"target_collection_id" binding:"required"`
+}
+
+// DocumentTagsRequest replaces the tags of a document; an empty list clears them
+type DocumentTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// FAQPair is a question with its authoritative answer
+type FAQPair struct {
+	Question string         `json:"question"`
+	Answer   string         `json:"answer"`
+	Metadata map[string]any `json:"-"` // set internally, e.g. provenance of a verified answer
+}
+
+// VerifyAnswerRequest promotes a chat answer into a verified FAQ entry.
+// Answer replaces the assistant's text, e.g. after an editor's correction.
+type VerifyAnswerRequest struct {
+	CollectionID string `json:"collection_id" binding:"required"`
+	Answer       string `json:"answer,omitempty"`
+}
+
+// Summary lengths of POST /documents/:id/summarize
+const (
+	SummaryLengthShort  = "short"
+	SummaryLengthMedium = "medium"
+	SummaryLengthLong   = "long"
+)
+
+// SummarizeDocumentRequest asks for a summary of a document; Length is
+// short, medium (default) or long
+type SummarizeDocumentRequest struct {
+	Length string `json:"length,omitempty"`
+}
+
+// DocumentSummary is a summary of a document for readers
+type DocumentSummary struct {
+	DocumentID string `json:"document_id"`
+	Length     string `json:"length"`
+	Summary    string `json:"summary"`
+	Cached     bool   `json:"cached"` // stored from an earlier request
+}
+
+// DocumentStatusResponse reports where a document is in ingestion
+type DocumentStatusResponse struct {
+	DocumentID string  `json:"document_id"`
+	Status     string  `json:"status"`
+	ChunkCount int     `json:"chunk_count"`
+	Error      string  `json:"error,omitempty"`
+	Attempts   int     `json:"attempts,omitempty"`
+	Progress   float64 `json:"progress"` // 0 pending, 0.5 processing, 1 ready or failed
+}
+
+// DocumentListResponse is the response for listing documents. Page is set
+// for offset pagination; NextCursor continues the listing after this page
+// and is empty on the last one.
 type DocumentListResponse struct {
-	Documents []*Document `json:"documents"`
-	Total     int         `json:"total"`
-	Page      int         `json:"page"`
-	PageSize  int         `json:"page_size"`
+	Documents  []*Document `json:"documents"`
+	Total      int         `json:"total"`
+	Page       int         `json:"page,omitempty"`
+	PageSize   int         `json:"page_size"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// EmbeddingRecord is one chunk vector in an embeddings export
+type EmbeddingRecord struct {
+	Seq          int64     `json:"seq"` // resume an export with ?after=<seq>
+	ChunkID      string    `json:"chunk_id"`
+	DocumentID   string    `json:"document_id"`
+	CollectionID string    `json:"collection_id,omitempty"`
+	Filename     string    `json:"filename,omitempty"`
+	FileType     string    `json:"file_type,omitempty"`
+	Vector       []float32 `json:"vector"`
+}
+
+// ExportFormatVersion is the version of the collection export archive layout
+const ExportFormatVersion = 1
+
+// ExportManifest is the manifest.json of a collection export archive. The
+// archive also holds collection.json and the original uploads under files/.
+type ExportManifest struct {
+	Version      int                `json:"version"`
+	CollectionID string             `json:"collection_id"`
+	ExportedAt   time.Time          `json:"exported_at"`
+	Documents    []ExportedDocument `json:"documents"`
+}
+
+// ExportedDocument is a document of an export with the archive path of its
+// original upload; File is empty for documents without a stored file
+type ExportedDocument struct {
+	*Document
+	File string `json:"file,omitempty"`
+}
+
+// ImportResult reports a collection import: the collection created for it
+// and what became of each document in the archive
+type ImportResult struct {
+	Collection *Collection         `json:"collection"`
+	Imported   int                 `json:"imported"`
+	Failed     int                 `json:"failed"`
+	Documents  []*ImportedDocument `json:"documents"`
+}
+
+// ImportedDocument is the outcome of importing one document. DocumentID is
+// the new document's ID; Status is pending for a queued upload, ready for an
+// FAQ entry and failed otherwise.
+type ImportedDocument struct {
+	SourceID   string `json:"source_id"`
+	Filename   string `json:"filename"`
+	DocumentID string `json:"document_id,omitempty"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ReencryptResult counts stored files visited by a re-encryption
+type ReencryptResult struct {
+	Reencrypted int `json:"reencrypted"`
+	Skipped     int `json:"skipped"` // already encrypted with the current key
+	Failed      int `json:"failed"`
 }
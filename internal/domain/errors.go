@@ -11,4 +11,33 @@ var (
 	ErrUnauthorized = errors.New("unauthorized")
 	// ErrRateLimited indicates rate limit exceeded
 	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrEmbeddingTimeout indicates the embedding stage of a chat timed out
+	ErrEmbeddingTimeout = errors.New("embedding timed out")
+	// ErrSearchTimeout indicates the vector search stage of a chat timed out
+	ErrSearchTimeout = errors.New("vector search timed out")
+	// ErrGenerationTimeout indicates the LLM generation stage of a chat timed out
+	ErrGenerationTimeout = errors.New("generation timed out")
+	// ErrChatTimeout indicates a chat turn ran past rag.chat_timeout
+	ErrChatTimeout = errors.New("chat timed out")
+	// ErrStreamTimeout indicates a streamed chat turn ran past rag.stream_timeout
+	ErrStreamTimeout = errors.New("stream timed out")
+	// ErrStreamCancelled indicates a streamed chat turn ended because the client went away
+	ErrStreamCancelled = errors.New("stream cancelled")
+	// ErrLLMUnavailable indicates the LLM circuit breaker is open
+	ErrLLMUnavailable = errors.New("service temporarily unavailable")
+	// ErrSourceMissing indicates a document's original upload is no longer in storage
+	ErrSourceMissing = errors.New("original file is missing from storage")
+	// ErrFetchFailed indicates a remote page could not be fetched for ingestion
+	ErrFetchFailed = errors.New("failed to fetch url")
+	// ErrFileTooLarge indicates an upload exceeds storage.max_file_size
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrDuplicate indicates an upload's content is already in its collection
+	ErrDuplicate = errors.New("duplicate document")
 )
+
+// IsTimeout reports whether err is a chat turn or one of its stages running
+// out of time, which the API answers with 504 Gateway Timeout
+func IsTimeout(err error) bool {
+	return errors.Is(err, ErrChatTimeout) || errors.Is(err, ErrEmbeddingTimeout) ||
+		errors.Is(err, ErrSearchTimeout) || errors.Is(err, ErrGenerationTimeout)
+}
@@ -0,0 +1,68 @@
+package domain
+
+import "time"
+
+// Ingest job status constants
+const (
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed" // every file failed
+)
+
+// Ingest job event types
+const (
+	JobEventStarted   = "started"
+	JobEventCompleted = "completed"
+	JobEventFailed    = "failed"
+	JobEventDone      = "done" // last event of a job
+)
+
+// IngestJob tracks the progress of one or more files being ingested together
+type IngestJob struct {
+	ID           string    `json:"id"`
+	CollectionID string    `json:"collection_id"`
+	Status       string    `json:"status"`
+	Total        int       `json:"total"`
+	Completed    int       `json:"completed"`
+	Failed       int       `json:"failed"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// JobEvent is a single progress update for an ingest job
+type JobEvent struct {
+	Seq        int       `json:"seq"`
+	JobID      string    `json:"job_id"`
+	Type       string    `json:"type"` // started, completed, failed, done
+	Filename   string    `json:"filename,omitempty"`
+	DocumentID string    `json:"document_id,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Total      int       `json:"total"`
+	Completed  int       `json:"completed"`
+	Failed     int       `json:"failed"`
+	Time       time.Time `json:"time"`
+}
+
+// IngestPreviewRequest chunks text, or the multipart "file", without
+// ingesting it. Unset sizes fall back to rag.chunk_size and rag.chunk_overlap.
+type IngestPreviewRequest struct {
+	Text         string `json:"text" form:"text"`
+	ChunkSize    *int   `json:"chunk_size" form:"chunk_size"`
+	ChunkOverlap *int   `json:"chunk_overlap" form:"chunk_overlap"`
+}
+
+// IngestPreview is how a document would be split into chunks on ingestion
+type IngestPreview struct {
+	Filename     string         `json:"filename,omitempty"`
+	ChunkSize    int            `json:"chunk_size"`
+	ChunkOverlap int            `json:"chunk_overlap"`
+	Count        int            `json:"count"`
+	Chunks       []PreviewChunk `json:"chunks"`
+}
+
+// PreviewChunk is one chunk of an ingestion preview; Length counts characters
+type PreviewChunk struct {
+	Index   int    `json:"index"`
+	Length  int    `json:"length"`
+	Content string `json:"content"`
+}
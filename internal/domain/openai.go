@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// OpenAIChatRequest is the subset of an OpenAI chat completions request that
+// AskDoc understands. Model names the site to answer from.
+type OpenAIChatRequest struct {
+	Model    string              `json:"model"`
+	Messages []OpenAIChatMessage `json:"messages" binding:"required"`
+	Stream   bool                `json:"stream,omitempty"`
+	User     string              `json:"user,omitempty"`
+}
+
+// OpenAIChatMessage is a chat message in OpenAI's format
+type OpenAIChatMessage struct {
+	Role    string        `json:"role"`
+	Content OpenAIContent `json:"content"`
+}
+
+// OpenAIContent is message content, sent either as a string or as an array
+// of parts; only text parts are kept
+type OpenAIContent string
+
+// UnmarshalJSON accepts both content forms
+func (c *OpenAIContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*c = OpenAIContent(text)
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or an array of parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	*c = OpenAIContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+// LastUserMessage returns the text of the last user message
+func (r *OpenAIChatRequest) LastUserMessage() (string, error) {
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role == "user" {
+			if text := strings.TrimSpace(string(r.Messages[i].Content)); text != "" {
+				return text, nil
+			}
+			break
+		}
+	}
+	return "", fmt.Errorf("%w: messages must include a non-empty user message", ErrInvalidRequest)
+}
+
+// OpenAIChatResponse is a chat completion, or with Object
+// "chat.completion.chunk" one event of a streamed completion. Sources and
+// SessionID are AskDoc extensions.
+type OpenAIChatResponse struct {
+	ID        string         `json:"id"`
+	Object    string         `json:"object"`
+	Created   int64          `json:"created"`
+	Model     string         `json:"model"`
+	Choices   []OpenAIChoice `json:"choices"`
+	Sources   []Source       `json:"sources,omitempty"`
+	SessionID string         `json:"session_id,omitempty"`
+}
+
+// OpenAIChoice is a completion choice; Message is set on completions and
+// Delta on stream chunks
+type OpenAIChoice struct {
+	Index        int                `json:"index"`
+	Message      *OpenAIChatMessage `json:"message,omitempty"`
+	Delta        *OpenAIChatMessage `json:"delta,omitempty"`
+	FinishReason *string            `json:"finish_reason"`
+}
+
+// OpenAIModel is an entry of the models list; each site is one model
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
@@ -1,6 +1,25 @@
 package domain
 
-import "time"
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultBlockedResponse is returned for blocked questions when a site has no custom response
+const DefaultBlockedResponse = "Sorry, I can't help with that topic."
+
+// DefaultFallbackMessage is returned when retrieval finds nothing to answer
+// from and a site has no custom fallback message
+const DefaultFallbackMessage = "No relevant documents found."
+
+// LanguageAuto answers in the language detected from each question
+const LanguageAuto = "auto"
+
+var languageCodeRe = regexp.MustCompile(`^[a-z]{2,3}$`)
 
 // Site represents a widget configuration
 type Site struct {
@@ -10,8 +29,31 @@ type Site struct {
 	CollectionIDs []string     `json:"collection_ids"`
 	WidgetConfig  WidgetConfig `json:"widget_config"`
 	RateLimit     int          `json:"rate_limit"`
-	CreatedAt     time.Time    `json:"created_at"`
-	UpdatedAt     time.Time    `json:"updated_at"`
+	// Blocklist entries are case-insensitive substrings, or regular expressions when wrapped in slashes (/.../)
+	Blocklist       []string `json:"blocklist,omitempty"`
+	BlockedResponse string   `json:"blocked_response,omitempty"`
+	// AllowedModels lists the models widget requests may select; empty allows only the default
+	AllowedModels []string `json:"allowed_models,omitempty"`
+	// FilterableKeys lists the metadata keys widget requests may filter on; empty allows none
+	FilterableKeys []string `json:"filterable_keys,omitempty"`
+	// Disclaimer is attached to every answer; {cutoff} becomes the knowledge cutoff date
+	Disclaimer string `json:"disclaimer,omitempty"`
+	// UseDefaultCollection answers from rag.default_collection while the
+	// site has no collections, or only empty ones
+	UseDefaultCollection bool `json:"use_default_collection"`
+	// PublicKey, when set, must be sent by the widget in the X-Widget-Key
+	// header; sites without one stay public
+	PublicKey string    `json:"public_key,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SiteListResponse is the response for listing sites
+type SiteListResponse struct {
+	Items    []*Site `json:"items"`
+	Total    int     `json:"total"`
+	Page     int     `json:"page"`
+	PageSize int     `json:"page_size"`
 }
 
 // WidgetConfig holds UI configuration for the widget
@@ -22,24 +64,47 @@ type WidgetConfig struct {
 	WelcomeMessage string `json:"welcome_message"`
 	Placeholder    string `json:"placeholder"`
 	ShowSources    bool   `json:"show_sources"`
+	// FallbackMessage is sent verbatim, without an LLM call, when retrieval
+	// finds nothing to answer from
+	FallbackMessage string `json:"fallback_message,omitempty"`
+	// Language pins the answer language to an ISO 639-1 code such as "de";
+	// "auto" (or empty) answers in the language of each question
+	Language string `json:"language,omitempty"`
 }
 
 // CreateSiteRequest is the request to create a site
 type CreateSiteRequest struct {
-	Name          string         `json:"name" binding:"required"`
-	Domain        string         `json:"domain" binding:"required"`
-	CollectionIDs []string       `json:"collection_ids" binding:"required"`
-	WidgetConfig  *WidgetConfig  `json:"widget_config,omitempty"`
-	RateLimit     int            `json:"rate_limit,omitempty"`
+	Name            string        `json:"name" binding:"required"`
+	Domain          string        `json:"domain" binding:"required"`
+	CollectionIDs   []string      `json:"collection_ids" binding:"required"`
+	WidgetConfig    *WidgetConfig `json:"widget_config,omitempty"`
+	RateLimit       int           `json:"rate_limit,omitempty"`
+	Blocklist       []string      `json:"blocklist,omitempty"`
+	BlockedResponse string        `json:"blocked_response,omitempty"`
+	AllowedModels   []string      `json:"allowed_models,omitempty"`
+	FilterableKeys  []string      `json:"filterable_keys,omitempty"`
+	Disclaimer      string        `json:"disclaimer,omitempty"`
+	PublicKey       string        `json:"public_key,omitempty"`
+
+	UseDefaultCollection bool `json:"use_default_collection,omitempty"`
 }
 
 // UpdateSiteRequest is the request to update a site
 type UpdateSiteRequest struct {
-	Name          string         `json:"name,omitempty"`
-	Domain        string         `json:"domain,omitempty"`
-	CollectionIDs []string       `json:"collection_ids,omitempty"`
-	WidgetConfig  *WidgetConfig  `json:"widget_config,omitempty"`
-	RateLimit     int            `json:"rate_limit,omitempty"`
+	Name            string        `json:"name,omitempty"`
+	Domain          string        `json:"domain,omitempty"`
+	CollectionIDs   []string      `json:"collection_ids,omitempty"`
+	WidgetConfig    *WidgetConfig `json:"widget_config,omitempty"`
+	RateLimit       int           `json:"rate_limit,omitempty"`
+	Blocklist       []string      `json:"blocklist,omitempty"`
+	BlockedResponse string        `json:"blocked_response,omitempty"`
+	AllowedModels   []string      `json:"allowed_models,omitempty"`
+	FilterableKeys  []string      `json:"filterable_keys,omitempty"`
+	Disclaimer      string        `json:"disclaimer,omitempty"`
+	// PublicKey replaces the site's widget key; an empty string removes it
+	PublicKey *string `json:"public_key,omitempty"`
+
+	UseDefaultCollection *bool `json:"use_default_collection,omitempty"`
 }
 
 // DefaultWidgetConfig returns default widget configuration
@@ -51,5 +116,153 @@ func DefaultWidgetConfig() WidgetConfig {
 		WelcomeMessage: "Hi! How can I help you?",
 		Placeholder:    "Ask a question...",
 		ShowSources:    true,
+		Language:       LanguageAuto,
+	}
+}
+
+// ValidateWidgetConfig checks the widget settings the server acts on
+func ValidateWidgetConfig(cfg *WidgetConfig) error {
+	if cfg == nil || cfg.Language == "" || cfg.Language == LanguageAuto {
+		return nil
+	}
+	if !languageCodeRe.MatchString(cfg.Language) {
+		return fmt.Errorf("%w: invalid language %q, want \"auto\" or a language code like \"de\"", ErrInvalidRequest, cfg.Language)
+	}
+	return nil
+}
+
+// ValidateBlocklist checks that every regular expression entry compiles
+func ValidateBlocklist(entries []string) error {
+	for _, entry := range entries {
+		if pattern, ok := blocklistPattern(entry); ok {
+			if _, err := regexp.Compile("(?i)" + pattern); err != nil {
+				return fmt.Errorf("%w: invalid blocklist pattern %q: %v", ErrInvalidRequest, entry, err)
+			}
+		}
+	}
+	return nil
+}
+
+// AcceptsWidgetKey reports whether key opens the site's widget endpoints
+func (s *Site) AcceptsWidgetKey(key string) bool {
+	if s.PublicKey == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(s.PublicKey)) == 1
+}
+
+// AllowsOrigin reports whether a browser origin (e.g. https://docs.example.com)
+// belongs to the site's domain. A domain of "*.example.com" also accepts
+// example.com and any of its subdomains, and "*" accepts every origin.
+func (s *Site) AllowsOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	d := strings.ToLower(strings.TrimSpace(s.Domain))
+	if _, rest, ok := strings.Cut(d, "://"); ok {
+		d = rest
+	}
+	d, _, _ = strings.Cut(d, "/")
+	if d == "*" {
+		return true
+	}
+
+	// Compare ports only when the domain names one
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(d, ":") {
+		host = strings.ToLower(u.Host)
+	}
+	if apex, ok := strings.CutPrefix(d, "*."); ok {
+		return host == apex || strings.HasSuffix(host, "."+apex)
+	}
+	return host == d
+}
+
+// IsBlocked reports whether a question matches any entry in the site's blocklist
+func (s *Site) IsBlocked(question string) bool {
+	lower := strings.ToLower(question)
+	for _, entry := range s.Blocklist {
+		if pattern, ok := blocklistPattern(entry); ok {
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err == nil && re.MatchString(question) {
+				return true
+			}
+			continue
+		}
+		if entry != "" && strings.Contains(lower, strings.ToLower(entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsModel reports whether widget requests for the site may select model
+func (s *Site) AllowsModel(model string) bool {
+	for _, m := range s.AllowedModels {
+		if m == model {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsFilter reports whether widget requests for the site may filter on key
+func (s *Site) AllowsFilter(key string) bool {
+	for _, k := range s.FilterableKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// BlockedAnswer returns the canned response for blocked questions
+func (s *Site) BlockedAnswer() string {
+	if s.BlockedResponse != "" {
+		return s.BlockedResponse
+	}
+	return DefaultBlockedResponse
+}
+
+// NoAnswerMessage returns the reply for questions retrieval finds nothing for
+func (s *Site) NoAnswerMessage() string {
+	if s.WidgetConfig.FallbackMessage != "" {
+		return s.WidgetConfig.FallbackMessage
+	}
+	return DefaultFallbackMessage
+}
+
+// PinnedLanguage returns the language code answers must use, or "" when the
+// site answers in the language of each question
+func (s *Site) PinnedLanguage() string {
+	if s.WidgetConfig.Language == LanguageAuto {
+		return ""
+	}
+	return s.WidgetConfig.Language
+}
+
+// blocklistPattern extracts the regular expression from a /pattern/ entry
+func blocklistPattern(entry string) (string, bool) {
+	if len(entry) >= 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+		return entry[1 : len(entry)-1], true
+	}
+	return "", false
+}
+
+// KnowledgeCutoffLayout formats knowledge cutoff dates
+const KnowledgeCutoffLayout = "2006-01-02"
+
+// DisclaimerText renders the site's disclaimer for a knowledge cutoff; a zero
+// cutoff renders as "unknown". Returns "" when the site has no disclaimer.
+func (s *Site) DisclaimerText(cutoff time.Time) string {
+	if s.Disclaimer == "" {
+		return ""
+	}
+	date := "unknown"
+	if !cutoff.IsZero() {
+		date = cutoff.Format(KnowledgeCutoffLayout)
 	}
+	return strings.ReplaceAll(s.Disclaimer, "{cutoff}", date)
 }
@@ -0,0 +1,241 @@
+// Package metrics collects AskDoc's Prometheus metrics and serves them in the
+// Prometheus text exposition format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP metrics, labelled by route pattern rather than path so IDs don't
+// multiply the series
+var (
+	HTTPRequests = newCounter("askdoc_http_requests_total",
+		"HTTP requests by method, route and status.", "method", "route", "status")
+	HTTPDuration = newHistogram("askdoc_http_request_duration_seconds",
+		"HTTP request latency by method and route.", latencyBuckets, "method", "route")
+	ActiveStreams = newGauge("askdoc_sse_streams_active",
+		"Open SSE streams by stream type.", "stream")
+)
+
+// Chat and LLM metrics
+var (
+	ChatDuration = newHistogram("askdoc_chat_duration_seconds",
+		"Time to answer a chat question, from retrieval to the last token, by mode (chat or stream).", latencyBuckets, "mode")
+	LLMDuration = newHistogram("askdoc_llm_request_duration_seconds",
+		"LLM call duration by operation (embed, generate or stream) and outcome (ok or error).", latencyBuckets, "operation", "outcome")
+)
+
+// Ingestion metrics
+var (
+	Ingestions = newCounter("askdoc_ingestions_total",
+		"Finished document ingestions by status (ready or failed).", "status")
+	IngestionsInProgress = newGauge("askdoc_ingestions_in_progress",
+		"Documents currently being ingested.")
+	IngestionsQueued = newGauge("askdoc_ingestions_queued",
+		"Documents waiting for an ingestion worker.")
+	IngestDuration = newHistogram("askdoc_ingestion_duration_seconds",
+		"Document ingestion duration by status.", ingestBuckets, "status")
+)
+
+// Stream types of ActiveStreams
+const (
+	StreamChat      = "chat"
+	StreamOpenAI    = "openai"
+	StreamIngestJob = "ingest_job"
+)
+
+var (
+	latencyBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	ingestBuckets  = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800}
+)
+
+// Outcome returns the outcome label for err
+func Outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// Counter is a counter with labels
+type Counter struct{ family *family }
+
+// Inc adds one to the series with the given label values
+func (c Counter) Inc(labels ...string) {
+	c.family.update(labels, func(s *series) { s.value++ })
+}
+
+// Gauge is a gauge with labels
+type Gauge struct{ family *family }
+
+// Inc adds one to the series with the given label values
+func (g Gauge) Inc(labels ...string) {
+	g.family.update(labels, func(s *series) { s.value++ })
+}
+
+// Dec subtracts one from the series with the given label values
+func (g Gauge) Dec(labels ...string) {
+	g.family.update(labels, func(s *series) { s.value-- })
+}
+
+// Histogram is a histogram with labels
+type Histogram struct{ family *family }
+
+// Observe records a value in the series with the given label values
+func (h Histogram) Observe(value float64, labels ...string) {
+	h.family.update(labels, func(s *series) {
+		for i, bound := range h.family.buckets {
+			if value <= bound {
+				s.counts[i]++
+			}
+		}
+		s.sum += value
+		s.count++
+	})
+}
+
+// ObserveSince records the seconds elapsed since start
+func (h Histogram) ObserveSince(start time.Time, labels ...string) {
+	h.Observe(time.Since(start).Seconds(), labels...)
+}
+
+// family is a metric and all of its labelled series
+type family struct {
+	name    string
+	help    string
+	kind    string // counter, gauge or histogram
+	labels  []string
+	buckets []float64 // histogram upper bounds, ascending
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64  // counter and gauge
+	counts []uint64 // histogram: cumulative count per bucket
+	sum    float64
+	count  uint64
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []*family
+)
+
+func register(f *family) *family {
+	f.series = make(map[string]*series)
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, f)
+	return f
+}
+
+func newCounter(name, help string, labels ...string) Counter {
+	return Counter{register(&family{name: name, help: help, kind: "counter", labels: labels})}
+}
+
+func newGauge(name, help string, labels ...string) Gauge {
+	return Gauge{register(&family{name: name, help: help, kind: "gauge", labels: labels})}
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) Histogram {
+	return Histogram{register(&family{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets})}
+}
+
+// update applies fn to the series for the label values, creating it on first
+// use. Missing label values are left empty and extra ones are dropped.
+func (f *family) update(values []string, fn func(*series)) {
+	labels := make([]string, len(f.labels))
+	copy(labels, values)
+	key := strings.Join(labels, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: labels}
+		if f.kind == "histogram" {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+// Handler serves every metric in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registryMu.Lock()
+		families := append([]*family(nil), registry...)
+		registryMu.Unlock()
+		for _, f := range families {
+			f.write(w)
+		}
+	})
+}
+
+func (f *family) write(w io.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelSet(s.labels, ""), formatFloat(s.value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelSet(s.labels, formatFloat(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelSet(s.labels, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelSet(s.labels, ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelSet(s.labels, ""), s.count)
+	}
+}
+
+// labelSet formats label values as {name="value",...}, adding le for a
+// histogram bucket
+func (f *family) labelSet(values []string, le string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, name := range f.labels {
+		pairs = append(pairs, name+"="+escapeLabel(values[i]))
+	}
+	if le != "" {
+		pairs = append(pairs, "le="+strconv.Quote(le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
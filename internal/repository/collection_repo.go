@@ -4,12 +4,16 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/liliang-cn/askdoc/internal/domain"
 )
 
+// collectionColumns is the column list shared by all collection queries (see scanCollection)
+const collectionColumns = `id, name, description, metadata, document_count, version, last_ingested_at, strip_html_boilerplate, synonyms, embed_synonyms, chunk_size, chunk_overlap, created_at, updated_at`
+
 // CollectionRepository handles collection persistence
 type CollectionRepository struct {
 	db *DB
@@ -32,24 +36,50 @@ func (r *CollectionRepository) Create(collection *domain.Collection) error {
 	metadataJSON, _ := json.Marshal(collection.Metadata)
 
 	_, err := r.db.Exec(`
-		INSERT INTO collections (id, name, description, metadata, document_count, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO collections (id, name, description, metadata, document_count, strip_html_boilerplate, synonyms, embed_synonyms,
+			chunk_size, chunk_overlap, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, collection.ID, collection.Name, collection.Description, string(metadataJSON),
-		collection.DocumentCount, collection.CreatedAt, collection.UpdatedAt)
+		collection.DocumentCount, collection.StripHTMLBoilerplate, marshalSynonyms(collection.Synonyms), collection.EmbedSynonyms,
+		collection.ChunkSize, collection.ChunkOverlap, collection.CreatedAt, collection.UpdatedAt)
 
 	return err
 }
 
-// Get retrieves a collection by ID
-func (r *CollectionRepository) Get(id string) (*domain.Collection, error) {
-	collection := &domain.Collection{}
-	var metadataJSON string
+// CreateIfNameFree creates collection unless one with the same name exists,
+// as a single statement so concurrent callers can't both create it. It
+// reports whether the collection was created.
+func (r *CollectionRepository) CreateIfNameFree(collection *domain.Collection) (bool, error) {
+	if collection.ID == "" {
+		collection.ID = uuid.New().String()
+	}
+	now := time.Now()
+	collection.CreatedAt = now
+	collection.UpdatedAt = now
 
-	err := r.db.QueryRow(`
-		SELECT id, name, description, metadata, document_count, created_at, updated_at
-		FROM collections WHERE id = ?
-	`, id).Scan(&collection.ID, &collection.Name, &collection.Description,
-		&metadataJSON, &collection.DocumentCount, &collection.CreatedAt, &collection.UpdatedAt)
+	metadataJSON, _ := json.Marshal(collection.Metadata)
+
+	result, err := r.db.Exec(`
+		INSERT INTO collections (id, name, description, metadata, document_count, strip_html_boilerplate, synonyms, embed_synonyms,
+			chunk_size, chunk_overlap, created_at, updated_at)
+		SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM collections WHERE name = ?)
+	`, collection.ID, collection.Name, collection.Description, string(metadataJSON),
+		collection.DocumentCount, collection.StripHTMLBoilerplate, marshalSynonyms(collection.Synonyms), collection.EmbedSynonyms,
+		collection.ChunkSize, collection.ChunkOverlap, collection.CreatedAt, collection.UpdatedAt, collection.Name)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// GetByName retrieves the oldest collection with the given name
+func (r *CollectionRepository) GetByName(name string) (*domain.Collection, error) {
+	collection, err := scanCollection(r.db.QueryRow(`
+		SELECT `+collectionColumns+`
+		FROM collections WHERE name = ? ORDER BY created_at, id LIMIT 1
+	`, name))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -58,41 +88,71 @@ func (r *CollectionRepository) Get(id string) (*domain.Collection, error) {
 		return nil, err
 	}
 
-	if metadataJSON != "" {
-		json.Unmarshal([]byte(metadataJSON), &collection.Metadata)
+	return collection, nil
+}
+
+// Get retrieves a collection by ID
+func (r *CollectionRepository) Get(id string) (*domain.Collection, error) {
+	collection, err := scanCollection(r.db.QueryRow(`
+		SELECT `+collectionColumns+`
+		FROM collections WHERE id = ?
+	`, id))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	return collection, nil
 }
 
-// List retrieves all collections
-func (r *CollectionRepository) List() ([]*domain.Collection, error) {
+// List retrieves a page of collections and the total number of matches. A
+// non-empty query keeps those whose name or description contains it, ignoring
+// case, ranking exact name matches first; otherwise the newest come first.
+// A limit of 0 or less lists every match.
+func (r *CollectionRepository) List(query string, limit, offset int) ([]*domain.Collection, int, error) {
+	where, order := ``, `created_at DESC`
+	var args []any
+	if query != "" {
+		pattern := containsPattern(query)
+		where = ` WHERE name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\'`
+		order = `CASE WHEN lower(name) = lower(?) THEN 0 ELSE 1 END, ` + order
+		args = append(args, pattern, pattern)
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM collections`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if query != "" {
+		args = append(args, query)
+	}
+	if limit <= 0 {
+		limit, offset = -1, 0 // SQLite treats a negative limit as none
+	}
+
 	rows, err := r.db.Query(`
-		SELECT id, name, description, metadata, document_count, created_at, updated_at
-		FROM collections ORDER BY created_at DESC
-	`)
+		SELECT `+collectionColumns+`
+		FROM collections`+where+`
+		ORDER BY `+order+` LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var collections []*domain.Collection
+	collections := []*domain.Collection{}
 	for rows.Next() {
-		collection := &domain.Collection{}
-		var metadataJSON string
-
-		if err := rows.Scan(&collection.ID, &collection.Name, &collection.Description,
-			&metadataJSON, &collection.DocumentCount, &collection.CreatedAt, &collection.UpdatedAt); err != nil {
-			return nil, err
-		}
-
-		if metadataJSON != "" {
-			json.Unmarshal([]byte(metadataJSON), &collection.Metadata)
+		collection, err := scanCollection(rows)
+		if err != nil {
+			return nil, 0, err
 		}
 		collections = append(collections, collection)
 	}
 
-	return collections, rows.Err()
+	return collections, total, rows.Err()
 }
 
 // Update updates a collection
@@ -101,9 +161,11 @@ func (r *CollectionRepository) Update(collection *domain.Collection) error {
 	metadataJSON, _ := json.Marshal(collection.Metadata)
 
 	result, err := r.db.Exec(`
-		UPDATE collections SET name = ?, description = ?, metadata = ?, updated_at = ?
+		UPDATE collections SET name = ?, description = ?, metadata = ?, strip_html_boilerplate = ?,
+			synonyms = ?, embed_synonyms = ?, chunk_size = ?, chunk_overlap = ?, updated_at = ?
 		WHERE id = ?
-	`, collection.Name, collection.Description, string(metadataJSON),
+	`, collection.Name, collection.Description, string(metadataJSON), collection.StripHTMLBoilerplate,
+		marshalSynonyms(collection.Synonyms), collection.EmbedSynonyms, collection.ChunkSize, collection.ChunkOverlap,
 		collection.UpdatedAt, collection.ID)
 
 	if err != nil {
@@ -141,3 +203,102 @@ func (r *CollectionRepository) UpdateDocumentCount(id string, delta int) error {
 	`, delta, time.Now(), id)
 	return err
 }
+
+// BumpVersion increments a collection's version stamp after its content changes
+func (r *CollectionRepository) BumpVersion(id string) error {
+	_, err := r.db.Exec(`UPDATE collections SET version = version + 1 WHERE id = ?`, id)
+	return err
+}
+
+// SetLastIngested records when a document was last ingested into a collection
+func (r *CollectionRepository) SetLastIngested(id string, at time.Time) error {
+	_, err := r.db.Exec(`UPDATE collections SET last_ingested_at = ? WHERE id = ?`, at, id)
+	return err
+}
+
+// LastIngested returns the most recent ingest time across the given
+// collections, or the zero time if none has ingested anything
+func (r *CollectionRepository) LastIngested(ids []string) (time.Time, error) {
+	var latest time.Time
+	for _, id := range ids {
+		var at sql.NullTime
+		err := r.db.QueryRow(`SELECT last_ingested_at FROM collections WHERE id = ?`, id).Scan(&at)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if at.Valid && at.Time.After(latest) {
+			latest = at.Time
+		}
+	}
+	return latest, nil
+}
+
+// Versions returns the current version stamp of each given collection.
+// Unknown collections are omitted.
+func (r *CollectionRepository) Versions(ids []string) (map[string]int64, error) {
+	versions := make(map[string]int64, len(ids))
+	if len(ids) == 0 {
+		return versions, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := r.db.Query(`SELECT id, version FROM collections WHERE id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var version int64
+		if err := rows.Scan(&id, &version); err != nil {
+			return nil, err
+		}
+		versions[id] = version
+	}
+	return versions, rows.Err()
+}
+
+// scanCollection reads a collection selected with collectionColumns
+func scanCollection(row rowScanner) (*domain.Collection, error) {
+	collection := &domain.Collection{}
+	var description, metadataJSON, synonymsJSON sql.NullString
+	var lastIngestedAt sql.NullTime
+
+	if err := row.Scan(&collection.ID, &collection.Name, &description, &metadataJSON,
+		&collection.DocumentCount, &collection.Version, &lastIngestedAt, &collection.StripHTMLBoilerplate,
+		&synonymsJSON, &collection.EmbedSynonyms, &collection.ChunkSize, &collection.ChunkOverlap,
+		&collection.CreatedAt, &collection.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	collection.Description = description.String
+	if lastIngestedAt.Valid {
+		collection.LastIngestedAt = &lastIngestedAt.Time
+	}
+	if metadataJSON.Valid && metadataJSON.String != "" {
+		json.Unmarshal([]byte(metadataJSON.String), &collection.Metadata)
+	}
+	if synonymsJSON.Valid && synonymsJSON.String != "" {
+		json.Unmarshal([]byte(synonymsJSON.String), &collection.Synonyms)
+	}
+
+	return collection, nil
+}
+
+// marshalSynonyms stores an empty synonym map as NULL
+func marshalSynonyms(synonyms map[string][]string) any {
+	if len(synonyms) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(synonyms)
+	return string(data)
+}
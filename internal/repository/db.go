@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	_ "modernc.org/sqlite"
 )
@@ -22,14 +23,15 @@ func NewDB(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	// Pragmas in the DSN apply to every pooled connection: foreign keys, and a
+	// busy timeout so concurrent requests wait for the write lock instead of
+	// failing with SQLITE_BUSY
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-
-	// Enable foreign keys
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Run migrations
@@ -41,8 +43,9 @@ func NewDB(dbPath string) (*DB, error) {
 }
 
 func runMigrations(db *sql.DB) error {
-	// Note: documents are now stored in rago's DocumentStore (sqvect)
-	// This DB only stores business metadata: collections, sites, sessions
+	// Note: documents are stored in rago's DocumentStore (sqvect); this DB
+	// stores business metadata (collections, sites, sessions) and a record of
+	// each document's ingestion status
 	migrations := []string{
 		`CREATE TABLE IF NOT EXISTS collections (
 			id TEXT PRIMARY KEY,
@@ -81,6 +84,49 @@ func runMigrations(db *sql.DB) error {
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_messages_session ON messages(session_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_sessions_site ON sessions(site_id)`,
+		`CREATE TABLE IF NOT EXISTS unanswered_questions (
+			id TEXT PRIMARY KEY,
+			site_id TEXT NOT NULL,
+			session_id TEXT,
+			question TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			top_score REAL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (site_id) REFERENCES sites(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_unanswered_site ON unanswered_questions(site_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS feedback (
+			id TEXT PRIMARY KEY,
+			site_id TEXT NOT NULL,
+			session_id TEXT NOT NULL,
+			message_id TEXT NOT NULL UNIQUE,
+			rating TEXT NOT NULL,
+			comment TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (site_id) REFERENCES sites(id) ON DELETE CASCADE,
+			FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_feedback_site ON feedback(site_id, created_at)`,
+		`CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS documents (
+			id TEXT PRIMARY KEY,
+			collection_id TEXT NOT NULL,
+			filename TEXT NOT NULL,
+			status TEXT NOT NULL,
+			error TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_collection ON documents(collection_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_status ON documents(status, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_created ON documents(created_at, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_messages_created ON messages(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_created ON sessions(created_at)`,
 	}
 
 	for _, m := range migrations {
@@ -89,5 +135,90 @@ func runMigrations(db *sql.DB) error {
 		}
 	}
 
+	// Columns added after the initial schema; applied only when missing
+	columns := []struct {
+		table, column, definition string
+	}{
+		{"sessions", "summary", "TEXT"},
+		{"sessions", "summarized_count", "INTEGER DEFAULT 0"},
+		{"sites", "blocklist", "TEXT"},
+		{"sites", "blocked_response", "TEXT"},
+		{"sessions", "external_user_id", "TEXT"},
+		{"sessions", "metadata", "TEXT"},
+		{"collections", "version", "INTEGER NOT NULL DEFAULT 0"},
+		{"sites", "allowed_models", "TEXT"},
+		{"collections", "last_ingested_at", "DATETIME"},
+		{"sites", "disclaimer", "TEXT"},
+		{"collections", "strip_html_boilerplate", "INTEGER NOT NULL DEFAULT 0"},
+		{"collections", "synonyms", "TEXT"},
+		{"collections", "embed_synonyms", "INTEGER NOT NULL DEFAULT 0"},
+		{"sites", "use_default_collection", "INTEGER NOT NULL DEFAULT 0"},
+		{"sites", "filterable_keys", "TEXT"},
+		{"sites", "public_key", "TEXT"},
+		{"messages", "language", "TEXT"},
+		{"documents", "deleted_at", "DATETIME"},
+		{"documents", "content_hash", "TEXT"},
+		{"documents", "tags", "TEXT"},
+		{"collections", "chunk_size", "INTEGER"},
+		{"collections", "chunk_overlap", "INTEGER"},
+	}
+
+	for _, c := range columns {
+		if err := ensureColumn(db, c.table, c.column, c.definition); err != nil {
+			return fmt.Errorf("migration failed: %w", err)
+		}
+	}
+
+	// Indexes on added columns
+	indexes := []string{
+		`CREATE INDEX IF NOT EXISTS idx_sessions_external_user ON sessions(external_user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_hash ON documents(collection_id, content_hash)`,
+	}
+	for _, idx := range indexes {
+		if _, err := db.Exec(idx); err != nil {
+			return fmt.Errorf("migration failed: %w\nSQL: %s", err, idx)
+		}
+	}
+
 	return nil
 }
+
+// ensureColumn adds a column to an existing table if it isn't there yet
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern returns a LIKE pattern (used with ESCAPE '\') matching
+// text that contains q literally
+func containsPattern(q string) string {
+	return "%" + likeEscaper.Replace(q) + "%"
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// documentColumns is the column list shared by all document queries (see scanDocument)
+const documentColumns = `id, collection_id, filename, status, error, tags, created_at, updated_at`
+
+// DocumentRepository keeps a record of every uploaded document and its
+// ingestion status. Chunks and full metadata live in rago; this record
+// survives ingestion failures that leave nothing in rago.
+type DocumentRepository struct {
+	db *DB
+}
+
+// NewDocumentRepository creates a new document repository
+func NewDocumentRepository(db *DB) *DocumentRepository {
+	return &DocumentRepository{db: db}
+}
+
+// Save creates or replaces the record of a document
+func (r *DocumentRepository) Save(doc *domain.Document) error {
+	now := time.Now()
+	if doc.CreatedAt.IsZero() {
+		doc.CreatedAt = now
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO documents (id, collection_id, filename, status, error, tags, content_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			collection_id = excluded.collection_id,
+			filename = excluded.filename,
+			status = excluded.status,
+			error = excluded.error,
+			tags = excluded.tags,
+			content_hash = COALESCE(excluded.content_hash, documents.content_hash),
+			updated_at = excluded.updated_at
+	`, doc.ID, doc.CollectionID, doc.Filename, doc.Status, doc.Error, nullString(strings.Join(doc.Tags, ",")),
+		doc.ContentHash, doc.CreatedAt, now)
+	return err
+}
+
+// SetStatus records a document's ingestion status and error. Documents
+// without a record are left alone.
+func (r *DocumentRepository) SetStatus(id, status, errMsg string) error {
+	_, err := r.db.Exec(`
+		UPDATE documents SET status = ?, error = ?, updated_at = ? WHERE id = ?
+	`, status, errMsg, time.Now(), id)
+	return err
+}
+
+// SetTags records the tags of a document
+func (r *DocumentRepository) SetTags(id string, tags []string) error {
+	_, err := r.db.Exec(`
+		UPDATE documents SET tags = ?, updated_at = ? WHERE id = ?
+	`, nullString(strings.Join(tags, ",")), time.Now(), id)
+	return err
+}
+
+// SetCollection records that a document moved to another collection
+func (r *DocumentRepository) SetCollection(id, collectionID string) error {
+	_, err := r.db.Exec(`
+		UPDATE documents SET collection_id = ?, updated_at = ? WHERE id = ?
+	`, collectionID, time.Now(), id)
+	return err
+}
+
+// MoveCollection reassigns every document of one collection to another
+func (r *DocumentRepository) MoveCollection(sourceID, targetID string) error {
+	_, err := r.db.Exec(`
+		UPDATE documents SET collection_id = ?, updated_at = ? WHERE collection_id = ?
+	`, targetID, time.Now(), sourceID)
+	return err
+}
+
+// SetDeletedAt records that a document was moved to the trash, or restored
+// from it when deletedAt is nil
+func (r *DocumentRepository) SetDeletedAt(id string, deletedAt *time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE documents SET deleted_at = ?, updated_at = ? WHERE id = ?
+	`, deletedAt, time.Now(), id)
+	return err
+}
+
+// Backfill records documents stored before they were all recorded here,
+// with their tags, content hash and trash state, and fills in the tags of
+// records written before tags were. Documents whose collection is gone are
+// skipped. It returns how many records it added or completed.
+func (r *DocumentRepository) Backfill(docs []*domain.Document) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO documents (id, collection_id, filename, status, error, tags, content_hash, deleted_at, created_at, updated_at)
+		SELECT ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?
+		WHERE EXISTS (SELECT 1 FROM collections WHERE id = ?)
+		ON CONFLICT(id) DO UPDATE SET tags = excluded.tags
+			WHERE documents.tags IS NULL AND excluded.tags IS NOT NULL
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	added := 0
+	for _, doc := range docs {
+		res, err := stmt.Exec(doc.ID, doc.CollectionID, doc.Filename, doc.Status, doc.Error,
+			nullString(strings.Join(doc.Tags, ",")), doc.ContentHash, doc.DeletedAt, doc.CreatedAt, now, doc.CollectionID)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := res.RowsAffected()
+		added += int(n)
+	}
+	return added, tx.Commit()
+}
+
+// Delete deletes the record of a document
+func (r *DocumentRepository) Delete(id string) error {
+	_, err := r.db.Exec(`DELETE FROM documents WHERE id = ?`, id)
+	return err
+}
+
+// Get retrieves the record of a document, or nil if it has none
+func (r *DocumentRepository) Get(id string) (*domain.Document, error) {
+	doc, err := scanDocument(r.db.QueryRow(`
+		SELECT `+documentColumns+`
+		FROM documents WHERE id = ?
+	`, id))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// FindByHash returns the oldest document of a collection with the given
+// content hash, or nil if there is none. Failed uploads and documents in the
+// trash don't count.
+func (r *DocumentRepository) FindByHash(collectionID, hash string) (*domain.Document, error) {
+	doc, err := scanDocument(r.db.QueryRow(`
+		SELECT `+documentColumns+`
+		FROM documents
+		WHERE collection_id = ? AND content_hash = ? AND status != ? AND deleted_at IS NULL
+		ORDER BY created_at LIMIT 1
+	`, collectionID, hash, domain.DocumentStatusFailed))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// List retrieves the records of a collection's documents, or of every
+// document when collectionID is empty, newest first. Documents in the trash
+// are left out.
+func (r *DocumentRepository) List(collectionID string) ([]*domain.Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE deleted_at IS NULL`
+	var args []any
+	if collectionID != "" {
+		query += ` AND collection_id = ?`
+		args = append(args, collectionID)
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []*domain.Document
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// DocumentQuery selects a page of document records, newest first unless
+// Ascending. A page continues after the record with ID After when it is set,
+// and skips Offset records otherwise.
+type DocumentQuery struct {
+	CollectionID string // empty for all collections
+	Status       string
+	Tag          string
+	Ascending    bool
+	After        string
+	Offset       int
+	Limit        int
+}
+
+// Page returns a page of the records matching q, leaving out those in the
+// trash, and how many match in all. An After record that no longer exists
+// yields ErrInvalidRequest.
+func (r *DocumentRepository) Page(q DocumentQuery) ([]*domain.Document, int, error) {
+	where := ` WHERE deleted_at IS NULL`
+	var args []any
+	if q.CollectionID != "" {
+		where += ` AND collection_id = ?`
+		args = append(args, q.CollectionID)
+	}
+	if q.Status != "" {
+		where += ` AND status = ?`
+		args = append(args, q.Status)
+	}
+	if q.Tag != "" {
+		where += ` AND instr(',' || COALESCE(tags, '') || ',', ?) > 0`
+		args = append(args, ","+strings.ToLower(strings.TrimSpace(q.Tag))+",")
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM documents`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order, before := `created_at DESC, id DESC`, `<`
+	if q.Ascending {
+		order, before = `created_at, id`, `>`
+	}
+	offset := q.Offset
+	if q.After != "" {
+		var exists bool
+		if err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM documents WHERE id = ?)`, q.After).Scan(&exists); err != nil {
+			return nil, 0, err
+		}
+		if !exists {
+			return nil, 0, fmt.Errorf("%w: cursor %s no longer exists", domain.ErrInvalidRequest, q.After)
+		}
+		where += ` AND (created_at, id) ` + before + ` (SELECT created_at, id FROM documents WHERE id = ?)`
+		args = append(args, q.After)
+		offset = 0
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit, offset = -1, 0 // SQLite treats a negative limit as none
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+documentColumns+`
+		FROM documents`+where+`
+		ORDER BY `+order+` LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	docs := []*domain.Document{}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, total, rows.Err()
+}
+
+// scanDocument reads a row selected with documentColumns
+func scanDocument(row rowScanner) (*domain.Document, error) {
+	var doc domain.Document
+	var errMsg, tags sql.NullString
+	if err := row.Scan(&doc.ID, &doc.CollectionID, &doc.Filename, &doc.Status, &errMsg,
+		&tags, &doc.CreatedAt, &doc.UpdatedAt); err != nil {
+		return nil, err
+	}
+	doc.Error = errMsg.String
+	if tags.String != "" {
+		doc.Tags = strings.Split(tags.String, ",")
+	}
+	return &doc, nil
+}
@@ -3,12 +3,17 @@ package repository
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/liliang-cn/askdoc/internal/domain"
 )
 
+// sessionColumns is the column list shared by all session queries (see scanSession)
+const sessionColumns = `id, site_id, summary, summarized_count, external_user_id, metadata,
+	created_at, updated_at`
+
 // SessionRepository handles session persistence
 type SessionRepository struct {
 	db *DB
@@ -29,22 +34,20 @@ func (r *SessionRepository) Create(session *domain.Session) error {
 	session.UpdatedAt = now
 
 	_, err := r.db.Exec(`
-		INSERT INTO sessions (id, site_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?)
-	`, session.ID, session.SiteID, session.CreatedAt, session.UpdatedAt)
+		INSERT INTO sessions (id, site_id, external_user_id, metadata, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, session.ID, session.SiteID, nullString(session.ExternalUserID),
+		marshalMetadata(session.Metadata), session.CreatedAt, session.UpdatedAt)
 
 	return err
 }
 
 // Get retrieves a session by ID
 func (r *SessionRepository) Get(id string) (*domain.Session, error) {
-	session := &domain.Session{}
-	var siteID sql.NullString
-
-	err := r.db.QueryRow(`
-		SELECT id, site_id, created_at, updated_at
+	session, err := scanSession(r.db.QueryRow(`
+		SELECT `+sessionColumns+`
 		FROM sessions WHERE id = ?
-	`, id).Scan(&session.ID, &siteID, &session.CreatedAt, &session.UpdatedAt)
+	`, id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -53,11 +56,93 @@ func (r *SessionRepository) Get(id string) (*domain.Session, error) {
 		return nil, err
 	}
 
-	if siteID.Valid {
+	return session, nil
+}
+
+// List retrieves sessions, newest first, optionally filtered by site and
+// external user, and returns the total number of matches
+func (r *SessionRepository) List(siteID, externalUserID string, limit, offset int) ([]*domain.Session, int, error) {
+	where := ` WHERE 1 = 1`
+	var args []any
+	if siteID != "" {
+		where += ` AND site_id = ?`
+		args = append(args, siteID)
+	}
+	if externalUserID != "" {
+		where += ` AND external_user_id = ?`
+		args = append(args, externalUserID)
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM sessions`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+sessionColumns+`
+		FROM sessions`+where+`
+		ORDER BY updated_at DESC LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	sessions := []*domain.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, total, rows.Err()
+}
+
+// ListActive retrieves sessions updated at or after since, most recent first,
+// with their site name and message stats, and returns the total number active
+func (r *SessionRepository) ListActive(since time.Time, limit, offset int) ([]*domain.ActiveSession, int, error) {
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM sessions WHERE updated_at >= ?`, since).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT s.id, s.site_id, si.name, s.external_user_id, s.updated_at,
+			(SELECT COUNT(*) FROM messages WHERE session_id = s.id), lm.created_at
+		FROM sessions s
+		LEFT JOIN sites si ON si.id = s.site_id
+		LEFT JOIN messages lm ON lm.id = (
+			SELECT id FROM messages WHERE session_id = s.id ORDER BY created_at DESC LIMIT 1
+		)
+		WHERE s.updated_at >= ?
+		ORDER BY s.updated_at DESC LIMIT ? OFFSET ?
+	`, since, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	sessions := []*domain.ActiveSession{}
+	for rows.Next() {
+		session := &domain.ActiveSession{}
+		var siteID, siteName, externalUserID sql.NullString
+		var lastMessageAt sql.NullTime
+		if err := rows.Scan(&session.ID, &siteID, &siteName, &externalUserID, &session.UpdatedAt,
+			&session.MessageCount, &lastMessageAt); err != nil {
+			return nil, 0, err
+		}
 		session.SiteID = siteID.String
+		session.SiteName = siteName.String
+		session.ExternalUserID = externalUserID.String
+		if lastMessageAt.Valid {
+			session.LastMessageAt = &lastMessageAt.Time
+		}
+		sessions = append(sessions, session)
 	}
 
-	return session, nil
+	return sessions, total, rows.Err()
 }
 
 // Update updates a session's updated_at timestamp
@@ -66,6 +151,24 @@ func (r *SessionRepository) Update(id string) error {
 	return err
 }
 
+// UpdateSummary stores the running conversation summary for a session
+func (r *SessionRepository) UpdateSummary(id, summary string, summarizedCount int) error {
+	_, err := r.db.Exec(`
+		UPDATE sessions SET summary = ?, summarized_count = ?, updated_at = ?
+		WHERE id = ?
+	`, summary, summarizedCount, time.Now(), id)
+	return err
+}
+
+// UpdateLink stores the host application's user ID and metadata for a session
+func (r *SessionRepository) UpdateLink(id, externalUserID string, metadata map[string]any) error {
+	_, err := r.db.Exec(`
+		UPDATE sessions SET external_user_id = ?, metadata = ?, updated_at = ?
+		WHERE id = ?
+	`, nullString(externalUserID), marshalMetadata(metadata), time.Now(), id)
+	return err
+}
+
 // CreateMessage creates a new message
 func (r *SessionRepository) CreateMessage(message *domain.Message) error {
 	if message.ID == "" {
@@ -76,18 +179,146 @@ func (r *SessionRepository) CreateMessage(message *domain.Message) error {
 	sourcesJSON, _ := json.Marshal(message.Sources)
 
 	_, err := r.db.Exec(`
-		INSERT INTO messages (id, session_id, role, content, sources, created_at)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO messages (id, session_id, role, content, sources, language, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`, message.ID, message.SessionID, message.Role, message.Content,
-		string(sourcesJSON), message.CreatedAt)
+		string(sourcesJSON), nullString(message.Language), message.CreatedAt)
 
 	return err
 }
 
+// CreateUnanswered records a question the assistant could not answer well
+func (r *SessionRepository) CreateUnanswered(q *domain.UnansweredQuestion) error {
+	if q.ID == "" {
+		q.ID = uuid.New().String()
+	}
+	q.CreatedAt = time.Now()
+
+	_, err := r.db.Exec(`
+		INSERT INTO unanswered_questions (id, site_id, session_id, question, reason, top_score, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, q.ID, q.SiteID, nullString(q.SessionID), q.Question, q.Reason, q.TopScore, q.CreatedAt)
+	return err
+}
+
+// ListUnanswered returns the most recent unanswered questions, newest first;
+// an empty siteID lists all sites
+func (r *SessionRepository) ListUnanswered(siteID string, limit int) ([]*domain.UnansweredQuestion, error) {
+	query := `SELECT id, site_id, session_id, question, reason, top_score, created_at FROM unanswered_questions`
+	var args []any
+	if siteID != "" {
+		query += ` WHERE site_id = ?`
+		args = append(args, siteID)
+	}
+	query += ` ORDER BY created_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []*domain.UnansweredQuestion
+	for rows.Next() {
+		q := &domain.UnansweredQuestion{}
+		var sessionID sql.NullString
+		if err := rows.Scan(&q.ID, &q.SiteID, &sessionID, &q.Question, &q.Reason, &q.TopScore, &q.CreatedAt); err != nil {
+			return nil, err
+		}
+		q.SessionID = sessionID.String
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+// GetMessage retrieves a single message, or nil when it doesn't exist
+func (r *SessionRepository) GetMessage(id string) (*domain.Message, error) {
+	message := &domain.Message{}
+	var sourcesJSON, language sql.NullString
+	err := r.db.QueryRow(`
+		SELECT id, session_id, role, content, sources, language, created_at
+		FROM messages WHERE id = ?
+	`, id).Scan(&message.ID, &message.SessionID, &message.Role,
+		&message.Content, &sourcesJSON, &language, &message.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	message.Language = language.String
+	if sourcesJSON.Valid && sourcesJSON.String != "" {
+		json.Unmarshal([]byte(sourcesJSON.String), &message.Sources)
+	}
+	return message, nil
+}
+
+// SaveFeedback stores a rating for a message. Rating the same message again
+// replaces the earlier rating and comment.
+func (r *SessionRepository) SaveFeedback(f *domain.Feedback) error {
+	if f.ID == "" {
+		f.ID = uuid.New().String()
+	}
+	f.CreatedAt = time.Now()
+
+	return r.db.QueryRow(`
+		INSERT INTO feedback (id, site_id, session_id, message_id, rating, comment, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(message_id) DO UPDATE SET rating = excluded.rating,
+			comment = excluded.comment, created_at = excluded.created_at
+		RETURNING id
+	`, f.ID, f.SiteID, f.SessionID, f.MessageID, f.Rating, nullString(f.Comment), f.CreatedAt).Scan(&f.ID)
+}
+
+// ListFeedback retrieves feedback, newest first, optionally filtered by site
+// and rating, and returns the total number of matches
+func (r *SessionRepository) ListFeedback(siteID, rating string, limit, offset int) ([]*domain.Feedback, int, error) {
+	where := ` WHERE 1 = 1`
+	var args []any
+	if siteID != "" {
+		where += ` AND site_id = ?`
+		args = append(args, siteID)
+	}
+	if rating != "" {
+		where += ` AND rating = ?`
+		args = append(args, rating)
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM feedback`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT id, site_id, session_id, message_id, rating, comment, created_at
+		FROM feedback`+where+`
+		ORDER BY created_at DESC LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	feedback := []*domain.Feedback{}
+	for rows.Next() {
+		f := &domain.Feedback{}
+		var comment sql.NullString
+		if err := rows.Scan(&f.ID, &f.SiteID, &f.SessionID, &f.MessageID, &f.Rating, &comment, &f.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		f.Comment = comment.String
+		feedback = append(feedback, f)
+	}
+
+	return feedback, total, rows.Err()
+}
+
 // GetMessages retrieves all messages for a session
 func (r *SessionRepository) GetMessages(sessionID string) ([]*domain.Message, error) {
 	rows, err := r.db.Query(`
-		SELECT id, session_id, role, content, sources, created_at
+		SELECT id, session_id, role, content, sources, language, created_at
 		FROM messages WHERE session_id = ?
 		ORDER BY created_at ASC
 	`, sessionID)
@@ -99,12 +330,13 @@ func (r *SessionRepository) GetMessages(sessionID string) ([]*domain.Message, er
 	var messages []*domain.Message
 	for rows.Next() {
 		message := &domain.Message{}
-		var sourcesJSON sql.NullString
+		var sourcesJSON, language sql.NullString
 
 		if err := rows.Scan(&message.ID, &message.SessionID, &message.Role,
-			&message.Content, &sourcesJSON, &message.CreatedAt); err != nil {
+			&message.Content, &sourcesJSON, &language, &message.CreatedAt); err != nil {
 			return nil, err
 		}
+		message.Language = language.String
 
 		if sourcesJSON.Valid && sourcesJSON.String != "" {
 			json.Unmarshal([]byte(sourcesJSON.String), &message.Sources)
@@ -121,3 +353,129 @@ func (r *SessionRepository) CountChats() (int, error) {
 	err := r.db.QueryRow(`SELECT COUNT(*) FROM messages WHERE role = 'user'`).Scan(&count)
 	return count, err
 }
+
+// ListQuestions retrieves up to limit user messages sent in [from, to), newest
+// first; an empty siteID lists all sites
+func (r *SessionRepository) ListQuestions(siteID string, from, to time.Time, limit int) ([]*domain.AskedQuestion, error) {
+	query := `
+		SELECT m.content, s.site_id, m.created_at
+		FROM messages m JOIN sessions s ON s.id = m.session_id
+		WHERE m.role = 'user' AND m.created_at >= ? AND m.created_at < ?`
+	args := []any{from, to}
+	if siteID != "" {
+		query += ` AND s.site_id = ?`
+		args = append(args, siteID)
+	}
+	query += ` ORDER BY m.created_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []*domain.AskedQuestion
+	for rows.Next() {
+		q := &domain.AskedQuestion{}
+		var site sql.NullString
+		if err := rows.Scan(&q.Question, &site, &q.CreatedAt); err != nil {
+			return nil, err
+		}
+		q.SiteID = site.String
+		questions = append(questions, q)
+	}
+	return questions, rows.Err()
+}
+
+// activityBuckets are the SQL expressions bucketing a created_at column by
+// granularity. Timestamps are stored as text starting with the local date;
+// weeks are keyed by their Monday.
+var activityBuckets = map[string]string{
+	domain.GranularityDay:   `substr(%s, 1, 10)`,
+	domain.GranularityWeek:  `date(substr(%s, 1, 10), '-6 days', 'weekday 1')`,
+	domain.GranularityMonth: `substr(%s, 1, 7)`,
+}
+
+// ChatActivity counts the user messages sent and the sessions started per
+// time bucket and site in [from, to), ordered by bucket
+func (r *SessionRepository) ChatActivity(from, to time.Time, granularity string) ([]*domain.ActivityCount, error) {
+	bucket, ok := activityBuckets[granularity]
+	if !ok {
+		return nil, fmt.Errorf("unknown granularity %q", granularity)
+	}
+
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT a.bucket, a.site_id, si.name, SUM(a.messages), SUM(a.sessions)
+		FROM (
+			SELECT %s AS bucket, s.site_id, COUNT(*) AS messages, 0 AS sessions
+			FROM messages m JOIN sessions s ON s.id = m.session_id
+			WHERE m.role = 'user' AND m.created_at >= ? AND m.created_at < ?
+			GROUP BY bucket, s.site_id
+			UNION ALL
+			SELECT %s AS bucket, site_id, 0, COUNT(*)
+			FROM sessions
+			WHERE created_at >= ? AND created_at < ?
+			GROUP BY bucket, site_id
+		) a
+		LEFT JOIN sites si ON si.id = a.site_id
+		GROUP BY a.bucket, a.site_id
+		ORDER BY a.bucket
+	`, fmt.Sprintf(bucket, "m.created_at"), fmt.Sprintf(bucket, "created_at")), from, to, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []*domain.ActivityCount
+	for rows.Next() {
+		c := &domain.ActivityCount{}
+		var siteID, siteName sql.NullString
+		if err := rows.Scan(&c.Bucket, &siteID, &siteName, &c.Messages, &c.Sessions); err != nil {
+			return nil, err
+		}
+		c.SiteID = siteID.String
+		c.SiteName = siteName.String
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// scanSession reads a session selected with sessionColumns
+func scanSession(row rowScanner) (*domain.Session, error) {
+	session := &domain.Session{}
+	var siteID, summary, externalUserID, metadataJSON sql.NullString
+	var summarizedCount sql.NullInt64
+
+	if err := row.Scan(&session.ID, &siteID, &summary, &summarizedCount,
+		&externalUserID, &metadataJSON, &session.CreatedAt, &session.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	session.SiteID = siteID.String
+	session.Summary = summary.String
+	session.SummarizedCount = int(summarizedCount.Int64)
+	session.ExternalUserID = externalUserID.String
+	if metadataJSON.Valid && metadataJSON.String != "" {
+		json.Unmarshal([]byte(metadataJSON.String), &session.Metadata)
+	}
+
+	return session, nil
+}
+
+// marshalMetadata encodes a metadata map for storage, keeping NULL for empty maps
+func marshalMetadata(metadata map[string]any) any {
+	if len(metadata) == 0 {
+		return nil
+	}
+	data, _ := json.Marshal(metadata)
+	return string(data)
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SettingsRepository stores runtime settings that override the config file
+type SettingsRepository struct {
+	db *DB
+}
+
+// NewSettingsRepository creates a new settings repository
+func NewSettingsRepository(db *DB) *SettingsRepository {
+	return &SettingsRepository{db: db}
+}
+
+// Get returns a setting's value and whether it is set
+func (r *SettingsRepository) Get(key string) (string, bool, error) {
+	var value string
+	err := r.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// Set creates or replaces a setting
+func (r *SettingsRepository) Set(key, value string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at
+	`, key, value, time.Now())
+	return err
+}
+
+// Delete removes a setting; deleting an unset key is not an error
+func (r *SettingsRepository) Delete(key string) error {
+	_, err := r.db.Exec(`DELETE FROM settings WHERE key = ?`, key)
+	return err
+}
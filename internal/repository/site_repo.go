@@ -10,6 +10,11 @@ import (
 	"github.com/liliang-cn/askdoc/internal/domain"
 )
 
+// siteColumns is the column list shared by all site queries (see scanSite)
+const siteColumns = `id, name, domain, collection_ids, widget_config, rate_limit,
+	blocklist, blocked_response, allowed_models, disclaimer, use_default_collection, filterable_keys,
+	public_key, created_at, updated_at`
+
 // SiteRepository handles site persistence
 type SiteRepository struct {
 	db *DB
@@ -31,26 +36,28 @@ func (r *SiteRepository) Create(site *domain.Site) error {
 
 	collectionIDsJSON, _ := json.Marshal(site.CollectionIDs)
 	widgetConfigJSON, _ := json.Marshal(site.WidgetConfig)
+	blocklistJSON, _ := json.Marshal(site.Blocklist)
+	allowedModelsJSON, _ := json.Marshal(site.AllowedModels)
+	filterableKeysJSON, _ := json.Marshal(site.FilterableKeys)
 
 	_, err := r.db.Exec(`
-		INSERT INTO sites (id, name, domain, collection_ids, widget_config, rate_limit, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO sites (`+siteColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`, site.ID, site.Name, site.Domain, string(collectionIDsJSON),
-		string(widgetConfigJSON), site.RateLimit, site.CreatedAt, site.UpdatedAt)
+		string(widgetConfigJSON), site.RateLimit, string(blocklistJSON),
+		site.BlockedResponse, string(allowedModelsJSON), site.Disclaimer,
+		site.UseDefaultCollection, string(filterableKeysJSON), site.PublicKey,
+		site.CreatedAt, site.UpdatedAt)
 
 	return err
 }
 
 // Get retrieves a site by ID
 func (r *SiteRepository) Get(id string) (*domain.Site, error) {
-	site := &domain.Site{}
-	var collectionIDsJSON, widgetConfigJSON string
-
-	err := r.db.QueryRow(`
-		SELECT id, name, domain, collection_ids, widget_config, rate_limit, created_at, updated_at
+	site, err := scanSite(r.db.QueryRow(`
+		SELECT `+siteColumns+`
 		FROM sites WHERE id = ?
-	`, id).Scan(&site.ID, &site.Name, &site.Domain, &collectionIDsJSON,
-		&widgetConfigJSON, &site.RateLimit, &site.CreatedAt, &site.UpdatedAt)
+	`, id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -59,39 +66,54 @@ func (r *SiteRepository) Get(id string) (*domain.Site, error) {
 		return nil, err
 	}
 
-	json.Unmarshal([]byte(collectionIDsJSON), &site.CollectionIDs)
-	json.Unmarshal([]byte(widgetConfigJSON), &site.WidgetConfig)
-
 	return site, nil
 }
 
-// List retrieves all sites
-func (r *SiteRepository) List() ([]*domain.Site, error) {
+// List retrieves a page of sites and the total number of matches. A
+// non-empty query keeps those whose name or domain contains it, ignoring
+// case, ranking exact name matches first; otherwise the newest come first.
+// A limit of 0 or less lists every match.
+func (r *SiteRepository) List(query string, limit, offset int) ([]*domain.Site, int, error) {
+	where, order := ``, `created_at DESC`
+	var args []any
+	if query != "" {
+		pattern := containsPattern(query)
+		where = ` WHERE name LIKE ? ESCAPE '\' OR domain LIKE ? ESCAPE '\'`
+		order = `CASE WHEN lower(name) = lower(?) THEN 0 ELSE 1 END, ` + order
+		args = append(args, pattern, pattern)
+	}
+
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM sites`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if query != "" {
+		args = append(args, query)
+	}
+	if limit <= 0 {
+		limit, offset = -1, 0 // SQLite treats a negative limit as none
+	}
+
 	rows, err := r.db.Query(`
-		SELECT id, name, domain, collection_ids, widget_config, rate_limit, created_at, updated_at
-		FROM sites ORDER BY created_at DESC
-	`)
+		SELECT `+siteColumns+`
+		FROM sites`+where+`
+		ORDER BY `+order+` LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var sites []*domain.Site
+	sites := []*domain.Site{}
 	for rows.Next() {
-		site := &domain.Site{}
-		var collectionIDsJSON, widgetConfigJSON string
-
-		if err := rows.Scan(&site.ID, &site.Name, &site.Domain, &collectionIDsJSON,
-			&widgetConfigJSON, &site.RateLimit, &site.CreatedAt, &site.UpdatedAt); err != nil {
-			return nil, err
+		site, err := scanSite(rows)
+		if err != nil {
+			return nil, 0, err
 		}
-
-		json.Unmarshal([]byte(collectionIDsJSON), &site.CollectionIDs)
-		json.Unmarshal([]byte(widgetConfigJSON), &site.WidgetConfig)
 		sites = append(sites, site)
 	}
 
-	return sites, rows.Err()
+	return sites, total, rows.Err()
 }
 
 // Update updates a site
@@ -99,12 +121,19 @@ func (r *SiteRepository) Update(site *domain.Site) error {
 	site.UpdatedAt = time.Now()
 	collectionIDsJSON, _ := json.Marshal(site.CollectionIDs)
 	widgetConfigJSON, _ := json.Marshal(site.WidgetConfig)
+	blocklistJSON, _ := json.Marshal(site.Blocklist)
+	allowedModelsJSON, _ := json.Marshal(site.AllowedModels)
+	filterableKeysJSON, _ := json.Marshal(site.FilterableKeys)
 
 	result, err := r.db.Exec(`
-		UPDATE sites SET name = ?, domain = ?, collection_ids = ?, widget_config = ?, rate_limit = ?, updated_at = ?
+		UPDATE sites SET name = ?, domain = ?, collection_ids = ?, widget_config = ?, rate_limit = ?,
+			blocklist = ?, blocked_response = ?, allowed_models = ?, disclaimer = ?,
+			use_default_collection = ?, filterable_keys = ?, public_key = ?, updated_at = ?
 		WHERE id = ?
 	`, site.Name, site.Domain, string(collectionIDsJSON),
-		string(widgetConfigJSON), site.RateLimit, site.UpdatedAt, site.ID)
+		string(widgetConfigJSON), site.RateLimit, string(blocklistJSON),
+		site.BlockedResponse, string(allowedModelsJSON), site.Disclaimer,
+		site.UseDefaultCollection, string(filterableKeysJSON), site.PublicKey, site.UpdatedAt, site.ID)
 
 	if err != nil {
 		return err
@@ -132,3 +161,39 @@ func (r *SiteRepository) Delete(id string) error {
 
 	return nil
 }
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanSite reads a site selected with siteColumns
+func scanSite(row rowScanner) (*domain.Site, error) {
+	site := &domain.Site{}
+	var collectionIDsJSON, widgetConfigJSON string
+	var blocklistJSON, blockedResponse, allowedModelsJSON, disclaimer, filterableKeysJSON, publicKey sql.NullString
+
+	if err := row.Scan(&site.ID, &site.Name, &site.Domain, &collectionIDsJSON,
+		&widgetConfigJSON, &site.RateLimit, &blocklistJSON, &blockedResponse,
+		&allowedModelsJSON, &disclaimer, &site.UseDefaultCollection, &filterableKeysJSON,
+		&publicKey, &site.CreatedAt, &site.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	json.Unmarshal([]byte(collectionIDsJSON), &site.CollectionIDs)
+	json.Unmarshal([]byte(widgetConfigJSON), &site.WidgetConfig)
+	if blocklistJSON.Valid && blocklistJSON.String != "" {
+		json.Unmarshal([]byte(blocklistJSON.String), &site.Blocklist)
+	}
+	site.BlockedResponse = blockedResponse.String
+	site.Disclaimer = disclaimer.String
+	site.PublicKey = publicKey.String
+	if allowedModelsJSON.Valid && allowedModelsJSON.String != "" {
+		json.Unmarshal([]byte(allowedModelsJSON.String), &site.AllowedModels)
+	}
+	if filterableKeysJSON.Valid && filterableKeysJSON.String != "" {
+		json.Unmarshal([]byte(filterableKeysJSON.String), &site.FilterableKeys)
+	}
+
+	return site, nil
+}
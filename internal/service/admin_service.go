@@ -2,14 +2,25 @@ package service
 
 import (
 	"context"
-
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/config"
 	"github.com/liliang-cn/askdoc/internal/domain"
 	"github.com/liliang-cn/askdoc/internal/repository"
 )
 
 // AdminService handles admin operations
 type AdminService struct {
+	cfg            *config.Config
 	collectionRepo *repository.CollectionRepository
+	documentRepo   *repository.DocumentRepository
 	siteRepo       *repository.SiteRepository
 	sessionRepo    *repository.SessionRepository
 	orchestrator   *OrchestratorService
@@ -17,13 +28,17 @@ type AdminService struct {
 
 // NewAdminService creates a new admin service
 func NewAdminService(
+	cfg *config.Config,
 	collectionRepo *repository.CollectionRepository,
+	documentRepo *repository.DocumentRepository,
 	siteRepo *repository.SiteRepository,
 	sessionRepo *repository.SessionRepository,
 	orchestrator *OrchestratorService,
 ) *AdminService {
 	return &AdminService{
+		cfg:            cfg,
 		collectionRepo: collectionRepo,
+		documentRepo:   documentRepo,
 		siteRepo:       siteRepo,
 		sessionRepo:    sessionRepo,
 		orchestrator:   orchestrator,
@@ -33,10 +48,21 @@ func NewAdminService(
 // Collection operations
 
 func (s *AdminService) CreateCollection(ctx context.Context, req *domain.CreateCollectionRequest) (*domain.Collection, error) {
+	if err := domain.ValidateSynonyms(req.Synonyms); err != nil {
+		return nil, err
+	}
 	collection := &domain.Collection{
-		Name:        req.Name,
-		Description: req.Description,
-		Metadata:    req.Metadata,
+		Name:                 req.Name,
+		Description:          req.Description,
+		Metadata:             req.Metadata,
+		StripHTMLBoilerplate: req.StripHTMLBoilerplate,
+		Synonyms:             req.Synonyms,
+		EmbedSynonyms:        req.EmbedSynonyms,
+		ChunkSize:            req.ChunkSize,
+		ChunkOverlap:         req.ChunkOverlap,
+	}
+	if err := checkChunking(collectionChunking(s.cfg, collection)); err != nil {
+		return nil, err
 	}
 	if err := s.collectionRepo.Create(collection); err != nil {
 		return nil, err
@@ -44,12 +70,54 @@ func (s *AdminService) CreateCollection(ctx context.Context, req *domain.CreateC
 	return collection, nil
 }
 
+// CollectionByName returns the collection with the given name. When create is
+// set a missing collection is created, and created reports whether this call
+// created it; concurrent calls for the same name create it only once.
+func (s *AdminService) CollectionByName(ctx context.Context, name string, create bool) (*domain.Collection, bool, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, false, fmt.Errorf("%w: collection name is required", domain.ErrInvalidRequest)
+	}
+
+	collection, err := s.collectionRepo.GetByName(name)
+	if err != nil || collection != nil {
+		return collection, false, err
+	}
+	if !create {
+		return nil, false, domain.ErrNotFound
+	}
+
+	created, err := s.collectionRepo.CreateIfNameFree(&domain.Collection{Name: name})
+	if err != nil {
+		return nil, false, err
+	}
+	collection, err = s.collectionRepo.GetByName(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if collection == nil {
+		return nil, false, fmt.Errorf("collection %q disappeared after creation", name)
+	}
+	return collection, created, nil
+}
+
 func (s *AdminService) GetCollection(ctx context.Context, id string) (*domain.Collection, error) {
 	return s.collectionRepo.Get(id)
 }
 
-func (s *AdminService) ListCollections(ctx context.Context) ([]*domain.Collection, error) {
-	return s.collectionRepo.List()
+// ListCollections lists a page of the collections whose name or description
+// contains query (all when empty); a page size of 0 lists every match
+func (s *AdminService) ListCollections(ctx context.Context, query string, page, pageSize int) (*domain.CollectionListResponse, error) {
+	collections, total, err := s.collectionRepo.List(strings.TrimSpace(query), pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.CollectionListResponse{
+		Items:    collections,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
 }
 
 func (s *AdminService) UpdateCollection(ctx context.Context, id string, req *domain.UpdateCollectionRequest) (*domain.Collection, error) {
@@ -70,17 +138,240 @@ func (s *AdminService) UpdateCollection(ctx context.Context, id string, req *dom
 	if req.Metadata != nil {
 		collection.Metadata = req.Metadata
 	}
+	if req.StripHTMLBoilerplate != nil {
+		collection.StripHTMLBoilerplate = *req.StripHTMLBoilerplate
+	}
+	// Synonyms change retrieval, so cached answers for the collection are stale
+	retrievalChanged := false
+	if req.Synonyms != nil {
+		if err := domain.ValidateSynonyms(req.Synonyms); err != nil {
+			return nil, err
+		}
+		collection.Synonyms = req.Synonyms
+		retrievalChanged = true
+	}
+	if req.EmbedSynonyms != nil && *req.EmbedSynonyms != collection.EmbedSynonyms {
+		collection.EmbedSynonyms = *req.EmbedSynonyms
+		retrievalChanged = true
+	}
+	// Chunking only applies to documents ingested from now on
+	if req.ChunkSize != nil {
+		collection.ChunkSize = chunkingOverride(*req.ChunkSize)
+	}
+	if req.ChunkOverlap != nil {
+		collection.ChunkOverlap = chunkingOverride(*req.ChunkOverlap)
+	}
+	if req.ChunkSize != nil || req.ChunkOverlap != nil {
+		if err := checkChunking(collectionChunking(s.cfg, collection)); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := s.collectionRepo.Update(collection); err != nil {
 		return nil, err
 	}
+	if retrievalChanged {
+		if err := s.collectionRepo.BumpVersion(id); err != nil {
+			return nil, err
+		}
+		collection.Version++
+	}
 	return collection, nil
 }
 
+// DeleteCollection deletes a collection together with its documents' chunks
+// and stored files. Document removal is best-effort: every failure is logged
+// and the collection row is kept so the delete can be retried.
 func (s *AdminService) DeleteCollection(ctx context.Context, id string) error {
+	if s.orchestrator != nil {
+		docs, err := s.collectionDocuments(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, doc := range docs {
+			if err := s.orchestrator.ReleaseDocument(ctx, doc.ID); err != nil {
+				log.Printf("[Admin] Deleting document %s of collection %s failed: %v", doc.ID, id, err)
+				errs = append(errs, fmt.Errorf("document %s: %w", doc.ID, err))
+				continue
+			}
+			if err := removeStoredDocument(s.cfg.Storage.Documents, id, doc.ID); err != nil {
+				log.Printf("[Admin] Removing stored file of document %s failed: %v", doc.ID, err)
+				errs = append(errs, fmt.Errorf("document %s: %w", doc.ID, err))
+			}
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("failed to delete %d of %d documents: %w", len(errs), len(docs), errors.Join(errs...))
+		}
+	}
+
+	// Remove the storage directory if nothing else is left in it
+	if dir, err := safeStoragePath(s.cfg.Storage.Documents, id); err == nil {
+		os.Remove(dir)
+	}
 	return s.collectionRepo.Delete(id)
 }
 
+// MergeCollections moves every document of the source collection into the
+// target and deletes the source. The target keeps its name and description;
+// source metadata keys are only added where the target has none. Documents are
+// moved one at a time, so a failed merge can simply be retried.
+func (s *AdminService) MergeCollections(ctx context.Context, targetID, sourceID string) (*domain.Collection, error) {
+	if targetID == sourceID {
+		return nil, fmt.Errorf("%w: cannot merge a collection into itself", domain.ErrInvalidRequest)
+	}
+
+	target, err := s.collectionRepo.Get(targetID)
+	if err != nil {
+		return nil, err
+	}
+	source, err := s.collectionRepo.Get(sourceID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil || source == nil {
+		return nil, domain.ErrNotFound
+	}
+
+	// Reassign documents and their chunks
+	if s.orchestrator != nil {
+		docs, err := s.collectionDocuments(ctx, sourceID)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range docs {
+			if err := s.orchestrator.MoveDocument(ctx, doc.ID, targetID); err != nil {
+				return nil, fmt.Errorf("failed to move document %s: %w", doc.ID, err)
+			}
+			if err := s.collectionRepo.UpdateDocumentCount(sourceID, -1); err != nil {
+				return nil, err
+			}
+			if err := s.collectionRepo.UpdateDocumentCount(targetID, 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Move stored files; names are unique IDs so they cannot collide
+	if err := s.moveCollectionFiles(sourceID, targetID); err != nil {
+		return nil, err
+	}
+
+	// Fold in any remaining count (documents pending ingestion or without RAG)
+	if source, err = s.collectionRepo.Get(sourceID); err != nil {
+		return nil, err
+	}
+	if source.DocumentCount != 0 {
+		if err := s.collectionRepo.UpdateDocumentCount(targetID, source.DocumentCount); err != nil {
+			return nil, err
+		}
+	}
+
+	// Merge metadata, target wins on conflicts
+	target, err = s.collectionRepo.Get(targetID)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range source.Metadata {
+		if target.Metadata == nil {
+			target.Metadata = make(map[string]any)
+		}
+		if _, exists := target.Metadata[k]; !exists {
+			target.Metadata[k] = v
+		}
+	}
+	if err := s.collectionRepo.Update(target); err != nil {
+		return nil, err
+	}
+
+	if err := s.collectionRepo.BumpVersion(targetID); err != nil {
+		return nil, err
+	}
+	if source.LastIngestedAt != nil && (target.LastIngestedAt == nil || source.LastIngestedAt.After(*target.LastIngestedAt)) {
+		if err := s.collectionRepo.SetLastIngested(targetID, *source.LastIngestedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	// Point sites at the target instead of the source
+	if err := s.replaceSiteCollection(sourceID, targetID); err != nil {
+		return nil, err
+	}
+
+	// Document records would otherwise be deleted with the source
+	if err := s.documentRepo.MoveCollection(sourceID, targetID); err != nil {
+		return nil, err
+	}
+
+	if err := s.collectionRepo.Delete(sourceID); err != nil {
+		return nil, err
+	}
+
+	return s.collectionRepo.Get(targetID)
+}
+
+// moveCollectionFiles moves uploaded files from one collection's storage directory to another's
+func (s *AdminService) moveCollectionFiles(sourceID, targetID string) error {
+	sourceDir, err := safeStoragePath(s.cfg.Storage.Documents, sourceID)
+	if err != nil {
+		return err
+	}
+	targetDir, err := safeStoragePath(s.cfg.Storage.Documents, targetID)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(sourceDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read storage directory: %w", err)
+	}
+
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	for _, entry := range entries {
+		if err := os.Rename(filepath.Join(sourceDir, entry.Name()), filepath.Join(targetDir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to move %s: %w", entry.Name(), err)
+		}
+	}
+	return os.Remove(sourceDir)
+}
+
+// replaceSiteCollection swaps a collection ID in every site that references it
+func (s *AdminService) replaceSiteCollection(oldID, newID string) error {
+	sites, _, err := s.siteRepo.List("", 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, site := range sites {
+		found := false
+		ids := make([]string, 0, len(site.CollectionIDs))
+		seen := make(map[string]bool)
+		for _, id := range site.CollectionIDs {
+			if id == oldID {
+				id = newID
+				found = true
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if !found {
+			continue
+		}
+		site.CollectionIDs = ids
+		if err := s.siteRepo.Update(site); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Document operations (delegated to IngestService via orchestrator)
 
 func (s *AdminService) GetDocument(ctx context.Context, id string) (*domain.Document, error) {
@@ -90,17 +381,131 @@ func (s *AdminService) GetDocument(ctx context.Context, id string) (*domain.Docu
 	return s.orchestrator.GetDocument(ctx, id)
 }
 
-func (s *AdminService) ListDocuments(ctx context.Context, collectionID string, page, pageSize int) (*domain.DocumentListResponse, error) {
+// SummarizeDocument returns a summary of a document for readers, of the
+// given length (short, medium or long; default medium). Summaries are kept
+// in the document metadata until it is reingested.
+func (s *AdminService) SummarizeDocument(ctx context.Context, id, length string) (*domain.DocumentSummary, error) {
 	if s.orchestrator == nil {
-		return &domain.DocumentListResponse{Documents: []*domain.Document{}, Total: 0, Page: page, PageSize: pageSize}, nil
+		return nil, domain.ErrNotFound
+	}
+	if length == "" {
+		length = domain.SummaryLengthMedium
+	}
+	switch length {
+	case domain.SummaryLengthShort, domain.SummaryLengthMedium, domain.SummaryLengthLong:
+	default:
+		return nil, fmt.Errorf("%w: length must be short, medium or long", domain.ErrInvalidRequest)
+	}
+
+	doc, err := s.orchestrator.GetDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Status != domain.DocumentStatusReady {
+		return nil, fmt.Errorf("%w: document is %s, only ready documents can be summarized", domain.ErrInvalidRequest, doc.Status)
+	}
+
+	summaries := make(map[string]any)
+	if stored, ok := doc.Metadata[domain.MetadataKeySummaries].(map[string]any); ok {
+		maps.Copy(summaries, stored)
+	}
+	if summary, ok := summaries[length].(string); ok && summary != "" {
+		return &domain.DocumentSummary{DocumentID: id, Length: length, Summary: summary, Cached: true}, nil
+	}
+
+	// Copies of an identical upload have no chunks of their own
+	source := id
+	if doc.SharedFrom != "" {
+		source = doc.SharedFrom
+	}
+	summary, err := s.orchestrator.ReaderSummary(ctx, source, length)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries[length] = summary
+	if err := s.orchestrator.UpdateDocumentMetadata(ctx, id, map[string]any{domain.MetadataKeySummaries: summaries}); err != nil {
+		log.Printf("[Admin] Storing summary of %s failed: %v", id, err)
+	}
+	return &domain.DocumentSummary{DocumentID: id, Length: length, Summary: summary}, nil
+}
+
+// ListDocuments lists a page of a collection's documents, newest first and
+// only those tagged tag when it is not empty. The page continues after the
+// document with ID cursor, or is page number page when cursor is empty.
+func (s *AdminService) ListDocuments(ctx context.Context, collectionID, tag, cursor string, page, pageSize int) (*domain.DocumentListResponse, error) {
+	return s.documentPage(ctx, repository.DocumentQuery{CollectionID: collectionID, Tag: tag}, cursor, page, pageSize)
+}
+
+// ListAllDocuments lists documents across collections by created_at, newest
+// first unless ascending, optionally only those with status, paged like
+// ListDocuments. Each document on the page carries its collection's name.
+func (s *AdminService) ListAllDocuments(ctx context.Context, status string, ascending bool, cursor string, page, pageSize int) (*domain.DocumentListResponse, error) {
+	result, err := s.documentPage(ctx, repository.DocumentQuery{Status: status, Ascending: ascending}, cursor, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string)
+	for _, doc := range result.Documents {
+		name, ok := names[doc.CollectionID]
+		if !ok {
+			collection, err := s.collectionRepo.Get(doc.CollectionID)
+			if err != nil {
+				return nil, err
+			}
+			if collection != nil {
+				name = collection.Name
+			}
+			names[doc.CollectionID] = name
+		}
+		doc.CollectionName = name
 	}
+	return result, nil
+}
 
-	docs, err := s.orchestrator.ListDocumentsByCollection(ctx, collectionID)
+// documentPage queries one page of document records from the metadata DB
+// and loads those documents from rago; documents only the metadata DB
+// records, such as uploads that failed before rago stored anything, are
+// listed from their record. One more record than the page holds is fetched
+// to tell whether a next page exists.
+func (s *AdminService) documentPage(ctx context.Context, q repository.DocumentQuery, cursor string, page, pageSize int) (*domain.DocumentListResponse, error) {
+	q.After = cursor
+	if cursor == "" && page > 1 {
+		q.Offset = (page - 1) * pageSize
+	}
+	q.Limit = pageSize + 1
+	records, total, err := s.documentRepo.Page(q)
 	if err != nil {
 		return nil, err
 	}
 
-	// Pagination
+	result := &domain.DocumentListResponse{Documents: records, Total: total, PageSize: pageSize}
+	if cursor == "" {
+		result.Page = page
+	}
+	if len(records) > pageSize {
+		result.Documents = records[:pageSize]
+		result.NextCursor = records[pageSize-1].ID
+	}
+	if s.orchestrator == nil {
+		return result, nil
+	}
+	for i, record := range result.Documents {
+		doc, err := s.orchestrator.GetDocument(ctx, record.ID)
+		if err == domain.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.Documents[i] = doc
+	}
+	return result, nil
+}
+
+// paginateDocuments returns one page of docs
+func paginateDocuments(docs []*domain.Document, page, pageSize int) *domain.DocumentListResponse {
 	total := len(docs)
 	start := (page - 1) * pageSize
 	if start < 0 {
@@ -123,24 +528,298 @@ func (s *AdminService) ListDocuments(ctx context.Context, collectionID string, p
 		Total:     total,
 		Page:      page,
 		PageSize:  pageSize,
-	}, nil
+	}
 }
 
-func (s *AdminService) DeleteDocument(ctx context.Context, id string) error {
+// MoveDocument moves a document, its chunks and its stored file to another
+// collection, keeping the embeddings. Counts and the file are restored if a
+// later step fails.
+func (s *AdminService) MoveDocument(ctx context.Context, id, targetID string) (*domain.Document, error) {
 	if s.orchestrator == nil {
-		return domain.ErrNotFound
+		return nil, domain.ErrNotFound
 	}
-	return s.orchestrator.DeleteDocument(ctx, id)
+
+	doc, err := s.orchestrator.GetDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.collectionRepo.Get(targetID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%w: target collection %s not found", domain.ErrInvalidRequest, targetID)
+	}
+	if doc.CollectionID == targetID {
+		return doc, nil
+	}
+	if doc.Status == domain.DocumentStatusPending || doc.Status == domain.DocumentStatusProcessing {
+		return nil, fmt.Errorf("%w: document is still being ingested", domain.ErrInvalidRequest)
+	}
+	if doc.SharedFrom != "" {
+		return nil, fmt.Errorf("%w: document shares the chunks of %s and cannot be moved; upload it to the target collection instead", domain.ErrInvalidRequest, doc.SharedFrom)
+	}
+	sourceID := doc.CollectionID
+
+	if err := s.collectionRepo.UpdateDocumentCount(sourceID, -1); err != nil {
+		return nil, err
+	}
+	if err := s.collectionRepo.UpdateDocumentCount(targetID, 1); err != nil {
+		s.restoreDocumentCounts(sourceID, "")
+		return nil, err
+	}
+
+	if err := moveStoredDocument(s.cfg.Storage.Documents, sourceID, targetID, id); err != nil {
+		s.restoreDocumentCounts(sourceID, targetID)
+		return nil, err
+	}
+
+	if err := s.orchestrator.MoveDocument(ctx, id, targetID); err != nil {
+		if err := moveStoredDocument(s.cfg.Storage.Documents, targetID, sourceID, id); err != nil {
+			log.Printf("[Admin] Moving the file of %s back to collection %s failed: %v", id, sourceID, err)
+		}
+		s.restoreDocumentCounts(sourceID, targetID)
+		return nil, err
+	}
+	doc.CollectionID = targetID
+	if doc.Metadata != nil {
+		doc.Metadata[domain.MetadataKeyCollectionID] = targetID
+	}
+	if err := s.documentRepo.SetCollection(id, targetID); err != nil {
+		log.Printf("[Admin] Recording the move of %s failed: %v", id, err)
+	}
+
+	// Cached answers of both collections are stale
+	for _, collectionID := range []string{sourceID, targetID} {
+		if err := s.collectionRepo.BumpVersion(collectionID); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// restoreDocumentCounts undoes the count changes of a failed move; an empty
+// targetID means only the source was decremented
+func (s *AdminService) restoreDocumentCounts(sourceID, targetID string) {
+	if err := s.collectionRepo.UpdateDocumentCount(sourceID, 1); err != nil {
+		log.Printf("[Admin] Restoring the document count of %s failed: %v", sourceID, err)
+	}
+	if targetID == "" {
+		return
+	}
+	if err := s.collectionRepo.UpdateDocumentCount(targetID, -1); err != nil {
+		log.Printf("[Admin] Restoring the document count of %s failed: %v", targetID, err)
+	}
+}
+
+// PublishDocument makes a draft document searchable. Publishing an already
+// published document is a no-op.
+func (s *AdminService) PublishDocument(ctx context.Context, id string) (*domain.Document, error) {
+	if s.orchestrator == nil {
+		return nil, domain.ErrNotFound
+	}
+
+	doc, err := s.orchestrator.GetDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Visibility == domain.DocumentVisibilityPublished {
+		return doc, nil
+	}
+
+	if err := s.orchestrator.SetDocumentVisibility(ctx, id, domain.DocumentVisibilityPublished); err != nil {
+		return nil, err
+	}
+	doc.Visibility = domain.DocumentVisibilityPublished
+
+	// Cached answers were built without this document
+	if err := s.collectionRepo.BumpVersion(doc.CollectionID); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// SetDocumentTags replaces the tags of a document
+func (s *AdminService) SetDocumentTags(ctx context.Context, id string, tags []string) (*domain.Document, error) {
+	if s.orchestrator == nil {
+		return nil, domain.ErrNotFound
+	}
+	tags, err := domain.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := s.orchestrator.GetDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// Tags live on the chunks, which shared documents have only one set of
+	if doc.SharedFrom != "" {
+		return nil, fmt.Errorf("%w: document shares the chunks of %s, so its tags cannot be changed separately", domain.ErrInvalidRequest, doc.SharedFrom)
+	}
+	copies, err := s.orchestrator.sharedCopies(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(copies) > 0 {
+		return nil, fmt.Errorf("%w: %d other documents share this document's chunks, so its tags cannot be changed separately", domain.ErrInvalidRequest, len(copies))
+	}
+	if err := s.orchestrator.SetDocumentTags(ctx, id, tags); err != nil {
+		return nil, err
+	}
+	if err := s.documentRepo.SetTags(id, tags); err != nil {
+		log.Printf("[Admin] Recording the tags of %s failed: %v", id, err)
+	}
+	doc.Tags = tags
+	if doc.Metadata != nil {
+		doc.Metadata[domain.MetadataKeyTags] = strings.Join(tags, ",")
+	}
+
+	// Cached answers may have been filtered on the old tags
+	if err := s.collectionRepo.BumpVersion(doc.CollectionID); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ExportEmbeddings streams chunk vectors, optionally limited to one collection
+func (s *AdminService) ExportEmbeddings(ctx context.Context, collectionID string, after int64, limit int, fn func(*domain.EmbeddingRecord) error) error {
+	if s.orchestrator == nil {
+		return nil
+	}
+	return s.orchestrator.ExportEmbeddings(ctx, collectionID, after, limit, fn)
+}
+
+// Session operations
+
+func (s *AdminService) ListSessions(ctx context.Context, siteID, externalUserID string, page, pageSize int) (*domain.SessionListResponse, error) {
+	sessions, total, err := s.sessionRepo.List(siteID, externalUserID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.SessionListResponse{
+		Sessions: sessions,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+// ListActiveSessions lists sessions with activity within window
+func (s *AdminService) ListActiveSessions(ctx context.Context, window time.Duration, page, pageSize int) (*domain.ActiveSessionListResponse, error) {
+	sessions, total, err := s.sessionRepo.ListActive(time.Now().Add(-window), pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.ActiveSessionListResponse{
+		Sessions: sessions,
+		Total:    total,
+		Window:   window.String(),
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+func (s *AdminService) GetSession(ctx context.Context, id string) (*domain.SessionDetail, error) {
+	session, err := s.sessionRepo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, nil
+	}
+
+	messages, err := s.sessionRepo.GetMessages(id)
+	if err != nil {
+		return nil, err
+	}
+	if messages == nil {
+		messages = []*domain.Message{}
+	}
+	return &domain.SessionDetail{Session: session, Messages: messages}, nil
+}
+
+// VerifiedAnswer builds the FAQ pair for promoting an assistant message to a
+// verified answer: the question is the user message it replied to, and the
+// pair records the session and message it came from
+func (s *AdminService) VerifiedAnswer(ctx context.Context, sessionID, messageID, answer string) (*domain.FAQPair, error) {
+	session, err := s.sessionRepo.Get(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, domain.ErrNotFound
+	}
+	messages, err := s.sessionRepo.GetMessages(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, msg := range messages {
+		if msg.ID != messageID {
+			continue
+		}
+		if msg.Role != "assistant" {
+			return nil, fmt.Errorf("%w: only assistant messages can be verified", domain.ErrInvalidRequest)
+		}
+		var question string
+		for j := i - 1; j >= 0; j-- {
+			if messages[j].Role == "user" {
+				question = messages[j].Content
+				break
+			}
+		}
+		if question == "" {
+			return nil, fmt.Errorf("%w: message has no preceding question", domain.ErrInvalidRequest)
+		}
+		if strings.TrimSpace(answer) == "" {
+			answer = msg.Content
+		}
+		return &domain.FAQPair{
+			Question: question,
+			Answer:   answer,
+			Metadata: map[string]any{
+				domain.MetadataKeyVerified:        true,
+				domain.MetadataKeySourceSessionID: sessionID,
+				domain.MetadataKeySourceMessageID: messageID,
+			},
+		}, nil
+	}
+	return nil, domain.ErrNotFound
 }
 
 // Site operations
 
 func (s *AdminService) CreateSite(ctx context.Context, req *domain.CreateSiteRequest) (*domain.Site, error) {
+	if err := domain.ValidateBlocklist(req.Blocklist); err != nil {
+		return nil, err
+	}
+	if err := s.validateModels(req.AllowedModels); err != nil {
+		return nil, err
+	}
+	if err := domain.ValidateFilterableKeys(req.FilterableKeys); err != nil {
+		return nil, err
+	}
+	if err := domain.ValidateWidgetConfig(req.WidgetConfig); err != nil {
+		return nil, err
+	}
+	if err := s.validateDefaultCollection(req.UseDefaultCollection); err != nil {
+		return nil, err
+	}
+
 	site := &domain.Site{
-		Name:          req.Name,
-		Domain:        req.Domain,
-		CollectionIDs: req.CollectionIDs,
-		RateLimit:     req.RateLimit,
+		Name:            req.Name,
+		Domain:          req.Domain,
+		CollectionIDs:   req.CollectionIDs,
+		RateLimit:       req.RateLimit,
+		Blocklist:       req.Blocklist,
+		BlockedResponse: req.BlockedResponse,
+		AllowedModels:   req.AllowedModels,
+		FilterableKeys:  req.FilterableKeys,
+		Disclaimer:      req.Disclaimer,
+		PublicKey:       req.PublicKey,
+
+		UseDefaultCollection: req.UseDefaultCollection,
 	}
 
 	if req.WidgetConfig != nil {
@@ -159,12 +838,42 @@ func (s *AdminService) CreateSite(ctx context.Context, req *domain.CreateSiteReq
 	return site, nil
 }
 
+// validateModels checks that a site's allowed models are all configured
+func (s *AdminService) validateModels(models []string) error {
+	for _, m := range models {
+		if !s.cfg.LLM.HasModel(m) {
+			return fmt.Errorf("%w: model %q is not configured", domain.ErrInvalidRequest, m)
+		}
+	}
+	return nil
+}
+
+// validateDefaultCollection rejects enabling the default collection fallback
+// when rag.default_collection is not set
+func (s *AdminService) validateDefaultCollection(enabled bool) error {
+	if enabled && s.cfg.RAG.DefaultCollection == "" {
+		return fmt.Errorf("%w: rag.default_collection is not configured", domain.ErrInvalidRequest)
+	}
+	return nil
+}
+
 func (s *AdminService) GetSite(ctx context.Context, id string) (*domain.Site, error) {
 	return s.siteRepo.Get(id)
 }
 
-func (s *AdminService) ListSites(ctx context.Context) ([]*domain.Site, error) {
-	return s.siteRepo.List()
+// ListSites lists a page of the sites whose name or domain contains query
+// (all when empty); a page size of 0 lists every match
+func (s *AdminService) ListSites(ctx context.Context, query string, page, pageSize int) (*domain.SiteListResponse, error) {
+	sites, total, err := s.siteRepo.List(strings.TrimSpace(query), pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.SiteListResponse{
+		Items:    sites,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
 }
 
 func (s *AdminService) UpdateSite(ctx context.Context, id string, req *domain.UpdateSiteRequest) (*domain.Site, error) {
@@ -186,11 +895,47 @@ func (s *AdminService) UpdateSite(ctx context.Context, id string, req *domain.Up
 		site.CollectionIDs = req.CollectionIDs
 	}
 	if req.WidgetConfig != nil {
+		if err := domain.ValidateWidgetConfig(req.WidgetConfig); err != nil {
+			return nil, err
+		}
 		site.WidgetConfig = *req.WidgetConfig
 	}
 	if req.RateLimit > 0 {
 		site.RateLimit = req.RateLimit
 	}
+	if req.Blocklist != nil {
+		if err := domain.ValidateBlocklist(req.Blocklist); err != nil {
+			return nil, err
+		}
+		site.Blocklist = req.Blocklist
+	}
+	if req.BlockedResponse != "" {
+		site.BlockedResponse = req.BlockedResponse
+	}
+	if req.AllowedModels != nil {
+		if err := s.validateModels(req.AllowedModels); err != nil {
+			return nil, err
+		}
+		site.AllowedModels = req.AllowedModels
+	}
+	if req.FilterableKeys != nil {
+		if err := domain.ValidateFilterableKeys(req.FilterableKeys); err != nil {
+			return nil, err
+		}
+		site.FilterableKeys = req.FilterableKeys
+	}
+	if req.Disclaimer != "" {
+		site.Disclaimer = req.Disclaimer
+	}
+	if req.PublicKey != nil {
+		site.PublicKey = *req.PublicKey
+	}
+	if req.UseDefaultCollection != nil {
+		if err := s.validateDefaultCollection(*req.UseDefaultCollection); err != nil {
+			return nil, err
+		}
+		site.UseDefaultCollection = *req.UseDefaultCollection
+	}
 
 	if err := s.siteRepo.Update(site); err != nil {
 		return nil, err
@@ -205,8 +950,9 @@ func (s *AdminService) DeleteSite(ctx context.Context, id string) error {
 // Stats
 
 func (s *AdminService) GetStats(ctx context.Context) (*domain.Stats, error) {
-	collections, _ := s.collectionRepo.List()
-	sites, _ := s.siteRepo.List()
+	// Only the totals are needed, so fetch a single row of each
+	_, totalCollections, _ := s.collectionRepo.List("", 1, 0)
+	_, totalSites, _ := s.siteRepo.List("", 1, 0)
 	chats, _ := s.sessionRepo.CountChats()
 
 	// Get document count from rago
@@ -219,9 +965,9 @@ func (s *AdminService) GetStats(ctx context.Context) (*domain.Stats, error) {
 	}
 
 	return &domain.Stats{
-		TotalCollections: len(collections),
+		TotalCollections: totalCollections,
 		TotalDocuments:   docCount,
-		TotalSites:       len(sites),
+		TotalSites:       totalSites,
 		TotalChats:       chats,
 	}, nil
 }
@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+func TestMergeCollections(t *testing.T) {
+	env := newTestEnv(t, "")
+	ctx := context.Background()
+	target := env.createCollection(t, "guides")
+	source := env.createCollection(t, "howtos")
+	kept := env.upload(t, target.ID, "install.md", []byte("Install the agent with the package manager."), nil)
+	moved := []*domain.Document{
+		env.upload(t, source.ID, "upgrade.md", []byte("Upgrade the agent by reinstalling it."), nil),
+		env.upload(t, source.ID, "remove.md", []byte("Remove the agent with the uninstaller."), nil),
+	}
+
+	merged, err := env.admin.MergeCollections(ctx, target.ID, source.ID)
+	if err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	if merged.DocumentCount != 3 {
+		t.Errorf("merged document count = %d, want 3", merged.DocumentCount)
+	}
+	if gone, err := env.admin.GetCollection(ctx, source.ID); err != nil || gone != nil {
+		t.Errorf("source collection after merge = %v, %v; want it deleted", gone, err)
+	}
+
+	docs, err := env.orchestrator.ListDocumentsByCollection(ctx, target.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 3 {
+		t.Fatalf("target has %d documents, want 3", len(docs))
+	}
+	targetDir := filepath.Join(env.cfg.Storage.Documents, target.ID)
+	for _, doc := range append(moved, kept) {
+		files, err := storedDocumentFiles(targetDir, doc.ID)
+		if err != nil || len(files) != 1 {
+			t.Errorf("stored files of %s under the target = %v, %v; want one", doc.Filename, files, err)
+		}
+	}
+	for _, doc := range moved {
+		got, err := env.orchestrator.GetDocument(ctx, doc.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.CollectionID != target.ID {
+			t.Errorf("%s is in collection %s, want the target", doc.Filename, got.CollectionID)
+		}
+	}
+
+	// Moved chunks are retrieved under the target
+	sources, err := env.orchestrator.Search(ctx, "upgrade reinstalling", 5, "", map[string]string{domain.MetadataKeyCollectionID: target.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 || sources[0].DocumentID != moved[0].ID {
+		t.Errorf("search under the target = %+v, want the moved document first", sources)
+	}
+}
+
+func TestListActiveSessions(t *testing.T) {
+	env := newTestEnv(t, "")
+	ctx := context.Background()
+	site := env.createSite(t, &domain.Site{Name: "docs"})
+	session := func() *domain.Session {
+		t.Helper()
+		s := &domain.Session{SiteID: site.ID}
+		if err := env.sessionRepo.Create(s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	message := func(sessionID, content string) {
+		t.Helper()
+		if err := env.sessionRepo.CreateMessage(&domain.Message{SessionID: sessionID, Role: "user", Content: content}); err != nil {
+			t.Fatal(err)
+		}
+		if err := env.sessionRepo.Update(sessionID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stale := session()
+	message(stale.ID, "hello")
+	time.Sleep(400 * time.Millisecond)
+	active := session()
+	message(active.ID, "How do I install the agent?")
+	message(active.ID, "And upgrade it?")
+
+	resp, err := env.admin.ListActiveSessions(ctx, 200*time.Millisecond, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 1 || len(resp.Sessions) != 1 || resp.Sessions[0].ID != active.ID {
+		t.Fatalf("active sessions = %d %+v, want only the recent one", resp.Total, resp.Sessions)
+	}
+	got := resp.Sessions[0]
+	if got.SiteID != site.ID || got.SiteName != "docs" || got.MessageCount != 2 || got.LastMessageAt == nil {
+		t.Errorf("active session = %+v, want site docs with 2 messages and a last message time", got)
+	}
+
+	// A wider window takes in the stale session too
+	resp, err = env.admin.ListActiveSessions(ctx, time.Hour, 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Total != 2 || len(resp.Sessions) != 2 || resp.Sessions[0].ID != active.ID {
+		t.Errorf("sessions active within an hour = %d %+v, want both, most recent first", resp.Total, resp.Sessions)
+	}
+}
+
+func TestDraftDocumentsAreNotCitedUntilPublished(t *testing.T) {
+	env := newTestEnv(t, "")
+	ctx := context.Background()
+	collection := env.createCollection(t, "docs")
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+	draft, err := env.ingest.UploadDocumentContent(ctx, collection.ID, "install.md", []byte("Install the agent with the package manager."), nil, domain.DocumentVisibilityDraft, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.waitIngested(t)
+
+	cites := func() bool {
+		t.Helper()
+		resp, err := env.chat.Chat(ctx, site.ID, &domain.ChatRequest{Message: "How do I install the agent?"})
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		for _, source := range resp.Sources {
+			if source.DocumentID == draft.ID {
+				return true
+			}
+		}
+		return false
+	}
+	if cites() {
+		t.Fatal("chat cited a draft document")
+	}
+	list, err := env.admin.ListDocuments(ctx, collection.ID, "", "", 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Documents) != 1 || list.Documents[0].Visibility != domain.DocumentVisibilityDraft {
+		t.Errorf("admin listing = %+v, want the draft", list.Documents)
+	}
+
+	published, err := env.admin.PublishDocument(ctx, draft.ID)
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if published.Visibility != domain.DocumentVisibilityPublished {
+		t.Errorf("visibility after publishing = %s", published.Visibility)
+	}
+	if !cites() {
+		t.Error("chat did not cite the document once published")
+	}
+}
+
+func TestVerifiedAnswerIsRetrieved(t *testing.T) {
+	env := newTestEnv(t, "")
+	ctx := context.Background()
+	docs := env.createCollection(t, "docs")
+	verified := env.createCollection(t, "verified")
+	env.upload(t, docs.ID, "agent.md", []byte("The agent runs on every host and reports metrics."), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{docs.ID, verified.ID}})
+	env.generator.reply = func(prompt string) (string, error) { return "Run the installer, then restart the agent.", nil }
+
+	resp, err := env.chat.Chat(ctx, site.ID, &domain.ChatRequest{Message: "How do I upgrade the agent?"})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	messages, err := env.sessionRepo.GetMessages(resp.SessionID)
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("session messages = %d, %v; want the question and answer", len(messages), err)
+	}
+	answer := messages[1]
+
+	pair, err := env.admin.VerifiedAnswer(ctx, resp.SessionID, answer.ID, "")
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if pair.Question != "How do I upgrade the agent?" || pair.Answer != answer.Content {
+		t.Errorf("verified pair = %q / %q, want the chat's question and answer", pair.Question, pair.Answer)
+	}
+	if _, err := env.admin.VerifiedAnswer(ctx, resp.SessionID, messages[0].ID, ""); !errors.Is(err, domain.ErrInvalidRequest) {
+		t.Errorf("verifying a user message: err = %v, want ErrInvalidRequest", err)
+	}
+	promoted, err := env.ingest.IngestFAQ(ctx, verified.ID, []domain.FAQPair{*pair})
+	if err != nil {
+		t.Fatalf("FAQ ingestion failed: %v", err)
+	}
+	doc, err := env.orchestrator.GetDocument(ctx, promoted[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Metadata[domain.MetadataKeyVerified] != true || doc.Metadata[domain.MetadataKeySourceSessionID] != resp.SessionID ||
+		doc.Metadata[domain.MetadataKeySourceMessageID] != answer.ID {
+		t.Errorf("verified document metadata = %v, want its provenance", doc.Metadata)
+	}
+
+	// A similar question later retrieves the vetted answer first
+	resp, err = env.chat.Chat(ctx, site.ID, &domain.ChatRequest{Message: "how can I upgrade my agent"})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if len(resp.Sources) == 0 || resp.Sources[0].DocumentID != promoted[0].ID || resp.Sources[0].Content != answer.Content {
+		t.Errorf("sources = %+v, want the verified answer first", resp.Sources)
+	}
+}
+
+func TestUploadCreatesCollectionOnce(t *testing.T) {
+	env := newTestEnv(t, "")
+	ctx := context.Background()
+	if _, _, err := env.admin.CollectionByName(ctx, "provisioned", false); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("missing collection without create: err = %v, want ErrNotFound", err)
+	}
+
+	// Concurrent uploads to the same new collection, as the upload handler
+	// does with ?create=true
+	const uploads = 8
+	var wg sync.WaitGroup
+	var created atomic.Int32
+	ids := make([]string, uploads)
+	errs := make([]error, uploads)
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collection, isNew, err := env.admin.CollectionByName(ctx, "provisioned", true)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if isNew {
+				created.Add(1)
+			}
+			ids[i] = collection.ID
+			_, errs[i] = env.ingest.UploadDocumentContent(ctx, collection.ID, fmt.Sprintf("doc-%d.md", i), []byte(fmt.Sprintf("Document number %d.", i)), nil, "", "")
+		}()
+	}
+	wg.Wait()
+	env.waitIngested(t)
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("upload %d: %v", i, err)
+		}
+		if ids[i] != ids[0] {
+			t.Errorf("upload %d went to collection %s, want %s", i, ids[i], ids[0])
+		}
+	}
+	if n := created.Load(); n != 1 {
+		t.Errorf("%d uploads reported creating the collection, want 1", n)
+	}
+	list, err := env.admin.ListCollections(ctx, "provisioned", 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 1 {
+		t.Errorf("%d collections named provisioned, want 1", list.Total)
+	}
+	docs, err := env.orchestrator.ListDocumentsByCollection(ctx, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != uploads {
+		t.Errorf("collection holds %d documents, want %d", len(docs), uploads)
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+	"github.com/liliang-cn/rago/v2/pkg/agent"
+)
+
+// ChatWithAgent answers q's message through the rago agent service, which
+// can reason in several steps and remembers earlier turns of sessionID.
+// Sources are retrieved up front as Chat retrieves them, honoring q's
+// collections, filters, top_k and search mode, so the agent stays within the
+// site's documents and the answer can cite them.
+func (s *OrchestratorService) ChatWithAgent(ctx context.Context, sessionID string, q *ChatQuery) (*askdocdomain.ChatResponse, error) {
+	retrievalStart := time.Now()
+	vec, err := s.embedQuery(ctx, s.retrievalQuery(ctx, q))
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := s.retrieveChunks(ctx, vec, withSynonyms(q.Message, q.Synonyms), s.topK(q), q.SearchMode, s.minScore(q), q.Filters, q.CollectionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	diagnostics := &askdocdomain.RetrievalDiagnostics{RetrievalMs: time.Since(retrievalStart).Milliseconds()}
+
+	if !s.enoughSources(chunks) {
+		return &askdocdomain.ChatResponse{Answer: q.noAnswer(), Sources: []askdocdomain.Source{}, Diagnostics: diagnostics}, nil
+	}
+	docContext, sources := buildSources(chunks, q.CleanSources)
+
+	goal := fmt.Sprintf(`You are a documentation assistant. Answer the user's question using only the documentation excerpts below and what was said earlier in this session. If they don't contain the answer, say so. If an FAQ entry matches the question, give its answer as written.
+
+%sDocumentation:
+%s
+
+Question: %s`, languageInstruction(q.Language), docContext, q.Message)
+
+	if !s.breaker.Allow() {
+		return nil, askdocdomain.ErrLLMUnavailable
+	}
+	generationStart := time.Now()
+	stageCtx, cancel := withStageTimeout(ctx, s.cfg.RAG.GenerationTimeout)
+	defer cancel()
+	result, err := s.agentService.RunWithSession(stageCtx, goal, sessionID)
+	s.breaker.Record(ctx, breakerGenerate, err)
+	diagnostics.GenerationMs = time.Since(generationStart).Milliseconds()
+	if err = stageError(ctx, stageCtx, err, askdocdomain.ErrGenerationTimeout, "agent run failed"); err != nil {
+		return nil, err
+	}
+
+	answer, err := agentAnswer(result)
+	if err != nil {
+		return nil, err
+	}
+	return &askdocdomain.ChatResponse{
+		Answer:      answer,
+		Sources:     sources,
+		Diagnostics: diagnostics,
+	}, nil
+}
+
+// ChatWithAgentStream runs ChatWithAgent and emits its answer as a stream.
+// The agent does not stream tokens, so the answer arrives as one chunk.
+func (s *OrchestratorService) ChatWithAgentStream(ctx context.Context, sessionID string, q *ChatQuery) <-chan askdocdomain.StreamChunk {
+	stream := newChunkStream(ctx, 5)
+
+	go func() {
+		defer stream.close()
+
+		if !stream.send(askdocdomain.StreamChunk{Type: "thinking", Content: "Reasoning..."}) {
+			return
+		}
+		resp, err := s.ChatWithAgent(ctx, sessionID, q)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			stream.sendError(err)
+			return
+		}
+		streamResponse(stream, resp)
+	}()
+
+	return stream.ch
+}
+
+// agentAnswer extracts the final answer of an agent run
+func agentAnswer(result *agent.ExecutionResult) (string, error) {
+	if result == nil {
+		return "", fmt.Errorf("agent run returned no result")
+	}
+	if !result.Success && result.Error != "" {
+		return "", fmt.Errorf("agent run failed: %s", result.Error)
+	}
+	switch v := result.FinalResult.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v), nil
+		}
+		return string(data), nil
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// Analytics limits
+const (
+	// maxAnalyticsBuckets caps the length of an analytics series
+	maxAnalyticsBuckets = 1000
+	// maxTopQuestionMessages caps how many recent user messages a top
+	// questions report groups
+	maxTopQuestionMessages = 5000
+)
+
+// Analytics returns the chat activity in [from, to) as a series of buckets of
+// the given granularity, empty buckets included. With bySite it also breaks
+// the activity down per site, most messages first.
+func (s *AdminService) Analytics(ctx context.Context, from, to time.Time, granularity string, bySite bool) (*domain.Analytics, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: from must be before to", domain.ErrInvalidRequest)
+	}
+	buckets, err := analyticsBuckets(from, to, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.sessionRepo.ChatActivity(from, to, granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(buckets))
+	for i, b := range buckets {
+		index[b] = i
+	}
+	result := &domain.Analytics{From: from, To: to, Granularity: granularity, Series: newSeries(buckets)}
+	sites := make(map[string]*domain.SiteAnalytics)
+	for _, c := range counts {
+		i, ok := index[c.Bucket]
+		if !ok {
+			continue
+		}
+		result.Series[i].Messages += c.Messages
+		result.Series[i].Sessions += c.Sessions
+		result.Messages += c.Messages
+		result.Sessions += c.Sessions
+		if !bySite {
+			continue
+		}
+
+		site := sites[c.SiteID]
+		if site == nil {
+			site = &domain.SiteAnalytics{SiteID: c.SiteID, SiteName: c.SiteName, Series: newSeries(buckets)}
+			sites[c.SiteID] = site
+			result.Sites = append(result.Sites, site)
+		}
+		site.Series[i].Messages += c.Messages
+		site.Series[i].Sessions += c.Sessions
+		site.Messages += c.Messages
+		site.Sessions += c.Sessions
+	}
+
+	slices.SortStableFunc(result.Sites, func(a, b *domain.SiteAnalytics) int {
+		return b.Messages - a.Messages
+	})
+	return result, nil
+}
+
+// TopQuestions groups the user messages sent in [from, to) by similarity
+// (as QuestionGaps does), most frequently asked first; an empty siteID
+// reports all sites
+func (s *AdminService) TopQuestions(ctx context.Context, siteID string, from, to time.Time, limit int) (*domain.TopQuestionsReport, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("%w: from must be before to", domain.ErrInvalidRequest)
+	}
+	if siteID != "" {
+		site, err := s.siteRepo.Get(siteID)
+		if err != nil {
+			return nil, err
+		}
+		if site == nil {
+			return nil, domain.ErrNotFound
+		}
+	}
+
+	asked, err := s.sessionRepo.ListQuestions(siteID, from, to, maxTopQuestionMessages)
+	if err != nil {
+		return nil, err
+	}
+	texts := make([]string, len(asked))
+	for i, q := range asked {
+		texts[i] = q.Question
+	}
+	clusters, newWording := clusterQuestions(texts)
+
+	questions := []*domain.TopQuestion{}
+	for i, q := range asked {
+		c := clusters[i]
+		if c == len(questions) {
+			questions = append(questions, &domain.TopQuestion{Question: q.Question, LastAskedAt: q.CreatedAt})
+		} else if newWording[i] {
+			questions[c].Variants = append(questions[c].Variants, q.Question)
+		}
+		questions[c].Count++
+	}
+
+	// Stable keeps the most recently asked first among equal counts
+	slices.SortStableFunc(questions, func(a, b *domain.TopQuestion) int {
+		return b.Count - a.Count
+	})
+	if limit > 0 && len(questions) > limit {
+		questions = questions[:limit]
+	}
+	return &domain.TopQuestionsReport{SiteID: siteID, From: from, To: to, Questions: questions, Total: len(asked)}, nil
+}
+
+// analyticsBuckets returns the keys of the buckets overlapping [from, to),
+// in the format the session repository groups by
+func analyticsBuckets(from, to time.Time, granularity string) ([]string, error) {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	var layout string
+	var next func(time.Time) time.Time
+	switch granularity {
+	case domain.GranularityDay:
+		layout = "2006-01-02"
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case domain.GranularityWeek:
+		layout = "2006-01-02"
+		start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case domain.GranularityMonth:
+		layout = "2006-01"
+		start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, start.Location())
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default:
+		return nil, fmt.Errorf("%w: granularity must be %s, %s or %s", domain.ErrInvalidRequest,
+			domain.GranularityDay, domain.GranularityWeek, domain.GranularityMonth)
+	}
+
+	var buckets []string
+	for t := start; t.Before(to); t = next(t) {
+		if len(buckets) == maxAnalyticsBuckets {
+			return nil, fmt.Errorf("%w: the range spans more than %d %ss", domain.ErrInvalidRequest, maxAnalyticsBuckets, granularity)
+		}
+		buckets = append(buckets, t.Format(layout))
+	}
+	return buckets, nil
+}
+
+// newSeries returns a zeroed series for the given buckets
+func newSeries(buckets []string) []domain.AnalyticsPoint {
+	series := make([]domain.AnalyticsPoint, len(buckets))
+	for i, b := range buckets {
+		series[i].Bucket = b
+	}
+	return series
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// AnswerCache is an in-memory LRU cache of generated answers. Keys include the
+// version stamp of every collection the answer was drawn from, so a content
+// change in any of them makes the old entries unreachable; they then age out
+// through TTL or LRU eviction.
+type AnswerCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]*list.Element
+	order      *list.List // front = most recently used
+}
+
+type answerCacheEntry struct {
+	key       string
+	answer    string
+	sources   []domain.Source
+	expiresAt time.Time
+}
+
+// NewAnswerCache creates an answer cache; ttl <= 0 keeps entries until evicted
+func NewAnswerCache(ttl time.Duration, maxEntries int) *AnswerCache {
+	return &AnswerCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// answerCacheKey builds a cache key from the question, model, answer
+// language, retrieval options and the current version of each collection
+func answerCacheKey(question, model, language string, cleanSources bool, topK int, searchMode string, versions map[string]int64) string {
+	ids := make([]string, 0, len(versions))
+	for id := range versions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%t\x00%d\x00%s\x00", strings.ToLower(strings.Join(strings.Fields(question), " ")), model, language, cleanSources, topK, searchMode)
+	for _, id := range ids {
+		fmt.Fprintf(h, "%s@%d\x00", id, versions[id])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns a cached answer and its sources
+func (c *AnswerCache) Get(key string) (string, []domain.Source, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return "", nil, false
+	}
+	entry := elem.Value.(*answerCacheEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return "", nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.answer, entry.sources, true
+}
+
+// Set stores an answer, evicting the least recently used entry when full
+func (c *AnswerCache) Set(key, answer string, sources []domain.Source) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		expiresAt = time.Now().Add(c.ttl)
+	}
+	entry := &answerCacheEntry{key: key, answer: answer, sources: sources, expiresAt: expiresAt}
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*answerCacheEntry).key)
+	}
+}
@@ -0,0 +1,26 @@
+package service
+
+import "testing"
+
+func TestAnswerCacheKey(t *testing.T) {
+	versions := map[string]int64{"docs": 1}
+	base := answerCacheKey("How do I reset my password?", "", "", false, 5, "vector", versions)
+
+	tests := []struct {
+		name string
+		key  string
+		same bool
+	}{
+		{"whitespace and case", answerCacheKey("how do I  reset my PASSWORD?", "", "", false, 5, "vector", versions), true},
+		{"answer language", answerCacheKey("How do I reset my password?", "", "de", false, 5, "vector", versions), false},
+		{"model", answerCacheKey("How do I reset my password?", "gpt-4o", "", false, 5, "vector", versions), false},
+		{"collection version", answerCacheKey("How do I reset my password?", "", "", false, 5, "vector", map[string]int64{"docs": 2}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := tt.key == base; same != tt.same {
+				t.Errorf("key matches the base key = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
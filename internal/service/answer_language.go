@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// languageNames maps the language codes answers can be pinned to or detected
+// as to the names used in prompt instructions
+var languageNames = map[string]string{
+	"en": "English",
+	"de": "German",
+	"fr": "French",
+	"es": "Spanish",
+	"it": "Italian",
+	"pt": "Portuguese",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"sv": "Swedish",
+	"tr": "Turkish",
+	"ru": "Russian",
+	"uk": "Ukrainian",
+	"el": "Greek",
+	"ar": "Arabic",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"th": "Thai",
+	"zh": "Chinese",
+	"ja": "Japanese",
+	"ko": "Korean",
+}
+
+// scriptLanguages maps scripts used by a single language in practice to it
+var scriptLanguages = []struct {
+	script *unicode.RangeTable
+	code   string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Thai, "th"},
+}
+
+// stopwords are frequent short words that tell Latin-script languages apart
+var stopwords = map[string][]string{
+	"en": {"the", "is", "are", "and", "of", "to", "in", "what", "how", "do", "does", "can", "i", "you", "it", "for", "with", "my", "this", "on"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "wie", "ich", "ein", "eine", "mit", "für", "kann", "was", "wo", "auf", "den", "zu", "sie", "es"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "un", "pour", "que", "comment", "je", "pas", "avec", "dans", "du", "sur", "quoi", "il", "ce"},
+	"es": {"el", "la", "los", "las", "y", "es", "que", "como", "cómo", "qué", "para", "por", "una", "un", "con", "en", "no", "mi", "puedo", "del"},
+	"it": {"il", "lo", "la", "gli", "e", "è", "che", "come", "per", "una", "un", "con", "non", "di", "del", "della", "posso", "sono", "cosa", "mi"},
+	"pt": {"o", "a", "os", "as", "e", "é", "que", "como", "para", "uma", "um", "com", "não", "do", "da", "em", "posso", "meu", "isso", "no"},
+	"nl": {"de", "het", "een", "en", "is", "van", "hoe", "wat", "ik", "niet", "met", "voor", "op", "kan", "dat", "zijn", "je", "mijn", "waar", "er"},
+	"pl": {"i", "w", "nie", "jak", "na", "się", "jest", "to", "co", "z", "do", "czy", "mogę", "dla", "że", "o", "ten", "mam", "być", "od"},
+	"sv": {"och", "är", "att", "det", "som", "en", "ett", "hur", "jag", "inte", "med", "för", "på", "kan", "vad", "av", "den", "till", "min", "var"},
+	"tr": {"ve", "bir", "bu", "ne", "nasıl", "için", "ile", "mi", "mı", "değil", "var", "ben", "de", "da", "çok", "olan", "nedir", "neden", "gibi", "daha"},
+}
+
+// minLanguageLetters is the number of letters below which a question is too
+// short to tell its language
+const minLanguageLetters = 3
+
+// latinLettersPerWord weighs Latin letters against letters of other scripts
+const latinLettersPerWord = 4
+
+// detectLanguage guesses the language of a question and returns its code,
+// or "" when it can't tell. Non-Latin scripts decide on their own (kana marks
+// Japanese even among Han characters); Latin-script text is scored by
+// stopwords, and Cyrillic by letters only Ukrainian uses.
+func detectLanguage(text string) string {
+	counts := make(map[string]int)
+	var letters, latin, cyrillic, ukrainian int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+			continue
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+			if strings.ContainsRune("іїєґІЇЄҐ", r) {
+				ukrainian++
+			}
+			continue
+		}
+		for _, sl := range scriptLanguages {
+			if unicode.Is(sl.script, r) {
+				counts[sl.code]++
+				break
+			}
+		}
+	}
+	if letters < minLanguageLetters {
+		return ""
+	}
+	if counts["ja"] > 0 {
+		return "ja"
+	}
+
+	best, bestCount := "", 0
+	for code, n := range counts {
+		if n > bestCount || (n == bestCount && code < best) {
+			best, bestCount = code, n
+		}
+	}
+	if cyrillic > bestCount && cyrillic >= latin {
+		if ukrainian > 0 {
+			return "uk"
+		}
+		return "ru"
+	}
+	// A Han or Hangul character carries about as much as a Latin word, so a
+	// question is not taken for Latin script just for English product names
+	if bestCount > 0 && bestCount*latinLettersPerWord >= latin {
+		return best
+	}
+	return detectLatinLanguage(text)
+}
+
+// detectLatinLanguage returns the Latin-script language whose stopwords
+// occur most in text, or "" on no match or a tie
+func detectLatinLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+
+	best, bestScore, tied := "", 0, false
+	for code, list := range stopwords {
+		score := 0
+		for _, w := range words {
+			for _, stop := range list {
+				if w == stop {
+					score++
+					break
+				}
+			}
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = code, score, false
+		case score == bestScore && score > 0:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return best
+}
+
+// languageInstruction is the prompt line asking for an answer in the
+// language with the given code, or "" for no code
+func languageInstruction(code string) string {
+	if code == "" {
+		return ""
+	}
+	name, ok := languageNames[code]
+	if !ok {
+		name = fmt.Sprintf("the language with ISO 639 code %q", code)
+	}
+	return fmt.Sprintf("Answer in %s, whatever the language of the context.\n\n", name)
+}
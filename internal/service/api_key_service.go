@@ -0,0 +1,140 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/config"
+	"github.com/liliang-cn/askdoc/internal/domain"
+	"github.com/liliang-cn/askdoc/internal/repository"
+)
+
+// Settings holding the SHA-256 of the rotated admin API key, and of
+// admin.api_key when it was rotated
+const (
+	settingAdminKeyHash       = "admin_api_key_sha256"
+	settingAdminConfigKeyHash = "admin_config_key_sha256"
+)
+
+// minAPIKeyLength is the shortest admin API key accepted by Rotate
+const minAPIKeyLength = 16
+
+// APIKeyService validates and rotates the admin API key. A rotated key is
+// persisted (as a hash) and takes precedence over admin.api_key until
+// admin.api_key is changed, which resets the admin key to it.
+type APIKeyService struct {
+	cfg          *config.Config
+	settingsRepo *repository.SettingsRepository
+
+	mu            sync.RWMutex
+	current       []byte // SHA-256 of the active key, nil when auth is disabled
+	previous      []byte // SHA-256 of the key replaced by the last rotation
+	previousUntil time.Time
+}
+
+// KeyRotation is the result of rotating the admin API key
+type KeyRotation struct {
+	Key                string    `json:"key"`
+	PreviousValidUntil time.Time `json:"previous_valid_until"`
+}
+
+// NewAPIKeyService loads the active admin API key: the rotated key, unless
+// admin.api_key changed since the rotation
+func NewAPIKeyService(cfg *config.Config, settingsRepo *repository.SettingsRepository) (*APIKeyService, error) {
+	s := &APIKeyService{cfg: cfg, settingsRepo: settingsRepo}
+
+	stored, ok, err := settingsRepo.Get(settingAdminKeyHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin API key: %w", err)
+	}
+	if ok {
+		// Keys rotated before the configured key was recorded stay active
+		rotatedFrom, recorded, err := settingsRepo.Get(settingAdminConfigKeyHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load admin API key: %w", err)
+		}
+		if recorded && rotatedFrom != hex.EncodeToString(hashAPIKey(cfg.Admin.APIKey)) {
+			for _, key := range []string{settingAdminKeyHash, settingAdminConfigKeyHash} {
+				if err := settingsRepo.Delete(key); err != nil {
+					return nil, fmt.Errorf("failed to reset admin API key: %w", err)
+				}
+			}
+			ok = false
+		}
+	}
+	switch {
+	case ok:
+		if s.current, err = hex.DecodeString(stored); err != nil {
+			return nil, fmt.Errorf("invalid stored admin API key: %w", err)
+		}
+	case cfg.Admin.APIKey != "":
+		s.current = hashAPIKey(cfg.Admin.APIKey)
+	}
+	return s, nil
+}
+
+// Enabled reports whether admin requests must present a key
+func (s *APIKeyService) Enabled() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current != nil
+}
+
+// Valid reports whether key is the active key, or the previous key within
+// its grace period
+func (s *APIKeyService) Valid(key string) bool {
+	if key == "" {
+		return false
+	}
+	hash := hashAPIKey(key)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.current != nil && subtle.ConstantTimeCompare(hash, s.current) == 1 {
+		return true
+	}
+	return s.previous != nil && time.Now().Before(s.previousUntil) &&
+		subtle.ConstantTimeCompare(hash, s.previous) == 1
+}
+
+// Rotate activates newKey, or a generated key when newKey is empty. The
+// replaced key keeps working for admin.key_grace_period.
+func (s *APIKeyService) Rotate(newKey string) (*KeyRotation, error) {
+	if newKey == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate key: %w", err)
+		}
+		newKey = hex.EncodeToString(buf)
+	} else if len(newKey) < minAPIKeyLength {
+		return nil, fmt.Errorf("%w: key must be at least %d characters", domain.ErrInvalidRequest, minAPIKeyLength)
+	}
+
+	hash := hashAPIKey(newKey)
+	if err := s.settingsRepo.Set(settingAdminKeyHash, hex.EncodeToString(hash)); err != nil {
+		return nil, fmt.Errorf("failed to store admin API key: %w", err)
+	}
+	if err := s.settingsRepo.Set(settingAdminConfigKeyHash, hex.EncodeToString(hashAPIKey(s.cfg.Admin.APIKey))); err != nil {
+		return nil, fmt.Errorf("failed to store admin API key: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.previous = s.current
+	s.previousUntil = time.Now().Add(s.cfg.Admin.KeyGracePeriod)
+	s.current = hash
+
+	return &KeyRotation{Key: newKey, PreviousValidUntil: s.previousUntil}, nil
+}
+
+func hashAPIKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/config"
+	"github.com/liliang-cn/askdoc/internal/repository"
+)
+
+func TestAPIKeyRotation(t *testing.T) {
+	settingsRepo := repository.NewSettingsRepository(newTestDB(t))
+	cfg := &config.Config{}
+	cfg.Admin.APIKey = "configured-admin-key"
+	cfg.Admin.KeyGracePeriod = 100 * time.Millisecond
+
+	s, err := NewAPIKeyService(cfg, settingsRepo)
+	if err != nil {
+		t.Fatalf("NewAPIKeyService: %v", err)
+	}
+	rotation, err := s.Rotate("")
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if !s.Valid(rotation.Key) {
+		t.Error("rotated key rejected")
+	}
+	if !s.Valid("configured-admin-key") {
+		t.Error("previous key rejected within the grace period")
+	}
+
+	time.Sleep(time.Until(rotation.PreviousValidUntil) + 10*time.Millisecond)
+	if s.Valid("configured-admin-key") {
+		t.Error("previous key accepted after the grace period")
+	}
+	if !s.Valid(rotation.Key) {
+		t.Error("rotated key rejected after the grace period")
+	}
+
+	// A restart with the same admin.api_key keeps the rotated key
+	s, err = NewAPIKeyService(cfg, settingsRepo)
+	if err != nil {
+		t.Fatalf("NewAPIKeyService: %v", err)
+	}
+	if !s.Valid(rotation.Key) || s.Valid("configured-admin-key") {
+		t.Error("restart did not keep the rotated key")
+	}
+
+	// Changing admin.api_key resets the admin key to it
+	cfg.Admin.APIKey = "changed-admin-key"
+	s, err = NewAPIKeyService(cfg, settingsRepo)
+	if err != nil {
+		t.Fatalf("NewAPIKeyService: %v", err)
+	}
+	if !s.Valid("changed-admin-key") {
+		t.Error("changed admin.api_key rejected")
+	}
+	if s.Valid(rotation.Key) {
+		t.Error("rotated key still accepted after admin.api_key changed")
+	}
+}
@@ -2,7 +2,10 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
 
 	"github.com/liliang-cn/askdoc/internal/config"
 	"github.com/liliang-cn/askdoc/internal/domain"
@@ -11,10 +14,12 @@ import (
 
 // ChatService handles chat operations using Orchestrator Agent
 type ChatService struct {
-	cfg           *config.Config
-	siteRepo      *repository.SiteRepository
-	sessionRepo   *repository.SessionRepository
-	orchestrator  *OrchestratorService
+	cfg            *config.Config
+	siteRepo       *repository.SiteRepository
+	sessionRepo    *repository.SessionRepository
+	collectionRepo *repository.CollectionRepository
+	orchestrator   *OrchestratorService
+	cache          *AnswerCache // nil when cache.enabled is false
 }
 
 // NewChatService creates a new chat service
@@ -22,14 +27,20 @@ func NewChatService(
 	cfg *config.Config,
 	siteRepo *repository.SiteRepository,
 	sessionRepo *repository.SessionRepository,
+	collectionRepo *repository.CollectionRepository,
 	orchestrator *OrchestratorService,
 ) *ChatService {
-	return &ChatService{
-		cfg:          cfg,
-		siteRepo:     siteRepo,
-		sessionRepo:  sessionRepo,
-		orchestrator: orchestrator,
+	s := &ChatService{
+		cfg:            cfg,
+		siteRepo:       siteRepo,
+		sessionRepo:    sessionRepo,
+		collectionRepo: collectionRepo,
+		orchestrator:   orchestrator,
 	}
+	if cfg.Cache.Enabled {
+		s.cache = NewAnswerCache(cfg.Cache.TTL, cfg.Cache.MaxEntries)
+	}
+	return s
 }
 
 // Chat handles a chat message using Orchestrator Agent
@@ -42,32 +53,56 @@ func (s *ChatService) Chat(ctx context.Context, siteID string, req *domain.ChatR
 	if site == nil {
 		return nil, domain.ErrNotFound
 	}
+	site.CollectionIDs = s.siteCollections(site)
+
+	if err := s.checkModel(site, req); err != nil {
+		return nil, err
+	}
+	if err := checkFilters(site, req); err != nil {
+		return nil, err
+	}
 
-	// Get or create session
-	sessionID := req.SessionID
-	if sessionID == "" {
-		session := &domain.Session{SiteID: siteID}
-		if err := s.sessionRepo.Create(session); err != nil {
+	// Blocked questions get the site's canned response without retrieval or generation
+	if site.IsBlocked(req.Message) {
+		session, messageID, err := s.recordBlockedTurn(site, req)
+		if err != nil {
 			return nil, err
 		}
-		sessionID = session.ID
+		return &domain.ChatResponse{SessionID: session.ID, MessageID: messageID, Answer: site.BlockedAnswer()}, nil
 	}
 
-	// Save user message
-	userMsg := &domain.Message{
-		SessionID: sessionID,
-		Role:      "user",
-		Content:   req.Message,
-	}
-	if err := s.sessionRepo.CreateMessage(userMsg); err != nil {
+	ctx, cancel := s.chatContext(ctx)
+	defer cancel()
+
+	// Get or create session, load history and save the user message
+	session, query, err := s.beginTurn(ctx, site, req)
+	if err != nil {
 		return nil, err
 	}
+	sessionID := session.ID
 
 	// Query Orchestrator Agent
 	var resp *domain.ChatResponse
-	if s.orchestrator != nil {
-		resp, err = s.orchestrator.Chat(ctx, req.Message, site.CollectionIDs)
-		if err != nil {
+	cacheKey := s.cacheKey(query)
+	if answer, sources, ok := s.cachedAnswer(cacheKey); ok {
+		resp = &domain.ChatResponse{SessionID: sessionID, Answer: answer, Sources: sources}
+		resp.Disclaimer, resp.KnowledgeCutoff = s.disclaimer(site)
+	} else if s.orchestrator != nil {
+		if query.Mode == domain.ChatModeAgent {
+			resp, err = s.orchestrator.ChatWithAgent(ctx, sessionID, query)
+		} else {
+			resp, err = s.orchestrator.Chat(ctx, query)
+		}
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%w after %s", domain.ErrChatTimeout, s.cfg.RAG.ChatTimeout)
+		}
+		if domain.IsTimeout(err) {
+			// Reported to the client instead of answered, so it can retry
+			return nil, err
+		}
+		if errors.Is(err, domain.ErrLLMUnavailable) {
+			resp = &domain.ChatResponse{SessionID: sessionID, Answer: err.Error()}
+		} else if err != nil {
 			// Fallback to placeholder on error
 			resp = &domain.ChatResponse{
 				SessionID: sessionID,
@@ -75,6 +110,11 @@ func (s *ChatService) Chat(ctx context.Context, siteID string, req *domain.ChatR
 			}
 		} else {
 			resp.SessionID = sessionID
+			// The no-answer reply is per site, while cache keys are not
+			if cacheKey != "" && resp.Answer != query.noAnswer() {
+				s.cache.Set(cacheKey, resp.Answer, resp.Sources)
+			}
+			resp.Disclaimer, resp.KnowledgeCutoff = s.disclaimer(site)
 		}
 	} else {
 		// No orchestrator service configured
@@ -84,6 +124,10 @@ func (s *ChatService) Chat(ctx context.Context, siteID string, req *domain.ChatR
 		}
 	}
 
+	if s.suggestFollowups(query, resp.Answer, resp.Sources) {
+		resp.SuggestedQuestions = s.orchestrator.SuggestFollowups(ctx, req.Message, resp.Answer, resp.Sources)
+	}
+
 	// Save assistant message
 	assistantMsg := &domain.Message{
 		SessionID: sessionID,
@@ -94,15 +138,34 @@ func (s *ChatService) Chat(ctx context.Context, siteID string, req *domain.ChatR
 	if err := s.sessionRepo.CreateMessage(assistantMsg); err != nil {
 		return nil, err
 	}
+	resp.MessageID = assistantMsg.ID
 
 	// Update session
 	if err := s.sessionRepo.Update(sessionID); err != nil {
 		return nil, err
 	}
+	s.recordGap(site, sessionID, req.Message, resp.Answer, resp.Sources)
+
+	// Cached and fallback answers skip timed retrieval; report their sources
+	if resp.Diagnostics == nil {
+		resp.Diagnostics = &domain.RetrievalDiagnostics{}
+	}
+	resp.Diagnostics.SourcesCount = len(resp.Sources)
+	for _, src := range resp.Sources {
+		resp.Diagnostics.TopScore = max(resp.Diagnostics.TopScore, src.Score)
+	}
 
 	return resp, nil
 }
 
+// LLMStatus reports the LLM circuit breaker state
+func (s *ChatService) LLMStatus() BreakerStatus {
+	if s.orchestrator == nil {
+		return BreakerStatus{State: BreakerDisabled}
+	}
+	return s.orchestrator.BreakerStatus()
+}
+
 // ChatStream handles a streaming chat message using Orchestrator Agent
 func (s *ChatService) ChatStream(ctx context.Context, siteID string, req *domain.ChatRequest) (<-chan domain.StreamChunk, error) {
 	// Verify site exists
@@ -113,19 +176,438 @@ func (s *ChatService) ChatStream(ctx context.Context, siteID string, req *domain
 	if site == nil {
 		return nil, domain.ErrNotFound
 	}
+	site.CollectionIDs = s.siteCollections(site)
 
-	// Use Orchestrator Agent for streaming if available
-	if s.orchestrator != nil {
-		return s.orchestrator.ChatStream(ctx, req.Message, site.CollectionIDs, req.SessionID)
+	if err := s.checkModel(site, req); err != nil {
+		return nil, err
+	}
+	if err := checkFilters(site, req); err != nil {
+		return nil, err
+	}
+
+	if site.IsBlocked(req.Message) {
+		session, messageID, err := s.recordBlockedTurn(site, req)
+		if err != nil {
+			return nil, err
+		}
+		ch := make(chan domain.StreamChunk, 3)
+		ch <- domain.StreamChunk{Type: "session", SessionID: session.ID}
+		ch <- domain.StreamChunk{Type: "content", Content: site.BlockedAnswer()}
+		ch <- domain.StreamChunk{Type: "done", MessageID: messageID}
+		close(ch)
+		return ch, nil
 	}
 
 	// Fallback to simple streaming
-	ch := make(chan domain.StreamChunk, 100)
+	if s.orchestrator == nil {
+		ch := make(chan domain.StreamChunk, 100)
+		go func() {
+			defer close(ch)
+			ch <- domain.StreamChunk{Type: "thinking", Content: "Processing..."}
+			ch <- domain.StreamChunk{Type: "content", Content: "Orchestrator Agent not configured."}
+			ch <- domain.StreamChunk{Type: "done"}
+		}()
+		return ch, nil
+	}
+
+	ctx, cancel := s.streamContext(ctx)
+	session, query, err := s.beginTurn(ctx, site, req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var upstream <-chan domain.StreamChunk
+	cacheKey := s.cacheKey(query)
+	if answer, sources, ok := s.cachedAnswer(cacheKey); ok {
+		upstream = replayAnswer(answer, sources)
+		cacheKey = ""
+	} else if query.Mode == domain.ChatModeAgent {
+		upstream = s.orchestrator.ChatWithAgentStream(ctx, session.ID, query)
+	} else if upstream, err = s.orchestrator.ChatStream(ctx, query); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	disclaimer, cutoff := s.disclaimer(site)
+
+	// Relay the orchestrator stream, persisting the assistant answer when it
+	// completes. The relay stops when the client goes away or the stream
+	// times out; the orchestrator sees the same context and stops too.
+	stream := newChunkStream(ctx, 100)
 	go func() {
-		defer close(ch)
-		ch <- domain.StreamChunk{Type: "thinking", Content: "Processing..."}
-		ch <- domain.StreamChunk{Type: "content", Content: "Orchestrator Agent not configured."}
-		ch <- domain.StreamChunk{Type: "done"}
+		defer cancel()
+		defer stream.close()
+
+		// Send session_id to client
+		if !stream.send(domain.StreamChunk{Type: "session", SessionID: session.ID}) {
+			return
+		}
+
+		var answer strings.Builder
+		var sources []domain.Source
+		failed := false
+		for chunk := range upstream {
+			switch chunk.Type {
+			case "content":
+				answer.WriteString(chunk.Content)
+			case "sources":
+				sources = chunk.Sources
+			case "error":
+				failed = true
+			case "done":
+				if cacheKey != "" && !failed && answer.String() != query.noAnswer() {
+					s.cache.Set(cacheKey, answer.String(), sources)
+				}
+				assistantMsg := &domain.Message{
+					SessionID: session.ID,
+					Role:      "assistant",
+					Content:   answer.String(),
+					Sources:   sources,
+				}
+				if err := s.sessionRepo.CreateMessage(assistantMsg); err != nil {
+					log.Printf("[Chat] failed to save assistant message: %v", err)
+				} else {
+					chunk.MessageID = assistantMsg.ID
+				}
+				if err := s.sessionRepo.Update(session.ID); err != nil {
+					log.Printf("[Chat] failed to update session: %v", err)
+				}
+				if !failed {
+					s.recordGap(site, session.ID, req.Message, answer.String(), sources)
+				}
+				if disclaimer != "" && !failed {
+					stream.send(domain.StreamChunk{Type: "disclaimer", Content: disclaimer, KnowledgeCutoff: cutoff})
+				}
+				if !failed && s.suggestFollowups(query, answer.String(), sources) {
+					if questions := s.orchestrator.SuggestFollowups(ctx, req.Message, answer.String(), sources); len(questions) > 0 {
+						stream.send(domain.StreamChunk{Type: "suggestions", Suggestions: questions})
+					}
+				}
+			}
+			if !stream.send(chunk) {
+				return
+			}
+		}
 	}()
-	return ch, nil
+
+	return stream.ch, nil
+}
+
+// suggestFollowups reports whether an answer gets follow-up suggestions:
+// rag.suggest_followups is on and the answer is grounded in sources
+func (s *ChatService) suggestFollowups(query *ChatQuery, answer string, sources []domain.Source) bool {
+	return s.cfg.RAG.SuggestFollowups && s.orchestrator != nil && len(sources) > 0 && answer != query.noAnswer()
+}
+
+// cacheKey returns the answer cache key for a query, or "" when the answer
+// should not be cached. Only unfiltered fast-mode first turns are cached since
+// earlier conversation, or the agent's session memory, shapes the answer;
+// min_score overrides are for experiments and skip the cache too. Sites
+// without collections search every document, including ones outside any
+// collection, which no version stamp covers, so their answers aren't cached.
+func (s *ChatService) cacheKey(query *ChatQuery) string {
+	if s.cache == nil || s.orchestrator == nil || query.Summary != "" || len(query.History) > 0 || len(query.Filters) > 0 ||
+		query.Mode == domain.ChatModeAgent || query.MinScore != nil || len(query.CollectionIDs) == 0 {
+		return ""
+	}
+	versions, err := s.collectionRepo.Versions(query.CollectionIDs)
+	if err != nil {
+		log.Printf("[Chat] failed to read collection versions: %v", err)
+		return ""
+	}
+	return answerCacheKey(query.searchText(), query.Model, query.Language, query.CleanSources,
+		s.orchestrator.topK(query), s.orchestrator.searchMode(query.SearchMode), versions)
+}
+
+func (s *ChatService) cachedAnswer(key string) (string, []domain.Source, bool) {
+	if key == "" {
+		return "", nil, false
+	}
+	return s.cache.Get(key)
+}
+
+// replayAnswer emits a cached answer as an orchestrator stream
+func replayAnswer(answer string, sources []domain.Source) <-chan domain.StreamChunk {
+	ch := make(chan domain.StreamChunk, 3)
+	ch <- domain.StreamChunk{Type: "content", Content: answer}
+	ch <- domain.StreamChunk{Type: "sources", Sources: sources}
+	ch <- domain.StreamChunk{Type: "done"}
+	close(ch)
+	return ch
+}
+
+// siteCollections returns the collections a site answers from: its own, or
+// rag.default_collection when it opted in and has no documents of its own
+func (s *ChatService) siteCollections(site *domain.Site) []string {
+	if !site.UseDefaultCollection || s.cfg.RAG.DefaultCollection == "" {
+		return site.CollectionIDs
+	}
+	for _, id := range site.CollectionIDs {
+		collection, err := s.collectionRepo.Get(id)
+		if err != nil {
+			log.Printf("[Chat] failed to load collection %s: %v", id, err)
+			return site.CollectionIDs
+		}
+		if collection != nil && collection.DocumentCount > 0 {
+			return site.CollectionIDs
+		}
+	}
+	return []string{s.cfg.RAG.DefaultCollection}
+}
+
+// disclaimer renders the site's disclaimer with the knowledge cutoff: the
+// date of the latest document ingested into the site's collections
+func (s *ChatService) disclaimer(site *domain.Site) (string, string) {
+	if site.Disclaimer == "" {
+		return "", ""
+	}
+	latest, err := s.collectionRepo.LastIngested(site.CollectionIDs)
+	if err != nil {
+		log.Printf("[Chat] failed to read knowledge cutoff: %v", err)
+	}
+	cutoff := ""
+	if !latest.IsZero() {
+		cutoff = latest.Format(domain.KnowledgeCutoffLayout)
+	}
+	return site.DisclaimerText(latest), cutoff
+}
+
+// chatContext bounds a whole chat turn by rag.chat_timeout
+func (s *ChatService) chatContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.cfg.RAG.ChatTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.cfg.RAG.ChatTimeout)
+}
+
+// streamContext bounds a streamed chat turn by rag.stream_timeout. It is
+// cancelled when the client disconnects, since handlers pass the request
+// context.
+func (s *ChatService) streamContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.cfg.RAG.StreamTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.cfg.RAG.StreamTimeout)
+}
+
+// beginTurn resolves the session for a request, prepares the conversation
+// history for the prompt and records the incoming user message
+func (s *ChatService) beginTurn(ctx context.Context, site *domain.Site, req *domain.ChatRequest) (*domain.Session, *ChatQuery, error) {
+	session, err := s.resolveSession(site, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	history, err := s.sessionRepo.GetMessages(session.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	summary, recent := s.condenseHistory(ctx, session, history)
+	recent = limitHistory(recent, s.cfg.RAG.HistoryTurns, s.cfg.RAG.HistoryTokenBudget)
+
+	// Save user message
+	userMsg := &domain.Message{
+		SessionID: session.ID,
+		Role:      "user",
+		Content:   req.Message,
+		Language:  detectLanguage(req.Message),
+	}
+	if err := s.sessionRepo.CreateMessage(userMsg); err != nil {
+		return nil, nil, err
+	}
+
+	query := &ChatQuery{
+		Message:       req.Message,
+		CollectionIDs: site.CollectionIDs,
+		Summary:       summary,
+		History:       recent,
+		CleanSources:  req.CleanSources,
+		Model:         req.Model,
+		Filters:       req.Filters,
+		Mode:          req.Mode,
+		TopK:          min(req.TopK, domain.MaxTopK),
+		SearchMode:    req.SearchMode,
+		NoAnswer:      site.NoAnswerMessage(),
+		MinScore:      req.MinScore,
+		Language:      site.PinnedLanguage(),
+	}
+	if query.Language == "" {
+		query.Language = userMsg.Language
+	}
+	if query.Mode == "" {
+		query.Mode = domain.ChatModeFast
+	}
+	query.Synonyms, query.EmbedSynonyms = s.collectionSynonyms(site.CollectionIDs)
+	if s.cfg.RAG.NormalizeQuestions {
+		query.Normalized = normalizeQuestion(req.Message, s.cfg.RAG.NormalizeLowercase)
+	}
+	return session, query, nil
+}
+
+// checkModel rejects model overrides the caller may not use. Widget requests
+// are limited to the site's allowed models; admin requests to configured ones.
+func (s *ChatService) checkModel(site *domain.Site, req *domain.ChatRequest) error {
+	if req.Model == "" || req.Model == s.cfg.LLM.LLMModel {
+		return nil
+	}
+	if !s.cfg.LLM.HasModel(req.Model) {
+		return fmt.Errorf("%w: model %q is not configured", domain.ErrInvalidRequest, req.Model)
+	}
+	if !req.Admin && !site.AllowsModel(req.Model) {
+		return fmt.Errorf("%w: model %q is not allowed for this site", domain.ErrInvalidRequest, req.Model)
+	}
+	return nil
+}
+
+// checkFilters rejects widget filters on metadata keys the site does not
+// allow; admin requests may filter on any key
+func checkFilters(site *domain.Site, req *domain.ChatRequest) error {
+	if req.Admin {
+		return nil
+	}
+	for key := range req.Filters {
+		if !site.AllowsFilter(key) {
+			return fmt.Errorf("%w: filter key %q is not allowed for this site", domain.ErrInvalidRequest, key)
+		}
+	}
+	return nil
+}
+
+// resolveSession returns the request's session, creating it when needed.
+// Sessions of other sites are reported as not found.
+func (s *ChatService) resolveSession(site *domain.Site, req *domain.ChatRequest) (*domain.Session, error) {
+	if req.SessionID != "" {
+		session, err := s.sessionRepo.Get(req.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		if session != nil {
+			// Check ownership first so a request can't relink another
+			// site's session to its own user
+			if session.SiteID != site.ID {
+				return nil, domain.ErrNotFound
+			}
+			return session, s.linkSession(session, req)
+		}
+	}
+
+	session := &domain.Session{
+		ID:             req.SessionID,
+		SiteID:         site.ID,
+		ExternalUserID: req.ExternalUserID,
+		Metadata:       req.SessionMetadata,
+	}
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// linkSession applies a request's external user ID and metadata to an existing session
+func (s *ChatService) linkSession(session *domain.Session, req *domain.ChatRequest) error {
+	changed := false
+	if req.ExternalUserID != "" && req.ExternalUserID != session.ExternalUserID {
+		session.ExternalUserID = req.ExternalUserID
+		changed = true
+	}
+	if req.SessionMetadata != nil {
+		session.Metadata = req.SessionMetadata
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return s.sessionRepo.UpdateLink(session.ID, session.ExternalUserID, session.Metadata)
+}
+
+// recordBlockedTurn stores a blocked question and the canned reply in the
+// session, returning the session and the reply's message ID
+func (s *ChatService) recordBlockedTurn(site *domain.Site, req *domain.ChatRequest) (*domain.Session, string, error) {
+	session, err := s.resolveSession(site, req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	reply := &domain.Message{SessionID: session.ID, Role: "assistant", Content: site.BlockedAnswer()}
+	for _, msg := range []*domain.Message{
+		{SessionID: session.ID, Role: "user", Content: req.Message},
+		reply,
+	} {
+		if err := s.sessionRepo.CreateMessage(msg); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := s.sessionRepo.Update(session.ID); err != nil {
+		return nil, "", err
+	}
+	return session, reply.ID, nil
+}
+
+// condenseHistory folds older turns into the session's running summary once
+// the unsummarized history grows past rag.summarize_after, and returns the
+// summary together with the turns that should still be sent verbatim
+func (s *ChatService) condenseHistory(ctx context.Context, session *domain.Session, history []*domain.Message) (string, []*domain.Message) {
+	summarized := session.SummarizedCount
+	if summarized > len(history) {
+		summarized = len(history)
+	}
+	pending := history[summarized:]
+
+	threshold := s.cfg.RAG.SummarizeAfter
+	if threshold <= 0 || s.orchestrator == nil || len(pending) <= threshold {
+		return session.Summary, pending
+	}
+
+	keep := s.cfg.RAG.SummaryKeepRecent
+	if keep < 0 {
+		keep = 0
+	}
+	if keep >= len(pending) {
+		return session.Summary, pending
+	}
+	fold := pending[:len(pending)-keep]
+
+	summary, err := s.orchestrator.SummarizeConversation(ctx, session.Summary, fold)
+	if err != nil {
+		// Non-fatal, keep sending the raw turns
+		log.Printf("[Chat] conversation summarization failed: %v", err)
+		return session.Summary, pending
+	}
+
+	session.Summary = summary
+	session.SummarizedCount = summarized + len(fold)
+	if err := s.sessionRepo.UpdateSummary(session.ID, session.Summary, session.SummarizedCount); err != nil {
+		log.Printf("[Chat] failed to store conversation summary: %v", err)
+	}
+
+	return session.Summary, pending[len(fold):]
+}
+
+// historyCharsPerToken approximates prompt tokens from message length
+const historyCharsPerToken = 4
+
+// limitHistory keeps the last turns question/answer pairs (rag.history_turns),
+// then drops the oldest messages until the rest fit in tokenBudget (0 means
+// unbounded)
+func limitHistory(history []*domain.Message, turns, tokenBudget int) []*domain.Message {
+	if turns <= 0 {
+		return nil
+	}
+	if len(history) > turns*2 {
+		history = history[len(history)-turns*2:]
+	}
+	if tokenBudget <= 0 {
+		return history
+	}
+
+	tokens := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		tokens += len(history[i].Content)/historyCharsPerToken + 1
+		if tokens > tokenBudget {
+			return history[i+1:]
+		}
+	}
+	return history
 }
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/config"
+	"github.com/liliang-cn/askdoc/internal/domain"
+	"github.com/liliang-cn/askdoc/internal/repository"
+)
+
+func TestResolveSessionRejectsOtherSites(t *testing.T) {
+	db := newTestDB(t)
+	siteRepo := repository.NewSiteRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	s := &ChatService{siteRepo: siteRepo, sessionRepo: sessionRepo}
+
+	owner := &domain.Site{Name: "owner"}
+	other := &domain.Site{Name: "other"}
+	for _, site := range []*domain.Site{owner, other} {
+		if err := siteRepo.Create(site); err != nil {
+			t.Fatalf("failed to create site: %v", err)
+		}
+	}
+	session := &domain.Session{SiteID: owner.ID, ExternalUserID: "alice"}
+	if err := sessionRepo.Create(session); err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	hijack := &domain.ChatRequest{
+		SessionID:       session.ID,
+		ExternalUserID:  "mallory",
+		SessionMetadata: map[string]any{"plan": "free"},
+	}
+	if _, err := s.resolveSession(other, hijack); err != domain.ErrNotFound {
+		t.Fatalf("resolveSession from another site: err = %v, want ErrNotFound", err)
+	}
+	stored, err := sessionRepo.Get(session.ID)
+	if err != nil {
+		t.Fatalf("failed to get session: %v", err)
+	}
+	if stored.ExternalUserID != "alice" || stored.Metadata != nil {
+		t.Errorf("another site relinked the session: external user %q, metadata %v", stored.ExternalUserID, stored.Metadata)
+	}
+
+	got, err := s.resolveSession(owner, &domain.ChatRequest{SessionID: session.ID})
+	if err != nil {
+		t.Fatalf("resolveSession from the owning site: %v", err)
+	}
+	if got.ID != session.ID {
+		t.Errorf("resolveSession returned session %s, want %s", got.ID, session.ID)
+	}
+}
+
+func TestCacheKeyScope(t *testing.T) {
+	db := newTestDB(t)
+	collectionRepo := repository.NewCollectionRepository(db)
+	cfg := &config.Config{}
+	s := &ChatService{
+		cfg:            cfg,
+		collectionRepo: collectionRepo,
+		orchestrator:   &OrchestratorService{cfg: cfg},
+		cache:          NewAnswerCache(0, 10),
+	}
+
+	collection := &domain.Collection{Name: "docs"}
+	if err := collectionRepo.Create(collection); err != nil {
+		t.Fatalf("failed to create collection: %v", err)
+	}
+
+	if key := s.cacheKey(&ChatQuery{Message: "What is AskDoc?"}); key != "" {
+		t.Errorf("unscoped query got cache key %q, want none", key)
+	}
+
+	scoped := &ChatQuery{Message: "What is AskDoc?", CollectionIDs: []string{collection.ID}}
+	before := s.cacheKey(scoped)
+	if before == "" {
+		t.Fatal("scoped query got no cache key")
+	}
+	if err := collectionRepo.BumpVersion(collection.ID); err != nil {
+		t.Fatalf("failed to bump version: %v", err)
+	}
+	if after := s.cacheKey(scoped); after == before {
+		t.Error("cache key unchanged after the collection's content changed")
+	}
+}
+
+func TestChatSummarizesLongHistory(t *testing.T) {
+	env := newTestEnv(t, "rag:\n  summarize_after: 4\n  summary_keep_recent: 2\n")
+	env.generator.reply = func(prompt string) (string, error) {
+		if strings.HasPrefix(prompt, "Condense the conversation") {
+			return "The user is setting up the blue widget.", nil
+		}
+		return "answer", nil
+	}
+	collection := env.createCollection(t, "docs")
+	env.upload(t, collection.ID, "widgets.md", []byte("# Widgets\n\nThe blue widget is configured in the settings panel."), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+
+	questions := []string{
+		"first question about the blue widget",
+		"second question about the blue widget",
+		"third question about the blue widget",
+		"how do I configure the blue widget?",
+	}
+	var sessionID string
+	for _, question := range questions {
+		resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: question, SessionID: sessionID})
+		if err != nil {
+			t.Fatalf("Chat(%q): %v", question, err)
+		}
+		sessionID = resp.SessionID
+	}
+
+	session, err := env.sessionRepo.Get(sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Summary != "The user is setting up the blue widget." || session.SummarizedCount != 4 {
+		t.Errorf("session summary = %q over %d messages, want the generated summary over 4", session.Summary, session.SummarizedCount)
+	}
+
+	prompt := env.generator.lastPrompt()
+	if !strings.Contains(prompt, "Summary of earlier conversation:\nThe user is setting up the blue widget.") {
+		t.Errorf("answer prompt lacks the summary:\n%s", prompt)
+	}
+	for _, folded := range questions[:2] {
+		if strings.Contains(prompt, folded) {
+			t.Errorf("answer prompt still has the summarized turn %q:\n%s", folded, prompt)
+		}
+	}
+	if !strings.Contains(prompt, questions[2]) {
+		t.Errorf("answer prompt lacks the recent turn %q:\n%s", questions[2], prompt)
+	}
+}
+
+func TestChatBlocklist(t *testing.T) {
+	env := newTestEnv(t, "")
+	collection := env.createCollection(t, "docs")
+	env.upload(t, collection.ID, "widgets.md", []byte("# Widgets\n\nThe blue widget is configured in the settings panel."), nil)
+	site := env.createSite(t, &domain.Site{
+		Name:            "docs",
+		CollectionIDs:   []string{collection.ID},
+		Blocklist:       []string{"acme corp", `/\bpric(e|ing)\b/`},
+		BlockedResponse: "Please contact sales.",
+	})
+	embedCalls := env.embedder.calls
+
+	for _, question := range []string{"Is ACME Corp better?", "What is the Pricing?"} {
+		resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: question})
+		if err != nil {
+			t.Fatalf("Chat(%q): %v", question, err)
+		}
+		if resp.Answer != "Please contact sales." || len(resp.Sources) != 0 {
+			t.Errorf("Chat(%q) = %q with %d sources, want the canned response", question, resp.Answer, len(resp.Sources))
+		}
+	}
+	if env.embedder.calls != embedCalls || len(env.generator.prompts) != 0 {
+		t.Errorf("blocked questions reached retrieval or generation: %d embeddings, %d prompts", env.embedder.calls-embedCalls, len(env.generator.prompts))
+	}
+
+	resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: "How do I configure the blue widget?"})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.Answer != "answer" || len(resp.Sources) == 0 {
+		t.Errorf("unblocked question = %q with %d sources, want a generated answer with sources", resp.Answer, len(resp.Sources))
+	}
+}
+
+func TestChatModelAllowlist(t *testing.T) {
+	env := newTestEnv(t, "llm:\n  models: [\"small\", \"large\"]\n")
+	// Stand-ins for the generators the provider factory would create
+	small := &fakeGenerator{reply: func(string) (string, error) { return "from small", nil }}
+	large := &fakeGenerator{reply: func(string) (string, error) { return "from large", nil }}
+	env.orchestrator.models["small"] = small
+	env.orchestrator.models["large"] = large
+	collection := env.createCollection(t, "docs")
+	env.upload(t, collection.ID, "widgets.md", []byte("The blue widget is configured in the settings panel."), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}, AllowedModels: []string{"small"}})
+	question := "how is the blue widget configured?"
+
+	_, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: question, Model: "large"})
+	if !errors.Is(err, domain.ErrInvalidRequest) {
+		t.Fatalf("widget chat with a disallowed model: err = %v, want ErrInvalidRequest", err)
+	}
+	if len(large.prompts) != 0 {
+		t.Error("the disallowed model was called")
+	}
+
+	resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: question, Model: "small"})
+	if err != nil {
+		t.Fatalf("widget chat with an allowed model: %v", err)
+	}
+	if resp.Answer != "from small" {
+		t.Errorf("widget chat with an allowed model answered %q, want the model's answer", resp.Answer)
+	}
+
+	// Admin requests may use any configured model
+	resp, err = env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: question, Model: "large", Admin: true})
+	if err != nil {
+		t.Fatalf("admin chat with a configured model: %v", err)
+	}
+	if resp.Answer != "from large" {
+		t.Errorf("admin chat answered %q, want the model's answer", resp.Answer)
+	}
+	if _, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: question, Model: "unknown", Admin: true}); !errors.Is(err, domain.ErrInvalidRequest) {
+		t.Errorf("admin chat with an unconfigured model: err = %v, want ErrInvalidRequest", err)
+	}
+}
+
+func TestChatDisclaimer(t *testing.T) {
+	env := newTestEnv(t, "")
+	guides := env.createCollection(t, "guides")
+	faq := env.createCollection(t, "faq")
+	other := env.createCollection(t, "other")
+	env.upload(t, guides.ID, "widgets.md", []byte("The blue widget is configured in the settings panel."), nil)
+	if col, err := env.collectionRepo.Get(guides.ID); err != nil || col.LastIngestedAt == nil {
+		t.Fatalf("ingestion did not record its time: %v, %v", col, err)
+	}
+
+	// The cutoff is the latest ingestion across the site's collections only
+	dates := map[string]time.Time{
+		guides.ID: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		faq.ID:    time.Date(2026, 5, 20, 12, 0, 0, 0, time.UTC),
+		other.ID:  time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC),
+	}
+	for id, at := range dates {
+		if err := env.collectionRepo.SetLastIngested(id, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	site := env.createSite(t, &domain.Site{
+		Name:          "docs",
+		CollectionIDs: []string{guides.ID, faq.ID},
+		Disclaimer:    "Not legal advice. Information current as of {cutoff}.",
+	})
+	plain := env.createSite(t, &domain.Site{Name: "plain", CollectionIDs: []string{guides.ID, faq.ID}})
+
+	resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: "how is the blue widget configured?"})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.Disclaimer != "Not legal advice. Information current as of 2026-05-20." || resp.KnowledgeCutoff != "2026-05-20" {
+		t.Errorf("disclaimer = %q, cutoff %q; want the rendered disclaimer as of 2026-05-20", resp.Disclaimer, resp.KnowledgeCutoff)
+	}
+
+	resp, err = env.chat.Chat(context.Background(), plain.ID, &domain.ChatRequest{Message: "how is the blue widget configured?"})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.Disclaimer != "" || resp.KnowledgeCutoff != "" {
+		t.Errorf("site without a disclaimer got %q, cutoff %q", resp.Disclaimer, resp.KnowledgeCutoff)
+	}
+}
+
+func TestChatNormalizesQuestions(t *testing.T) {
+	env := newTestEnv(t, "rag:\n  normalize_questions: true\n  normalize_lowercase: true\n")
+	collection := env.createCollection(t, "docs")
+	env.upload(t, collection.ID, "install.md", []byte("Install the agent with the package manager."), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+
+	asked := "How do I install the agent?"
+	variant := "  how do I\tinstall   the AGENT  "
+	var keys []string
+	for _, question := range []string{asked, variant} {
+		_, query, err := env.chat.beginTurn(context.Background(), site, &domain.ChatRequest{Message: question})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query.Normalized != "how do i install the agent" || query.Message != question {
+			t.Errorf("query for %q = %q normalized to %q, want the original normalized to %q", question, query.Message, query.Normalized, "how do i install the agent")
+		}
+		keys = append(keys, env.chat.cacheKey(query))
+	}
+	if keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("cache keys %q differ for questions differing only in whitespace and case", keys)
+	}
+
+	resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: asked})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	// The variant is answered from the cache, and the session keeps what was typed
+	prompts := len(env.generator.prompts)
+	again, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: variant})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if len(env.generator.prompts) != prompts || again.Answer != resp.Answer {
+		t.Errorf("variant question was answered again instead of from the cache")
+	}
+	messages, err := env.sessionRepo.GetMessages(again.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) == 0 || messages[0].Content != variant {
+		t.Errorf("stored question = %+v, want %q as typed", messages, variant)
+	}
+}
+
+func TestChatDiagnosticsHeaders(t *testing.T) {
+	env := newTestEnv(t, "")
+	collection := env.createCollection(t, "docs")
+	env.upload(t, collection.ID, "install.md", []byte("Install the agent with the package manager."), nil)
+	env.upload(t, collection.ID, "upgrade.md", []byte("Upgrade the agent by reinstalling it."), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+	env.embedder.delay = 20 * time.Millisecond
+	env.generator.delay = 30 * time.Millisecond
+
+	resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: "How do I install the agent?"})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if len(resp.Sources) == 0 {
+		t.Fatal("chat found no sources")
+	}
+	headers := resp.Diagnostics.Headers()
+	for _, name := range []string{"X-AskDoc-Sources-Count", "X-AskDoc-Top-Score", "X-AskDoc-Retrieval-Ms", "X-AskDoc-Generation-Ms"} {
+		if headers[name] == "" {
+			t.Errorf("%s header missing", name)
+		}
+	}
+	if got, want := headers["X-AskDoc-Sources-Count"], strconv.Itoa(len(resp.Sources)); got != want {
+		t.Errorf("X-AskDoc-Sources-Count = %s, want %s", got, want)
+	}
+	if score, err := strconv.ParseFloat(headers["X-AskDoc-Top-Score"], 64); err != nil || score <= 0 || score > 1 ||
+		math.Abs(score-resp.Sources[0].Score) > 1e-4 {
+		t.Errorf("X-AskDoc-Top-Score = %s, want the best source's score %.4f", headers["X-AskDoc-Top-Score"], resp.Sources[0].Score)
+	}
+	if ms, err := strconv.ParseInt(headers["X-AskDoc-Retrieval-Ms"], 10, 64); err != nil || ms < 20 || ms > 10000 {
+		t.Errorf("X-AskDoc-Retrieval-Ms = %s, want at least the 20ms embedding", headers["X-AskDoc-Retrieval-Ms"])
+	}
+	if ms, err := strconv.ParseInt(headers["X-AskDoc-Generation-Ms"], 10, 64); err != nil || ms < 30 || ms > 10000 {
+		t.Errorf("X-AskDoc-Generation-Ms = %s, want at least the 30ms generation", headers["X-AskDoc-Generation-Ms"])
+	}
+
+	// Cached answers still report their sources
+	cached, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: "How do I install the agent?"})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if got := cached.Diagnostics.Headers(); got["X-AskDoc-Sources-Count"] != headers["X-AskDoc-Sources-Count"] || got["X-AskDoc-Generation-Ms"] != "0" {
+		t.Errorf("cached answer headers = %v, want the same sources and no generation", got)
+	}
+}
+
+func TestChatDefaultCollectionFallback(t *testing.T) {
+	env := newTestEnv(t, "")
+	shared := env.createCollection(t, "shared")
+	sharedDoc := env.upload(t, shared.ID, "install.md", []byte("Install the agent with the package manager."), nil)
+	own := env.createCollection(t, "own")
+	ownDoc := env.upload(t, own.ID, "agent.md", []byte("Install the agent from the downloads page."), nil)
+	empty := env.createCollection(t, "empty")
+	env.cfg.RAG.DefaultCollection = shared.ID
+
+	tests := []struct {
+		name string
+		site *domain.Site
+		want string // cited document, "" for none
+	}{
+		{"no collections, opted in", &domain.Site{Name: "new", UseDefaultCollection: true}, sharedDoc.ID},
+		{"empty collection, opted in", &domain.Site{Name: "empty", CollectionIDs: []string{empty.ID}, UseDefaultCollection: true}, sharedDoc.ID},
+		{"own content, opted in", &domain.Site{Name: "own", CollectionIDs: []string{own.ID}, UseDefaultCollection: true}, ownDoc.ID},
+		{"empty collection, not opted in", &domain.Site{Name: "plain", CollectionIDs: []string{empty.ID}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := env.createSite(t, tt.site)
+			resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: "How do I install the agent?"})
+			if err != nil {
+				t.Fatalf("Chat: %v", err)
+			}
+			var cited []string
+			for _, source := range resp.Sources {
+				cited = append(cited, source.DocumentID)
+			}
+			if tt.want == "" && len(cited) != 0 || tt.want != "" && (len(cited) != 1 || cited[0] != tt.want) {
+				t.Errorf("cited %v, want %q", cited, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// chunkStream is the sending side of a chat stream. A send gives up once ctx
+// is done, so a reader that went away or a stream past its deadline never
+// leaves the sending goroutine blocked, and sends after close are dropped.
+type chunkStream struct {
+	ctx context.Context
+	ch  chan askdocdomain.StreamChunk
+
+	mu     sync.Mutex
+	closed bool
+	ended  bool // a done or error chunk was sent
+}
+
+func newChunkStream(ctx context.Context, size int) *chunkStream {
+	return &chunkStream{ctx: ctx, ch: make(chan askdocdomain.StreamChunk, size)}
+}
+
+// send reports whether the chunk was delivered
+func (s *chunkStream) send(chunk askdocdomain.StreamChunk) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.ch <- chunk:
+		if chunk.Type == "done" || chunk.Type == "error" {
+			s.ended = true
+		}
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// sendError sends an error chunk
+func (s *chunkStream) sendError(err error) {
+	s.send(askdocdomain.StreamChunk{Type: "error", Content: err.Error()})
+}
+
+// close ends the stream. A stream cut short by its context gets a final
+// error chunk if the reader still has room for it.
+func (s *chunkStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if !s.ended && s.ctx.Err() != nil {
+		select {
+		case s.ch <- askdocdomain.StreamChunk{Type: "error", Content: streamError(s.ctx).Error()}:
+		default:
+		}
+	}
+	s.closed = true
+	close(s.ch)
+}
+
+// streamError reports why a stream's context ended
+func streamError(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return askdocdomain.ErrStreamTimeout
+	}
+	return askdocdomain.ErrStreamCancelled
+}
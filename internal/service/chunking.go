@@ -0,0 +1,73 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/liliang-cn/askdoc/internal/config"
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// collectionChunking returns the chunk size and overlap documents of a
+// collection are split with: its overrides where set, rag.chunk_size and
+// rag.chunk_overlap otherwise
+func collectionChunking(cfg *config.Config, collection *domain.Collection) (size, overlap int) {
+	size, overlap = cfg.RAG.ChunkSize, cfg.RAG.ChunkOverlap
+	if collection == nil {
+		return size, overlap
+	}
+	if collection.ChunkSize != nil {
+		size = *collection.ChunkSize
+	}
+	if collection.ChunkOverlap != nil {
+		overlap = *collection.ChunkOverlap
+	}
+	return size, overlap
+}
+
+// checkChunking rejects a chunk size and overlap the chunker can't use
+func checkChunking(size, overlap int) error {
+	if size <= 0 {
+		return fmt.Errorf("%w: chunk_size must be positive", domain.ErrInvalidRequest)
+	}
+	if overlap < 0 || overlap >= size {
+		return fmt.Errorf("%w: chunk_overlap must be at least 0 and less than chunk_size", domain.ErrInvalidRequest)
+	}
+	return nil
+}
+
+// chunkingOverride is the override stored for a requested value; negative
+// values clear it
+func chunkingOverride(v int) *int {
+	if v < 0 {
+		return nil
+	}
+	return &v
+}
+
+// sameChunking reports whether a document was split with size and overlap.
+// Documents ingested before the values were recorded count as split with
+// rag.chunk_size and rag.chunk_overlap.
+func sameChunking(cfg *config.Config, doc *domain.Document, size, overlap int) bool {
+	docSize, docOverlap := cfg.RAG.ChunkSize, cfg.RAG.ChunkOverlap
+	if v, ok := metadataInt(doc.Metadata, domain.MetadataKeyChunkSize); ok {
+		docSize = v
+	}
+	if v, ok := metadataInt(doc.Metadata, domain.MetadataKeyChunkOverlap); ok {
+		docOverlap = v
+	}
+	return docSize == size && docOverlap == overlap
+}
+
+// metadataInt reads a number from metadata, which holds float64 after a
+// round trip through JSON
+func metadataInt(metadata map[string]any, key string) (int, bool) {
+	switch v := metadata[key].(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerDisabled = "disabled"
+)
+
+// Kinds of LLM calls the circuit breaker counts failures of separately, so
+// embeddings that still work don't hide a generation backend that doesn't
+const (
+	breakerEmbed    = "embed"
+	breakerGenerate = "generate"
+)
+
+// BreakerStatus reports the LLM circuit breaker state
+type BreakerStatus struct {
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`            // most consecutive failures of one kind of call
+	OpenedAt *time.Time `json:"opened_at,omitempty"` // set while open
+}
+
+// CircuitBreaker fast-fails LLM calls once one kind of call has failed
+// threshold times in a row. While open it probes the backend every cooldown
+// and closes again on the first successful probe.
+type CircuitBreaker struct {
+	threshold int // 0 disables the breaker
+	cooldown  time.Duration
+	probe     func(ctx context.Context) error
+
+	mu       sync.Mutex
+	failures map[string]int // consecutive failures by kind of call
+	open     bool
+	openedAt time.Time
+	probing  bool // probeLoop is running
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewCircuitBreaker creates a circuit breaker; probe checks whether the
+// backend has recovered
+func NewCircuitBreaker(threshold int, cooldown time.Duration, probe func(ctx context.Context) error) *CircuitBreaker {
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		probe:     probe,
+		failures:  make(map[string]int),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Allow reports whether a call may go to the backend
+func (b *CircuitBreaker) Allow() bool {
+	if b == nil || b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.open
+}
+
+// Record counts the outcome of a backend call of a kind (breakerEmbed or
+// breakerGenerate). Calls abandoned by their caller (ctx cancelled) say
+// nothing about the backend and are ignored.
+func (b *CircuitBreaker) Record(ctx context.Context, kind string, err error) {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures[kind] = 0
+		if b.open {
+			b.open = false
+			log.Printf("[Chat] LLM circuit breaker closed")
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	b.failures[kind]++
+	if !b.open && b.failures[kind] >= b.threshold {
+		b.open = true
+		b.openedAt = time.Now()
+		log.Printf("[Chat] LLM circuit breaker opened after %d %s failures: %v", b.failures[kind], kind, err)
+		if !b.probing {
+			b.probing = true
+			go b.probeLoop()
+		}
+	}
+}
+
+// probeLoop probes the backend every cooldown until it recovers or the
+// breaker is closed
+func (b *CircuitBreaker) probeLoop() {
+	ticker := time.NewTicker(b.cooldown)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		b.mu.Lock()
+		if !b.open {
+			// A call that was already in flight succeeded and closed the breaker
+			b.probing = false
+			b.mu.Unlock()
+			return
+		}
+		b.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.cooldown)
+		err := b.probe(ctx)
+		cancel()
+
+		if err != nil {
+			log.Printf("[Chat] LLM backend probe failed: %v", err)
+			continue
+		}
+
+		b.mu.Lock()
+		if b.open {
+			b.open = false
+			clear(b.failures)
+			log.Printf("[Chat] LLM circuit breaker closed, backend probe succeeded")
+		}
+		b.probing = false
+		b.mu.Unlock()
+		return
+	}
+}
+
+// Status returns the current breaker state
+func (b *CircuitBreaker) Status() BreakerStatus {
+	if b == nil || b.threshold <= 0 {
+		return BreakerStatus{State: BreakerDisabled}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{State: BreakerClosed}
+	for _, failures := range b.failures {
+		status.Failures = max(status.Failures, failures)
+	}
+	if b.open {
+		openedAt := b.openedAt
+		status.State = BreakerOpen
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// Close stops background probing
+func (b *CircuitBreaker) Close() {
+	if b == nil {
+		return
+	}
+	b.stopOnce.Do(func() { close(b.stop) })
+}
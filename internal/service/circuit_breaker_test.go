@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	env := newTestEnv(t, "llm:\n  breaker_threshold: 3\n  breaker_cooldown: 50ms\n")
+	collection := env.createCollection(t, "docs")
+	env.upload(t, collection.ID, "install.md", []byte("Install the agent with the package manager."), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+	health := NewHealthService(newTestDB(t), env.orchestrator)
+
+	var down atomic.Bool
+	down.Store(true)
+	env.generator.reply = func(prompt string) (string, error) {
+		if down.Load() {
+			return "", errors.New("connection refused")
+		}
+		return "Use the package manager.", nil
+	}
+	ask := func() *domain.ChatResponse {
+		t.Helper()
+		resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: "How do I install the agent?"})
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		return resp
+	}
+
+	for i := 0; i < 3; i++ {
+		if resp := ask(); !strings.HasPrefix(resp.Answer, "Error from Agent") {
+			t.Fatalf("chat %d while down answered %q, want the backend error", i+1, resp.Answer)
+		}
+	}
+	if status := env.orchestrator.BreakerStatus(); status.State != BreakerOpen || status.Failures != 3 {
+		t.Fatalf("breaker after 3 failures = %+v, want open with 3 failures", status)
+	}
+	if ready := health.Ready(context.Background()); ready.Ready || ready.LLM.State != BreakerOpen || ready.Checks["llm"].Status != DependencyDown {
+		t.Errorf("readiness while open = %+v, want unavailable with the breaker open", ready)
+	}
+
+	// Open, chats fail fast without reaching the backend
+	env.generator.mu.Lock()
+	prompts := len(env.generator.prompts)
+	env.generator.mu.Unlock()
+	if resp := ask(); resp.Answer != domain.ErrLLMUnavailable.Error() {
+		t.Errorf("chat while open answered %q, want %q", resp.Answer, domain.ErrLLMUnavailable)
+	}
+	env.generator.mu.Lock()
+	reached := len(env.generator.prompts) > prompts+1 // a probe may run meanwhile
+	env.generator.mu.Unlock()
+	if reached {
+		t.Error("chat while open reached the backend")
+	}
+
+	// The next probe after the backend returns closes it
+	down.Store(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for env.orchestrator.BreakerStatus().State != BreakerClosed {
+		if time.Now().After(deadline) {
+			t.Fatal("breaker did not close after the backend recovered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if resp := ask(); resp.Answer != "Use the package manager." {
+		t.Errorf("chat after recovery answered %q", resp.Answer)
+	}
+	if status := env.orchestrator.BreakerStatus(); status.Failures != 0 {
+		t.Errorf("failures after recovery = %d, want 0", status.Failures)
+	}
+}
+
+func TestCircuitBreakerKeywordFallback(t *testing.T) {
+	env := newTestEnv(t, "llm:\n  breaker_threshold: 1\n  breaker_cooldown: 1h\n  breaker_fallback: true\n")
+	collection := env.createCollection(t, "docs")
+	doc := env.upload(t, collection.ID, "install.md", []byte("Install the agent with the package manager."), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+	env.generator.reply = func(prompt string) (string, error) { return "", errors.New("connection refused") }
+
+	req := &domain.ChatRequest{Message: "How do I install the agent?"}
+	if _, err := env.chat.Chat(context.Background(), site.ID, req); err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if state := env.orchestrator.BreakerStatus().State; state != BreakerOpen {
+		t.Fatalf("breaker state = %s, want open", state)
+	}
+
+	resp, err := env.chat.Chat(context.Background(), site.ID, req)
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if resp.Answer != fallbackMessage || len(resp.Sources) == 0 || resp.Sources[0].DocumentID != doc.ID {
+		t.Errorf("degraded chat = %q with %d sources, want keyword matches", resp.Answer, len(resp.Sources))
+	}
+}
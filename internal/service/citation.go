@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// citationProbeLen is how much of a chunk's start is searched for in the
+// source text to find where the chunk came from
+const citationProbeLen = 80
+
+var (
+	markdownHeadingRe = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+	asciidocHeadingRe = regexp.MustCompile(`^(={1,6})\s+(.+?)\s*$`)
+	markdownFenceRe   = regexp.MustCompile("^\\s*(```|~~~)")
+)
+
+// sectionHeading is a heading and where it starts in the source text
+type sectionHeading struct {
+	offset int
+	level  int
+	text   string
+}
+
+// hasSections reports whether headings can be read from a file type's source text
+func hasSections(fileType string) bool {
+	return fileType == FileTypeMD || fileType == FileTypeADOC
+}
+
+// parseHeadings returns the headings of markdown or asciidoc text in order,
+// ignoring fenced code blocks
+func parseHeadings(fileType, text string) []sectionHeading {
+	headingRe := markdownHeadingRe
+	if fileType == FileTypeADOC {
+		headingRe = asciidocHeadingRe
+	}
+
+	var headings []sectionHeading
+	inFence := false
+	offset := 0
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case fileType == FileTypeMD && markdownFenceRe.MatchString(trimmed):
+			inFence = !inFence
+		case fileType == FileTypeADOC && strings.HasPrefix(trimmed, "----"):
+			inFence = !inFence
+		case !inFence:
+			if m := headingRe.FindStringSubmatch(trimmed); m != nil {
+				headings = append(headings, sectionHeading{offset: offset, level: len(m[1]), text: m[2]})
+			}
+		}
+		offset += len(line)
+	}
+	return headings
+}
+
+// documentTitle is the document's level-1 heading, if it opens with one
+func documentTitle(headings []sectionHeading) string {
+	if len(headings) > 0 && headings[0].level == 1 {
+		return headings[0].text
+	}
+	return ""
+}
+
+// AnnotateSections records the document title and each chunk's section
+// heading in the chunk metadata, used for citation labels. source is the
+// text the document was chunked from.
+func (s *OrchestratorService) AnnotateSections(ctx context.Context, docID, fileType, source string) error {
+	headings := parseHeadings(fileType, source)
+	if len(headings) == 0 {
+		return nil
+	}
+	title := documentTitle(headings)
+
+	embeddings, err := s.sqvectCore.GetByDocID(ctx, docID)
+	if err != nil {
+		return fmt.Errorf("failed to load document chunks: %w", err)
+	}
+	// Chunks come back in insertion (document) order; searching on from the
+	// last match resolves repeated passages to the right section
+	db := s.sqvectCore.GetDB()
+	from := 0
+	for _, emb := range embeddings {
+		if !isContentChunk(emb.Metadata) {
+			continue
+		}
+		offset := locateChunk(source, emb.Content, from)
+		section := ""
+		if offset >= 0 {
+			from = offset
+			section = sectionAt(headings, offset, title)
+		}
+		if _, err := db.ExecContext(ctx, `
+			UPDATE embeddings SET metadata = json_set(COALESCE(metadata, '{}'), '$.title', ?, '$.section', ?)
+			WHERE id = ?
+		`, title, section, emb.ID); err != nil {
+			return fmt.Errorf("failed to update chunk metadata: %w", err)
+		}
+	}
+
+	if title != "" {
+		return s.UpdateDocumentMetadata(ctx, docID, map[string]any{askdocdomain.MetadataKeyTitle: title})
+	}
+	return nil
+}
+
+// locateChunk returns the offset of a chunk's text in source, searching from
+// from first, or -1 when it can't be found
+func locateChunk(source, content string, from int) int {
+	probe := strings.TrimSpace(content)
+	if len(probe) > citationProbeLen {
+		probe = probe[:citationProbeLen]
+		// Don't cut a multi-byte character in half
+		probe = strings.ToValidUTF8(probe, "")
+	}
+	if probe == "" {
+		return -1
+	}
+	if i := strings.Index(source[from:], probe); i >= 0 {
+		return from + i
+	}
+	return strings.Index(source, probe)
+}
+
+// sectionAt returns the heading of the section containing offset; the
+// document title itself is not a section
+func sectionAt(headings []sectionHeading, offset int, title string) string {
+	section := ""
+	for _, h := range headings {
+		if h.offset > offset {
+			break
+		}
+		section = h.text
+		if h.level == 1 && h.text == title {
+			section = ""
+		}
+	}
+	return section
+}
+
+// citationLabel renders a source's citation, e.g. "Installation Guide, §2.3
+// Proxy" or "manual.pdf, p. 12", from the title, section and page captured at
+// ingest. Documents without a title are named by filename.
+func citationLabel(metadata map[string]any, filename string) string {
+	title, _ := metadata[askdocdomain.MetadataKeyTitle].(string)
+	section, _ := metadata[askdocdomain.MetadataKeySection].(string)
+	if title == "" {
+		title = filename
+	}
+	if title == "" {
+		return title
+	}
+	if section != "" {
+		title = fmt.Sprintf("%s, §%s", title, section)
+	}
+	if page := chunkPage(metadata); page > 0 {
+		title = fmt.Sprintf("%s, p. %d", title, page)
+	}
+	return title
+}
+
+// annotateSections reads the headings of a stored markdown or asciidoc
+// upload (at its plaintext path) into its chunks' metadata
+func (s *IngestService) annotateSections(ctx context.Context, document *askdocdomain.Document, path string) error {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return s.orchestrator.AnnotateSections(ctx, document.ID, document.FileType, string(source))
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+func TestSourceCitationLabels(t *testing.T) {
+	env := newTestEnv(t, "rag:\n  chunk_size: 100\n  chunk_overlap: 0\n")
+	collection := env.createCollection(t, "docs")
+	guide := "# Installation Guide\n\nThis guide installs the agent on Linux hosts and servers.\n\n" +
+		"## Proxy\n\nSet HTTPS_PROXY before running the installer behind a corporate proxy.\n"
+	env.upload(t, collection.ID, "install-7f3a.md", []byte(guide), nil)
+	env.upload(t, collection.ID, "notes.txt", []byte("Corporate proxy notes without any headings."), nil)
+
+	sources, err := env.orchestrator.Search(context.Background(), "installer behind a corporate proxy", 5, domain.SearchModeVector, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := make(map[string]string)
+	for _, source := range sources {
+		labels[source.Content] = source.Label
+	}
+	tests := []struct {
+		content string
+		label   string
+	}{
+		{"## Proxy\n\nSet HTTPS_PROXY before running the installer behind a corporate proxy.", "Installation Guide, §Proxy"},
+		{"Corporate proxy notes without any headings.", "notes.txt"},
+	}
+	for _, tt := range tests {
+		label, ok := labels[tt.content]
+		if !ok {
+			t.Errorf("no source with content %q among %+v", tt.content, sources)
+			continue
+		}
+		if label != tt.label {
+			t.Errorf("label of %q = %q, want %q", tt.content, label, tt.label)
+		}
+	}
+}
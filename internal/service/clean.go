@@ -0,0 +1,132 @@
+package service
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlBlockRe     = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	htmlPreRe       = regexp.MustCompile(`(?is)<pre[^>]*>(.*?)</pre>`)
+	htmlBreakRe     = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/h[1-6]|/tr)[^>]*>`)
+	htmlTagRe       = regexp.MustCompile(`(?s)<[^>]*>`)
+	mdImageRe       = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	mdLinkRe        = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	mdHeadingRe     = regexp.MustCompile(`(?m)^\s{0,3}#{1,6}\s+`)
+	mdQuoteRe       = regexp.MustCompile(`(?m)^\s{0,3}>\s?`)
+	mdListRe        = regexp.MustCompile(`(?m)^\s*(?:[-*+]|\d+\.)\s+`)
+	mdRuleRe        = regexp.MustCompile(`(?m)^\s{0,3}(?:[-*_]\s*){3,}$`)
+	mdEmphasisRe    = regexp.MustCompile(`(\*\*|__|\*|_|~~)([^*_~\n]+)(\*\*|__|\*|_|~~)`)
+	mdInlineCodeRe  = regexp.MustCompile("`([^`\n]+)`")
+	adocHeadingRe   = regexp.MustCompile(`(?m)^={1,6}\s+`)
+	adocAttributeRe = regexp.MustCompile(`(?m)^:[\w-]+:.*$`)
+	spaceRe         = regexp.MustCompile(`[ \t\f\v]+`)
+	blankLinesRe    = regexp.MustCompile(`\n\s*\n+`)
+)
+
+// cleanSourceText converts stored chunk text into plain text suitable for
+// citation popovers. Code blocks are kept verbatim.
+func cleanSourceText(fileType, content string) string {
+	switch fileType {
+	case FileTypeHTML:
+		return cleanHTML(content)
+	case FileTypeMD:
+		return cleanFenced(content, "```", cleanMarkdown)
+	case FileTypeADOC:
+		return cleanFenced(content, "----", cleanAsciiDoc)
+	default:
+		return collapseWhitespace(content)
+	}
+}
+
+// cleanHTML strips tags and decodes entities, preserving <pre> blocks
+func cleanHTML(content string) string {
+	content = htmlBlockRe.ReplaceAllString(content, "")
+
+	var out strings.Builder
+	last := 0
+	for _, m := range htmlPreRe.FindAllStringSubmatchIndex(content, -1) {
+		out.WriteString(stripHTML(content[last:m[0]]))
+		out.WriteString("\n")
+		out.WriteString(html.UnescapeString(htmlTagRe.ReplaceAllString(content[m[2]:m[3]], "")))
+		out.WriteString("\n")
+		last = m[1]
+	}
+	out.WriteString(stripHTML(content[last:]))
+	return strings.TrimSpace(out.String())
+}
+
+func stripHTML(s string) string {
+	s = htmlBreakRe.ReplaceAllString(s, "\n")
+	s = htmlTagRe.ReplaceAllString(s, "")
+	return collapseWhitespace(html.UnescapeString(s))
+}
+
+func cleanMarkdown(s string) string {
+	s = mdImageRe.ReplaceAllString(s, "$1")
+	s = mdLinkRe.ReplaceAllString(s, "$1")
+	s = mdRuleRe.ReplaceAllString(s, "")
+	s = mdHeadingRe.ReplaceAllString(s, "")
+	s = mdQuoteRe.ReplaceAllString(s, "")
+	s = mdListRe.ReplaceAllString(s, "")
+	s = mdEmphasisRe.ReplaceAllString(s, "$2")
+	s = mdInlineCodeRe.ReplaceAllString(s, "$1")
+	return collapseWhitespace(s)
+}
+
+func cleanAsciiDoc(s string) string {
+	s = adocAttributeRe.ReplaceAllString(s, "")
+	s = adocHeadingRe.ReplaceAllString(s, "")
+	return cleanMarkdown(s)
+}
+
+// cleanFenced applies clean to the text outside fenced code blocks and keeps
+// the fenced content as-is. An unterminated fence runs to the end of the text.
+func cleanFenced(content, fence string, clean func(string) string) string {
+	var out []string
+	var prose, code []string
+	inCode := false
+
+	flushProse := func() {
+		if text := clean(strings.Join(prose, "\n")); text != "" {
+			out = append(out, text)
+		}
+		prose = nil
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), fence) {
+			if inCode {
+				out = append(out, strings.Join(code, "\n"))
+				code = nil
+			} else {
+				flushProse()
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			code = append(code, line)
+		} else {
+			prose = append(prose, line)
+		}
+	}
+	if inCode {
+		out = append(out, strings.Join(code, "\n"))
+	}
+	flushProse()
+
+	return strings.Join(out, "\n\n")
+}
+
+// collapseWhitespace squeezes runs of spaces and blank lines
+func collapseWhitespace(s string) string {
+	s = spaceRe.ReplaceAllString(s, " ")
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	s = blankLinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(s)
+}
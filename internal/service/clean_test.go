@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+func TestChatCleansHTMLSources(t *testing.T) {
+	env := newTestEnv(t, "")
+	collection := env.createCollection(t, "docs")
+	page := `<html><body><h1>Returns</h1><p>Items can be <b>returned</b> within <a href="/days">30 days</a> &amp; refunded.</p></body></html>`
+	env.upload(t, collection.ID, "returns.html", []byte(page), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+
+	for _, clean := range []bool{false, true} {
+		resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: "can items be returned?", CleanSources: clean})
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		if len(resp.Sources) == 0 {
+			t.Fatal("Chat returned no sources")
+		}
+		source := resp.Sources[0]
+		if !clean {
+			if !strings.Contains(source.Content, "<b>returned</b>") || source.RawContent != "" {
+				t.Errorf("raw source = %q (raw %q), want the stored HTML", source.Content, source.RawContent)
+			}
+			continue
+		}
+		if strings.ContainsAny(source.Content, "<>") || strings.Contains(source.Content, "&amp;") {
+			t.Errorf("cleaned source content has markup: %q", source.Content)
+		}
+		if !strings.Contains(source.Content, "Items can be returned within 30 days & refunded.") {
+			t.Errorf("cleaned source content = %q, want the page text", source.Content)
+		}
+		if !strings.Contains(source.RawContent, "<b>returned</b>") {
+			t.Errorf("raw content = %q, want the stored HTML", source.RawContent)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// ExportCollection writes a zip archive of a collection to w: collection.json,
+// the original upload of each document under files/ and manifest.json with
+// the metadata of every document. Files are copied one at a time, so the
+// archive is never held in memory. Documents whose upload is no longer
+// stored are listed in the manifest without a file.
+func (s *IngestService) ExportCollection(ctx context.Context, collection *domain.Collection, w io.Writer) error {
+	if s.orchestrator == nil {
+		return fmt.Errorf("orchestrator not available")
+	}
+	docs, err := s.orchestrator.ListDocumentsByCollection(ctx, collection.ID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	if err := writeZipJSON(zw, "collection.json", collection.UpdatedAt, collection); err != nil {
+		return err
+	}
+
+	manifest := domain.ExportManifest{
+		Version:      domain.ExportFormatVersion,
+		CollectionID: collection.ID,
+		ExportedAt:   time.Now(),
+		Documents:    make([]domain.ExportedDocument, 0, len(docs)),
+	}
+	for _, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		exported := domain.ExportedDocument{Document: doc}
+		if doc.FileType != domain.DocumentTypeFAQ {
+			name := "files/" + doc.ID + filepath.Ext(doc.Filename)
+			written, err := s.exportFile(zw, name, doc)
+			if err != nil {
+				return fmt.Errorf("failed to export %s: %w", doc.Filename, err)
+			}
+			if written {
+				exported.File = name
+			}
+		}
+		manifest.Documents = append(manifest.Documents, exported)
+	}
+
+	if err := writeZipJSON(zw, "manifest.json", manifest.ExportedAt, manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// exportFile copies the original upload of doc into the archive, decrypting
+// it if needed, and reports whether it was stored
+func (s *IngestService) exportFile(zw *zip.Writer, name string, doc *domain.Document) (bool, error) {
+	storagePath := s.GetStoragePath(doc)
+	if storagePath == "" {
+		return false, nil
+	}
+	f, err := os.Open(storagePath)
+	if os.IsNotExist(err) {
+		log.Printf("[Ingest] Export: original file of %s is no longer stored", doc.ID)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: doc.CreatedAt})
+	if err != nil {
+		return false, err
+	}
+	plain, _, err := s.files.open(f)
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(entry, plain)
+	return err == nil, err
+}
+
+// writeZipJSON adds v to the archive as an indented JSON file
+func writeZipJSON(zw *zip.Writer, name string, modified time.Time, v any) error {
+	entry, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(entry)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// importDroppedKeys are the metadata keys an import leaves for ingestion to
+// set again; tags and custom fields are kept
+var importDroppedKeys = map[string]bool{
+	domain.MetadataKeyCollectionID:      true,
+	domain.MetadataKeyFilename:          true,
+	domain.MetadataKeyFileType:          true,
+	domain.MetadataKeyFileSize:          true,
+	domain.MetadataKeyVisibility:        true,
+	domain.MetadataKeyType:              true,
+	domain.MetadataKeyFAQAnswer:         true,
+	domain.MetadataKeyContentHash:       true,
+	domain.MetadataKeySharedFrom:        true,
+	domain.MetadataKeySharedCollections: true,
+}
+
+// ImportCollection recreates a collection from an archive written by
+// ExportCollection. The collection and its documents get new IDs; files are
+// queued for ingestion like uploads and FAQ entries are indexed again.
+// A document that can't be imported is reported as failed without stopping
+// the others.
+func (s *IngestService) ImportCollection(ctx context.Context, r io.ReaderAt, size int64) (*domain.ImportResult, error) {
+	if s.orchestrator == nil {
+		return nil, fmt.Errorf("orchestrator not available")
+	}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a zip archive: %v", domain.ErrInvalidRequest, err)
+	}
+
+	var source domain.Collection
+	if err := readZipJSON(zr, "collection.json", &source); err != nil {
+		return nil, err
+	}
+	var manifest domain.ExportManifest
+	if err := readZipJSON(zr, "manifest.json", &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version > domain.ExportFormatVersion {
+		return nil, fmt.Errorf("%w: archive format version %d is newer than this server supports", domain.ErrInvalidRequest, manifest.Version)
+	}
+	if source.Name == "" {
+		return nil, fmt.Errorf("%w: collection.json has no collection name", domain.ErrInvalidRequest)
+	}
+	if err := domain.ValidateSynonyms(source.Synonyms); err != nil {
+		return nil, err
+	}
+
+	collection := &domain.Collection{
+		Name:                 source.Name,
+		Description:          source.Description,
+		Metadata:             source.Metadata,
+		StripHTMLBoilerplate: source.StripHTMLBoilerplate,
+		Synonyms:             source.Synonyms,
+		EmbedSynonyms:        source.EmbedSynonyms,
+		ChunkSize:            source.ChunkSize,
+		ChunkOverlap:         source.ChunkOverlap,
+	}
+	if err := checkChunking(collectionChunking(s.cfg, collection)); err != nil {
+		return nil, err
+	}
+	if err := s.collectionRepo.Create(collection); err != nil {
+		return nil, err
+	}
+
+	result := &domain.ImportResult{Collection: collection, Documents: make([]*domain.ImportedDocument, 0, len(manifest.Documents))}
+	for _, exported := range manifest.Documents {
+		if exported.Document == nil {
+			continue
+		}
+		imported := &domain.ImportedDocument{SourceID: exported.ID, Filename: exported.Filename}
+		doc, err := s.importDocument(ctx, zr, collection.ID, exported)
+		if err != nil {
+			imported.Status = domain.DocumentStatusFailed
+			imported.Error = err.Error()
+			result.Failed++
+		} else {
+			imported.DocumentID = doc.ID
+			imported.Status = doc.Status
+			result.Imported++
+		}
+		result.Documents = append(result.Documents, imported)
+	}
+
+	log.Printf("[Ingest] Imported collection %s as %s: %d documents, %d failed", source.ID, collection.ID, result.Imported, result.Failed)
+	return result, nil
+}
+
+// importDocument re-creates one exported document in a collection
+func (s *IngestService) importDocument(ctx context.Context, zr *zip.Reader, collectionID string, exported domain.ExportedDocument) (*domain.Document, error) {
+	metadata := make(map[string]any, len(exported.Metadata))
+	for k, v := range exported.Metadata {
+		if !ingestResultKeys[k] && !importDroppedKeys[k] {
+			metadata[k] = v
+		}
+	}
+
+	if exported.FileType == domain.DocumentTypeFAQ {
+		answer, _ := exported.Metadata[domain.MetadataKeyFAQAnswer].(string)
+		docs, err := s.IngestFAQ(ctx, collectionID, []domain.FAQPair{{Question: exported.Filename, Answer: answer, Metadata: metadata}})
+		if err != nil {
+			return nil, err
+		}
+		return docs[0], nil
+	}
+
+	if exported.File == "" {
+		return nil, fmt.Errorf("the archive has no file for this document")
+	}
+	f, err := zr.Open(exported.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", exported.File, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkFileSize(info.Size()); err != nil {
+		return nil, err
+	}
+	// Keep the archive's documents as they were, duplicates included
+	return s.uploadDocument(ctx, collectionID, filepath.Base(exported.Filename), info.Size(), f, metadata, exported.Visibility, domain.OnDuplicateAllow, "")
+}
+
+// readZipJSON decodes a JSON file of an import archive
+func readZipJSON(zr *zip.Reader, name string, v any) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("%w: archive has no %s", domain.ErrInvalidRequest, name)
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(v); err != nil {
+		return fmt.Errorf("%w: invalid %s: %v", domain.ErrInvalidRequest, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+	ragodomain "github.com/liliang-cn/rago/v2/pkg/domain"
+)
+
+// Document summary limits
+const (
+	summarySourceChars  = 8000 // document text sent to the LLM for summarizing
+	summaryMaxDocuments = 3    // summary matches expanded per search
+	summaryChunksPerDoc = 2    // best chunks taken from each summary-matched document
+)
+
+// SummarizeDocument generates a summary of an ingested document from its
+// chunks and stores it as an extra embedding of the document, so broad
+// questions can match the document's overall topic (rag.document_summaries)
+func (s *OrchestratorService) SummarizeDocument(ctx context.Context, docID string) error {
+	embeddings, err := s.sqvectCore.GetByDocID(ctx, docID)
+	if err != nil {
+		return fmt.Errorf("failed to load document chunks: %w", err)
+	}
+
+	var text strings.Builder
+	var metadata map[string]any
+	for _, emb := range embeddings {
+		if !isContentChunk(emb.Metadata) {
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]any, len(emb.Metadata)+1)
+			for k, v := range emb.Metadata {
+				metadata[k] = v
+			}
+		}
+		if text.Len() < summarySourceChars {
+			text.WriteString(emb.Content)
+			text.WriteString("\n\n")
+		}
+	}
+	if metadata == nil {
+		return fmt.Errorf("document %s has no chunks", docID)
+	}
+	source := text.String()
+	if len(source) > summarySourceChars {
+		source = source[:summarySourceChars]
+	}
+
+	prompt := fmt.Sprintf(`Summarize the following document in 3 to 5 sentences. Name its main topics and what a reader can learn from it. Reply with the summary only.
+
+Document:
+%s
+
+Summary:`, source)
+	summary, err := s.generate(ctx, "", prompt)
+	if err != nil {
+		return err
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return fmt.Errorf("empty summary")
+	}
+
+	vec, err := s.embedQuery(ctx, summary)
+	if err != nil {
+		return err
+	}
+	metadata[askdocdomain.MetadataKeyType] = askdocdomain.ChunkTypeSummary
+	return s.sqliteStore.Store(ctx, []ragodomain.Chunk{{
+		ID:         docID + "-summary",
+		DocumentID: docID,
+		Content:    summary,
+		Vector:     vec,
+		Metadata:   metadata,
+	}})
+}
+
+// summaryMaxParts bounds the LLM calls of a map-reduce reader summary; longer
+// documents are split into fewer, larger parts
+const summaryMaxParts = 20
+
+// summaryLengthInstructions says how long each reader summary length is
+var summaryLengthInstructions = map[string]string{
+	askdocdomain.SummaryLengthShort:  "in 2 to 3 sentences",
+	askdocdomain.SummaryLengthMedium: "in one paragraph of 5 to 8 sentences",
+	askdocdomain.SummaryLengthLong:   "in several paragraphs, one per main topic, keeping key facts, figures and steps",
+}
+
+// ReaderSummary writes a summary of a document for people to read. A
+// document whose text fits in one prompt is summarized directly; a longer
+// one is summarized part by part and the part summaries are combined.
+func (s *OrchestratorService) ReaderSummary(ctx context.Context, docID, length string) (string, error) {
+	embeddings, err := s.sqvectCore.GetByDocID(ctx, docID)
+	if err != nil {
+		return "", fmt.Errorf("failed to load document chunks: %w", err)
+	}
+	var chunks []string
+	total := 0
+	for _, emb := range embeddings {
+		if isContentChunk(emb.Metadata) {
+			chunks = append(chunks, emb.Content)
+			total += len(emb.Content)
+		}
+	}
+	if len(chunks) == 0 {
+		return "", fmt.Errorf("%w: document has no chunks to summarize", askdocdomain.ErrInvalidRequest)
+	}
+	instruction := summaryLengthInstructions[length]
+
+	if total <= summarySourceChars {
+		return s.summarizeText(ctx, strings.Join(chunks, "\n\n"), "Summarize the following document "+instruction+".")
+	}
+
+	// Map: summarize parts of consecutive chunks
+	partSize := max(summarySourceChars, total/summaryMaxParts+1)
+	var parts []string
+	var part strings.Builder
+	for i, chunk := range chunks {
+		part.WriteString(chunk)
+		part.WriteString("\n\n")
+		if part.Len() < partSize && i < len(chunks)-1 {
+			continue
+		}
+		summary, err := s.summarizeText(ctx, part.String(), "Summarize this part of a longer document in a few sentences, keeping its key facts.")
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, summary)
+		part.Reset()
+	}
+
+	// Reduce: combine the part summaries
+	return s.summarizeText(ctx, strings.Join(parts, "\n\n"),
+		"The following are summaries of consecutive parts of one document. Combine them into a single summary of the whole document "+instruction+".")
+}
+
+// summarizeText asks the LLM to summarize text as instructed
+func (s *OrchestratorService) summarizeText(ctx context.Context, text, instruction string) (string, error) {
+	prompt := fmt.Sprintf(`%s Write in the language of the document. Reply with the summary only.
+
+Document:
+%s
+
+Summary:`, instruction, text)
+	summary, err := s.generate(ctx, "", prompt)
+	if err != nil {
+		return "", err
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return summary, nil
+}
+
+// isContentChunk reports whether an embedding holds document text, rather
+// than a document summary or rago's document record
+func isContentChunk(metadata map[string]string) bool {
+	if t, ok := metadata["_type"]; ok && t != "chunk" {
+		return false
+	}
+	return metadata[askdocdomain.MetadataKeyType] != askdocdomain.ChunkTypeSummary
+}
+
+func isSummaryChunk(chunk ragodomain.Chunk) bool {
+	return fmt.Sprint(chunk.Metadata[askdocdomain.MetadataKeyType]) == askdocdomain.ChunkTypeSummary
+}
+
+// splitSummaries separates document summary matches from content chunks
+func splitSummaries(chunks []ragodomain.Chunk) (summaries, content []ragodomain.Chunk) {
+	for _, chunk := range chunks {
+		if isSummaryChunk(chunk) {
+			summaries = append(summaries, chunk)
+		} else {
+			content = append(content, chunk)
+		}
+	}
+	return summaries, content
+}
+
+// expandSummaries is the second retrieval stage: each document whose summary
+// matched contributes its best chunks, scored at least as high as its summary,
+// so a topically relevant document is found even when no single chunk of it
+// scores well on its own. chunks must already be scored with metric.
+func (s *OrchestratorService) expandSummaries(ctx context.Context, metric string, vec []float64, summaries, chunks []ragodomain.Chunk) []ragodomain.Chunk {
+	index := make(map[string]int, len(chunks))
+	for i, chunk := range chunks {
+		index[chunk.ID] = i
+	}
+
+	for i, summary := range summaries {
+		if i == summaryMaxDocuments {
+			break
+		}
+		embeddings, err := s.sqvectCore.GetByDocID(ctx, summary.DocumentID)
+		if err != nil {
+			continue
+		}
+
+		var docChunks []ragodomain.Chunk
+		for _, emb := range embeddings {
+			if !isContentChunk(emb.Metadata) {
+				continue
+			}
+			chunkVec := make([]float64, len(emb.Vector))
+			for j, v := range emb.Vector {
+				chunkVec[j] = float64(v)
+			}
+			metadata := make(map[string]any, len(emb.Metadata))
+			for k, v := range emb.Metadata {
+				metadata[k] = v
+			}
+			docChunks = append(docChunks, ragodomain.Chunk{
+				ID:         emb.ID,
+				DocumentID: emb.DocID,
+				Content:    emb.Content,
+				Vector:     chunkVec,
+				Score:      vectorSimilarity(metric, vec, chunkVec),
+				Metadata:   metadata,
+			})
+		}
+		sort.SliceStable(docChunks, func(a, b int) bool {
+			return docChunks[a].Score > docChunks[b].Score
+		})
+		if len(docChunks) > summaryChunksPerDoc {
+			docChunks = docChunks[:summaryChunksPerDoc]
+		}
+
+		for _, chunk := range docChunks {
+			chunk.Score = max(chunk.Score, summary.Score)
+			if j, ok := index[chunk.ID]; ok {
+				chunks[j].Score = max(chunks[j].Score, chunk.Score)
+				continue
+			}
+			index[chunk.ID] = len(chunks)
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	sort.SliceStable(chunks, func(a, b int) bool {
+		return chunks[a].Score > chunks[b].Score
+	})
+	return chunks
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+func TestDocumentSummaryRetrieval(t *testing.T) {
+	// The network document's chunk is far from the broad question; only its
+	// summary is close
+	vector := func(x, y, z float64) []float64 {
+		vec := make([]float64, fakeEmbedderDims)
+		vec[0], vec[1], vec[2] = x, y, z
+		return vec
+	}
+	const (
+		question       = "network setup guide"
+		networkChunk   = "Open port 8443 on the firewall."
+		networkSummary = "This guide covers setting up the agent's network access."
+		billingChunk   = "Monthly invoices are emailed to account owners."
+		billingSummary = "This document covers billing."
+	)
+	vectors := map[string][]float64{
+		question:       vector(1, 0, 0),
+		networkChunk:   vector(0.2, 1, 0),
+		networkSummary: vector(1, 0.1, 0),
+		billingChunk:   vector(0, 0, 1),
+		billingSummary: vector(0, 0.1, 1),
+	}
+
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("document_summaries=%t", enabled), func(t *testing.T) {
+			env := newTestEnv(t, fmt.Sprintf("rag:\n  min_score: 0.5\n  document_summaries: %t\n", enabled))
+			env.embedder.vectors = vectors
+			env.generator.reply = func(prompt string) (string, error) {
+				switch {
+				case strings.Contains(prompt, networkChunk):
+					return networkSummary, nil
+				case strings.Contains(prompt, billingChunk):
+					return billingSummary, nil
+				}
+				return "answer", nil
+			}
+			collection := env.createCollection(t, "docs")
+			network := env.upload(t, collection.ID, "network.md", []byte(networkChunk), nil)
+			env.upload(t, collection.ID, "billing.md", []byte(billingChunk), nil)
+
+			sources, err := env.orchestrator.Search(context.Background(), question, 5, domain.SearchModeVector, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !enabled {
+				if len(sources) != 0 {
+					t.Errorf("sources = %+v, want none scoring 0.5 without summaries", sources)
+				}
+				return
+			}
+			if len(sources) != 1 || sources[0].DocumentID != network.ID {
+				t.Fatalf("sources = %+v, want the network document found by its summary", sources)
+			}
+			if sources[0].Content != networkChunk {
+				t.Errorf("source content = %q, want the document's chunk rather than its summary", sources[0].Content)
+			}
+		})
+	}
+}
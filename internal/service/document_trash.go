@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// trashSweepInterval is how often expired documents are purged from the trash
+const trashSweepInterval = time.Hour
+
+// deletedAt returns when a document was moved to the trash, or nil when it
+// is not in the trash
+func deletedAt(metadata map[string]any) *time.Time {
+	v, _ := metadata[askdocdomain.MetadataKeyDeletedAt].(string)
+	if v == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// chunkTrashed reports whether a chunk belongs to a document in the trash
+// and no copy outside the trash shares it
+func chunkTrashed(metadata map[string]any) bool {
+	if deletedAt(metadata) == nil {
+		return false
+	}
+	shared, _ := metadata[askdocdomain.MetadataKeySharedCollections].(string)
+	return shared == ""
+}
+
+// SetDocumentDeletedAt moves a document and its chunks to the trash, or
+// restores them when deletedAt is nil. A copy's collection is dropped from or
+// added back to the owner's chunks.
+func (s *OrchestratorService) SetDocumentDeletedAt(ctx context.Context, id string, deletedAt *time.Time) error {
+	doc, err := s.GetDocument(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	var value any
+	if deletedAt != nil {
+		value = deletedAt.UTC().Format(time.RFC3339)
+	}
+	if err := s.UpdateDocumentMetadata(ctx, id, map[string]any{
+		askdocdomain.MetadataKeyDeletedAt: value,
+	}); err != nil {
+		return err
+	}
+
+	if doc.SharedFrom != "" {
+		return s.syncSharedCollections(ctx, doc.SharedFrom)
+	}
+	_, err = s.sqvectCore.GetDB().ExecContext(ctx, `
+		UPDATE embeddings SET metadata = json_set(COALESCE(metadata, '{}'), '$.deleted_at', ?)
+		WHERE doc_id = ?
+	`, value, id)
+	if err != nil {
+		return fmt.Errorf("failed to update chunk metadata: %w", err)
+	}
+	return nil
+}
+
+// ListTrashedDocuments lists the documents in the trash, most recently
+// deleted first
+func (s *OrchestratorService) ListTrashedDocuments(ctx context.Context) ([]*askdocdomain.Document, error) {
+	docs, err := s.documentStore.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents: %w", err)
+	}
+
+	var result []*askdocdomain.Document
+	for _, doc := range docs {
+		if deletedAt(doc.Metadata) != nil {
+			result = append(result, ragoDocToAskDoc(doc))
+		}
+	}
+	slices.SortStableFunc(result, func(a, b *askdocdomain.Document) int {
+		return b.DeletedAt.Compare(*a.DeletedAt)
+	})
+	return result, nil
+}
+
+// DeleteDocument moves a document to the trash, where it is hidden from
+// listings and chat until it is restored or purged. With permanent it is
+// deleted right away instead.
+func (s *AdminService) DeleteDocument(ctx context.Context, id string, permanent bool) error {
+	if s.orchestrator == nil {
+		return askdocdomain.ErrNotFound
+	}
+
+	doc, err := s.orchestrator.GetDocument(ctx, id)
+	if err != nil {
+		return err
+	}
+	if permanent {
+		return s.purgeDocument(ctx, doc)
+	}
+	if doc.DeletedAt != nil {
+		return nil
+	}
+	if doc.Status == askdocdomain.DocumentStatusPending || doc.Status == askdocdomain.DocumentStatusProcessing {
+		return fmt.Errorf("%w: document is still being ingested; delete it with permanent=true or wait", askdocdomain.ErrInvalidRequest)
+	}
+
+	now := time.Now()
+	if err := s.orchestrator.SetDocumentDeletedAt(ctx, id, &now); err != nil {
+		return err
+	}
+	if err := s.documentRepo.SetDeletedAt(id, &now); err != nil {
+		log.Printf("[Admin] Recording the deletion of %s failed: %v", id, err)
+	}
+	return s.collectionRepo.BumpVersion(doc.CollectionID)
+}
+
+// RestoreDocument takes a document out of the trash
+func (s *AdminService) RestoreDocument(ctx context.Context, id string) (*askdocdomain.Document, error) {
+	if s.orchestrator == nil {
+		return nil, askdocdomain.ErrNotFound
+	}
+
+	doc, err := s.orchestrator.GetDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if doc.DeletedAt == nil {
+		return nil, fmt.Errorf("%w: document is not in the trash", askdocdomain.ErrInvalidRequest)
+	}
+	collection, err := s.collectionRepo.Get(doc.CollectionID)
+	if err != nil {
+		return nil, err
+	}
+	if collection == nil {
+		return nil, fmt.Errorf("%w: collection %s no longer exists", askdocdomain.ErrInvalidRequest, doc.CollectionID)
+	}
+
+	if err := s.orchestrator.SetDocumentDeletedAt(ctx, id, nil); err != nil {
+		return nil, err
+	}
+	if err := s.documentRepo.SetDeletedAt(id, nil); err != nil {
+		log.Printf("[Admin] Recording the restore of %s failed: %v", id, err)
+	}
+	if err := s.collectionRepo.BumpVersion(doc.CollectionID); err != nil {
+		return nil, err
+	}
+	doc.DeletedAt = nil
+	return doc, nil
+}
+
+// ListTrash lists a page of the documents in the trash, most recently
+// deleted first
+func (s *AdminService) ListTrash(ctx context.Context, page, pageSize int) (*askdocdomain.DocumentListResponse, error) {
+	var docs []*askdocdomain.Document
+	if s.orchestrator != nil {
+		var err error
+		if docs, err = s.orchestrator.ListTrashedDocuments(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return paginateDocuments(docs, page, pageSize), nil
+}
+
+// PurgeTrash permanently deletes the documents that have been in the trash
+// for at least olderThan (all of them for 0) and returns how many it deleted.
+// A document that fails to purge is logged and left in the trash.
+func (s *AdminService) PurgeTrash(ctx context.Context, olderThan time.Duration) (int, error) {
+	if s.orchestrator == nil {
+		return 0, nil
+	}
+	docs, err := s.orchestrator.ListTrashedDocuments(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-olderThan)
+	purged := 0
+	for _, doc := range docs {
+		if doc.DeletedAt.After(cutoff) {
+			continue
+		}
+		if err := s.purgeDocument(ctx, doc); err != nil {
+			log.Printf("[Admin] Purging document %s from the trash failed: %v", doc.ID, err)
+			continue
+		}
+		purged++
+	}
+	if purged > 0 {
+		log.Printf("[Admin] Purged %d documents from the trash", purged)
+	}
+	return purged, nil
+}
+
+// SweepTrash purges documents older than storage.trash_retention from the
+// trash every hour until ctx is cancelled. It returns at once when the
+// retention is 0.
+func (s *AdminService) SweepTrash(ctx context.Context) {
+	retention := s.cfg.Storage.TrashRetention
+	if retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(trashSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.PurgeTrash(ctx, retention); err != nil {
+			log.Printf("[Admin] Sweeping the trash failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectionDocuments lists every document of a collection, those in the
+// trash included
+func (s *AdminService) collectionDocuments(ctx context.Context, collectionID string) ([]*askdocdomain.Document, error) {
+	docs, err := s.orchestrator.ListDocumentsByCollection(ctx, collectionID)
+	if err != nil {
+		return nil, err
+	}
+	trashed, err := s.orchestrator.ListTrashedDocuments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range trashed {
+		if doc.CollectionID == collectionID {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+// purgeDocument deletes a document, its record and its stored file for good
+func (s *AdminService) purgeDocument(ctx context.Context, doc *askdocdomain.Document) error {
+	if err := s.orchestrator.ReleaseDocument(ctx, doc.ID); err != nil {
+		return err
+	}
+	if err := s.documentRepo.Delete(doc.ID); err != nil {
+		return err
+	}
+	if err := removeStoredDocument(s.cfg.Storage.Documents, doc.CollectionID, doc.ID); err != nil {
+		log.Printf("[Admin] Removing stored file of %s failed: %v", doc.ID, err)
+	}
+	return s.collectionRepo.BumpVersion(doc.CollectionID)
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxDOCXBodySize caps the uncompressed size of word/document.xml so a
+// zip bomb can't exhaust memory
+const maxDOCXBodySize = 64 << 20
+
+// docxSkipped are run contents holding images or embedded objects rather than
+// document text
+var docxSkipped = map[string]bool{
+	"drawing": true,
+	"pict":    true,
+	"object":  true,
+}
+
+// docxTable collects the cells of a table being read
+type docxTable struct {
+	row  []string
+	cell strings.Builder
+}
+
+// extractDOCXText returns the paragraphs and table rows of a Word document as
+// plain text, one block per paragraph and one line per table row with cells
+// separated by " | ". Images and embedded objects are skipped.
+func extractDOCXText(path string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid docx file: %w", err)
+	}
+	defer zr.Close()
+
+	var body *zip.File
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			body = f
+			break
+		}
+	}
+	if body == nil {
+		return "", fmt.Errorf("invalid docx file: word/document.xml not found")
+	}
+	if body.UncompressedSize64 > maxDOCXBodySize {
+		return "", fmt.Errorf("docx document body exceeds %d bytes", maxDOCXBodySize)
+	}
+
+	rc, err := body.Open()
+	if err != nil {
+		return "", fmt.Errorf("invalid docx file: %w", err)
+	}
+	defer rc.Close()
+
+	var (
+		blocks []string
+		para   strings.Builder
+		tables []*docxTable
+		inText bool
+		skip   int // depth inside a skipped element
+	)
+	d := xml.NewDecoder(io.LimitReader(rc, maxDOCXBodySize))
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid docx file: %w", err)
+		}
+
+		if skip > 0 {
+			switch tok.(type) {
+			case xml.StartElement:
+				skip++
+			case xml.EndElement:
+				skip--
+			}
+			continue
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+			case "t":
+				inText = true
+			case "tab":
+				para.WriteByte('\t')
+			case "br", "cr":
+				para.WriteByte('\n')
+			case "tbl":
+				tables = append(tables, &docxTable{})
+			case "tr":
+				if len(tables) > 0 {
+					tables[len(tables)-1].row = nil
+				}
+			case "tc":
+				if len(tables) > 0 {
+					tables[len(tables)-1].cell.Reset()
+				}
+			default:
+				if docxSkipped[t.Name.Local] {
+					skip = 1
+				}
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(para.String())
+				if text == "" {
+					break
+				}
+				if len(tables) > 0 {
+					appendDOCXCell(&tables[len(tables)-1].cell, text)
+				} else {
+					blocks = append(blocks, text)
+				}
+			case "tc":
+				if len(tables) > 0 {
+					table := tables[len(tables)-1]
+					table.row = append(table.row, strings.TrimSpace(table.cell.String()))
+				}
+			case "tr":
+				if len(tables) == 0 {
+					break
+				}
+				line := strings.Join(tables[len(tables)-1].row, " | ")
+				if strings.Trim(line, " |") == "" {
+					break
+				}
+				if len(tables) > 1 {
+					// Nested table rows become part of the enclosing cell
+					appendDOCXCell(&tables[len(tables)-2].cell, line)
+				} else {
+					blocks = append(blocks, line)
+				}
+			case "tbl":
+				if len(tables) > 0 {
+					tables = tables[:len(tables)-1]
+				}
+			}
+		}
+	}
+
+	text := strings.Join(blocks, "\n\n")
+	if text == "" {
+		return "", fmt.Errorf("docx contains no text")
+	}
+	return text, nil
+}
+
+// appendDOCXCell adds a paragraph to a table cell's text
+func appendDOCXCell(cell *strings.Builder, text string) {
+	if cell.Len() > 0 {
+		cell.WriteByte(' ')
+	}
+	cell.WriteString(text)
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// needsExtraction reports whether a file type must be converted to text
+// before ingestion, either because rago cannot read it directly or because
+// the collection preprocesses it
+func needsExtraction(fileType string, collection *domain.Collection) bool {
+	switch fileType {
+	case FileTypePNG, FileTypeJPG, FileTypeDOCX:
+		return true
+	case FileTypeHTML:
+		return collection != nil && collection.StripHTMLBoilerplate
+	default:
+		return false
+	}
+}
+
+// extractText converts a stored file into plain text for ingestion
+func (s *IngestService) extractText(ctx context.Context, fileType, path string) (string, error) {
+	switch fileType {
+	case FileTypePNG, FileTypeJPG:
+		return s.extractImageText(ctx, path)
+	case FileTypeHTML:
+		return extractHTMLMainContent(path)
+	case FileTypeDOCX:
+		return extractDOCXText(path)
+	default:
+		return "", fmt.Errorf("no text extractor for file type: %s", fileType)
+	}
+}
+
+// extractImageText runs the configured OCR engine over an image
+func (s *IngestService) extractImageText(ctx context.Context, path string) (string, error) {
+	if !s.cfg.OCR.Enabled {
+		return "", fmt.Errorf("image ingestion requires ocr.enabled")
+	}
+
+	args := []string{path, "stdout"}
+	if s.cfg.OCR.Languages != "" {
+		args = append(args, "-l", s.cfg.OCR.Languages)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.cfg.OCR.Command, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ocr failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	text := strings.TrimSpace(stdout.String())
+	if text == "" {
+		return "", fmt.Errorf("ocr found no text in image")
+	}
+	return text, nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// pngHeader is enough of a PNG for the upload to sniff as image/png
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestImageTextIsSearchable(t *testing.T) {
+	// A stand-in for tesseract that "reads" the same text from any image
+	ocr := filepath.Join(t.TempDir(), "ocr")
+	script := "#!/bin/sh\necho 'The warranty covers water damage for two years.'\n"
+	if err := os.WriteFile(ocr, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	env := newTestEnv(t, "ocr:\n  enabled: true\n  command: "+ocr+"\n")
+	collection := env.createCollection(t, "scans")
+
+	doc := env.upload(t, collection.ID, "warranty.png", pngHeader, nil)
+	if doc.Status != domain.DocumentStatusReady {
+		t.Fatalf("image status = %s (%s), want ready", doc.Status, doc.Error)
+	}
+
+	sources, err := env.orchestrator.Search(context.Background(), "warranty water damage", 5, "", nil)
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(sources) == 0 || sources[0].DocumentID != doc.ID {
+		t.Fatalf("search returned %+v, want the image first", sources)
+	}
+	if !strings.Contains(sources[0].Content, "water damage for two years") {
+		t.Errorf("source content = %q, want the OCR text", sources[0].Content)
+	}
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// SubmitFeedback records a rating of an assistant answer. The message must
+// be an answer given in one of the site's sessions.
+func (s *ChatService) SubmitFeedback(ctx context.Context, siteID string, req *domain.FeedbackRequest) (*domain.Feedback, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	message, err := s.sessionRepo.GetMessage(req.MessageID)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, domain.ErrNotFound
+	}
+	if message.Role != "assistant" {
+		return nil, fmt.Errorf("%w: only assistant messages can be rated", domain.ErrInvalidRequest)
+	}
+	session, err := s.sessionRepo.Get(message.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.SiteID != siteID {
+		return nil, domain.ErrNotFound
+	}
+
+	feedback := &domain.Feedback{
+		SiteID:    siteID,
+		SessionID: session.ID,
+		MessageID: message.ID,
+		Rating:    req.Rating,
+		Comment:   req.Comment,
+	}
+	if err := s.sessionRepo.SaveFeedback(feedback); err != nil {
+		return nil, err
+	}
+	return feedback, nil
+}
+
+// ListFeedback lists answer ratings, newest first, optionally filtered by
+// site and rating
+func (s *AdminService) ListFeedback(ctx context.Context, siteID, rating string, page, pageSize int) (*domain.FeedbackListResponse, error) {
+	feedback, total, err := s.sessionRepo.ListFeedback(siteID, rating, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.FeedbackListResponse{
+		Feedback: feedback,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
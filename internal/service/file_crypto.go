@@ -0,0 +1,341 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/liliang-cn/askdoc/internal/config"
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// encryptedFileMagic starts every stored file encrypted with
+// storage.encryption_key; files without it are plaintext
+var encryptedFileMagic = []byte("ASKDOC-ENC1\n")
+
+// encryptedSegmentSize is the plaintext size of each sealed segment, so
+// files are encrypted and decrypted as streams rather than held in memory
+const encryptedSegmentSize = 64 << 10
+
+// fileCipher encrypts stored uploads with AES-256-GCM. After the magic, a
+// file is a series of segments, each a random nonce and the sealed
+// encryptedSegmentSize bytes of plaintext; the last segment is shorter, and
+// empty when the plaintext fills the previous one. Each segment is
+// authenticated with its index and whether it is the last, so segments can't
+// be reordered, dropped or truncated away. Files are sealed with the current
+// key; previous keys only decrypt.
+type fileCipher struct {
+	keys []cipher.AEAD // current key first
+}
+
+// newFileCipher builds the cipher for storage.encryption_key, or returns nil
+// when encryption is off
+func newFileCipher(cfg config.StorageConfig) (*fileCipher, error) {
+	if cfg.EncryptionKey == "" {
+		return nil, nil
+	}
+	c := &fileCipher{}
+	for _, key := range append([]string{cfg.EncryptionKey}, cfg.PreviousEncryptionKeys...) {
+		raw, err := config.DecodeEncryptionKey(key)
+		if err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = append(c.keys, aead)
+	}
+	return c, nil
+}
+
+// segmentAAD is the additional data authenticating a segment's position
+func segmentAAD(index uint64, last bool) []byte {
+	aad := binary.BigEndian.AppendUint64(bytes.Clone(encryptedFileMagic), index)
+	if last {
+		return append(aad, 1)
+	}
+	return append(aad, 0)
+}
+
+// seal encrypts src to dst with the current key, one segment at a time
+func (c *fileCipher) seal(dst io.Writer, src io.Reader) error {
+	aead := c.keys[0]
+	if _, err := dst.Write(encryptedFileMagic); err != nil {
+		return err
+	}
+	plain := make([]byte, encryptedSegmentSize)
+	sealed := make([]byte, aead.NonceSize(), aead.NonceSize()+encryptedSegmentSize+aead.Overhead())
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(src, plain)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		nonce := sealed[:aead.NonceSize()]
+		if _, err := rand.Read(nonce); err != nil {
+			return err
+		}
+		if _, err := dst.Write(aead.Seal(nonce, nonce, plain[:n], segmentAAD(index, last))); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// open returns a reader of the original content of src, which may be sealed
+// by seal, and the index of the key that decrypts it. Plaintext is read
+// unchanged with index -1. The first segment is decrypted right away to find
+// the key; later ones as they are read.
+func (c *fileCipher) open(src io.Reader) (io.Reader, int, error) {
+	magic := make([]byte, len(encryptedFileMagic))
+	n, err := io.ReadFull(src, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, 0, err
+	}
+	if !bytes.Equal(magic[:n], encryptedFileMagic) {
+		return io.MultiReader(bytes.NewReader(magic[:n]), src), -1, nil
+	}
+	if c == nil {
+		return nil, 0, fmt.Errorf("stored file is encrypted but storage.encryption_key is not set")
+	}
+
+	r := &segmentReader{src: src, keys: c.keys, key: -1}
+	r.sealed = make([]byte, c.keys[0].NonceSize()+encryptedSegmentSize+c.keys[0].Overhead())
+	r.buf = make([]byte, encryptedSegmentSize)
+	if err := r.next(); err != nil {
+		return nil, 0, err
+	}
+	return r, r.key, nil
+}
+
+// segmentReader decrypts the segments of a sealed file as it is read
+type segmentReader struct {
+	src    io.Reader
+	keys   []cipher.AEAD
+	key    int // index of the key that opened the first segment
+	index  uint64
+	sealed []byte // buffer for the segment being decrypted
+	buf    []byte // buffer for its plaintext
+	plain  []byte // decrypted bytes not yet read
+	done   bool   // the last segment was decrypted
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next decrypts the following segment; a full-size segment is never the last
+func (r *segmentReader) next() error {
+	n, err := io.ReadFull(r.src, r.sealed)
+	last := err == io.ErrUnexpectedEOF
+	switch {
+	case err == io.EOF:
+		return fmt.Errorf("stored file is truncated")
+	case err != nil && !last:
+		return err
+	}
+
+	keys := r.keys
+	if r.key >= 0 {
+		keys = keys[r.key : r.key+1]
+	}
+	for i, aead := range keys {
+		if n < aead.NonceSize()+aead.Overhead() {
+			break
+		}
+		nonceSize := aead.NonceSize()
+		plain, err := aead.Open(r.buf[:0], r.sealed[:nonceSize], r.sealed[nonceSize:n], segmentAAD(r.index, last))
+		if err != nil {
+			continue
+		}
+		if r.key < 0 {
+			r.key = i
+		}
+		r.plain, r.done = plain, last
+		r.index++
+		return nil
+	}
+	return fmt.Errorf("stored file cannot be decrypted with the configured keys")
+}
+
+// openStoredFile opens a stored upload for reading its original content,
+// returning the index of the key that decrypts it (-1 for plaintext)
+func (s *IngestService) openStoredFile(path string) (io.Reader, int, func(), error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	plain, key, err := s.files.open(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, nil, err
+	}
+	return plain, key, func() { f.Close() }, nil
+}
+
+// writeStoredFile writes an upload to its storage file, encrypted when
+// storage.encryption_key is set, and returns the SHA-256 of its content
+func (s *IngestService) writeStoredFile(dst io.Writer, src io.Reader) (string, error) {
+	hash := sha256.New()
+	src = io.TeeReader(src, hash)
+	if s.files == nil {
+		if _, err := io.Copy(dst, src); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+	if err := s.files.seal(dst, src); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ReadStoredFile returns the original content of a stored upload, decrypting
+// it if needed
+func (s *IngestService) ReadStoredFile(path string) ([]byte, error) {
+	plain, _, closeFile, err := s.openStoredFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile()
+	return io.ReadAll(plain)
+}
+
+// plainStoredFile returns a path holding the original content of a stored
+// upload for readers that need a file (rago, OCR). Encrypted files are
+// decrypted to a private temp file that cleanup removes; plaintext files are
+// used in place.
+func (s *IngestService) plainStoredFile(path string) (string, func(), error) {
+	noop := func() {}
+	if s.files == nil {
+		return path, noop, nil
+	}
+
+	plain, key, closeFile, err := s.openStoredFile(path)
+	if err != nil {
+		return "", noop, err
+	}
+	defer closeFile()
+	if key < 0 {
+		return path, noop, nil
+	}
+
+	// Keep the stored name so file type detection sees the same extension
+	dir, err := os.MkdirTemp("", "askdoc-decrypted-*")
+	if err != nil {
+		return "", noop, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	tmp, err := os.OpenFile(filepath.Join(dir, filepath.Base(path)), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		cleanup()
+		return "", noop, err
+	}
+	_, err = io.Copy(tmp, plain)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", noop, err
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// ReencryptFiles encrypts every stored upload with the current key: files
+// sealed with a previous key and plaintext files stored before encryption was
+// enabled. Files already using the current key are skipped.
+func (s *IngestService) ReencryptFiles(ctx context.Context) (*domain.ReencryptResult, error) {
+	if s.files == nil {
+		return nil, fmt.Errorf("%w: storage.encryption_key is not set", domain.ErrInvalidRequest)
+	}
+
+	result := &domain.ReencryptResult{}
+	err := filepath.WalkDir(s.cfg.Storage.Documents, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == s.cfg.Storage.Documents {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Skip temp files of uploads and re-encryptions in progress
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+
+		reencrypted, err := s.reencryptFile(path)
+		switch {
+		case err != nil:
+			log.Printf("[Ingest] Re-encrypting %s failed: %v", path, err)
+			result.Failed++
+		case reencrypted:
+			result.Reencrypted++
+		default:
+			result.Skipped++
+		}
+		return nil
+	})
+	return result, err
+}
+
+// reencryptFile seals path with the current key, replacing it atomically;
+// it reports false when the file already used the current key
+func (s *IngestService) reencryptFile(path string) (bool, error) {
+	plain, key, closeFile, err := s.openStoredFile(path)
+	if err != nil {
+		return false, err
+	}
+	defer closeFile()
+	if key == 0 {
+		return false, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".reencrypt-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := s.files.seal(tmp, plain); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp.Name(), path)
+}
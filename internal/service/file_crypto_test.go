@@ -0,0 +1,121 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/liliang-cn/askdoc/internal/config"
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+func TestStoredFilesEncryptedAtRest(t *testing.T) {
+	oldKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	newKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	env := newTestEnv(t, "storage:\n  encryption_key: "+oldKey+"\n")
+	collection := env.createCollection(t, "docs")
+	content := []byte("Rotate the agent token monthly.")
+	doc := env.upload(t, collection.ID, "tokens.md", content, nil)
+	if doc.Status != domain.DocumentStatusReady {
+		t.Fatalf("document status = %s (%s), want ready", doc.Status, doc.Error)
+	}
+
+	path := env.ingest.GetStoragePath(doc)
+	onDisk, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(onDisk, encryptedFileMagic) || bytes.Contains(onDisk, []byte("agent token")) {
+		t.Fatalf("stored file is not ciphertext: %q", onDisk)
+	}
+	if got, err := env.ingest.ReadStoredFile(path); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("ReadStoredFile = %q, %v; want the original content", got, err)
+	}
+	// Ingestion read the decrypted text
+	sources, err := env.orchestrator.Search(context.Background(), "rotate agent token", 5, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 || sources[0].Content != string(content) {
+		t.Errorf("search found %+v, want the original text", sources)
+	}
+
+	// Rotate: the old key still decrypts until the files are re-encrypted
+	rotate := func(storage config.StorageConfig) {
+		t.Helper()
+		if env.ingest.files, err = newFileCipher(storage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rotate(config.StorageConfig{EncryptionKey: newKey, PreviousEncryptionKeys: []string{oldKey}})
+	if got, err := env.ingest.ReadStoredFile(path); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("ReadStoredFile with the previous key = %q, %v; want the original content", got, err)
+	}
+	result, err := env.ingest.ReencryptFiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reencrypted != 1 || result.Failed != 0 {
+		t.Errorf("re-encryption = %+v, want 1 file re-encrypted", result)
+	}
+	rotate(config.StorageConfig{EncryptionKey: newKey})
+	if got, err := env.ingest.ReadStoredFile(path); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("ReadStoredFile with only the new key = %q, %v; want the original content", got, err)
+	}
+	rotate(config.StorageConfig{EncryptionKey: oldKey})
+	if _, err := env.ingest.ReadStoredFile(path); err == nil {
+		t.Error("the old key alone still decrypts the re-encrypted file")
+	}
+}
+
+func TestFileCipherSegments(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	c, err := newFileCipher(config.StorageConfig{EncryptionKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seal := func(plain []byte) []byte {
+		t.Helper()
+		var sealed bytes.Buffer
+		if err := c.seal(&sealed, bytes.NewReader(plain)); err != nil {
+			t.Fatal(err)
+		}
+		return sealed.Bytes()
+	}
+	open := func(sealed []byte) ([]byte, error) {
+		plain, _, err := c.open(bytes.NewReader(sealed))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(plain)
+	}
+
+	for _, size := range []int{0, 100, encryptedSegmentSize, 2*encryptedSegmentSize + 100} {
+		plain := bytes.Repeat([]byte("x"), size)
+		if got, err := open(seal(plain)); err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("%d bytes: read back %d bytes, %v", size, len(got), err)
+		}
+	}
+
+	// Segments are bound to their position: dropping the last one or
+	// swapping two fails instead of returning partial content
+	plain := append(bytes.Repeat([]byte("a"), encryptedSegmentSize), bytes.Repeat([]byte("b"), encryptedSegmentSize)...)
+	sealed := seal(append(plain, "tail"...))
+	segment := 12 + encryptedSegmentSize + 16
+	first := sealed[len(encryptedFileMagic) : len(encryptedFileMagic)+segment]
+	second := sealed[len(encryptedFileMagic)+segment : len(encryptedFileMagic)+2*segment]
+	tampered := map[string][]byte{
+		"truncated at a segment": sealed[:len(encryptedFileMagic)+2*segment],
+		"swapped segments":       slices.Concat(encryptedFileMagic, second, first, sealed[len(encryptedFileMagic)+2*segment:]),
+		"cut mid-segment":        sealed[:len(sealed)-3],
+	}
+	for name, data := range tampered {
+		if got, err := open(data); err == nil {
+			t.Errorf("%s: read back %d bytes, want an error", name, len(got))
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// sniffLen is how much of an upload is read to tell its content type
+const sniffLen = 512
+
+// sniffedTypes maps the binary file types to the content type their magic
+// bytes sniff as; every other supported type must sniff as text
+var sniffedTypes = map[string]string{
+	FileTypePDF:  "application/pdf",
+	FileTypeDOCX: "application/zip",
+	FileTypePNG:  "image/png",
+	FileTypeJPG:  "image/jpeg",
+}
+
+// checkFileContent rejects an upload whose first bytes don't match the type
+// its name claims, e.g. a binary blob named .txt
+func checkFileContent(fileType string, head []byte) error {
+	sniffed := http.DetectContentType(head)
+	if want, ok := sniffedTypes[fileType]; ok {
+		if sniffed != want {
+			return fmt.Errorf("%w: content is %s, not %s", domain.ErrInvalidRequest, sniffed, fileType)
+		}
+		return nil
+	}
+	if !strings.HasPrefix(sniffed, "text/") {
+		return fmt.Errorf("%w: content is %s, not %s text", domain.ErrInvalidRequest, sniffed, fileType)
+	}
+	return nil
+}
+
+// sniffUpload checks the first bytes of src against fileType and returns a
+// reader yielding the whole of src again
+func sniffUpload(fileType string, src io.Reader) (io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(src, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+	head = head[:n]
+	if err := checkFileContent(fileType, head); err != nil {
+		return nil, err
+	}
+	return io.MultiReader(bytes.NewReader(head), src), nil
+}
+
+// checkUploadContent sniffs a multipart upload without storing it
+func checkUploadContent(file *multipart.FileHeader) error {
+	src, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+	_, err = sniffUpload(DetectFileType(file.Filename), src)
+	return err
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// Follow-up suggestion limits
+const (
+	maxSuggestedQuestions = 3
+	// suggestionSourceChars caps each source excerpt in the suggestion prompt
+	suggestionSourceChars = 500
+)
+
+// SuggestFollowups proposes up to three questions the user might ask next,
+// answerable from the sources of the answer (rag.suggest_followups).
+// Failures are only logged and yield no suggestions.
+func (s *OrchestratorService) SuggestFollowups(ctx context.Context, question, answer string, sources []askdocdomain.Source) []string {
+	var excerpts strings.Builder
+	for _, src := range sources {
+		content := src.Content
+		if runes := []rune(content); len(runes) > suggestionSourceChars {
+			content = string(runes[:suggestionSourceChars])
+		}
+		fmt.Fprintf(&excerpts, "- %s\n", strings.Join(strings.Fields(content), " "))
+	}
+
+	prompt := fmt.Sprintf(`Suggest %d short follow-up questions the user might ask next. Each must be answerable from the excerpts and must not repeat the question. Write them in the language of the question, one per line, without numbering.
+
+Question: %s
+
+Answer: %s
+
+Excerpts:
+%s
+Follow-up questions:`, maxSuggestedQuestions, question, answer, excerpts.String())
+
+	reply, err := s.generate(ctx, "", prompt)
+	if err != nil {
+		log.Printf("[Chat] Suggesting follow-up questions failed: %v", err)
+		return nil
+	}
+	return parseSuggestions(reply)
+}
+
+// parseSuggestions reads one question per line, dropping list markers and
+// quotes the model added anyway
+func parseSuggestions(reply string) []string {
+	var questions []string
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimLeft(line, "-*•0123456789.) ")
+		line = strings.Trim(line, `"`)
+		if line == "" {
+			continue
+		}
+		questions = append(questions, line)
+		if len(questions) == maxSuggestedQuestions {
+			break
+		}
+	}
+	return questions
+}
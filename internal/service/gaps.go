@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// gapSimilarity is the keyword overlap (Jaccard) above which two unanswered
+// questions are reported as the same gap
+const gapSimilarity = 0.6
+
+// maxGapQuestions caps how many recent unanswered questions a report groups
+const maxGapQuestions = 5000
+
+// gapReason classifies an answer as a content gap, returning "" when the
+// question was answered well enough
+func (s *ChatService) gapReason(site *domain.Site, answer string, sources []domain.Source) string {
+	switch {
+	case answer == site.NoAnswerMessage():
+		return domain.GapReasonNoAnswer
+	case answer == domain.ErrLLMUnavailable.Error(), strings.HasPrefix(answer, fallbackMessage):
+		return domain.GapReasonFallback
+	}
+	threshold := s.cfg.RAG.GapScoreThreshold
+	if threshold <= 0 || len(sources) == 0 {
+		return ""
+	}
+	var top float64
+	for _, src := range sources {
+		top = max(top, src.Score)
+	}
+	if top < threshold {
+		return domain.GapReasonLowScore
+	}
+	return ""
+}
+
+// recordGap stores the question of a turn that was not answered well
+func (s *ChatService) recordGap(site *domain.Site, sessionID, question, answer string, sources []domain.Source) {
+	reason := s.gapReason(site, answer, sources)
+	if reason == "" {
+		return
+	}
+	var top float64
+	for _, src := range sources {
+		top = max(top, src.Score)
+	}
+	q := &domain.UnansweredQuestion{
+		SiteID:    site.ID,
+		SessionID: sessionID,
+		Question:  question,
+		Reason:    reason,
+		TopScore:  top,
+	}
+	if err := s.sessionRepo.CreateUnanswered(q); err != nil {
+		log.Printf("[Chat] failed to record unanswered question: %v", err)
+	}
+}
+
+// QuestionGaps groups a site's recent unanswered questions by similarity;
+// an empty siteID reports all sites
+func (s *AdminService) QuestionGaps(ctx context.Context, siteID string, limit int) (*domain.GapReport, error) {
+	if siteID != "" {
+		site, err := s.siteRepo.Get(siteID)
+		if err != nil {
+			return nil, err
+		}
+		if site == nil {
+			return nil, domain.ErrNotFound
+		}
+	}
+
+	questions, err := s.sessionRepo.ListUnanswered(siteID, maxGapQuestions)
+	if err != nil {
+		return nil, err
+	}
+
+	gaps := groupGaps(questions)
+	if limit > 0 && len(gaps) > limit {
+		gaps = gaps[:limit]
+	}
+	return &domain.GapReport{SiteID: siteID, Gaps: gaps, Total: len(questions)}, nil
+}
+
+// groupGaps clusters questions (newest first) whose normalized text matches
+// or whose keywords overlap by at least gapSimilarity
+func groupGaps(questions []*domain.UnansweredQuestion) []*domain.QuestionGap {
+	texts := make([]string, len(questions))
+	for i, q := range questions {
+		texts[i] = q.Question
+	}
+	clusters, newWording := clusterQuestions(texts)
+
+	var gaps []*domain.QuestionGap
+	for i, q := range questions {
+		c := clusters[i]
+		if c == len(gaps) {
+			// Questions arrive newest first, so the first wording is the latest
+			gaps = append(gaps, &domain.QuestionGap{Question: q.Question, LastAskedAt: q.CreatedAt})
+		} else if newWording[i] {
+			gaps[c].Variants = append(gaps[c].Variants, q.Question)
+		}
+		gaps[c].Count++
+		if !slices.Contains(gaps[c].Reasons, q.Reason) {
+			gaps[c].Reasons = append(gaps[c].Reasons, q.Reason)
+		}
+	}
+
+	// Stable keeps the most recently asked first among equal counts
+	slices.SortStableFunc(gaps, func(a, b *domain.QuestionGap) int {
+		return b.Count - a.Count
+	})
+	return gaps
+}
+
+// clusterQuestions groups questions whose normalized text matches or whose
+// keywords overlap by at least gapSimilarity. It returns the cluster of each
+// question, numbered in order of first appearance, and whether the question
+// is a wording its cluster hasn't seen yet (always true for a cluster's first).
+func clusterQuestions(questions []string) (clusters []int, newWording []bool) {
+	type group struct {
+		norm  map[string]bool
+		terms map[string]bool
+	}
+	var groups []*group
+	clusters = make([]int, len(questions))
+	newWording = make([]bool, len(questions))
+
+	for i, q := range questions {
+		norm := normalizeQuestion(q, true)
+		terms := make(map[string]bool)
+		for _, term := range keywordTerms(norm) {
+			terms[term] = true
+		}
+
+		match := -1
+		for j, g := range groups {
+			if g.norm[norm] || jaccard(g.terms, terms) >= gapSimilarity {
+				match = j
+				break
+			}
+		}
+		if match < 0 {
+			match = len(groups)
+			groups = append(groups, &group{norm: map[string]bool{}, terms: terms})
+		}
+		clusters[i] = match
+		if !groups[match].norm[norm] {
+			groups[match].norm[norm] = true
+			newWording[i] = true
+		}
+	}
+	return clusters, newWording
+}
+
+// jaccard returns the overlap of two term sets, 0 when either is empty
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for term := range a {
+		if b[term] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+func TestQuestionGaps(t *testing.T) {
+	env := newTestEnv(t, "rag:\n  min_score: 0.5\n")
+	ctx := context.Background()
+	collection := env.createCollection(t, "docs")
+	env.upload(t, collection.ID, "install.md", []byte("Install the agent with the package manager."), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+	other := env.createSite(t, &domain.Site{Name: "other", CollectionIDs: []string{collection.ID}})
+
+	ask := func(site *domain.Site, question string) {
+		t.Helper()
+		if _, err := env.chat.Chat(ctx, site.ID, &domain.ChatRequest{Message: question}); err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+	}
+	ask(site, "Install the agent with the package manager?")
+	ask(site, "What does the enterprise plan cost?")
+	ask(site, "what does the enterprise plan cost")
+	ask(other, "Which regions are supported?")
+
+	report, err := env.admin.QuestionGaps(ctx, site.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 2 || len(report.Gaps) != 1 {
+		t.Fatalf("gap report = %d questions in %d gaps, want 2 in 1", report.Total, len(report.Gaps))
+	}
+	gap := report.Gaps[0]
+	if gap.Count != 2 || !slices.Contains(gap.Reasons, domain.GapReasonNoAnswer) {
+		t.Errorf("gap = %+v, want the enterprise plan question asked twice without an answer", gap)
+	}
+	if gap.Question != "What does the enterprise plan cost?" && gap.Question != "what does the enterprise plan cost" {
+		t.Errorf("gap question = %q, want the enterprise plan question", gap.Question)
+	}
+}
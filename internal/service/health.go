@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/repository"
+)
+
+// Readiness check limits
+const (
+	dbCheckTimeout  = 2 * time.Second
+	llmCheckTimeout = 3 * time.Second
+	// llmCheckInterval reuses an LLM check result for this long, so frequent
+	// probes don't each cost an embedding call
+	llmCheckInterval = 15 * time.Second
+)
+
+// Dependency check states
+const (
+	DependencyOK   = "ok"
+	DependencyDown = "down"
+)
+
+// DependencyStatus is the result of checking one dependency
+type DependencyStatus struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// Readiness reports whether the server can answer questions
+type Readiness struct {
+	Ready  bool                        `json:"-"`
+	Status string                      `json:"status"` // ready or unavailable
+	Checks map[string]DependencyStatus `json:"checks"`
+	LLM    BreakerStatus               `json:"llm"`
+}
+
+// HealthService checks the dependencies a chat needs: the metadata
+// database, the vector store and the LLM endpoint
+type HealthService struct {
+	db           *repository.DB
+	orchestrator *OrchestratorService
+
+	mu         sync.Mutex
+	llmResult  DependencyStatus
+	llmChecked time.Time
+}
+
+// NewHealthService creates a new health service
+func NewHealthService(db *repository.DB, orchestrator *OrchestratorService) *HealthService {
+	return &HealthService{db: db, orchestrator: orchestrator}
+}
+
+// Ready runs the readiness checks concurrently
+func (s *HealthService) Ready(ctx context.Context) *Readiness {
+	checks := map[string]func(context.Context) DependencyStatus{
+		"database":     s.checkDatabase,
+		"vector_store": s.checkVectorStore,
+		"llm":          s.checkLLM,
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	r := &Readiness{Ready: true, Status: "ready", Checks: make(map[string]DependencyStatus, len(checks))}
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status := check(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			r.Checks[name] = status
+			if status.Status != DependencyOK {
+				r.Ready, r.Status = false, "unavailable"
+			}
+		}()
+	}
+	wg.Wait()
+
+	if s.orchestrator != nil {
+		r.LLM = s.orchestrator.BreakerStatus()
+	} else {
+		r.LLM = BreakerStatus{State: BreakerDisabled}
+	}
+	return r
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) DependencyStatus {
+	return timedCheck(ctx, dbCheckTimeout, func(ctx context.Context) error {
+		var one int
+		return s.db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	})
+}
+
+func (s *HealthService) checkVectorStore(ctx context.Context) DependencyStatus {
+	if s.orchestrator == nil {
+		return DependencyStatus{Status: DependencyDown, Error: "RAG is not initialized"}
+	}
+	return timedCheck(ctx, dbCheckTimeout, s.orchestrator.PingStore)
+}
+
+// checkLLM embeds a short text at most every llmCheckInterval. While the
+// circuit breaker is open the backend is reported down without a call.
+func (s *HealthService) checkLLM(ctx context.Context) DependencyStatus {
+	if s.orchestrator == nil {
+		return DependencyStatus{Status: DependencyDown, Error: "RAG is not initialized"}
+	}
+	if s.orchestrator.BreakerStatus().State == BreakerOpen {
+		return DependencyStatus{Status: DependencyDown, Error: "circuit breaker is open"}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.llmChecked) < llmCheckInterval {
+		return s.llmResult
+	}
+	s.llmResult = timedCheck(ctx, llmCheckTimeout, s.orchestrator.PingLLM)
+	s.llmChecked = time.Now()
+	return s.llmResult
+}
+
+// timedCheck runs check within timeout and reports how it went
+func timedCheck(ctx context.Context, timeout time.Duration, check func(context.Context) error) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	status := DependencyStatus{Status: DependencyOK, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		status.Status = DependencyDown
+		status.Error = err.Error()
+		if ctx.Err() == context.DeadlineExceeded {
+			status.Error = fmt.Sprintf("timed out after %s", timeout)
+		}
+	}
+	return status
+}
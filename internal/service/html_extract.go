@@ -0,0 +1,265 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// boilerplateRe matches class/id values of page chrome rather than content
+var boilerplateRe = regexp.MustCompile(`(?i)(^|[\s_-])(nav|navbar|menu|header|footer|sidebar|breadcrumbs?|cookie|banner|comments?|share|social|advert|ads?|promo|related|subscribe|newsletter|popup|modal|skip)($|[\s_-])`)
+
+// boilerplateRoles are ARIA landmark roles of page chrome
+var boilerplateRoles = map[string]bool{
+	"navigation":    true,
+	"banner":        true,
+	"contentinfo":   true,
+	"complementary": true,
+	"search":        true,
+}
+
+// boilerplateTags are elements never part of an article's text
+var boilerplateTags = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Nav:      true,
+	atom.Header:   true,
+	atom.Footer:   true,
+	atom.Aside:    true,
+	atom.Form:     true,
+	atom.Iframe:   true,
+	atom.Svg:      true,
+	atom.Button:   true,
+}
+
+// blockTags start a new line in extracted text
+var blockTags = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Li: true, atom.Ul: true, atom.Ol: true, atom.Tr: true, atom.Table: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Br: true, atom.Dt: true, atom.Dd: true,
+}
+
+// extractHTMLMainContent reads an HTML file and returns the text of its main
+// content, without navigation, scripts, styles and other page chrome
+func extractHTMLMainContent(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readHTMLMainContent(f)
+}
+
+// readHTMLMainContent is extractHTMLMainContent for HTML read from r
+func readHTMLMainContent(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse html: %w", err)
+	}
+
+	removeBoilerplate(doc)
+	text := collapseHTMLText(htmlText(mainContentNode(doc)))
+	if text == "" {
+		return "", fmt.Errorf("html document has no main content")
+	}
+	return text, nil
+}
+
+// removeBoilerplate detaches page chrome elements from the tree
+func removeBoilerplate(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && isBoilerplate(c)) {
+			n.RemoveChild(c)
+		} else {
+			removeBoilerplate(c)
+		}
+		c = next
+	}
+}
+
+func isBoilerplate(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Html, atom.Body, atom.Main, atom.Article:
+		// Layout classes on these (e.g. "has-sidebar") say nothing about their content
+		return false
+	case atom.Header, atom.Footer:
+		// An article's own header holds its title
+		return !insideArticle(n)
+	}
+	if boilerplateTags[n.DataAtom] {
+		return true
+	}
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "class", "id":
+			if boilerplateRe.MatchString(a.Val) {
+				return true
+			}
+		case "role":
+			if boilerplateRoles[strings.ToLower(a.Val)] {
+				return true
+			}
+		case "hidden", "aria-hidden":
+			if a.Key == "hidden" || a.Val == "true" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func insideArticle(n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.DataAtom == atom.Article || p.DataAtom == atom.Main {
+			return true
+		}
+	}
+	return false
+}
+
+// mainContentNode picks the element holding the article: an explicit
+// <main>/<article>/role=main when present, otherwise the element scoring
+// highest on paragraph text (readability-style)
+func mainContentNode(doc *html.Node) *html.Node {
+	var explicit *html.Node
+	explicitLen := 0
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom == atom.Main || n.DataAtom == atom.Article || attr(n, "role") == "main" {
+			if l := len(strings.TrimSpace(htmlText(n))); l > explicitLen {
+				explicit, explicitLen = n, l
+			}
+		}
+	})
+	if explicit != nil {
+		return explicit
+	}
+
+	// Each paragraph credits its parent fully and its grandparent by half
+	scores := make(map[*html.Node]float64)
+	walkElements(doc, func(n *html.Node) {
+		if n.DataAtom != atom.P && n.DataAtom != atom.Pre {
+			return
+		}
+		text := strings.TrimSpace(htmlText(n))
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		if parent := n.Parent; parent != nil {
+			scores[parent] += score
+			if grand := parent.Parent; grand != nil {
+				scores[grand] += score / 2
+			}
+		}
+	})
+
+	var best *html.Node
+	bestScore := 0.0
+	for n, score := range scores {
+		score *= 1 - linkDensity(n)
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best != nil {
+		return best
+	}
+
+	// No paragraphs: fall back to the whole body
+	var body *html.Node
+	walkElements(doc, func(n *html.Node) {
+		if body == nil && n.DataAtom == atom.Body {
+			body = n
+		}
+	})
+	if body != nil {
+		return body
+	}
+	return doc
+}
+
+// linkDensity is the share of n's text that sits inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(htmlText(n))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	walkElements(n, func(c *html.Node) {
+		if c.DataAtom == atom.A {
+			linked += len(htmlText(c))
+		}
+	})
+	return float64(linked) / float64(total)
+}
+
+// htmlText renders n as plain text; block elements start new lines and <pre>
+// content is kept verbatim
+func htmlText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node, bool)
+	walk = func(n *html.Node, pre bool) {
+		switch n.Type {
+		case html.TextNode:
+			if pre {
+				b.WriteString(n.Data)
+				return
+			}
+			text := spaceRe.ReplaceAllString(strings.ReplaceAll(n.Data, "\n", " "), " ")
+			if b.Len() == 0 || strings.HasSuffix(b.String(), "\n") {
+				text = strings.TrimLeft(text, " ")
+			}
+			b.WriteString(text)
+			return
+		case html.ElementNode:
+			pre = pre || n.DataAtom == atom.Pre
+			if blockTags[n.DataAtom] {
+				b.WriteString("\n")
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, pre)
+		}
+		if n.Type == html.ElementNode && blockTags[n.DataAtom] {
+			b.WriteString("\n")
+		}
+	}
+	walk(n, false)
+	return b.String()
+}
+
+// collapseHTMLText trims lines and squeezes blank lines in extracted text
+func collapseHTMLText(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(blankLinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+func walkElements(n *html.Node, fn func(*html.Node)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			fn(c)
+		}
+		walkElements(c, fn)
+	}
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
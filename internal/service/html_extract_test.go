@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+const boilerplatePage = `<!DOCTYPE html>
+<html>
+<head><title>Rotating tokens</title><style>body { color: teal; }</style></head>
+<body>
+<header><a href="/">Acme Docs</a></header>
+<nav><a href="/pricing">Pricing</a> <a href="/careers">Careers</a></nav>
+<div class="cookie-banner">We use cookies to improve your experience.</div>
+<main>
+<article>
+<h1>Rotating tokens</h1>
+<p>Rotate the agent token monthly from the security settings page.</p>
+</article>
+</main>
+<aside class="sidebar">Related: Webinar signup</aside>
+<footer>Copyright Acme Corporation</footer>
+<script>trackPageview("tokens");</script>
+</body>
+</html>`
+
+func TestHTMLBoilerplateStripping(t *testing.T) {
+	env := newTestEnv(t, "")
+	query := "rotate agent token pricing careers cookies webinar copyright acme trackPageview teal"
+	chunkText := func(documentID string) string {
+		t.Helper()
+		sources, err := env.orchestrator.Search(context.Background(), query, 20, domain.SearchModeVector, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var text strings.Builder
+		for _, source := range sources {
+			if source.DocumentID == documentID {
+				text.WriteString(source.Content + "\n")
+			}
+		}
+		return text.String()
+	}
+	boilerplate := []string{"Acme Docs", "Pricing", "Careers", "cookies", "Webinar", "Copyright", "trackPageview", "color: teal"}
+
+	stripped, err := env.admin.CreateCollection(context.Background(), &domain.CreateCollectionRequest{Name: "crawled", StripHTMLBoilerplate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := env.upload(t, stripped.ID, "tokens.html", []byte(boilerplatePage), nil)
+	text := chunkText(doc.ID)
+	if !strings.Contains(text, "Rotate the agent token monthly from the security settings page.") {
+		t.Fatalf("stripped chunks %q are missing the article text", text)
+	}
+	for _, chrome := range boilerplate {
+		if strings.Contains(text, chrome) {
+			t.Errorf("stripped chunks contain boilerplate %q: %q", chrome, text)
+		}
+	}
+
+	// Collections without the setting keep the page as is
+	kept := env.createCollection(t, "raw")
+	doc = env.upload(t, kept.ID, "tokens.html", []byte(boilerplatePage), nil)
+	if text := chunkText(doc.ID); !strings.Contains(text, "Careers") {
+		t.Errorf("chunks of a collection keeping boilerplate = %q, want the navigation too", text)
+	}
+}
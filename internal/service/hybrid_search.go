@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+	ragodomain "github.com/liliang-cn/rago/v2/pkg/domain"
+)
+
+// rrfK dampens the weight of top ranks in reciprocal rank fusion; 60 is the
+// value from the original RRF paper
+const rrfK = 60
+
+// hybridCandidateFactor widens each ranking fused by hybrid search, so chunks
+// ranked moderately by both can still make the top K
+const hybridCandidateFactor = 3
+
+// retrieveChunks returns the topK chunks for a question scoring at least
+// minScore: by vector similarity, or in hybrid mode by vector similarity and
+// keyword matches fused with reciprocal rank fusion. With rag.rerank enabled,
+// more candidates are retrieved and reranked down to topK.
+//
+// minScore is a similarity threshold, so in hybrid mode it applies to the
+// vector candidates before fusion; fused scores only reflect rank.
+func (s *OrchestratorService) retrieveChunks(ctx context.Context, vec []float64, query string, topK int, mode string, minScore float64, filters map[string]string, collectionIDs []string) ([]ragodomain.Chunk, error) {
+	want := topK
+	if s.reranker != nil {
+		want = max(topK, s.cfg.RAG.Rerank.Candidates)
+	}
+
+	if s.searchMode(mode) != askdocdomain.SearchModeHybrid {
+		chunks, err := s.searchChunks(ctx, vec, want, filters, collectionIDs)
+		if err != nil {
+			return nil, err
+		}
+		return aboveScore(s.rerankChunks(ctx, query, chunks, topK), minScore), nil
+	}
+
+	candidates := want * hybridCandidateFactor
+	vectorChunks, err := s.searchChunks(ctx, vec, candidates, filters, collectionIDs)
+	if err != nil {
+		return nil, err
+	}
+	keywordChunks, err := s.keywordSearch(ctx, query, candidates, filters, collectionIDs)
+	if err != nil {
+		return nil, err
+	}
+	chunks := fuseRankings(want, aboveScore(vectorChunks, minScore), keywordChunks)
+	return s.rerankChunks(ctx, query, chunks, topK), nil
+}
+
+// searchMode resolves a requested search mode, empty for rag.search_mode
+func (s *OrchestratorService) searchMode(mode string) string {
+	if mode != "" {
+		return mode
+	}
+	if s.cfg.RAG.SearchMode != "" {
+		return s.cfg.RAG.SearchMode
+	}
+	return askdocdomain.SearchModeVector
+}
+
+// fuseRankings merges rankings with reciprocal rank fusion: each chunk scores
+// the sum of 1/(rrfK+rank) over the rankings it appears in. Scores are
+// normalized to 0..1, where 1 means first in every ranking, and ties are
+// broken by chunk ID so the order is stable.
+func fuseRankings(topK int, rankings ...[]ragodomain.Chunk) []ragodomain.Chunk {
+	if len(rankings) == 0 {
+		return nil
+	}
+	maxScore := float64(len(rankings)) / float64(rrfK+1)
+
+	scores := make(map[string]float64)
+	chunks := make(map[string]ragodomain.Chunk)
+	for _, ranking := range rankings {
+		for rank, chunk := range ranking {
+			scores[chunk.ID] += 1 / float64(rrfK+rank+1)
+			if _, ok := chunks[chunk.ID]; !ok {
+				chunks[chunk.ID] = chunk
+			}
+		}
+	}
+
+	fused := make([]ragodomain.Chunk, 0, len(chunks))
+	for id, chunk := range chunks {
+		chunk.Score = scores[id] / maxScore
+		fused = append(fused, chunk)
+	}
+	sort.Slice(fused, func(i, j int) bool {
+		if fused[i].Score != fused[j].Score {
+			return fused[i].Score > fused[j].Score
+		}
+		return fused[i].ID < fused[j].ID
+	})
+	if len(fused) > topK {
+		fused = fused[:topK]
+	}
+	return fused
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+	ragodomain "github.com/liliang-cn/rago/v2/pkg/domain"
+	"github.com/liliang-cn/rago/v2/pkg/rag/chunker"
+)
+
+// PreviewChunks splits an uploaded file, or text when file is nil, into the
+// chunks ingestion would store, without embedding or storing anything.
+// chunkSize and chunkOverlap override rag.chunk_size and rag.chunk_overlap
+// when set.
+func (s *IngestService) PreviewChunks(ctx context.Context, file *multipart.FileHeader, text string, chunkSize, chunkOverlap *int) (*domain.IngestPreview, error) {
+	size, overlap := s.cfg.RAG.ChunkSize, s.cfg.RAG.ChunkOverlap
+	if chunkSize != nil {
+		size = *chunkSize
+	}
+	if chunkOverlap != nil {
+		overlap = *chunkOverlap
+	}
+	if err := checkChunking(size, overlap); err != nil {
+		return nil, err
+	}
+
+	preview := &domain.IngestPreview{ChunkSize: size, ChunkOverlap: overlap}
+	switch {
+	case file != nil && text != "":
+		return nil, fmt.Errorf("%w: send either text or a file, not both", domain.ErrInvalidRequest)
+	case file != nil:
+		var err error
+		if text, err = s.previewFileText(ctx, file); err != nil {
+			return nil, err
+		}
+		preview.Filename = file.Filename
+	case strings.TrimSpace(text) == "":
+		return nil, fmt.Errorf("%w: text or file is required", domain.ErrInvalidRequest)
+	default:
+		if err := s.checkFileSize(int64(len(text))); err != nil {
+			return nil, err
+		}
+	}
+
+	// The same splitter and method rago's processor uses on ingestion
+	chunks, err := chunker.New().Split(text, ragodomain.ChunkOptions{
+		Size:    size,
+		Overlap: overlap,
+		Method:  "sentence",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to chunk text: %w", err)
+	}
+	preview.Chunks = make([]domain.PreviewChunk, len(chunks))
+	for i, chunk := range chunks {
+		preview.Chunks[i] = domain.PreviewChunk{Index: i, Length: utf8.RuneCountInString(chunk), Content: chunk}
+	}
+	preview.Count = len(chunks)
+	return preview, nil
+}
+
+// previewFileText reads an upload into the text ingestion would chunk, going
+// through a temp file since the extractors work on paths
+func (s *IngestService) previewFileText(ctx context.Context, file *multipart.FileHeader) (string, error) {
+	if err := s.checkFileType(file.Filename); err != nil {
+		return "", fmt.Errorf("%w: %v", domain.ErrInvalidRequest, err)
+	}
+	if err := s.checkFileSize(file.Size); err != nil {
+		return "", err
+	}
+	fileType := DetectFileType(file.Filename)
+
+	src, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+	content, err := sniffUpload(fileType, src)
+	if err != nil {
+		return "", err
+	}
+
+	// Keep the extension so the extractors see the same file type
+	tmp, err := os.CreateTemp("", "askdoc-preview-*"+filepath.Ext(file.Filename))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to save uploaded file: %w", err)
+	}
+
+	text, err := s.previewText(ctx, fileType, tmp.Name())
+	if err != nil && ctx.Err() == nil {
+		err = fmt.Errorf("%w: %v", domain.ErrInvalidRequest, err)
+	}
+	return text, err
+}
+
+// previewText extracts the text of a file as ingestDocument hands it to rago.
+// HTML is read as is, as for collections that keep boilerplate.
+func (s *IngestService) previewText(ctx context.Context, fileType, path string) (string, error) {
+	switch {
+	case isStructured(fileType):
+		structured, err := extractStructured(fileType, path, nil)
+		if err != nil {
+			return "", err
+		}
+		return structured.text, nil
+	case needsExtraction(fileType, nil):
+		return s.extractText(ctx, fileType, path)
+	case fileType == FileTypePDF:
+		pages, err := extractPDFPages(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(pages, "\n"), nil
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
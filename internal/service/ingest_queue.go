@@ -0,0 +1,75 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/liliang-cn/askdoc/internal/metrics"
+)
+
+// ingestQueue runs queued ingestions in order on a fixed number of workers,
+// so a bulk import doesn't embed every file at once
+type ingestQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	tasks   []func()
+	running int
+	closed  bool
+}
+
+func newIngestQueue(workers int) *ingestQueue {
+	q := &ingestQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	for range max(workers, 1) {
+		go q.work()
+	}
+	return q
+}
+
+// push queues a task for the next free worker
+func (q *ingestQueue) push(task func()) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, task)
+	q.mu.Unlock()
+	metrics.IngestionsQueued.Inc()
+	q.cond.Signal()
+}
+
+func (q *ingestQueue) work() {
+	for {
+		q.mu.Lock()
+		for len(q.tasks) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.tasks) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		task := q.tasks[0]
+		q.tasks[0] = nil
+		q.tasks = q.tasks[1:]
+		q.running++
+		q.mu.Unlock()
+		metrics.IngestionsQueued.Dec()
+
+		task()
+
+		q.mu.Lock()
+		q.running--
+		q.mu.Unlock()
+	}
+}
+
+// depth returns the number of tasks waiting for a worker and running
+func (q *ingestQueue) depth() (queued, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.tasks), q.running
+}
+
+// close stops the workers once the queue is drained
+func (q *ingestQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// permanentError marks an ingestion failure that retrying cannot fix, such
+// as content that cannot be read
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent wraps err so it is not retried
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// transientMarkers are substrings of LLM backend and network errors worth retrying
+var transientMarkers = []string{
+	"timeout", "timed out", "deadline exceeded", "connection refused", "connection reset",
+	"broken pipe", "eof", "temporarily", "rate limit",
+	"too many requests", "internal server error", "bad gateway", "service unavailable", "gateway timeout",
+}
+
+// isTransient reports whether an ingestion failure may succeed on retry
+func isTransient(err error) bool {
+	var perm *permanentError
+	if errors.As(err, &perm) || errors.Is(err, domain.ErrInvalidRequest) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, domain.ErrLLMUnavailable) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range transientMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay is the wait before the given retry (1-based): ingest.retry_backoff
+// doubled for every earlier retry
+func (s *IngestService) retryDelay(retry int) time.Duration {
+	delay := s.cfg.Ingest.RetryBackoff
+	for i := 1; i < retry && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+// withRetries runs attempt until it succeeds, fails permanently or
+// ingest.max_attempts is reached, and returns the number of attempts made
+func (s *IngestService) withRetries(ctx context.Context, filename string, attempt func() error) (int, error) {
+	maxAttempts := max(s.cfg.Ingest.MaxAttempts, 1)
+	for n := 1; ; n++ {
+		err := attempt()
+		if err == nil || n >= maxAttempts || ctx.Err() != nil || !isTransient(err) {
+			return n, err
+		}
+
+		delay := s.retryDelay(n)
+		log.Printf("[Ingest] Attempt %d/%d for %s failed, retrying in %s: %v", n, maxAttempts, filename, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return n, err
+		case <-timer.C:
+		}
+	}
+}
@@ -1,39 +1,69 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/liliang-cn/askdoc/internal/config"
 	"github.com/liliang-cn/askdoc/internal/domain"
+	"github.com/liliang-cn/askdoc/internal/metrics"
 	"github.com/liliang-cn/askdoc/internal/repository"
+	ragodomain "github.com/liliang-cn/rago/v2/pkg/domain"
 )
 
 // IngestService handles document ingestion using rago storage
 type IngestService struct {
 	collectionRepo *repository.CollectionRepository
+	documentRepo   *repository.DocumentRepository
 	cfg            *config.Config
 	orchestrator   *OrchestratorService
+	jobs           *JobTracker
+	files          *fileCipher // nil when storage.encryption_key is unset
+
+	// In-flight ingestions run under baseCtx so shutdown can drain or cancel
+	// them; inflight counts queued ones too
+	baseCtx  context.Context
+	cancel   context.CancelFunc
+	inflight sync.WaitGroup
+	queue    *ingestQueue // ingest.concurrency workers
 }
 
 // NewIngestService creates a new ingest service
 func NewIngestService(
 	collectionRepo *repository.CollectionRepository,
+	documentRepo *repository.DocumentRepository,
 	cfg *config.Config,
 	orchestrator *OrchestratorService,
 ) *IngestService {
-	return &IngestService{
+	s := &IngestService{
 		collectionRepo: collectionRepo,
+		documentRepo:   documentRepo,
 		cfg:            cfg,
 		orchestrator:   orchestrator,
+		jobs:           NewJobTracker(),
+		queue:          newIngestQueue(cfg.Ingest.Concurrency),
+	}
+	// The keys were validated by config.Load
+	if files, err := newFileCipher(cfg.Storage); err != nil {
+		log.Fatalf("[Ingest] invalid storage encryption key: %v", err)
+	} else {
+		s.files = files
 	}
+	s.baseCtx, s.cancel = context.WithCancel(context.Background())
+	return s
 }
 
 // FileType constants
@@ -43,6 +73,11 @@ const (
 	FileTypeTXT  = "txt"
 	FileTypeHTML = "html"
 	FileTypeADOC = "adoc"
+	FileTypeDOCX = "docx"
+	FileTypePNG  = "png"
+	FileTypeJPG  = "jpg"
+	FileTypeCSV  = "csv"
+	FileTypeJSON = "json"
 )
 
 // DetectFileType detects file type from filename
@@ -59,6 +94,16 @@ func DetectFileType(filename string) string {
 		return FileTypeHTML
 	case ".adoc", ".asciidoc":
 		return FileTypeADOC
+	case ".docx":
+		return FileTypeDOCX
+	case ".png":
+		return FileTypePNG
+	case ".jpg", ".jpeg":
+		return FileTypeJPG
+	case ".csv":
+		return FileTypeCSV
+	case ".json", ".jsonl", ".ndjson":
+		return FileTypeJSON
 	default:
 		return ext[1:] // remove leading dot
 	}
@@ -72,6 +117,11 @@ func IsSupported(fileType string) bool {
 		FileTypeTXT:  true,
 		FileTypeHTML: true,
 		FileTypeADOC: true,
+		FileTypeDOCX: true,
+		FileTypePNG:  true,
+		FileTypeJPG:  true,
+		FileTypeCSV:  true,
+		FileTypeJSON: true,
 	}
 	return supported[fileType]
 }
@@ -82,7 +132,167 @@ func (s *IngestService) UploadDocument(
 	collectionID string,
 	file *multipart.FileHeader,
 	metadata map[string]any,
+	visibility string,
+	onDuplicate string,
+) (*domain.Document, error) {
+	return s.uploadFile(ctx, collectionID, file, metadata, visibility, onDuplicate, "")
+}
+
+// UploadDocuments queues a batch of uploaded files for ingestion, sharing
+// metadata and visibility. The whole batch is rejected when it exceeds
+// storage.max_batch_files or storage.max_batch_size, or when any file would
+// be refused on its own. If storing a file fails, the documents queued so far
+// are returned with the error.
+func (s *IngestService) UploadDocuments(
+	ctx context.Context,
+	collectionID string,
+	files []*multipart.FileHeader,
+	metadata map[string]any,
+	visibility string,
+	onDuplicate string,
+) ([]*domain.Document, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: at least one file is required", domain.ErrInvalidRequest)
+	}
+	if limit := s.cfg.Storage.MaxBatchFiles; limit > 0 && len(files) > limit {
+		return nil, fmt.Errorf("%w: batch has %d files, the limit is %d", domain.ErrInvalidRequest, len(files), limit)
+	}
+	if _, err := domain.ParseVisibility(visibility); err != nil {
+		return nil, err
+	}
+	if _, err := domain.ParseOnDuplicate(onDuplicate); err != nil {
+		return nil, err
+	}
+	if err := normalizeMetadataTags(metadata); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, file := range files {
+		if err := s.checkFileSize(file.Size); err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Filename, err)
+		}
+		if err := s.checkFileType(file.Filename); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", domain.ErrInvalidRequest, file.Filename, err)
+		}
+		if err := checkUploadContent(file); err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Filename, err)
+		}
+		total += file.Size
+	}
+	if limit := s.cfg.Storage.MaxBatchSize; limit > 0 && total > limit {
+		return nil, fmt.Errorf("%w: batch is %d bytes, the limit is %d", domain.ErrInvalidRequest, total, limit)
+	}
+
+	collection, err := s.collectionRepo.Get(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if collection == nil {
+		return nil, domain.ErrNotFound
+	}
+
+	// The batch is one job, so its progress streams file by file
+	job := s.jobs.Create(collectionID, len(files))
+	documents := make([]*domain.Document, 0, len(files))
+	for i, file := range files {
+		document, err := s.uploadFile(ctx, collectionID, file, maps.Clone(metadata), visibility, onDuplicate, job.ID)
+		if err != nil {
+			// The files left unstored end the job
+			s.jobs.FileFailed(job.ID, file.Filename, err)
+			for _, rest := range files[i+1:] {
+				s.jobs.FileFailed(job.ID, rest.Filename, fmt.Errorf("batch stopped at %s", file.Filename))
+			}
+			return documents, fmt.Errorf("%s: %w", file.Filename, err)
+		}
+		documents = append(documents, document)
+	}
+	return documents, nil
+}
+
+// uploadFile uploads a multipart file, reporting its progress to the job
+// jobID as uploadDocument does
+func (s *IngestService) uploadFile(ctx context.Context, collectionID string, file *multipart.FileHeader, metadata map[string]any, visibility, onDuplicate, jobID string) (*domain.Document, error) {
+	if err := s.checkFileSize(file.Size); err != nil {
+		return nil, err
+	}
+	src, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	return s.uploadDocument(ctx, collectionID, file.Filename, file.Size, src, metadata, visibility, onDuplicate, jobID)
+}
+
+// UploadDocumentContent queues an in-memory file (e.g. a decoded base64
+// payload) for ingestion, with the same checks as UploadDocument
+func (s *IngestService) UploadDocumentContent(
+	ctx context.Context,
+	collectionID string,
+	filename string,
+	content []byte,
+	metadata map[string]any,
+	visibility string,
+	onDuplicate string,
+) (*domain.Document, error) {
+	if strings.TrimSpace(filename) == "" {
+		return nil, fmt.Errorf("%w: filename is required", domain.ErrInvalidRequest)
+	}
+	if err := s.checkFileSize(int64(len(content))); err != nil {
+		return nil, err
+	}
+	return s.uploadDocument(ctx, collectionID, filename, int64(len(content)), bytes.NewReader(content), metadata, visibility, onDuplicate, "")
+}
+
+// checkFileSize rejects uploads larger than storage.max_file_size
+func (s *IngestService) checkFileSize(size int64) error {
+	if limit := s.cfg.Storage.MaxFileSize; limit > 0 && size > limit {
+		return fmt.Errorf("%w: file exceeds %d bytes", domain.ErrFileTooLarge, limit)
+	}
+	return nil
+}
+
+// checkFileType rejects files that can't be ingested, judged by their name
+func (s *IngestService) checkFileType(filename string) error {
+	fileType := DetectFileType(filename)
+	if !IsSupported(fileType) {
+		return fmt.Errorf("unsupported file type: %s", fileType)
+	}
+	if (fileType == FileTypePNG || fileType == FileTypeJPG) && !s.cfg.OCR.Enabled {
+		return fmt.Errorf("image uploads require ocr.enabled")
+	}
+	return nil
+}
+
+// uploadDocument stores src under the collection and starts its ingestion.
+// When the collection already has a document with the same content,
+// onDuplicate decides whether the upload fails, returns that document or is
+// stored anyway.
+// Its progress is reported to the job jobID, or to a job of its own when
+// empty.
+func (s *IngestService) uploadDocument(
+	ctx context.Context,
+	collectionID string,
+	filename string,
+	size int64,
+	src io.Reader,
+	metadata map[string]any,
+	visibility string,
+	onDuplicate string,
+	jobID string,
 ) (*domain.Document, error) {
+	visibility, err := domain.ParseVisibility(visibility)
+	if err != nil {
+		return nil, err
+	}
+	if onDuplicate, err = domain.ParseOnDuplicate(onDuplicate); err != nil {
+		return nil, err
+	}
+	if err := normalizeMetadataTags(metadata); err != nil {
+		return nil, err
+	}
+
 	// Check collection exists
 	collection, err := s.collectionRepo.Get(collectionID)
 	if err != nil {
@@ -92,101 +302,348 @@ func (s *IngestService) UploadDocument(
 		return nil, fmt.Errorf("collection not found: %s", collectionID)
 	}
 
-	// Detect file type
-	fileType := DetectFileType(file.Filename)
-	if !IsSupported(fileType) {
-		return nil, fmt.Errorf("unsupported file type: %s", fileType)
+	if err := s.checkFileType(filename); err != nil {
+		return nil, err
+	}
+	fileType := DetectFileType(filename)
+	// Trust the content over the extension
+	if src, err = sniffUpload(fileType, src); err != nil {
+		return nil, err
+	}
+	// The declared size may understate what the body holds
+	limited := &io.LimitedReader{R: src, N: s.cfg.Storage.MaxFileSize + 1}
+	if s.cfg.Storage.MaxFileSize > 0 {
+		src = limited
 	}
 
 	// Create storage directory
-	storageDir := filepath.Join(s.cfg.Storage.Documents, collectionID)
+	storageDir, err := safeStoragePath(s.cfg.Storage.Documents, collectionID)
+	if err != nil {
+		return nil, err
+	}
 	if err := os.MkdirAll(storageDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create storage directory: %w", err)
 	}
 
 	// Generate unique document ID
 	docID := uuid.New().String()
-	ext := filepath.Ext(file.Filename)
-	storagePath := filepath.Join(storageDir, docID+ext)
-
-	// Save file
-	src, err := file.Open()
+	ext := filepath.Ext(filename)
+	storagePath, err := safeStoragePath(s.cfg.Storage.Documents, collectionID, docID+ext)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open uploaded file: %w", err)
+		return nil, err
 	}
-	defer src.Close()
 
-	dst, err := os.Create(storagePath)
+	// Save file
+	dst, storagePath, err := createStorageFile(storagePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create storage file: %w", err)
 	}
 	defer dst.Close()
 
-	if _, err := io.Copy(dst, src); err != nil {
+	contentHash, err := s.writeStoredFile(dst, src)
+	if err == nil && limited.N <= 0 {
+		err = fmt.Errorf("%w: file exceeds %d bytes", domain.ErrFileTooLarge, s.cfg.Storage.MaxFileSize)
+	}
+	if err != nil {
+		// Don't leave a partial file behind
+		dst.Close()
+		if rmErr := os.Remove(storagePath); rmErr != nil {
+			log.Printf("[Ingest] Removing partial file %s failed: %v", storagePath, rmErr)
+		}
+		if errors.Is(err, domain.ErrFileTooLarge) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to save file: %w", err)
 	}
-
-	// Update collection document count
-	if err := s.collectionRepo.UpdateDocumentCount(collectionID, 1); err != nil {
-		return nil, err
+	if existing, err := s.duplicateDocument(ctx, collectionID, contentHash, onDuplicate); existing != nil || err != nil {
+		dst.Close()
+		if rmErr := os.Remove(storagePath); rmErr != nil {
+			log.Printf("[Ingest] Removing duplicate file %s failed: %v", storagePath, rmErr)
+		}
+		if existing != nil {
+			// The file is already ingested as the existing document
+			s.jobs.FileCompleted(jobID, filename, existing.ID)
+		}
+		return existing, err
 	}
 
-	// Create document record (will be stored in rago after ingestion)
 	document := &domain.Document{
 		ID:           docID,
 		CollectionID: collectionID,
-		Filename:     file.Filename,
+		Filename:     filename,
 		FileType:     fileType,
-		FileSize:     file.Size,
+		FileSize:     size,
 		Status:       domain.DocumentStatusPending,
+		Visibility:   visibility,
+		Tags:         domain.ParseTags(metadata),
 		Metadata:     metadata,
+		ContentHash:  contentHash,
+	}
+
+	// Record the document under its upload ID so its status can be polled
+	// while it is pending and after a failure
+	if err := s.documentRepo.Save(document); err != nil {
+		return nil, fmt.Errorf("failed to record document: %w", err)
+	}
+	if s.orchestrator != nil {
+		if err := s.orchestrator.CreateDocumentRecord(ctx, docID, filename, documentMetadata(document, domain.DocumentStatusPending)); err != nil {
+			return nil, fmt.Errorf("failed to create document record: %w", err)
+		}
 	}
 
-	// Start async ingestion using Orchestrator
-	go s.ingestDocument(context.Background(), document, storagePath)
+	// Update collection document count
+	if err := s.collectionRepo.UpdateDocumentCount(collectionID, 1); err != nil {
+		return nil, err
+	}
+
+	// Track progress as a single-file job unless part of a batch
+	if jobID == "" {
+		jobID = s.jobs.Create(collectionID, 1).ID
+	}
+	document.JobID = jobID
+
+	// Queue async ingestion using Orchestrator
+	s.enqueue(func() {
+		s.ingestDocument(s.baseCtx, collection, document, storagePath)
+	})
 
 	return document, nil
 }
 
-// ingestDocument processes a document and ingests it into rago storage
-func (s *IngestService) ingestDocument(ctx context.Context, document *domain.Document, storagePath string) {
-	// Build metadata for rago - includes all AskDoc-specific fields
+// duplicateDocument looks for a document of the collection with the same
+// content as an upload. Under on_duplicate=reject it returns a
+// DuplicateDocumentError, under existing the document found.
+func (s *IngestService) duplicateDocument(ctx context.Context, collectionID, hash, onDuplicate string) (*domain.Document, error) {
+	if onDuplicate == domain.OnDuplicateAllow {
+		return nil, nil
+	}
+	record, err := s.documentRepo.FindByHash(collectionID, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up duplicates: %w", err)
+	}
+	if record == nil {
+		return nil, nil
+	}
+	if onDuplicate == domain.OnDuplicateReject {
+		return nil, &domain.DuplicateDocumentError{ExistingID: record.ID}
+	}
+
+	existing := record
+	if s.orchestrator != nil {
+		if doc, err := s.orchestrator.GetDocument(ctx, record.ID); err == nil {
+			existing = doc
+		}
+	}
+	existing.Duplicate = true
+	return existing, nil
+}
+
+// normalizeMetadataTags validates the tags of upload metadata, given as a
+// comma-separated string or a list of strings, and stores them in the
+// comma-separated form chunks are filtered on
+func normalizeMetadataTags(metadata map[string]any) error {
+	raw, ok := metadata[domain.MetadataKeyTags]
+	if !ok {
+		return nil
+	}
+	var tags []string
+	switch v := raw.(type) {
+	case string:
+		if v != "" {
+			tags = strings.Split(v, ",")
+		}
+	case []string:
+		tags = v
+	case []any:
+		for _, item := range v {
+			tag, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("%w: tags must be strings", domain.ErrInvalidRequest)
+			}
+			tags = append(tags, tag)
+		}
+	default:
+		return fmt.Errorf("%w: tags must be a list of strings", domain.ErrInvalidRequest)
+	}
+
+	tags, err := domain.NormalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		delete(metadata, domain.MetadataKeyTags)
+		return nil
+	}
+	metadata[domain.MetadataKeyTags] = strings.Join(tags, ",")
+	return nil
+}
+
+// documentMetadata is the rago metadata of an uploaded document, copied to
+// each of its chunks
+func documentMetadata(document *domain.Document, status string) map[string]any {
 	metadata := make(map[string]any)
 	metadata[domain.MetadataKeyCollectionID] = document.CollectionID
 	metadata[domain.MetadataKeyFilename] = document.Filename
 	metadata[domain.MetadataKeyFileType] = document.FileType
 	metadata[domain.MetadataKeyFileSize] = document.FileSize
-	metadata[domain.MetadataKeyStatus] = domain.DocumentStatusProcessing
+	metadata[domain.MetadataKeyStatus] = status
 	for k, v := range document.Metadata {
 		metadata[k] = v
 	}
+	metadata[domain.MetadataKeyVisibility] = document.Visibility
+	if document.ContentHash != "" {
+		metadata[domain.MetadataKeyContentHash] = document.ContentHash
+	}
+	return metadata
+}
+
+// identicalDocument returns an ingested document with the same content whose
+// chunks the upload can share (ingest.share_identical), or nil. Drafts are
+// never shared since their chunks must stay hidden until published, nor are
+// documents split with another chunk size or overlap or carrying other tags.
+func (s *IngestService) identicalDocument(ctx context.Context, document *domain.Document, chunkSize, chunkOverlap int) *domain.Document {
+	if !s.cfg.Ingest.ShareIdentical || s.orchestrator == nil || document.ContentHash == "" ||
+		document.Visibility != domain.DocumentVisibilityPublished {
+		return nil
+	}
+	owner, err := s.orchestrator.FindSharedDocument(ctx, document.ContentHash, document.ID)
+	if err != nil {
+		log.Printf("[Ingest] Looking up identical documents failed: %v", err)
+		return nil
+	}
+	if owner != nil && (!sameChunking(s.cfg, owner, chunkSize, chunkOverlap) || !slices.Equal(owner.Tags, document.Tags)) {
+		return nil
+	}
+	return owner
+}
+
+// ingestDocument processes a document and ingests it into rago storage
+func (s *IngestService) ingestDocument(ctx context.Context, collection *domain.Collection, document *domain.Document, storagePath string) {
+	s.jobs.FileStarted(document.JobID, document.Filename)
+	metrics.IngestionsInProgress.Inc()
+	defer metrics.IngestionsInProgress.Dec()
+	start := time.Now()
+	defer func() {
+		metrics.Ingestions.Inc(document.Status)
+		metrics.IngestDuration.ObserveSince(start, document.Status)
+	}()
+
+	s.recordStatus(document.ID, domain.DocumentStatusProcessing, "")
+	defer func() { s.recordStatus(document.ID, document.Status, document.Error) }()
+
+	// Build metadata for rago - includes all AskDoc-specific fields
+	metadata := documentMetadata(document, domain.DocumentStatusProcessing)
+	// Recorded so the chunks can be reproduced after the settings change
+	chunkSize, chunkOverlap := collectionChunking(s.cfg, collection)
+	metadata[domain.MetadataKeyChunkSize] = chunkSize
+	metadata[domain.MetadataKeyChunkOverlap] = chunkOverlap
 
 	var chunkCount int
 	var ingestErr error
 
-	if s.orchestrator != nil {
+	if owner := s.identicalDocument(ctx, document, chunkSize, chunkOverlap); owner != nil {
+		// Reuse the chunks of an identical upload instead of embedding again
+		if ingestErr = s.orchestrator.ShareDocument(ctx, document.ID, owner); ingestErr == nil {
+			chunkCount = owner.ChunkCount
+			log.Printf("[Ingest] %s is identical to document %s, sharing its chunks", document.Filename, owner.ID)
+		}
+	} else if s.orchestrator != nil {
 		// Ingest using Orchestrator (stores document in rago)
 		log.Printf("[Ingest] Starting ingestion for document: %s", document.Filename)
-		resp, err := s.orchestrator.IngestFile(ctx, storagePath, metadata)
+		if err := s.orchestrator.UpdateDocumentMetadata(ctx, document.ID, map[string]any{
+			domain.MetadataKeyStatus: domain.DocumentStatusProcessing,
+		}); err != nil {
+			log.Printf("[Ingest] UpdateDocumentMetadata failed: %v", err)
+		}
+		var resp *ragodomain.IngestResponse
+		// Encrypted uploads are decrypted to a temp file for the duration
+		ingestPath, cleanup, err := s.plainStoredFile(storagePath)
+		defer cleanup()
+		attempts := 0
+		var structured *structuredText
+		if err == nil {
+			attempts, err = s.withRetries(ctx, document.Filename, func() error {
+				var err error
+				if isStructured(document.FileType) {
+					// One "field: value" block per row, tagged with its row afterwards
+					if structured, err = extractStructured(document.FileType, ingestPath, structuredFields(document.Metadata)); err != nil {
+						return permanent(err)
+					}
+					resp, err = s.orchestrator.IngestText(ctx, structured.text, document.Filename, chunkSize, chunkOverlap, metadata)
+				} else if needsExtraction(document.FileType, collection) {
+					// Convert to text first; the original file stays in storage for citation/download
+					var text string
+					if text, err = s.extractText(ctx, document.FileType, ingestPath); err != nil {
+						if ctx.Err() == nil {
+							err = permanent(err)
+						}
+						return err
+					}
+					resp, err = s.orchestrator.IngestText(ctx, text, document.Filename, chunkSize, chunkOverlap, metadata)
+				} else {
+					resp, err = s.orchestrator.IngestFile(ctx, ingestPath, chunkSize, chunkOverlap, metadata)
+				}
+				return err
+			})
+		}
+		document.Attempts = attempts
+		if err == nil {
+			// Keep the upload's ID rather than the one rago generated
+			if err = s.orchestrator.AdoptDocument(ctx, document.ID, resp.DocumentID); err != nil {
+				s.orchestrator.DeleteDocument(context.WithoutCancel(ctx), resp.DocumentID)
+			}
+		}
 		if err != nil {
 			ingestErr = err
 			log.Printf("[Ingest] IngestFile failed: %v", err)
 		} else {
 			chunkCount = resp.ChunkCount
-			// Update document ID to match rago's document ID
-			document.ID = resp.DocumentID
 			log.Printf("[Ingest] IngestFile success, docID=%s, chunks=%d", document.ID, chunkCount)
 
 			// Update metadata with chunk count and status
 			updateMeta := map[string]any{
 				domain.MetadataKeyChunkCount: chunkCount,
 				domain.MetadataKeyStatus:     domain.DocumentStatusReady,
+				domain.MetadataKeyAttempts:   attempts,
+			}
+			if structured != nil {
+				updateMeta[domain.MetadataKeySkippedRows] = structured.skipped
 			}
 			if err := s.orchestrator.UpdateDocumentMetadata(ctx, document.ID, updateMeta); err != nil {
 				log.Printf("[Ingest] UpdateDocumentMetadata failed: %v", err)
 			} else {
 				log.Printf("[Ingest] UpdateDocumentMetadata success")
 			}
+
+			// Row numbers only improve citations, so failures don't fail the document
+			if structured != nil {
+				if structured.skipped > 0 {
+					log.Printf("[Ingest] Skipped %d malformed rows of %s", structured.skipped, document.Filename)
+				}
+				if err := s.orchestrator.AnnotateRows(ctx, document.ID, structured); err != nil {
+					log.Printf("[Ingest] Recording rows of %s failed: %v", document.Filename, err)
+				}
+			}
+
+			// Headings only improve citation labels, so failures don't fail the document
+			if hasSections(document.FileType) {
+				if err := s.annotateSections(ctx, document, ingestPath); err != nil {
+					log.Printf("[Ingest] Reading sections of %s failed: %v", document.Filename, err)
+				}
+			}
+			// Page numbers only improve citations too
+			if document.FileType == FileTypePDF {
+				if err := s.annotatePages(ctx, document, ingestPath); err != nil {
+					log.Printf("[Ingest] Reading pages of %s failed: %v", document.Filename, err)
+				}
+			}
+
+			// A missing summary only weakens retrieval, so it doesn't fail the document
+			if s.cfg.RAG.DocumentSummaries {
+				if err := s.orchestrator.SummarizeDocument(ctx, document.ID); err != nil {
+					log.Printf("[Ingest] Summarizing %s failed: %v", document.Filename, err)
+				}
+			}
 		}
 	} else {
 		// No orchestrator service, just mark as ready with 0 chunks
@@ -195,26 +652,467 @@ func (s *IngestService) ingestDocument(ctx context.Context, document *domain.Doc
 
 	// Handle ingestion error
 	if ingestErr != nil {
+		if ctx.Err() != nil {
+			// Cancelled by shutdown; the uploaded file is kept so it can be re-ingested
+			ingestErr = fmt.Errorf("ingestion interrupted by shutdown: %w", ingestErr)
+			log.Printf("[Ingest] Interrupted ingestion of %s, file kept at %s", document.Filename, storagePath)
+		}
+
 		// Update metadata with error status
 		if s.orchestrator != nil {
 			updateMeta := map[string]any{
-				domain.MetadataKeyStatus: domain.DocumentStatusFailed,
-				domain.MetadataKeyError:  ingestErr.Error(),
+				domain.MetadataKeyStatus:   domain.DocumentStatusFailed,
+				domain.MetadataKeyError:    ingestErr.Error(),
+				domain.MetadataKeyAttempts: document.Attempts,
 			}
-			s.orchestrator.UpdateDocumentMetadata(ctx, document.ID, updateMeta)
+			s.orchestrator.UpdateDocumentMetadata(context.WithoutCancel(ctx), document.ID, updateMeta)
 		}
 		document.Status = domain.DocumentStatusFailed
 		document.Error = ingestErr.Error()
+		s.jobs.FileFailed(document.JobID, document.Filename, ingestErr)
 	} else {
 		document.Status = domain.DocumentStatusReady
 		document.ChunkCount = chunkCount
+
+		// New content invalidates cached answers for the collection
+		if err := s.collectionRepo.BumpVersion(document.CollectionID); err != nil {
+			log.Printf("[Ingest] BumpVersion failed: %v", err)
+		}
+		if err := s.collectionRepo.SetLastIngested(document.CollectionID, time.Now()); err != nil {
+			log.Printf("[Ingest] SetLastIngested failed: %v", err)
+		}
+		s.jobs.FileCompleted(document.JobID, document.Filename, document.ID)
+	}
+}
+
+// recordStatus keeps a document's metadata DB record in step with its
+// ingestion. Failures are only logged; rago holds the status too.
+func (s *IngestService) recordStatus(id, status, errMsg string) {
+	if err := s.documentRepo.SetStatus(id, status, errMsg); err != nil {
+		log.Printf("[Ingest] Recording status %s of %s failed: %v", status, id, err)
+	}
+}
+
+// recordDocument saves the metadata DB record of a document ingested
+// synchronously. Failures are only logged since the document is in rago.
+func (s *IngestService) recordDocument(document *domain.Document) {
+	if err := s.documentRepo.Save(document); err != nil {
+		log.Printf("[Ingest] Recording document %s failed: %v", document.ID, err)
+	}
+}
+
+// ingestResultKeys are the metadata keys written by ingestion itself; a
+// reingest drops them and keeps everything else
+var ingestResultKeys = map[string]bool{
+	domain.MetadataKeyStatus:     true,
+	domain.MetadataKeyChunkCount: true,
+	domain.MetadataKeyError:      true,
+	domain.MetadataKeyAttempts:   true,
+
+	domain.MetadataKeySkippedRows: true,
+	domain.MetadataKeySummaries:   true,
+
+	domain.MetadataKeyChunkSize:    true,
+	domain.MetadataKeyChunkOverlap: true,
+}
+
+// ReingestDocument re-chunks and re-embeds a document from its stored
+// original with the current RAG settings. The document keeps its ID and
+// metadata; its old chunks are deleted before ingestion starts.
+func (s *IngestService) ReingestDocument(ctx context.Context, id string) (*domain.Document, error) {
+	if s.orchestrator == nil {
+		return nil, domain.ErrNotFound
+	}
+
+	doc, err := s.orchestrator.GetDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case doc.FileType == domain.DocumentTypeFAQ:
+		return nil, fmt.Errorf("%w: FAQ entries have no stored file", domain.ErrInvalidRequest)
+	case doc.SharedFrom != "":
+		return nil, fmt.Errorf("%w: document shares the chunks of %s, reingest that document instead", domain.ErrInvalidRequest, doc.SharedFrom)
+	case doc.Status == domain.DocumentStatusPending || doc.Status == domain.DocumentStatusProcessing:
+		return nil, fmt.Errorf("%w: document is already being ingested", domain.ErrInvalidRequest)
+	case doc.DeletedAt != nil:
+		return nil, fmt.Errorf("%w: document is in the trash, restore it first", domain.ErrInvalidRequest)
+	}
+	return s.reingest(ctx, doc)
+}
+
+// reingest deletes a document's chunks and queues its ingestion from the
+// stored original
+func (s *IngestService) reingest(ctx context.Context, doc *domain.Document) (*domain.Document, error) {
+	collection, err := s.collectionRepo.Get(doc.CollectionID)
+	if err != nil {
+		return nil, err
+	}
+	if collection == nil {
+		return nil, fmt.Errorf("collection not found: %s", doc.CollectionID)
+	}
+
+	storagePath := s.GetStoragePath(doc)
+	if storagePath == "" {
+		return nil, domain.ErrSourceMissing
+	}
+	if _, err := os.Stat(storagePath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, domain.ErrSourceMissing
+		}
+		return nil, fmt.Errorf("failed to stat stored file: %w", err)
+	}
+
+	if err := s.orchestrator.DeleteDocumentChunks(ctx, doc.ID); err != nil {
+		return nil, err
+	}
+	if err := s.orchestrator.UpdateDocumentMetadata(ctx, doc.ID, map[string]any{
+		domain.MetadataKeyStatus:     domain.DocumentStatusPending,
+		domain.MetadataKeyChunkCount: 0,
+		domain.MetadataKeyError:      "",
+		domain.MetadataKeyAttempts:   0,
+		domain.MetadataKeySummaries:  nil,
+	}); err != nil {
+		return nil, err
+	}
+	// Cached answers may cite the deleted chunks
+	if err := s.collectionRepo.BumpVersion(doc.CollectionID); err != nil {
+		log.Printf("[Ingest] BumpVersion failed: %v", err)
+	}
+
+	metadata := make(map[string]any, len(doc.Metadata))
+	for k, v := range doc.Metadata {
+		if !ingestResultKeys[k] {
+			metadata[k] = v
+		}
+	}
+	// ContentHash stays in the stored metadata but is left off here, so the
+	// document is embedded again rather than matched against itself
+	document := &domain.Document{
+		ID:           doc.ID,
+		CollectionID: doc.CollectionID,
+		Filename:     doc.Filename,
+		FileType:     doc.FileType,
+		FileSize:     doc.FileSize,
+		Status:       domain.DocumentStatusPending,
+		Visibility:   doc.Visibility,
+		Tags:         doc.Tags,
+		Metadata:     metadata,
+		CreatedAt:    doc.CreatedAt,
+	}
+
+	s.recordDocument(document)
+
+	job := s.jobs.Create(doc.CollectionID, 1)
+	document.JobID = job.ID
+
+	s.enqueue(func() {
+		s.ingestDocument(s.baseCtx, collection, document, storagePath)
+		// Copies of this document search its new chunks in their collections
+		if document.Status == domain.DocumentStatusReady {
+			if err := s.orchestrator.syncSharedCollections(s.baseCtx, document.ID); err != nil {
+				log.Printf("[Ingest] Updating shared copies of %s failed: %v", document.Filename, err)
+			}
+		}
+	})
+
+	return document, nil
+}
+
+// RetryDocument re-attempts the ingestion of a failed document from its
+// stored original, like ReingestDocument. Documents in any other state are
+// rejected.
+func (s *IngestService) RetryDocument(ctx context.Context, id string) (*domain.Document, error) {
+	status, err := s.DocumentStatus(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if status.Status != domain.DocumentStatusFailed {
+		return nil, fmt.Errorf("%w: only failed documents can be retried, document is %s", domain.ErrInvalidRequest, status.Status)
+	}
+	return s.ReingestDocument(ctx, id)
+}
+
+// IngestFAQ indexes question/answer pairs as one document each. Questions are
+// embedded for retrieval and answers are cited as the response.
+func (s *IngestService) IngestFAQ(ctx context.Context, collectionID string, pairs []domain.FAQPair) ([]*domain.Document, error) {
+	if s.orchestrator == nil {
+		return nil, fmt.Errorf("orchestrator not available")
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("%w: at least one question/answer pair is required", domain.ErrInvalidRequest)
+	}
+	for i, pair := range pairs {
+		if strings.TrimSpace(pair.Question) == "" || strings.TrimSpace(pair.Answer) == "" {
+			return nil, fmt.Errorf("%w: pair %d needs both question and answer", domain.ErrInvalidRequest, i)
+		}
+	}
+
+	collection, err := s.collectionRepo.Get(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if collection == nil {
+		return nil, domain.ErrNotFound
+	}
+
+	documents := make([]*domain.Document, 0, len(pairs))
+	defer func() {
+		if len(documents) > 0 {
+			if err := s.collectionRepo.BumpVersion(collectionID); err != nil {
+				log.Printf("[Ingest] BumpVersion failed: %v", err)
+			}
+			if err := s.collectionRepo.SetLastIngested(collectionID, time.Now()); err != nil {
+				log.Printf("[Ingest] SetLastIngested failed: %v", err)
+			}
+		}
+	}()
+
+	for _, pair := range pairs {
+		question := strings.TrimSpace(pair.Question)
+		answer := strings.TrimSpace(pair.Answer)
+
+		metadata := make(map[string]any, len(pair.Metadata)+7)
+		for k, v := range pair.Metadata {
+			metadata[k] = v
+		}
+		metadata[domain.MetadataKeyCollectionID] = collectionID
+		metadata[domain.MetadataKeyFilename] = question
+		metadata[domain.MetadataKeyFileType] = domain.DocumentTypeFAQ
+		metadata[domain.MetadataKeyFileSize] = int64(len(question) + len(answer))
+		metadata[domain.MetadataKeyStatus] = domain.DocumentStatusReady
+		metadata[domain.MetadataKeyChunkCount] = 1
+		metadata[domain.MetadataKeyVisibility] = domain.DocumentVisibilityPublished
+		resp, err := s.orchestrator.IngestFAQ(ctx, question, answer, "faq", metadata)
+		if err != nil {
+			return documents, fmt.Errorf("failed to ingest FAQ %q: %w", question, err)
+		}
+		if err := s.collectionRepo.UpdateDocumentCount(collectionID, 1); err != nil {
+			return documents, err
+		}
+
+		docMeta := map[string]any{
+			domain.MetadataKeyType:      domain.DocumentTypeFAQ,
+			domain.MetadataKeyFAQAnswer: answer,
+		}
+		for k, v := range pair.Metadata {
+			docMeta[k] = v
+		}
+		document := &domain.Document{
+			ID:           resp.DocumentID,
+			CollectionID: collectionID,
+			Filename:     question,
+			FileType:     domain.DocumentTypeFAQ,
+			FileSize:     int64(len(question) + len(answer)),
+			Status:       domain.DocumentStatusReady,
+			Visibility:   domain.DocumentVisibilityPublished,
+			Tags:         domain.ParseTags(docMeta),
+			ChunkCount:   resp.ChunkCount,
+			Metadata:     docMeta,
+		}
+		s.recordDocument(document)
+		documents = append(documents, document)
+	}
+	log.Printf("[Ingest] Ingested %d FAQ pairs into collection %s", len(documents), collectionID)
+
+	return documents, nil
+}
+
+// enqueue queues an ingestion for the worker pool. One still queued when
+// shutdown cancels ingestion doesn't start: its document stays pending and
+// is picked up by ResumeIngestion on the next start.
+func (s *IngestService) enqueue(task func()) {
+	s.inflight.Add(1)
+	s.queue.push(func() {
+		defer s.inflight.Done()
+		if s.baseCtx.Err() != nil {
+			return
+		}
+		task()
+	})
+}
+
+// RecordDocuments adds to the metadata DB the documents rago stores without
+// a record there, e.g. those ingested by earlier versions, so that document
+// listings, which page through the records, include them
+func (s *IngestService) RecordDocuments(ctx context.Context) error {
+	if s.orchestrator == nil {
+		return nil
+	}
+	docs, err := s.orchestrator.ListDocuments(ctx)
+	if err != nil {
+		return err
+	}
+	trashed, err := s.orchestrator.ListTrashedDocuments(ctx)
+	if err != nil {
+		return err
+	}
+
+	recorded, err := s.documentRepo.Backfill(append(docs, trashed...))
+	if err != nil {
+		return err
+	}
+	if recorded > 0 {
+		log.Printf("[Ingest] Recorded %d documents in the metadata DB", recorded)
+	}
+	return nil
+}
+
+// ResumeIngestion queues the documents left pending or processing by the
+// previous run, which was stopped before their ingestion finished.
+// Documents that can no longer be ingested are marked failed.
+func (s *IngestService) ResumeIngestion(ctx context.Context) error {
+	if s.orchestrator == nil {
+		return nil
+	}
+	records, err := s.documentRepo.List("")
+	if err != nil {
+		return err
 	}
+
+	resumed := 0
+	for _, record := range records {
+		if record.Status != domain.DocumentStatusPending && record.Status != domain.DocumentStatusProcessing {
+			continue
+		}
+		doc, err := s.orchestrator.GetDocument(ctx, record.ID)
+		if err == nil {
+			_, err = s.reingest(ctx, doc)
+		}
+		if err != nil {
+			log.Printf("[Ingest] Resuming ingestion of %s failed: %v", record.Filename, err)
+			if err == domain.ErrNotFound || err == domain.ErrSourceMissing {
+				s.recordStatus(record.ID, domain.DocumentStatusFailed, "ingestion was interrupted and cannot be resumed: "+err.Error())
+			}
+			continue
+		}
+		resumed++
+	}
+	if resumed > 0 {
+		log.Printf("[Ingest] Resumed ingestion of %d documents", resumed)
+	}
+	return nil
+}
+
+// QueueDepth returns the number of ingestions waiting for a worker and
+// running
+func (s *IngestService) QueueDepth() (queued, running int) {
+	return s.queue.depth()
 }
 
-// GetStoragePath returns the storage path for a document
+// Shutdown waits for queued and in-flight ingestions to finish. If ctx
+// expires first, they are cancelled and marked failed, and Shutdown waits for
+// them to stop.
+func (s *IngestService) Shutdown(ctx context.Context) error {
+	defer s.queue.close()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-done
+		return fmt.Errorf("in-flight ingestion cancelled: %w", ctx.Err())
+	}
+}
+
+// GetJob returns the progress of an ingest job
+func (s *IngestService) GetJob(id string) (*domain.IngestJob, bool) {
+	return s.jobs.Get(id)
+}
+
+// SubscribeJob returns an ingest job's events so far and a channel of later ones
+func (s *IngestService) SubscribeJob(id string) ([]domain.JobEvent, <-chan domain.JobEvent, func(), bool) {
+	return s.jobs.Subscribe(id)
+}
+
+// GetStoragePath returns the storage path for a document, or "" if the
+// document's fields do not map to a path inside the storage root
 func (s *IngestService) GetStoragePath(doc *domain.Document) string {
-	ext := filepath.Ext(doc.Filename)
-	return filepath.Join(s.cfg.Storage.Documents, doc.CollectionID, doc.ID+ext)
+	path, err := safeStoragePath(s.cfg.Storage.Documents, doc.CollectionID, doc.ID+filepath.Ext(doc.Filename))
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// DocumentFile returns a document with the original content of its upload.
+// It fails with domain.ErrNotFound for an unknown document and with
+// domain.ErrSourceMissing when the upload is no longer in storage.
+func (s *IngestService) DocumentFile(ctx context.Context, id string) (*domain.Document, []byte, error) {
+	if s.orchestrator == nil {
+		return nil, nil, domain.ErrNotFound
+	}
+	doc, err := s.orchestrator.GetDocument(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if doc.FileType == domain.DocumentTypeFAQ {
+		return nil, nil, fmt.Errorf("%w: FAQ entries have no stored file", domain.ErrInvalidRequest)
+	}
+
+	storagePath := s.GetStoragePath(doc)
+	if storagePath == "" {
+		return nil, nil, domain.ErrSourceMissing
+	}
+	content, err := s.ReadStoredFile(storagePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, domain.ErrSourceMissing
+		}
+		return nil, nil, fmt.Errorf("failed to read stored file: %w", err)
+	}
+	return doc, content, nil
+}
+
+// DocumentStatus reports the ingestion progress of a document. The status
+// and error come from the metadata DB record when there is one, so uploads
+// that never reached rago can be polled too.
+func (s *IngestService) DocumentStatus(ctx context.Context, id string) (*domain.DocumentStatusResponse, error) {
+	record, err := s.documentRepo.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	doc := record
+	if s.orchestrator != nil {
+		ragoDoc, err := s.orchestrator.GetDocument(ctx, id)
+		switch {
+		case err == nil:
+			doc = ragoDoc
+			if record != nil {
+				doc.Status, doc.Error = record.Status, record.Error
+			}
+		case err != domain.ErrNotFound:
+			return nil, err
+		}
+	}
+	if doc == nil {
+		return nil, domain.ErrNotFound
+	}
+
+	status := &domain.DocumentStatusResponse{
+		DocumentID: doc.ID,
+		Status:     doc.Status,
+		ChunkCount: doc.ChunkCount,
+		Error:      doc.Error,
+		Attempts:   doc.Attempts,
+	}
+	switch doc.Status {
+	case domain.DocumentStatusPending:
+		status.Progress = 0
+	case domain.DocumentStatusProcessing:
+		status.Progress = 0.5
+	default:
+		status.Progress = 1
+	}
+	return status, nil
 }
 
 // GetDocument retrieves a document from rago storage
@@ -261,17 +1159,17 @@ func (s *IngestService) DeleteDocument(ctx context.Context, id string, collectio
 	}
 
 	// Delete from rago storage
-	if err := s.orchestrator.DeleteDocument(ctx, id); err != nil {
+	if err := s.orchestrator.ReleaseDocument(ctx, id); err != nil {
 		return err
 	}
 
 	// Delete from file system
-	storagePath := filepath.Join(s.cfg.Storage.Documents, collectionID, id)
-	// Try common extensions
-	for _, ext := range []string{".txt", ".pdf", ".md", ".html"} {
-		if err := os.Remove(storagePath + ext); err == nil {
-			break
-		}
+	if err := removeStoredDocument(s.cfg.Storage.Documents, collectionID, id); err != nil {
+		log.Printf("[Ingest] Removing stored file of %s failed: %v", id, err)
+	}
+
+	if err := s.collectionRepo.BumpVersion(collectionID); err != nil {
+		return err
 	}
 
 	// Update collection document count
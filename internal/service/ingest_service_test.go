@@ -0,0 +1,328 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime/multipart"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// multipartFiles builds the files[] parts of a multipart upload
+func multipartFiles(t *testing.T, files map[string][]byte, order []string) []*multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, name := range order {
+		part, err := w.CreateFormFile("files[]", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(files[name])
+	}
+	w.Close()
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["files[]"]
+}
+
+func TestUploadBatchStreamsProgress(t *testing.T) {
+	// An OCR engine that always fails makes the image fail ingestion
+	env := newTestEnv(t, "ocr:\n  enabled: true\n  command: \"false\"\n")
+	collection := env.createCollection(t, "docs")
+	order := []string{"install.md", "scan.png", "upgrade.md"}
+	files := multipartFiles(t, map[string][]byte{
+		"install.md": []byte("Install the agent with the package manager."),
+		"scan.png":   pngHeader,
+		"upgrade.md": []byte("Upgrade the agent by reinstalling it."),
+	}, order)
+
+	documents, err := env.ingest.UploadDocuments(context.Background(), collection.ID, files, nil, "", "")
+	if err != nil {
+		t.Fatalf("batch upload failed: %v", err)
+	}
+	jobID := documents[0].JobID
+	for _, doc := range documents {
+		if doc.JobID != jobID {
+			t.Fatalf("documents of the batch have jobs %s and %s, want one", jobID, doc.JobID)
+		}
+	}
+	// Events recorded before subscribing are replayed
+	history, live, cancel, ok := env.ingest.SubscribeJob(jobID)
+	if !ok {
+		t.Fatalf("job %s not found", jobID)
+	}
+	defer cancel()
+
+	events := history
+	timeout := time.After(30 * time.Second)
+	for done := false; !done; {
+		select {
+		case ev, open := <-live:
+			if !open {
+				done = true
+				break
+			}
+			events = append(events, ev)
+		case <-timeout:
+			t.Fatalf("job did not finish; events so far: %+v", events)
+		}
+	}
+
+	started := make(map[string]bool)
+	finished := make(map[string]string)
+	for i, ev := range events {
+		if ev.Seq != i+1 {
+			t.Fatalf("event %d has seq %d, want %d", i, ev.Seq, i+1)
+		}
+		if i > 0 && (ev.Completed < events[i-1].Completed || ev.Failed < events[i-1].Failed) {
+			t.Errorf("running totals went back at event %d: %+v after %+v", ev.Seq, ev, events[i-1])
+		}
+		switch ev.Type {
+		case domain.JobEventStarted:
+			started[ev.Filename] = true
+		case domain.JobEventCompleted, domain.JobEventFailed:
+			if !started[ev.Filename] {
+				t.Errorf("%s %s before it started", ev.Filename, ev.Type)
+			}
+			finished[ev.Filename] = ev.Type
+		}
+	}
+	want := map[string]string{"install.md": domain.JobEventCompleted, "scan.png": domain.JobEventFailed, "upgrade.md": domain.JobEventCompleted}
+	for name, outcome := range want {
+		if finished[name] != outcome {
+			t.Errorf("%s finished as %q, want %q", name, finished[name], outcome)
+		}
+	}
+
+	last := events[len(events)-1]
+	if last.Type != domain.JobEventDone || last.Total != 3 || last.Completed != 2 || last.Failed != 1 {
+		t.Errorf("last event = %+v, want done with 2 of 3 completed and 1 failed", last)
+	}
+	if job, _ := env.ingest.GetJob(jobID); job.Status != domain.JobStatusCompleted {
+		t.Errorf("job status = %s, want completed", job.Status)
+	}
+}
+
+func TestShutdownDrainsIngestion(t *testing.T) {
+	env := newTestEnv(t, "")
+	collection := env.createCollection(t, "docs")
+	env.embedder.delay = 200 * time.Millisecond
+	doc, err := env.ingest.UploadDocumentContent(context.Background(), collection.ID, "install.md", []byte("Install the agent."), nil, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := env.ingest.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	record, err := env.documentRepo.Get(doc.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != domain.DocumentStatusReady {
+		t.Errorf("document status after draining = %s, want ready", record.Status)
+	}
+}
+
+func TestShutdownCancelsIngestion(t *testing.T) {
+	env := newTestEnv(t, "ingest:\n  concurrency: 1\n")
+	collection := env.createCollection(t, "docs")
+	env.embedder.delay = time.Minute
+	var docs []*domain.Document
+	for _, name := range []string{"install.md", "upgrade.md"} {
+		doc, err := env.ingest.UploadDocumentContent(context.Background(), collection.ID, name, []byte("About "+name), nil, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := env.ingest.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown err = %v, want the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("shutdown took %s to cancel ingestion", elapsed)
+	}
+
+	// The document being ingested failed, the queued one is left for
+	// ResumeIngestion; both keep their files
+	for i, want := range []string{domain.DocumentStatusFailed, domain.DocumentStatusPending} {
+		record, err := env.documentRepo.Get(docs[i].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Status != want {
+			t.Errorf("%s status after cancelling = %s, want %s", docs[i].Filename, record.Status, want)
+		}
+		if path := env.ingest.GetStoragePath(docs[i]); path == "" {
+			t.Errorf("%s has no storage path", docs[i].Filename)
+		} else if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s file after cancelling: %v", docs[i].Filename, err)
+		}
+	}
+}
+
+func TestFAQRetrievesPairedAnswer(t *testing.T) {
+	env := newTestEnv(t, "")
+	collection := env.createCollection(t, "faq")
+	docs, err := env.ingest.IngestFAQ(context.Background(), collection.ID, []domain.FAQPair{
+		{Question: "How do I reset my password?", Answer: "Use the Forgot password link on the sign-in page."},
+		{Question: "Which regions are supported?", Answer: "Europe and North America."},
+	})
+	if err != nil {
+		t.Fatalf("FAQ ingestion failed: %v", err)
+	}
+	site := env.createSite(t, &domain.Site{Name: "support", CollectionIDs: []string{collection.ID}})
+
+	resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: "how can I reset my password?"})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if len(resp.Sources) == 0 || resp.Sources[0].DocumentID != docs[0].ID {
+		t.Fatalf("sources = %+v, want the password FAQ first", resp.Sources)
+	}
+	if got := resp.Sources[0].Content; got != "Use the Forgot password link on the sign-in page." {
+		t.Errorf("FAQ source content = %q, want the paired answer", got)
+	}
+	if prompt := env.generator.lastPrompt(); !strings.Contains(prompt, "(FAQ)\nQ: How do I reset my password?\nA: Use the Forgot password link on the sign-in page.") {
+		t.Errorf("answer prompt lacks the FAQ pair:\n%s", prompt)
+	}
+}
+
+func TestIngestRetriesTransientFailures(t *testing.T) {
+	env := newTestEnv(t, "ingest:\n  max_attempts: 3\n  retry_backoff: 10ms\n")
+	collection := env.createCollection(t, "docs")
+	env.embedder.errs = []error{
+		errors.New("dial tcp 127.0.0.1:11434: connection refused"),
+		errors.New("503 service unavailable"),
+	}
+
+	doc := env.upload(t, collection.ID, "install.md", []byte("Install the agent with the package manager."), nil)
+	if doc.Status != domain.DocumentStatusReady {
+		t.Fatalf("document status = %s (%s), want ready", doc.Status, doc.Error)
+	}
+	if doc.Attempts != 3 {
+		t.Errorf("attempts = %d, want 3", doc.Attempts)
+	}
+	sources, err := env.orchestrator.Search(context.Background(), "install agent", 5, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 || sources[0].DocumentID != doc.ID {
+		t.Errorf("search found %+v, want the retried document", sources)
+	}
+}
+
+func TestUploadLargeFileStreamsToStorage(t *testing.T) {
+	// A multipart body on disk, parsed with a small memory limit as gin does
+	// with storage.max_multipart_memory, so the file part spills to a temp file
+	const size = 32 << 20
+	body, err := os.CreateTemp(t.TempDir(), "upload-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	w := multipart.NewWriter(body)
+	part, err := w.CreateFormFile("file", "large.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte(strings.Repeat("The agent reports metrics every minute. ", 25) + "\n")
+	content := sha256.New()
+	for written := 0; written < size; written += len(line) {
+		part.Write(line)
+		content.Write(line)
+	}
+	w.Close()
+	if _, err := body.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	form, err := multipart.NewReader(body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer form.RemoveAll()
+	file := form.File["file"][0]
+	if f, err := file.Open(); err != nil {
+		t.Fatal(err)
+	} else if _, onDisk := f.(*os.File); !onDisk {
+		t.Fatal("multipart file was kept in memory")
+	} else {
+		f.Close()
+	}
+
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	segments := file.Size/encryptedSegmentSize + 1
+	tests := []struct {
+		name       string
+		yaml       string
+		storedSize int64
+	}{
+		{"plaintext", "", file.Size},
+		{"encrypted", "storage:\n  encryption_key: " + key + "\n",
+			int64(len(encryptedFileMagic)) + file.Size + segments*(12+16)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, "ingest:\n  concurrency: 1\n"+tt.yaml)
+			collection := env.createCollection(t, "docs")
+			// Hold ingestion on another document so only the upload itself allocates
+			env.embedder.delay = time.Minute
+			if _, err := env.ingest.UploadDocumentContent(context.Background(), collection.ID, "install.md", []byte("Install the agent."), nil, "", ""); err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				env.ingest.Shutdown(ctx)
+			}()
+
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+			doc, err := env.ingest.UploadDocument(context.Background(), collection.ID, file, nil, "", "")
+			runtime.ReadMemStats(&after)
+			if err != nil {
+				t.Fatalf("upload: %v", err)
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/8 {
+				t.Errorf("uploading a %d-byte file allocated %d bytes, want it streamed into storage", file.Size, allocated)
+			}
+			path := env.ingest.GetStoragePath(doc)
+			if info, err := os.Stat(path); err != nil || info.Size() != tt.storedSize {
+				t.Errorf("stored file = %v, %v; want %d bytes", info, err, tt.storedSize)
+			}
+
+			plain, _, closeFile, err := env.ingest.openStoredFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeFile()
+			stored := sha256.New()
+			if _, err := io.Copy(stored, plain); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(stored.Sum(nil), content.Sum(nil)) {
+				t.Error("stored file does not read back as the upload")
+			}
+		})
+	}
+}
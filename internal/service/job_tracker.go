@@ -0,0 +1,180 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// finishedJobRetention is how long finished jobs stay queryable
+const finishedJobRetention = time.Hour
+
+// JobTracker keeps in-memory progress for ingest jobs and fans out progress
+// events to subscribers
+type JobTracker struct {
+	mu   sync.Mutex
+	jobs map[string]*trackedJob
+}
+
+type trackedJob struct {
+	job         domain.IngestJob
+	events      []domain.JobEvent
+	subscribers map[chan domain.JobEvent]struct{}
+}
+
+// NewJobTracker creates an empty job tracker
+func NewJobTracker() *JobTracker {
+	return &JobTracker{jobs: make(map[string]*trackedJob)}
+}
+
+// Create registers a new job for the given number of files
+func (t *JobTracker) Create(collectionID string, total int) *domain.IngestJob {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pruneLocked()
+
+	now := time.Now()
+	tj := &trackedJob{
+		job: domain.IngestJob{
+			ID:           uuid.New().String(),
+			CollectionID: collectionID,
+			Status:       domain.JobStatusRunning,
+			Total:        total,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		},
+		subscribers: make(map[chan domain.JobEvent]struct{}),
+	}
+	t.jobs[tj.job.ID] = tj
+
+	job := tj.job
+	return &job
+}
+
+// Get returns a snapshot of a job
+func (t *JobTracker) Get(id string) (*domain.IngestJob, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tj, ok := t.jobs[id]
+	if !ok {
+		return nil, false
+	}
+	job := tj.job
+	return &job, true
+}
+
+// FileStarted records that a file of the job began processing
+func (t *JobTracker) FileStarted(jobID, filename string) {
+	t.record(jobID, domain.JobEvent{Type: domain.JobEventStarted, Filename: filename})
+}
+
+// FileCompleted records that a file was ingested
+func (t *JobTracker) FileCompleted(jobID, filename, documentID string) {
+	t.record(jobID, domain.JobEvent{Type: domain.JobEventCompleted, Filename: filename, DocumentID: documentID})
+}
+
+// FileFailed records that a file could not be ingested
+func (t *JobTracker) FileFailed(jobID, filename string, err error) {
+	t.record(jobID, domain.JobEvent{Type: domain.JobEventFailed, Filename: filename, Error: err.Error()})
+}
+
+// Subscribe returns the events recorded so far and a channel for later ones.
+// The channel is closed after the job's done event or when cancel is called.
+func (t *JobTracker) Subscribe(jobID string) ([]domain.JobEvent, <-chan domain.JobEvent, func(), bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tj, ok := t.jobs[jobID]
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	history := append([]domain.JobEvent(nil), tj.events...)
+	ch := make(chan domain.JobEvent, 64)
+	if tj.job.Status != domain.JobStatusRunning {
+		close(ch)
+		return history, ch, func() {}, true
+	}
+
+	tj.subscribers[ch] = struct{}{}
+	cancel := func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if _, ok := tj.subscribers[ch]; ok {
+			delete(tj.subscribers, ch)
+			close(ch)
+		}
+	}
+	return history, ch, cancel, true
+}
+
+// record applies an event to its job, emitting the done event once every
+// file has finished
+func (t *JobTracker) record(jobID string, ev domain.JobEvent) {
+	if jobID == "" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tj, ok := t.jobs[jobID]
+	if !ok || tj.job.Status != domain.JobStatusRunning {
+		return
+	}
+
+	switch ev.Type {
+	case domain.JobEventCompleted:
+		tj.job.Completed++
+	case domain.JobEventFailed:
+		tj.job.Failed++
+	}
+	tj.emitLocked(ev)
+
+	if tj.job.Completed+tj.job.Failed >= tj.job.Total {
+		tj.job.Status = domain.JobStatusCompleted
+		if tj.job.Completed == 0 && tj.job.Failed > 0 {
+			tj.job.Status = domain.JobStatusFailed
+		}
+		tj.emitLocked(domain.JobEvent{Type: domain.JobEventDone})
+		for ch := range tj.subscribers {
+			close(ch)
+		}
+		tj.subscribers = make(map[chan domain.JobEvent]struct{})
+	}
+}
+
+func (tj *trackedJob) emitLocked(ev domain.JobEvent) {
+	now := time.Now()
+	tj.job.UpdatedAt = now
+
+	ev.Seq = len(tj.events) + 1
+	ev.JobID = tj.job.ID
+	ev.Total = tj.job.Total
+	ev.Completed = tj.job.Completed
+	ev.Failed = tj.job.Failed
+	ev.Time = now
+	tj.events = append(tj.events, ev)
+
+	for ch := range tj.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Slow subscriber; it can catch up from the job status
+		}
+	}
+}
+
+// pruneLocked drops finished jobs past their retention
+func (t *JobTracker) pruneLocked() {
+	cutoff := time.Now().Add(-finishedJobRetention)
+	for id, tj := range t.jobs {
+		if tj.job.Status != domain.JobStatusRunning && tj.job.UpdatedAt.Before(cutoff) {
+			delete(t.jobs, id)
+		}
+	}
+}
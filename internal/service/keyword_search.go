@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+	ragodomain "github.com/liliang-cn/rago/v2/pkg/domain"
+)
+
+// Keyword search limits
+const (
+	keywordMaxTerms   = 8
+	keywordMinTermLen = 3
+	keywordCandidates = 200
+)
+
+// fallbackMessage prefixes answers built from keyword matches while the LLM
+// backend is unavailable
+const fallbackMessage = "The assistant is temporarily unavailable. These passages from the documentation may help:"
+
+// fallbackResponse answers with the retrieved sources instead of a generated answer
+func fallbackResponse(chunks []ragodomain.Chunk, clean bool) *askdocdomain.ChatResponse {
+	if len(chunks) == 0 {
+		return &askdocdomain.ChatResponse{Answer: askdocdomain.ErrLLMUnavailable.Error(), Sources: []askdocdomain.Source{}}
+	}
+	_, sources := buildSources(chunks, clean)
+	return &askdocdomain.ChatResponse{Answer: fallbackMessage, Sources: sources}
+}
+
+// keywordSearch ranks chunks by how many of the query's words they contain.
+// It needs no embedding, so it still works while the LLM backend is down.
+// An empty collectionIDs searches every collection.
+func (s *OrchestratorService) keywordSearch(ctx context.Context, query string, topK int, filters map[string]string, collectionIDs []string) ([]ragodomain.Chunk, error) {
+	terms := keywordTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	sqlQuery, args := keywordQuery(terms, collectionIDs)
+	rows, err := s.sqvectCore.GetDB().QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("keyword search failed: %w", err)
+	}
+	defer rows.Close()
+
+	var chunks []ragodomain.Chunk
+	for rows.Next() {
+		var chunk ragodomain.Chunk
+		var docID, metadataJSON *string
+		var matched int
+		if err := rows.Scan(&chunk.ID, &docID, &chunk.Content, &metadataJSON, &matched); err != nil {
+			return nil, fmt.Errorf("keyword search failed: %w", err)
+		}
+		if docID != nil {
+			chunk.DocumentID = *docID
+		}
+		if metadataJSON != nil {
+			json.Unmarshal([]byte(*metadataJSON), &chunk.Metadata)
+		}
+		chunk.Score = float64(matched) / float64(len(terms))
+		chunks = append(chunks, chunk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("keyword search failed: %w", err)
+	}
+
+	// The query already dropped drafts, trashed documents and chunks outside
+	// collectionIDs; metadata filters and summaries are applied here
+	_, chunks = splitSummaries(scopeChunks(filterChunks(chunks, filters), collectionIDs))
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].Score > chunks[j].Score
+	})
+	if len(chunks) > topK {
+		chunks = chunks[:topK]
+	}
+	return chunks, nil
+}
+
+// keywordQuery builds the candidate query for keywordSearch: published,
+// untrashed chunks of collectionIDs (every collection when empty) matching
+// any term, best matches first, so the candidate limit keeps the best ones.
+// Each row carries the number of terms it matched.
+func keywordQuery(terms, collectionIDs []string) (string, []any) {
+	var args []any
+	matches := make([]string, len(terms))
+	for i, term := range terms {
+		matches[i] = `(content LIKE ? ESCAPE '\')`
+		args = append(args, "%"+escapeLike(term)+"%")
+	}
+	// The score repeats the patterns for the WHERE clause
+	args = append(args, args...)
+
+	scope, scopeArgs := chunkScopeWhere(collectionIDs)
+	where := append([]string{"(" + strings.Join(matches, " OR ") + ")"}, scope...)
+	args = append(append(args, scopeArgs...), keywordCandidates)
+
+	return `SELECT id, doc_id, content, metadata, ` + strings.Join(matches, " + ") + ` AS matched
+		FROM embeddings WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY matched DESC LIMIT ?`, args
+}
+
+// chunkScopeWhere returns the SQL conditions, and their args, selecting the
+// published, untrashed chunks of collectionIDs (every collection when empty)
+func chunkScopeWhere(collectionIDs []string) ([]string, []any) {
+	where := []string{
+		`COALESCE(json_extract(metadata, '$.` + askdocdomain.MetadataKeyVisibility + `'), '') != ?`,
+		`(json_extract(metadata, '$.` + askdocdomain.MetadataKeyDeletedAt + `') IS NULL OR COALESCE(json_extract(metadata, '$.` + askdocdomain.MetadataKeySharedCollections + `'), '') != '')`,
+	}
+	args := []any{askdocdomain.DocumentVisibilityDraft}
+
+	// Mirrors chunkInCollection: the owning collection unless trashed, or
+	// any collection the chunk is shared into
+	if len(collectionIDs) > 0 {
+		scopes := make([]string, len(collectionIDs))
+		for i, id := range collectionIDs {
+			scopes[i] = `(json_extract(metadata, '$.` + askdocdomain.MetadataKeyCollectionID + `') = ? AND json_extract(metadata, '$.` + askdocdomain.MetadataKeyDeletedAt + `') IS NULL)` +
+				` OR (',' || COALESCE(json_extract(metadata, '$.` + askdocdomain.MetadataKeySharedCollections + `'), '') || ',') LIKE ? ESCAPE '\'`
+			args = append(args, id, "%,"+escapeLike(id)+",%")
+		}
+		where = append(where, "("+strings.Join(scopes, " OR ")+")")
+	}
+	return where, args
+}
+
+// keywordTerms splits a query into distinct lower-case words worth matching
+func keywordTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < keywordMinTermLen || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == keywordMaxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// escapeLike escapes LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestKeywordQuery(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "vectors.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE embeddings (id TEXT PRIMARY KEY, doc_id TEXT, content TEXT, metadata TEXT)`); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	for _, row := range []struct{ id, content, metadata string }{
+		{"both", "Reset your password from the login page", `{"collection_id":"docs"}`},
+		{"one", "Your password must be long", `{"collection_id":"docs"}`},
+		{"none", "Billing happens monthly", `{"collection_id":"docs"}`},
+		{"draft", "Reset the password", `{"collection_id":"docs","visibility":"draft"}`},
+		{"trashed", "Reset the password", `{"collection_id":"docs","deleted_at":"2026-01-01T00:00:00Z"}`},
+		{"other", "Reset the password", `{"collection_id":"blog"}`},
+		{"shared", "Reset the password", `{"collection_id":"blog","shared_collections":"faq,docs"}`},
+	} {
+		if _, err := db.Exec(`INSERT INTO embeddings (id, doc_id, content, metadata) VALUES (?, ?, ?, ?)`, row.id, row.id, row.content, row.metadata); err != nil {
+			t.Fatalf("failed to insert %s: %v", row.id, err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		collectionIDs []string
+		want          []string
+	}{
+		{"scoped", []string{"docs"}, []string{"both", "shared", "one"}},
+		{"every collection", nil, []string{"both", "other", "shared", "one"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := keywordQuery([]string{"reset", "password"}, tt.collectionIDs)
+			rows, err := db.Query(query, args...)
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			defer rows.Close()
+
+			var got []string
+			last := 2 // both terms
+			for rows.Next() {
+				var id, content, metadata string
+				var docID *string
+				var matched int
+				if err := rows.Scan(&id, &docID, &content, &metadata, &matched); err != nil {
+					t.Fatalf("scan failed: %v", err)
+				}
+				// Best matches come first, so the candidate limit keeps them
+				if matched > last {
+					t.Errorf("%s matched %d terms after a row matching %d", id, matched, last)
+				}
+				last = matched
+				got = append(got, id)
+			}
+
+			slices.Sort(got)
+			slices.Sort(tt.want)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,12 +2,21 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/liliang-cn/askdoc/internal/config"
 	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+	"github.com/liliang-cn/askdoc/internal/metrics"
 	sqvectcore "github.com/liliang-cn/sqvect/v2/pkg/core"
 	ragoconfig "github.com/liliang-cn/rago/v2/pkg/config"
 	ragodomain "github.com/liliang-cn/rago/v2/pkg/domain"
@@ -31,49 +40,43 @@ type OrchestratorService struct {
 	processor     ragodomain.Processor
 	documentStore *ragstore.DocumentStore
 	sqliteStore   *ragstore.SQLiteStore
-	sqvectCore    *sqvectcore.SQLiteStore // For chat session/message storage
+	sqvectCore    *sqvectcore.SQLiteStore // Direct access to the underlying sqvect store
 
 	// Agent service
 	agentService *agent.Service
 
 	// Progress callback for streaming
 	progressCallback func(eventType, message string)
+
+	// Generators for models selected per request, created on first use
+	providerFactory *providers.Factory
+	providerCfg     *ragodomain.OpenAIProviderConfig
+	modelsMu        sync.Mutex
+	models          map[string]ragodomain.Generator
+
+	// breaker fast-fails LLM calls while the backend is down
+	breaker *CircuitBreaker
+
+	// prompts are the answer prompt templates (rag.prompt_template)
+	prompts *answerPrompts
+
+	// reranker reorders retrieved chunks (nil unless rag.rerank.enabled)
+	reranker *reranker
 }
 
 // NewOrchestratorService creates a new orchestrator service with full rago agent integration
 func NewOrchestratorService(cfg *config.Config) (*OrchestratorService, error) {
-	// Create rago config
-	ragoCfg := &ragoconfig.Config{
-		Sqvect: ragoconfig.SqvectConfig{
-			DBPath:    cfg.RAG.DBPath,
-			IndexType: cfg.RAG.IndexType,
-		},
-		Chunker: ragoconfig.ChunkerConfig{
-			ChunkSize: cfg.RAG.ChunkSize,
-			Overlap:   cfg.RAG.ChunkOverlap,
-		},
-		Ingest: ragoconfig.IngestConfig{
-			MetadataExtraction: ragoconfig.MetadataExtractionConfig{
-				Enable: false,
-			},
-		},
-	}
-
 	// Create provider factory
 	factory := providers.NewFactory()
 
-	// Create OpenAI-compatible provider config
-	providerCfg := &ragodomain.OpenAIProviderConfig{
-		BaseURL:        cfg.LLM.BaseURL,
-		APIKey:         cfg.LLM.APIKey,
-		EmbeddingModel: cfg.LLM.EmbeddingModel,
-		LLMModel:       cfg.LLM.LLMModel,
-	}
+	// Create provider configs; embedding and generation may use different endpoints
+	embedderCfg := providerConfig(cfg.LLM.Embedding, cfg.LLM)
+	providerCfg := providerConfig(cfg.LLM.Generation, cfg.LLM)
 
 	ctx := context.Background()
 
 	// Create embedder
-	embedder, err := factory.CreateEmbedderProvider(ctx, providerCfg)
+	embedder, err := factory.CreateEmbedderProvider(ctx, embedderCfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create embedder: %w", err)
 	}
@@ -84,6 +87,45 @@ func NewOrchestratorService(cfg *config.Config) (*OrchestratorService, error) {
 		return nil, fmt.Errorf("failed to create LLM provider: %w", err)
 	}
 
+	s, err := newOrchestratorService(cfg, embedder, llmProvider)
+	if err != nil {
+		return nil, err
+	}
+	s.providerFactory = factory
+	s.providerCfg = providerCfg
+	return s, nil
+}
+
+// newOrchestratorService builds the stores, processor and agent around an
+// embedder and generator, normalizing embeddings when configured. Generators
+// for per-request models need the provider factory, which the caller sets.
+func newOrchestratorService(cfg *config.Config, embedder ragodomain.EmbedderProvider, llmProvider ragodomain.Generator) (*OrchestratorService, error) {
+	if cfg.RAG.NormalizeEmbeddings {
+		embedder = &normalizingEmbedder{embedder}
+	}
+
+	prompts, err := newAnswerPrompts(cfg.RAG.PromptTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create rago config
+	ragoCfg := &ragoconfig.Config{
+		Sqvect: ragoconfig.SqvectConfig{
+			DBPath:    cfg.RAG.DBPath,
+			IndexType: cfg.RAG.IndexType,
+		},
+		Chunker: ragoconfig.ChunkerConfig{
+			ChunkSize: cfg.RAG.ChunkSize,
+			Overlap:   cfg.RAG.ChunkOverlap,
+		},
+		Ingest: ragoconfig.IngestConfig{
+			MetadataExtraction: ragoconfig.MetadataExtractionConfig{
+				Enable: false,
+			},
+		},
+	}
+
 	// Create RAG client
 	ragClient, err := rag.NewClient(ragoCfg, embedder, llmProvider, nil)
 	if err != nil {
@@ -124,16 +166,25 @@ func NewOrchestratorService(cfg *config.Config) (*OrchestratorService, error) {
 		return nil, fmt.Errorf("failed to create agent service: %w", err)
 	}
 
+	breaker := NewCircuitBreaker(cfg.LLM.BreakerThreshold, cfg.LLM.BreakerCooldown, func(ctx context.Context) error {
+		_, err := llmProvider.Generate(ctx, "ping", &ragodomain.GenerationOptions{MaxTokens: 1})
+		return err
+	})
+
 	return &OrchestratorService{
-		cfg:            cfg,
-		ragClient:      ragClient,
-		embedder:       embedder,
-		generator:      llmProvider,
-		processor:      proc,
-		documentStore:  documentStore,
-		sqliteStore:    sqliteStore,
-		sqvectCore:     sqliteStore.GetSqvectStore(),
-		agentService:   agentService,
+		cfg:           cfg,
+		ragClient:     ragClient,
+		embedder:      embedder,
+		generator:     llmProvider,
+		processor:     proc,
+		documentStore: documentStore,
+		sqliteStore:   sqliteStore,
+		sqvectCore:    sqliteStore.GetSqvectStore(),
+		models:        make(map[string]ragodomain.Generator),
+		agentService:  agentService,
+		breaker:       breaker,
+		prompts:       prompts,
+		reranker:      newReranker(cfg),
 	}, nil
 }
 
@@ -142,259 +193,781 @@ func (s *OrchestratorService) SetProgressCallback(cb func(eventType, message str
 	s.progressCallback = cb
 }
 
-// IngestFile ingests a file into the vector store
-func (s *OrchestratorService) IngestFile(ctx context.Context, filePath string, metadata map[string]any) (*ragodomain.IngestResponse, error) {
+// IngestFile ingests a file into the vector store, split into chunks of
+// chunkSize characters overlapping by overlap
+func (s *OrchestratorService) IngestFile(ctx context.Context, filePath string, chunkSize, overlap int, metadata map[string]any) (*ragodomain.IngestResponse, error) {
 	opts := &rag.IngestOptions{
-		ChunkSize: s.cfg.RAG.ChunkSize,
-		Overlap:   s.cfg.RAG.ChunkOverlap,
+		ChunkSize: chunkSize,
+		Overlap:   overlap,
 		Metadata:  metadata,
 	}
 	return s.ragClient.IngestFile(ctx, filePath, opts)
 }
 
-// IngestText ingests text content into the vector store
-func (s *OrchestratorService) IngestText(ctx context.Context, text, source string, metadata map[string]any) (*ragodomain.IngestResponse, error) {
+// IngestText ingests text content into the vector store, chunked as by
+// IngestFile
+func (s *OrchestratorService) IngestText(ctx context.Context, text, source string, chunkSize, overlap int, metadata map[string]any) (*ragodomain.IngestResponse, error) {
 	opts := &rag.IngestOptions{
-		ChunkSize: s.cfg.RAG.ChunkSize,
-		Overlap:   s.cfg.RAG.ChunkOverlap,
+		ChunkSize: chunkSize,
+		Overlap:   overlap,
 		Metadata:  metadata,
 	}
 	return s.ragClient.IngestText(ctx, text, source, opts)
 }
 
+// IngestFAQ stores a question/answer pair as a single chunk. Only the question
+// is embedded; the answer travels in the chunk metadata.
+func (s *OrchestratorService) IngestFAQ(ctx context.Context, question, answer, source string, metadata map[string]any) (*ragodomain.IngestResponse, error) {
+	faqMeta := map[string]any{
+		askdocdomain.MetadataKeyType:        askdocdomain.DocumentTypeFAQ,
+		askdocdomain.MetadataKeyFAQQuestion: question,
+		askdocdomain.MetadataKeyFAQAnswer:   answer,
+		"source":                            source,
+	}
+	opts := &rag.IngestOptions{
+		ChunkSize: len(question) + 1, // never split the question
+		Overlap:   0,
+		Metadata:  metadata,
+	}
+	return s.ragClient.IngestTextWithMetadata(ctx, question, source, faqMeta, opts)
+}
+
+// ChatQuery carries the inputs for a single chat turn
+type ChatQuery struct {
+	Message       string
+	Normalized    string // Message after rag.normalize_questions, used for retrieval and cache keys
+	CollectionIDs []string
+	Summary       string                  // running summary of turns older than History
+	History       []*askdocdomain.Message // prior turns, oldest first, excluding Message
+	CleanSources  bool                    // return plain-text source content
+	Model         string                  // generation model, empty for llm.llm_model
+	Filters       map[string]string       // chunk metadata that retrieved chunks must match
+	Synonyms      map[string][]string     // term aliases of the site's collections
+	EmbedSynonyms bool                    // also expand the embedded query with Synonyms
+	Mode          string                  // domain.ChatModeFast or domain.ChatModeAgent
+	TopK          int                     // chunks to retrieve, 0 for rag.top_k
+	SearchMode    string                  // domain.SearchModeVector or SearchModeHybrid, empty for rag.search_mode
+	NoAnswer      string                  // reply when retrieval finds nothing, empty for domain.DefaultFallbackMessage
+	MinScore      *float64                // chunk score floor, nil for rag.min_score
+	Language      string                  // language code to answer in, empty to leave it to the model
+}
+
+// topK is the number of chunks retrieved for q
+func (s *OrchestratorService) topK(q *ChatQuery) int {
+	if q != nil && q.TopK > 0 {
+		return q.TopK
+	}
+	if s.cfg.RAG.TopK > 0 {
+		return s.cfg.RAG.TopK
+	}
+	return 5
+}
+
+// noAnswer is the reply to q when retrieval finds nothing to answer from
+func (q *ChatQuery) noAnswer() string {
+	if q.NoAnswer != "" {
+		return q.NoAnswer
+	}
+	return askdocdomain.DefaultFallbackMessage
+}
+
+// minScore is the score below which retrieved chunks are dropped for q
+func (s *OrchestratorService) minScore(q *ChatQuery) float64 {
+	if q != nil && q.MinScore != nil {
+		return *q.MinScore
+	}
+	return s.cfg.RAG.MinScore
+}
+
+// searchText is the question text used for retrieval and cache keys
+func (q *ChatQuery) searchText() string {
+	if q.Normalized != "" {
+		return q.Normalized
+	}
+	return q.Message
+}
+
+// trailingPunctuation is stripped from the end of normalized questions
+const trailingPunctuation = "?!.,;:。？！，；："
+
+// normalizeQuestion trims q, collapses runs of whitespace, strips trailing
+// punctuation and optionally lowercases it. A question that is nothing but
+// punctuation is returned with only its whitespace normalized.
+func normalizeQuestion(q string, lowercase bool) string {
+	q = strings.Join(strings.Fields(q), " ")
+	if stripped := strings.TrimRight(strings.TrimRight(q, trailingPunctuation), " "); stripped != "" {
+		q = stripped
+	}
+	if lowercase {
+		q = strings.ToLower(q)
+	}
+	return q
+}
+
 // Chat uses simple RAG search + LLM generation (faster than Agent)
-func (s *OrchestratorService) Chat(ctx context.Context, message string, collectionIDs []string) (*askdocdomain.ChatResponse, error) {
+func (s *OrchestratorService) Chat(ctx context.Context, q *ChatQuery) (*askdocdomain.ChatResponse, error) {
+	defer metrics.ChatDuration.ObserveSince(time.Now(), "chat")
+
 	// 1. Generate embedding
-	vec, err := s.embedder.Embed(ctx, message)
+	retrievalStart := time.Now()
+	vec, err := s.embedQuery(ctx, s.retrievalQuery(ctx, q))
 	if err != nil {
-		return nil, fmt.Errorf("embedding failed: %w", err)
+		if s.degraded(err) {
+			return s.keywordFallback(ctx, q)
+		}
+		return nil, err
 	}
 
 	// 2. Search vector store directly
-	chunks, err := s.sqliteStore.Search(ctx, vec, 5)
+	chunks, err := s.retrieveChunks(ctx, vec, withSynonyms(q.Message, q.Synonyms), s.topK(q), q.SearchMode, s.minScore(q), q.Filters, q.CollectionIDs)
 	if err != nil {
-		return nil, fmt.Errorf("search failed: %w", err)
-	}
-
-	// 3. Build context from sources
-	context := ""
-	sources := make([]askdocdomain.Source, len(chunks))
-	for i, chunk := range chunks {
-		context += fmt.Sprintf("[Document %d]\n%s\n\n", i+1, chunk.Content)
-		sources[i] = askdocdomain.Source{
-			DocumentID: chunk.DocumentID,
-			Content:    chunk.Content,
-			Score:      chunk.Score,
-		}
+		return nil, err
 	}
 
-	// 4. Generate answer using LLM
-	prompt := fmt.Sprintf(`Based on the following context, answer the question. If the context doesn't contain relevant information, say so.
+	diagnostics := &askdocdomain.RetrievalDiagnostics{RetrievalMs: time.Since(retrievalStart).Milliseconds()}
 
-Context:
-%s
+	if !s.enoughSources(chunks) {
+		return &askdocdomain.ChatResponse{Answer: q.noAnswer(), Sources: []askdocdomain.Source{}, Diagnostics: diagnostics}, nil
+	}
 
-Question: %s
+	// 3. Build context from sources
+	docContext, sources := buildSources(chunks, q.CleanSources)
 
-Answer:`, context, message)
+	// 4. Generate answer using LLM
+	prompt, err := renderPrompt(s.prompts.answer, buildHistoryContext(q.Summary, q.History), docContext, q.Message, q.Language)
+	if err != nil {
+		return nil, err
+	}
 
-	answer, err := s.generator.Generate(ctx, prompt, nil)
+	generationStart := time.Now()
+	answer, err := s.generate(ctx, q.Model, prompt)
+	diagnostics.GenerationMs = time.Since(generationStart).Milliseconds()
 	if err != nil {
-		return nil, fmt.Errorf("generation failed: %w", err)
+		if s.degraded(err) {
+			resp := fallbackResponse(chunks, q.CleanSources)
+			resp.Diagnostics = diagnostics
+			return resp, nil
+		}
+		return nil, err
 	}
 
 	return &askdocdomain.ChatResponse{
-		Answer:  answer,
-		Sources: sources,
+		Answer:      answer,
+		Sources:     sources,
+		Diagnostics: diagnostics,
 	}, nil
 }
 
 // ChatStream performs streaming chat with simple RAG and chat history
-func (s *OrchestratorService) ChatStream(ctx context.Context, message string, collectionIDs []string, sessionID string) (<-chan askdocdomain.StreamChunk, error) {
-	ch := make(chan askdocdomain.StreamChunk, 100)
+func (s *OrchestratorService) ChatStream(ctx context.Context, q *ChatQuery) (<-chan askdocdomain.StreamChunk, error) {
+	stream := newChunkStream(ctx, 100)
 
 	go func() {
-		defer close(ch)
+		defer stream.close()
+		defer metrics.ChatDuration.ObserveSince(time.Now(), "stream")
 
-		// Create or get session
-		var sess *sqvectcore.Session
-		var err error
-
-		if sessionID == "" {
-			// Create new session
-			sess = &sqvectcore.Session{
-				ID:     uuid.New().String(),
-				UserID: "default",
-			}
-			if err := s.sqvectCore.CreateSession(ctx, sess); err != nil {
-				ch <- askdocdomain.StreamChunk{Type: "error", Content: fmt.Sprintf("Failed to create session: %v", err)}
-				return
-			}
-			sessionID = sess.ID
-		} else {
-			sess, err = s.sqvectCore.GetSession(ctx, sessionID)
-			if err != nil {
-				// Session not found, create new one
-				sess = &sqvectcore.Session{
-					ID:     sessionID,
-					UserID: "default",
-				}
-				if err := s.sqvectCore.CreateSession(ctx, sess); err != nil {
-					ch <- askdocdomain.StreamChunk{Type: "error", Content: fmt.Sprintf("Failed to create session: %v", err)}
+		// 1. Generate embedding
+		if !stream.send(askdocdomain.StreamChunk{Type: "thinking", Content: "Searching..."}) {
+			return
+		}
+		vec, err := s.embedQuery(ctx, s.retrievalQuery(ctx, q))
+		if err != nil {
+			if s.degraded(err) {
+				resp, err := s.keywordFallback(ctx, q)
+				if err == nil {
+					streamResponse(stream, resp)
 					return
 				}
 			}
+			stream.sendError(err)
+			return
 		}
 
-		// Send session_id to client
-		ch <- askdocdomain.StreamChunk{Type: "session", SessionID: sessionID}
-
-		// Save user message
-		userMsg := &sqvectcore.Message{
-			ID:        uuid.New().String(),
-			SessionID: sessionID,
-			Role:      "user",
-			Content:   message,
-		}
-		if err := s.sqvectCore.AddMessage(ctx, userMsg); err != nil {
-			ch <- askdocdomain.StreamChunk{Type: "error", Content: fmt.Sprintf("Failed to save message: %v", err)}
+		// 2. Search vector store directly
+		chunks, err := s.retrieveChunks(ctx, vec, withSynonyms(q.Message, q.Synonyms), s.topK(q), q.SearchMode, s.minScore(q), q.Filters, q.CollectionIDs)
+		if err != nil {
+			stream.sendError(err)
 			return
 		}
 
-		// 1. Generate embedding
-		ch <- askdocdomain.StreamChunk{Type: "thinking", Content: "Searching..."}
-		vec, err := s.embedder.Embed(ctx, message)
-		if err != nil {
-			ch <- askdocdomain.StreamChunk{Type: "error", Content: err.Error()}
+		if !s.enoughSources(chunks) {
+			stream.send(askdocdomain.StreamChunk{Type: "content", Content: q.noAnswer()})
+			stream.send(askdocdomain.StreamChunk{Type: "done"})
 			return
 		}
 
-		// 2. Search vector store directly
-		chunks, err := s.sqliteStore.Search(ctx, vec, 5)
+		// 3. Build context and collect sources
+		docContext, sources := buildSources(chunks, q.CleanSources)
+
+		// 4. Stream generate answer
+		if !stream.send(askdocdomain.StreamChunk{Type: "thinking", Content: "Generating..."}) {
+			return
+		}
+		prompt, err := renderPrompt(s.prompts.stream, buildHistoryContext(q.Summary, q.History), docContext, q.Message, q.Language)
 		if err != nil {
-			ch <- askdocdomain.StreamChunk{Type: "error", Content: err.Error()}
+			stream.sendError(err)
 			return
 		}
 
-		if len(chunks) == 0 {
-			ch <- askdocdomain.StreamChunk{Type: "content", Content: "No relevant documents found."}
-			ch <- askdocdomain.StreamChunk{Type: "done"}
+		generator, err := s.generatorFor(ctx, q.Model)
+		if err != nil {
+			stream.sendError(err)
 			return
 		}
-
-		// 3. Build context and collect sources
-		docContext := ""
-		sources := make([]askdocdomain.Source, len(chunks))
-		for i, chunk := range chunks {
-			docContext += fmt.Sprintf("[Document %d]\n%s\n\n", i+1, chunk.Content)
-			filename := ""
-			if chunk.Metadata != nil {
-				if fn, ok := chunk.Metadata["filename"].(string); ok {
-					filename = fn
-				}
-			}
-			sources[i] = askdocdomain.Source{
-				DocumentID: chunk.DocumentID,
-				Content:    chunk.Content,
-				Score:      chunk.Score,
-				Filename:   filename,
+		if !s.breaker.Allow() {
+			if s.cfg.LLM.BreakerFallback {
+				streamResponse(stream, fallbackResponse(chunks, q.CleanSources))
+				return
 			}
+			stream.sendError(askdocdomain.ErrLLMUnavailable)
+			return
+		}
+		genCtx, cancel := withStageTimeout(ctx, s.cfg.RAG.GenerationTimeout)
+		defer cancel()
+		llmStart := time.Now()
+		err = streamGenerate(genCtx, generator, prompt, stream)
+		metrics.LLMDuration.ObserveSince(llmStart, "stream", metrics.Outcome(err))
+		if ctx.Err() != nil {
+			// The client went away or the stream timed out; close reports it
+			return
+		}
+		s.breaker.Record(ctx, breakerGenerate, err)
+		if err = stageError(ctx, genCtx, err, askdocdomain.ErrGenerationTimeout, "generation failed"); err != nil {
+			stream.sendError(err)
+			return
 		}
 
-		// 4. Get chat history
-		history, err := s.sqvectCore.GetSessionHistory(ctx, sessionID, 10)
-		if err != nil {
-			// Non-fatal, continue without history
-			history = nil
-		}
-
-		// Build history context (excluding the current message we just added)
-		historyContext := ""
-		if len(history) > 1 {
-			var historyParts []string
-			for i := 0; i < len(history)-1; i++ {
-				msg := history[i]
-				role := "User"
-				if msg.Role == "assistant" {
-					role = "Assistant"
-				}
-				historyParts = append(historyParts, fmt.Sprintf("%s: %s", role, msg.Content))
-			}
-			if len(historyParts) > 0 {
-				historyContext = fmt.Sprintf("Previous conversation:\n%s\n\n", strings.Join(historyParts, "\n"))
-			}
+		// 5. Send sources
+		if !stream.send(askdocdomain.StreamChunk{Type: "sources", Sources: sources}) {
+			return
 		}
 
-		// 5. Stream generate answer
-		ch <- askdocdomain.StreamChunk{Type: "thinking", Content: "Generating..."}
-		prompt := fmt.Sprintf(`%sBased on the following context, answer the question concisely. If the question relates to previous conversation, use that context as well.
+		stream.send(askdocdomain.StreamChunk{Type: "done"})
+	}()
+
+	return stream.ch, nil
+}
+
+// streamGenerate streams an answer into stream, returning when generation
+// ends or ctx is done, even if the generator doesn't return
+func streamGenerate(ctx context.Context, generator ragodomain.Generator, prompt string, stream *chunkStream) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- generator.Stream(ctx, prompt, nil, func(chunk string) {
+			stream.send(askdocdomain.StreamChunk{Type: "content", Content: chunk})
+		})
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rewriteHistoryTurns is how many recent messages inform a query rewrite
+const rewriteHistoryTurns = 4
+
+// retrievalQuery returns the text to embed for q: the standalone query,
+// expanded with collection synonyms when EmbedSynonyms is set
+func (s *OrchestratorService) retrievalQuery(ctx context.Context, q *ChatQuery) string {
+	query := s.standaloneQuery(ctx, q)
+	if q.EmbedSynonyms {
+		query = withSynonyms(query, q.Synonyms)
+	}
+	return query
+}
+
+// standaloneQuery returns q's question. With rag.query_rewrite on, a
+// follow-up is rewritten into a standalone query using recent history; the
+// original message is still what the answer prompt uses. Rewrite failures
+// fall back to the original message.
+func (s *OrchestratorService) standaloneQuery(ctx context.Context, q *ChatQuery) string {
+	if !s.cfg.RAG.QueryRewrite || len(q.History) == 0 {
+		return q.searchText()
+	}
+
+	history := q.History
+	if len(history) > rewriteHistoryTurns {
+		history = history[len(history)-rewriteHistoryTurns:]
+	}
+	var transcript strings.Builder
+	for _, msg := range history {
+		fmt.Fprintf(&transcript, "%s: %s\n", roleLabel(msg.Role), msg.Content)
+	}
 
-Context:
+	prompt := fmt.Sprintf(`Rewrite the follow-up question as a standalone search query that can be understood without the conversation. Resolve pronouns and references using the conversation. If it is already standalone, return it unchanged. Reply with the query only.
+
+Conversation:
 %s
+Follow-up question: %s
 
-Question: %s
+Standalone query:`, transcript.String(), q.Message)
 
-Answer:`, historyContext, docContext, message)
+	rewritten, err := s.generate(ctx, "", prompt)
+	if err != nil {
+		log.Printf("[Chat] Query rewrite failed, using original question: %v", err)
+		return q.searchText()
+	}
+	rewritten = strings.Trim(strings.TrimSpace(rewritten), `"`)
+	if rewritten == "" {
+		return q.searchText()
+	}
+	log.Printf("[Chat] Rewrote query %q -> %q", q.Message, rewritten)
+	return rewritten
+}
 
-		// Use streaming generation
-		var fullAnswer strings.Builder
-		err = s.generator.Stream(ctx, prompt, nil, func(chunk string) {
-			fullAnswer.WriteString(chunk)
-			ch <- askdocdomain.StreamChunk{Type: "content", Content: chunk}
-		})
+// SummarizeConversation folds messages into an existing running summary
+func (s *OrchestratorService) SummarizeConversation(ctx context.Context, previousSummary string, messages []*askdocdomain.Message) (string, error) {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		fmt.Fprintf(&transcript, "%s: %s\n", roleLabel(msg.Role), msg.Content)
+	}
+
+	existing := previousSummary
+	if existing == "" {
+		existing = "(none)"
+	}
+
+	prompt := fmt.Sprintf(`Condense the conversation below into a short summary that preserves the user's goals, facts established so far, and any open questions. Extend the existing summary rather than repeating it.
+
+Existing summary:
+%s
+
+New conversation turns:
+%s
+Updated summary:`, existing, transcript.String())
+
+	summary, err := s.generate(ctx, "", prompt)
+	if err != nil {
+		return "", fmt.Errorf("summarization failed: %w", err)
+	}
+	return strings.TrimSpace(summary), nil
+}
+
+// embedQuery embeds a chat message within rag.embed_timeout
+func (s *OrchestratorService) embedQuery(ctx context.Context, text string) ([]float64, error) {
+	if !s.breaker.Allow() {
+		return nil, askdocdomain.ErrLLMUnavailable
+	}
+
+	stageCtx, cancel := withStageTimeout(ctx, s.cfg.RAG.EmbedTimeout)
+	defer cancel()
+
+	start := time.Now()
+	vec, err := s.embedder.Embed(stageCtx, text)
+	metrics.LLMDuration.ObserveSince(start, "embed", metrics.Outcome(err))
+	s.breaker.Record(ctx, breakerEmbed, err)
+	return vec, stageError(ctx, stageCtx, err, askdocdomain.ErrEmbeddingTimeout, "embedding failed")
+}
+
+// scopedCandidateFactor further widens the candidate set when a search is
+// limited to some collections, since the store ranks across all of them
+const scopedCandidateFactor = 4
+
+// searchChunks queries the vector store within rag.search_timeout. The store
+// ranks by cosine similarity; draft documents, metadata filters, collection
+// scoping and other metrics are applied to a wider candidate set. When a
+// scoped search finds fewer than topK chunks among the store's candidates,
+// e.g. for a collection that is small next to the others, the chunks of its
+// collections are ranked directly instead. An empty collectionIDs searches
+// every collection.
+func (s *OrchestratorService) searchChunks(ctx context.Context, vec []float64, topK int, filters map[string]string, collectionIDs []string) ([]ragodomain.Chunk, error) {
+	stageCtx, cancel := withStageTimeout(ctx, s.cfg.RAG.SearchTimeout)
+	defer cancel()
+
+	metric := s.cfg.RAG.DistanceMetric
+	cosine := metric == "" || metric == config.DistanceCosine
+	candidates := topK * metricCandidateFactor
+	scope := collectionIDs
+	if id := filters[askdocdomain.MetadataKeyCollectionID]; len(scope) == 0 && id != "" {
+		scope = []string{id}
+	}
+	if len(scope) > 0 {
+		candidates *= scopedCandidateFactor
+	}
+	chunks, err := s.sqliteStore.Search(stageCtx, vec, candidates)
+	if err = stageError(ctx, stageCtx, err, askdocdomain.ErrSearchTimeout, "search failed"); err != nil {
+		return nil, err
+	}
+	summaries, chunks := splitSummaries(scopeChunks(filterChunks(chunks, filters), collectionIDs))
+	if len(scope) > 0 && len(chunks) < topK {
+		scoped, err := s.scopedVectorSearch(stageCtx, vec, candidates, scope)
+		if err = stageError(ctx, stageCtx, err, askdocdomain.ErrSearchTimeout, "search failed"); err != nil {
+			return nil, err
+		}
+		summaries, chunks = splitSummaries(scopeChunks(filterChunks(scoped, filters), collectionIDs))
+	}
+	if !s.cfg.RAG.DocumentSummaries || len(summaries) == 0 {
+		if cosine {
+			if len(chunks) > topK {
+				chunks = chunks[:topK]
+			}
+			return chunks, nil
+		}
+		return rankChunks(metric, vec, chunks, topK), nil
+	}
+
+	if !cosine {
+		summaries = rankChunks(metric, vec, summaries, len(summaries))
+		chunks = rankChunks(metric, vec, chunks, len(chunks))
+	}
+	chunks = s.expandSummaries(stageCtx, metric, vec, summaries, chunks)
+	if len(chunks) > topK {
+		chunks = chunks[:topK]
+	}
+	return chunks, nil
+}
+
+// scopedVectorSearch ranks the published, untrashed chunks of collectionIDs
+// by cosine similarity to vec and returns the best limit of them. It selects
+// the chunks in SQL, like keyword search, and scores each one, so a
+// collection is searched in full however many chunks other collections hold.
+func (s *OrchestratorService) scopedVectorSearch(ctx context.Context, vec []float64, limit int, collectionIDs []string) ([]ragodomain.Chunk, error) {
+	where, args := chunkScopeWhere(collectionIDs)
+	rows, err := s.sqvectCore.GetDB().QueryContext(ctx, `SELECT id, doc_id, content, vector, metadata FROM embeddings
+		WHERE COALESCE(json_extract(metadata, '$._type'), '') = 'chunk' AND `+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []ragodomain.Chunk
+	for rows.Next() {
+		var chunk ragodomain.Chunk
+		var docID, metadataJSON *string
+		var blob []byte
+		if err := rows.Scan(&chunk.ID, &docID, &chunk.Content, &blob, &metadataJSON); err != nil {
+			return nil, err
+		}
+		vector, err := decodeVector(blob)
 		if err != nil {
-			ch <- askdocdomain.StreamChunk{Type: "error", Content: err.Error()}
-			return
+			log.Printf("[Search] Skipping chunk %s: %v", chunk.ID, err)
+			continue
+		}
+		chunk.Vector = make([]float64, len(vector))
+		for i, v := range vector {
+			chunk.Vector[i] = float64(v)
+		}
+		if docID != nil {
+			chunk.DocumentID = *docID
+		}
+		if metadataJSON != nil {
+			json.Unmarshal([]byte(*metadataJSON), &chunk.Metadata)
+		}
+		chunk.Score = vectorSimilarity(config.DistanceCosine, vec, chunk.Vector)
+		chunks = append(chunks, chunk)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].Score > chunks[j].Score
+	})
+	if len(chunks) > limit {
+		chunks = chunks[:limit]
+	}
+	return chunks, nil
+}
+
+// filterChunks keeps the published chunks whose metadata matches every
+// filter, dropping those of documents in the trash
+func filterChunks(chunks []ragodomain.Chunk, filters map[string]string) []ragodomain.Chunk {
+	kept := chunks[:0]
+	for _, chunk := range chunks {
+		if fmt.Sprint(chunk.Metadata[askdocdomain.MetadataKeyVisibility]) == askdocdomain.DocumentVisibilityDraft || chunkTrashed(chunk.Metadata) {
+			continue
+		}
+		if chunkMatches(chunk, filters) {
+			kept = append(kept, chunk)
+		}
+	}
+	return kept
+}
+
+// scopeChunks keeps the chunks belonging to any of collectionIDs; an empty
+// list keeps everything
+func scopeChunks(chunks []ragodomain.Chunk, collectionIDs []string) []ragodomain.Chunk {
+	if len(collectionIDs) == 0 {
+		return chunks
+	}
+	kept := chunks[:0]
+	for _, chunk := range chunks {
+		for _, id := range collectionIDs {
+			if chunkInCollection(chunk.Metadata, id) {
+				kept = append(kept, chunk)
+				break
+			}
 		}
+	}
+	return kept
+}
 
-		// Save assistant message
-		assistantMsg := &sqvectcore.Message{
-			ID:        uuid.New().String(),
-			SessionID: sessionID,
-			Role:      "assistant",
-			Content:   fullAnswer.String(),
+func chunkMatches(chunk ragodomain.Chunk, filters map[string]string) bool {
+	for key, want := range filters {
+		if key == askdocdomain.MetadataKeyCollectionID {
+			if !chunkInCollection(chunk.Metadata, want) {
+				return false
+			}
+			continue
+		}
+		if key == askdocdomain.MetadataKeyTags {
+			if !askdocdomain.HasTag(chunk.Metadata, want) {
+				return false
+			}
+			continue
 		}
-		if err := s.sqvectCore.AddMessage(ctx, assistantMsg); err != nil {
-			// Non-fatal, log but continue
+		value, ok := chunk.Metadata[key]
+		if !ok || fmt.Sprint(value) != want {
+			return false
 		}
+	}
+	return true
+}
+
+// generate runs a non-streaming completion within rag.generation_timeout.
+// An empty model uses llm.llm_model.
+func (s *OrchestratorService) generate(ctx context.Context, model, prompt string) (string, error) {
+	generator, err := s.generatorFor(ctx, model)
+	if err != nil {
+		return "", err
+	}
+	if !s.breaker.Allow() {
+		return "", askdocdomain.ErrLLMUnavailable
+	}
 
-		// 6. Send sources
-		ch <- askdocdomain.StreamChunk{Type: "sources", Sources: sources}
+	stageCtx, cancel := withStageTimeout(ctx, s.cfg.RAG.GenerationTimeout)
+	defer cancel()
 
-		ch <- askdocdomain.StreamChunk{Type: "done"}
-	}()
+	start := time.Now()
+	answer, err := generator.Generate(stageCtx, prompt, nil)
+	metrics.LLMDuration.ObserveSince(start, "generate", metrics.Outcome(err))
+	s.breaker.Record(ctx, breakerGenerate, err)
+	return answer, stageError(ctx, stageCtx, err, askdocdomain.ErrGenerationTimeout, "generation failed")
+}
 
-	return ch, nil
+// providerConfig builds the rago provider config for an endpoint. Every
+// supported provider serves an OpenAI-compatible API (Anthropic and Gemini
+// through their compatibility endpoints), so all of them use rago's OpenAI
+// provider at the provider's base URL.
+func providerConfig(p config.ProviderConfig, llm config.LLMConfig) *ragodomain.OpenAIProviderConfig {
+	return &ragodomain.OpenAIProviderConfig{
+		BaseURL:        p.BaseURL,
+		APIKey:         p.APIKey,
+		EmbeddingModel: llm.Embedding.Model,
+		LLMModel:       llm.Generation.Model,
+	}
 }
 
-// Search performs a pure vector search without LLM generation
-func (s *OrchestratorService) Search(ctx context.Context, query string, topK int) ([]askdocdomain.Source, error) {
-	opts := &rag.QueryOptions{
-		TopK:        topK,
-		Temperature: 0,
-		MaxTokens:   0,
-		ShowSources: true,
+// generatorFor returns the generator for a model. Callers are responsible for
+// checking the model is allowed; this only rejects models missing from config.
+func (s *OrchestratorService) generatorFor(ctx context.Context, model string) (ragodomain.Generator, error) {
+	if model == "" || model == s.cfg.LLM.LLMModel {
+		return s.generator, nil
+	}
+	if !s.cfg.LLM.HasModel(model) {
+		return nil, fmt.Errorf("%w: model %q is not configured", askdocdomain.ErrInvalidRequest, model)
 	}
 
-	resp, err := s.ragClient.Query(ctx, query, opts)
+	s.modelsMu.Lock()
+	defer s.modelsMu.Unlock()
+
+	if gen, ok := s.models[model]; ok {
+		return gen, nil
+	}
+	cfg := *s.providerCfg
+	cfg.LLMModel = model
+	gen, err := s.providerFactory.CreateLLMProvider(ctx, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create LLM provider for %s: %w", model, err)
+	}
+	s.models[model] = gen
+	return gen, nil
+}
+
+// enoughSources reports whether retrieved chunks span at least
+// rag.min_sources distinct documents
+func (s *OrchestratorService) enoughSources(chunks []ragodomain.Chunk) bool {
+	docs := make(map[string]struct{})
+	for _, chunk := range chunks {
+		docs[chunk.DocumentID] = struct{}{}
+	}
+	return len(chunks) > 0 && len(docs) >= s.cfg.RAG.MinSources
+}
+
+// aboveScore returns the chunks scoring at least minScore
+func aboveScore(chunks []ragodomain.Chunk, minScore float64) []ragodomain.Chunk {
+	kept := chunks[:0:0]
+	for _, chunk := range chunks {
+		if chunk.Score >= minScore {
+			kept = append(kept, chunk)
+		}
+	}
+	return kept
+}
+
+// degraded reports whether err means the LLM backend is unavailable and
+// llm.breaker_fallback allows answering from keyword search instead
+func (s *OrchestratorService) degraded(err error) bool {
+	return s.cfg.LLM.BreakerFallback && errors.Is(err, askdocdomain.ErrLLMUnavailable)
+}
+
+// keywordFallback answers q from keyword matches without the LLM backend
+func (s *OrchestratorService) keywordFallback(ctx context.Context, q *ChatQuery) (*askdocdomain.ChatResponse, error) {
+	chunks, err := s.keywordSearch(ctx, withSynonyms(q.Message, q.Synonyms), s.topK(q), q.Filters, q.CollectionIDs)
 	if err != nil {
 		return nil, err
 	}
+	return fallbackResponse(chunks, q.CleanSources), nil
+}
 
-	sources := make([]askdocdomain.Source, len(resp.Sources))
-	for i, src := range resp.Sources {
-		sources[i] = askdocdomain.Source{
-			DocumentID: src.DocumentID,
-			Content:    src.Content,
-			Score:      src.Score,
+// streamResponse sends a complete response as stream chunks
+func streamResponse(stream *chunkStream, resp *askdocdomain.ChatResponse) {
+	if !stream.send(askdocdomain.StreamChunk{Type: "content", Content: resp.Answer}) {
+		return
+	}
+	if len(resp.Sources) > 0 && !stream.send(askdocdomain.StreamChunk{Type: "sources", Sources: resp.Sources}) {
+		return
+	}
+	stream.send(askdocdomain.StreamChunk{Type: "done"})
+}
+
+// BreakerStatus reports the LLM circuit breaker state
+func (s *OrchestratorService) BreakerStatus() BreakerStatus {
+	return s.breaker.Status()
+}
+
+// PingStore runs a trivial query against the vector store
+func (s *OrchestratorService) PingStore(ctx context.Context) error {
+	var one int
+	return s.sqvectCore.GetDB().QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+// PingLLM checks that the embedding endpoint answers, outside the circuit breaker
+func (s *OrchestratorService) PingLLM(ctx context.Context) error {
+	_, err := s.embedder.Embed(ctx, "ping")
+	return err
+}
+
+// withStageTimeout derives a context for one chat stage; d <= 0 means no stage limit
+func withStageTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// stageError reports a stage's own deadline as timeoutErr so operators can see
+// which stage was slow; other failures, including the outer chat timeout, are
+// wrapped with msg
+func stageError(parent, stageCtx context.Context, err, timeoutErr error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	if parent.Err() == nil && errors.Is(stageCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", timeoutErr, err)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// buildSources formats retrieved chunks into prompt context and citation sources.
+// When clean is set, source content is converted to plain text per file type.
+func buildSources(chunks []ragodomain.Chunk, clean bool) (string, []askdocdomain.Source) {
+	var docContext strings.Builder
+	sources := make([]askdocdomain.Source, len(chunks))
+	for i, chunk := range chunks {
+		if answer, ok := faqAnswer(chunk); ok {
+			// The stored answer is authoritative for a matched FAQ question
+			label := "FAQ"
+			if fmt.Sprint(chunk.Metadata[askdocdomain.MetadataKeyVerified]) == "true" {
+				label = "Verified FAQ"
+			}
+			fmt.Fprintf(&docContext, "[Document %d] (%s)\nQ: %s\nA: %s\n\n", i+1, label, chunk.Content, answer)
+			filename, _ := chunk.Metadata[askdocdomain.MetadataKeyFilename].(string)
+			sources[i] = askdocdomain.Source{
+				DocumentID: chunk.DocumentID,
+				Content:    answer,
+				Score:      chunk.Score,
+				Filename:   filename,
+				Label:      citationLabel(chunk.Metadata, filename),
+			}
+			continue
 		}
-		if src.Metadata != nil {
-			if filename, ok := src.Metadata["filename"].(string); ok {
-				sources[i].Filename = filename
+
+		fmt.Fprintf(&docContext, "[Document %d]\n%s\n\n", i+1, chunk.Content)
+		filename, fileType := "", ""
+		if chunk.Metadata != nil {
+			if fn, ok := chunk.Metadata["filename"].(string); ok {
+				filename = fn
+			}
+			if ft, ok := chunk.Metadata[askdocdomain.MetadataKeyFileType].(string); ok {
+				fileType = ft
 			}
 		}
+		sources[i] = askdocdomain.Source{
+			DocumentID: chunk.DocumentID,
+			Content:    chunk.Content,
+			Score:      chunk.Score,
+			Filename:   filename,
+			Label:      citationLabel(chunk.Metadata, filename),
+			Language:   detectSourceLanguage(filename, fileType, chunk.Content),
+			Page:       chunkPage(chunk.Metadata),
+		}
+		sources[i].Section, _ = chunk.Metadata[askdocdomain.MetadataKeySection].(string)
+		if clean {
+			sources[i].RawContent = chunk.Content
+			sources[i].Content = cleanSourceText(fileType, chunk.Content)
+		}
+	}
+	return docContext.String(), sources
+}
+
+// faqAnswer returns the paired answer when chunk is an FAQ question
+func faqAnswer(chunk ragodomain.Chunk) (string, bool) {
+	if chunk.Metadata == nil || chunk.Metadata[askdocdomain.MetadataKeyType] != askdocdomain.DocumentTypeFAQ {
+		return "", false
+	}
+	answer, ok := chunk.Metadata[askdocdomain.MetadataKeyFAQAnswer].(string)
+	return answer, ok && answer != ""
+}
+
+// buildHistoryContext renders the conversation summary and prior turns for the prompt
+func buildHistoryContext(summary string, history []*askdocdomain.Message) string {
+	var b strings.Builder
+	if summary != "" {
+		fmt.Fprintf(&b, "Summary of earlier conversation:\n%s\n\n", summary)
+	}
+	if len(history) > 0 {
+		var parts []string
+		for _, msg := range history {
+			parts = append(parts, fmt.Sprintf("%s: %s", roleLabel(msg.Role), msg.Content))
+		}
+		fmt.Fprintf(&b, "Previous conversation:\n%s\n\n", strings.Join(parts, "\n"))
+	}
+	return b.String()
+}
+
+func roleLabel(role string) string {
+	if role == "assistant" {
+		return "Assistant"
 	}
+	return "User"
+}
 
+// Search retrieves sources without LLM generation, with mode (or
+// rag.search_mode when empty). Only chunks whose metadata matches every
+// filter and that score at least rag.min_score are returned.
+func (s *OrchestratorService) Search(ctx context.Context, query string, topK int, mode string, filters map[string]string) ([]askdocdomain.Source, error) {
+	vec, err := s.embedQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := s.retrieveChunks(ctx, vec, query, topK, mode, s.cfg.RAG.MinScore, filters, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, sources := buildSources(chunks, false)
 	return sources, nil
 }
 
@@ -403,27 +976,63 @@ func (s *OrchestratorService) Search(ctx context.Context, query string, topK int
 // GetDocument retrieves a document by ID from rago storage
 func (s *OrchestratorService) GetDocument(ctx context.Context, id string) (*askdocdomain.Document, error) {
 	doc, err := s.documentStore.Get(ctx, id)
+	if errors.Is(err, ragodomain.ErrDocumentNotFound) {
+		return nil, askdocdomain.ErrNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get document: %w", err)
 	}
 	return ragoDocToAskDoc(doc), nil
 }
 
-// ListDocuments lists all documents from rago storage
+// CreateDocumentRecord stores a document without chunks, so an upload can be
+// tracked by its own ID while it is pending or after it failed
+func (s *OrchestratorService) CreateDocumentRecord(ctx context.Context, id, filename string, metadata map[string]any) error {
+	return s.documentStore.Store(ctx, ragodomain.Document{
+		ID:       id,
+		Path:     filename,
+		Metadata: metadata,
+		Created:  time.Now(),
+	})
+}
+
+// AdoptDocument moves the chunks and metadata of a document that rago just
+// ingested (under an ID it generated) onto the record created for the
+// upload, then removes rago's document, so the upload keeps its ID
+func (s *OrchestratorService) AdoptDocument(ctx context.Context, id, ingestedID string) error {
+	ingested, err := s.documentStore.Get(ctx, ingestedID)
+	if err != nil {
+		return fmt.Errorf("failed to get ingested document: %w", err)
+	}
+	if err := s.UpdateDocumentMetadata(ctx, id, ingested.Metadata); err != nil {
+		return err
+	}
+
+	if _, err := s.sqvectCore.GetDB().ExecContext(ctx, `UPDATE embeddings SET doc_id = ? WHERE doc_id = ?`, id, ingestedID); err != nil {
+		return fmt.Errorf("failed to move chunks: %w", err)
+	}
+	return s.documentStore.Delete(ctx, ingestedID)
+}
+
+// ListDocuments lists all documents from rago storage except those in the
+// trash
 func (s *OrchestratorService) ListDocuments(ctx context.Context) ([]*askdocdomain.Document, error) {
 	docs, err := s.documentStore.List(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list documents: %w", err)
 	}
 
-	result := make([]*askdocdomain.Document, len(docs))
-	for i, doc := range docs {
-		result[i] = ragoDocToAskDoc(doc)
+	result := make([]*askdocdomain.Document, 0, len(docs))
+	for _, doc := range docs {
+		if deletedAt(doc.Metadata) == nil {
+			result = append(result, ragoDocToAskDoc(doc))
+		}
 	}
 	return result, nil
 }
 
-// ListDocumentsByCollection lists documents filtered by collection ID
+// ListDocumentsByCollection lists documents filtered by collection ID,
+// leaving out those in the trash
 func (s *OrchestratorService) ListDocumentsByCollection(ctx context.Context, collectionID string) ([]*askdocdomain.Document, error) {
 	docs, err := s.documentStore.List(ctx)
 	if err != nil {
@@ -432,7 +1041,7 @@ func (s *OrchestratorService) ListDocumentsByCollection(ctx context.Context, col
 
 	var result []*askdocdomain.Document
 	for _, doc := range docs {
-		if cid, ok := doc.Metadata[askdocdomain.MetadataKeyCollectionID].(string); ok && cid == collectionID {
+		if cid, ok := doc.Metadata[askdocdomain.MetadataKeyCollectionID].(string); ok && cid == collectionID && deletedAt(doc.Metadata) == nil {
 			result = append(result, ragoDocToAskDoc(doc))
 		}
 	}
@@ -444,6 +1053,14 @@ func (s *OrchestratorService) DeleteDocument(ctx context.Context, id string) err
 	return s.documentStore.Delete(ctx, id)
 }
 
+// DeleteDocumentChunks removes a document's chunks but keeps its record
+func (s *OrchestratorService) DeleteDocumentChunks(ctx context.Context, id string) error {
+	if _, err := s.sqvectCore.GetDB().ExecContext(ctx, `DELETE FROM embeddings WHERE doc_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete chunks: %w", err)
+	}
+	return nil
+}
+
 // UpdateDocumentMetadata updates document metadata in rago storage
 func (s *OrchestratorService) UpdateDocumentMetadata(ctx context.Context, id string, metadata map[string]any) error {
 	doc, err := s.documentStore.Get(ctx, id)
@@ -462,6 +1079,169 @@ func (s *OrchestratorService) UpdateDocumentMetadata(ctx context.Context, id str
 	return s.documentStore.Update(ctx, doc)
 }
 
+// MoveDocument reassigns a document and all of its chunks to another
+// collection. A shared copy has no chunks of its own, so its new collection
+// is recorded on the owner's chunks instead.
+func (s *OrchestratorService) MoveDocument(ctx context.Context, id, collectionID string) error {
+	doc, err := s.GetDocument(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.UpdateDocumentMetadata(ctx, id, map[string]any{
+		askdocdomain.MetadataKeyCollectionID: collectionID,
+	}); err != nil {
+		return err
+	}
+	if doc.SharedFrom != "" {
+		return s.syncSharedCollections(ctx, doc.SharedFrom)
+	}
+
+	// Chunks carry a copy of the document metadata for search-time filtering
+	_, err = s.sqvectCore.GetDB().ExecContext(ctx, `
+		UPDATE embeddings SET metadata = json_set(COALESCE(metadata, '{}'), '$.collection_id', ?)
+		WHERE doc_id = ?
+	`, collectionID, id)
+	if err != nil {
+		return fmt.Errorf("failed to update chunk metadata: %w", err)
+	}
+	return nil
+}
+
+// SetDocumentVisibility marks a document and its chunks draft or published
+func (s *OrchestratorService) SetDocumentVisibility(ctx context.Context, id, visibility string) error {
+	if err := s.UpdateDocumentMetadata(ctx, id, map[string]any{
+		askdocdomain.MetadataKeyVisibility: visibility,
+	}); err != nil {
+		return err
+	}
+
+	_, err := s.sqvectCore.GetDB().ExecContext(ctx, `
+		UPDATE embeddings SET metadata = json_set(COALESCE(metadata, '{}'), '$.visibility', ?)
+		WHERE doc_id = ?
+	`, visibility, id)
+	if err != nil {
+		return fmt.Errorf("failed to update chunk metadata: %w", err)
+	}
+	return nil
+}
+
+// SetDocumentTags replaces the tags of a document and its chunks; tags are
+// already normalized, and an empty list clears them
+func (s *OrchestratorService) SetDocumentTags(ctx context.Context, id string, tags []string) error {
+	joined := strings.Join(tags, ",")
+	if err := s.UpdateDocumentMetadata(ctx, id, map[string]any{
+		askdocdomain.MetadataKeyTags: joined,
+	}); err != nil {
+		return err
+	}
+
+	_, err := s.sqvectCore.GetDB().ExecContext(ctx, `
+		UPDATE embeddings SET metadata = json_set(COALESCE(metadata, '{}'), '$.tags', ?)
+		WHERE doc_id = ?
+	`, joined, id)
+	if err != nil {
+		return fmt.Errorf("failed to update chunk metadata: %w", err)
+	}
+	return nil
+}
+
+// exportBatchSize is the number of embeddings read per query during an export
+const exportBatchSize = 500
+
+// ExportEmbeddings walks the vector store in insertion order, calling fn for
+// every chunk after the given sequence number. An empty collectionID exports
+// all collections and limit <= 0 exports everything.
+func (s *OrchestratorService) ExportEmbeddings(ctx context.Context, collectionID string, after int64, limit int, fn func(*askdocdomain.EmbeddingRecord) error) error {
+	db := s.sqvectCore.GetDB()
+	sent := 0
+	for {
+		batch := exportBatchSize
+		if limit > 0 && limit-sent < batch {
+			batch = limit - sent
+		}
+		if batch <= 0 {
+			return nil
+		}
+
+		query := `SELECT rowid, id, doc_id, vector, metadata FROM embeddings WHERE rowid > ?`
+		args := []any{after}
+		if collectionID != "" {
+			query += ` AND json_extract(metadata, '$.collection_id') = ?`
+			args = append(args, collectionID)
+		}
+		query += ` ORDER BY rowid LIMIT ?`
+		args = append(args, batch)
+
+		records, err := s.readEmbeddingBatch(ctx, db, query, args)
+		if err != nil {
+			return err
+		}
+		for _, rec := range records {
+			if err := fn(rec); err != nil {
+				return err
+			}
+			after = rec.Seq
+		}
+
+		sent += len(records)
+		if len(records) < batch {
+			return nil
+		}
+	}
+}
+
+func (s *OrchestratorService) readEmbeddingBatch(ctx context.Context, db *sql.DB, query string, args []any) ([]*askdocdomain.EmbeddingRecord, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*askdocdomain.EmbeddingRecord
+	for rows.Next() {
+		rec := &askdocdomain.EmbeddingRecord{}
+		var docID, metadataJSON sql.NullString
+		var blob []byte
+		if err := rows.Scan(&rec.Seq, &rec.ChunkID, &docID, &blob, &metadataJSON); err != nil {
+			return nil, fmt.Errorf("failed to scan embedding: %w", err)
+		}
+		vec, err := decodeVector(blob)
+		if err != nil {
+			return nil, fmt.Errorf("embedding %s: %w", rec.ChunkID, err)
+		}
+		rec.DocumentID = docID.String
+		rec.Vector = vec
+
+		var metadata map[string]any
+		if metadataJSON.Valid {
+			json.Unmarshal([]byte(metadataJSON.String), &metadata)
+		}
+		rec.CollectionID, _ = metadata[askdocdomain.MetadataKeyCollectionID].(string)
+		rec.Filename, _ = metadata[askdocdomain.MetadataKeyFilename].(string)
+		rec.FileType, _ = metadata[askdocdomain.MetadataKeyFileType].(string)
+
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+// decodeVector reads sqvect's vector encoding: an int32 length followed by
+// little-endian float32 values
+func decodeVector(data []byte) ([]float32, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("invalid vector encoding")
+	}
+	n := int(int32(binary.LittleEndian.Uint32(data)))
+	if n < 0 || len(data)-4 < n*4 {
+		return nil, fmt.Errorf("invalid vector encoding")
+	}
+	vec := make([]float32, n)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4+i*4:]))
+	}
+	return vec, nil
+}
+
 // ragoDocToAskDoc converts rago Document to AskDoc Document
 func ragoDocToAskDoc(doc ragodomain.Document) *askdocdomain.Document {
 	result := &askdocdomain.Document{
@@ -488,6 +1268,10 @@ func ragoDocToAskDoc(doc ragodomain.Document) *askdocdomain.Document {
 		if v, ok := doc.Metadata[askdocdomain.MetadataKeyStatus].(string); ok {
 			result.Status = v
 		}
+		if v, ok := doc.Metadata[askdocdomain.MetadataKeyVisibility].(string); ok {
+			result.Visibility = v
+		}
+		result.Tags = askdocdomain.ParseTags(doc.Metadata)
 		if v, ok := doc.Metadata[askdocdomain.MetadataKeyChunkCount].(int); ok {
 			result.ChunkCount = v
 		} else if v, ok := doc.Metadata[askdocdomain.MetadataKeyChunkCount].(float64); ok {
@@ -496,11 +1280,24 @@ func ragoDocToAskDoc(doc ragodomain.Document) *askdocdomain.Document {
 		if v, ok := doc.Metadata[askdocdomain.MetadataKeyError].(string); ok {
 			result.Error = v
 		}
+		result.ContentHash, _ = doc.Metadata[askdocdomain.MetadataKeyContentHash].(string)
+		result.SharedFrom, _ = doc.Metadata[askdocdomain.MetadataKeySharedFrom].(string)
+		result.DeletedAt = deletedAt(doc.Metadata)
+		switch v := doc.Metadata[askdocdomain.MetadataKeyAttempts].(type) {
+		case int:
+			result.Attempts = v
+		case float64:
+			result.Attempts = int(v)
+		}
 	}
 
 	if result.Status == "" {
 		result.Status = askdocdomain.DocumentStatusReady
 	}
+	if result.Visibility == "" {
+		// Documents ingested before visibility existed are published
+		result.Visibility = askdocdomain.DocumentVisibilityPublished
+	}
 
 	return result
 }
@@ -527,6 +1324,7 @@ func (s *OrchestratorService) GetAgentService() *agent.Service {
 
 // Close closes the underlying stores
 func (s *OrchestratorService) Close() error {
+	s.breaker.Close()
 	if s.sqliteStore != nil {
 		return s.sqliteStore.Close()
 	}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/config"
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+func TestExportEmbeddings(t *testing.T) {
+	env := newTestEnv(t, "")
+	docs := env.createCollection(t, "docs")
+	other := env.createCollection(t, "other")
+	first := env.upload(t, docs.ID, "install.md", []byte("Install the agent with the package manager."), nil)
+	second := env.upload(t, docs.ID, "upgrade.md", []byte("Upgrade the agent by reinstalling it."), nil)
+	env.upload(t, other.ID, "billing.md", []byte("Invoices are sent monthly."), nil)
+
+	export := func(collectionID string, after int64, limit int) []*domain.EmbeddingRecord {
+		t.Helper()
+		var records []*domain.EmbeddingRecord
+		err := env.admin.ExportEmbeddings(context.Background(), collectionID, after, limit, func(rec *domain.EmbeddingRecord) error {
+			records = append(records, rec)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("export failed: %v", err)
+		}
+		return records
+	}
+
+	records := export(docs.ID, 0, 0)
+	if len(records) != 2 {
+		t.Fatalf("exported %d embeddings of the collection, want 2", len(records))
+	}
+	want := map[string]bool{first.ID: true, second.ID: true}
+	for _, rec := range records {
+		if len(rec.Vector) != fakeEmbedderDims {
+			t.Errorf("embedding %s has %d dimensions, want %d", rec.ChunkID, len(rec.Vector), fakeEmbedderDims)
+		}
+		if !want[rec.DocumentID] || rec.CollectionID != docs.ID {
+			t.Errorf("embedding %s of document %s in collection %s, want one of the collection's documents", rec.ChunkID, rec.DocumentID, rec.CollectionID)
+		}
+		delete(want, rec.DocumentID)
+	}
+
+	if all := export("", 0, 0); len(all) != 3 {
+		t.Errorf("exported %d embeddings in total, want 3", len(all))
+	}
+
+	// Resuming after the first page yields the rest
+	page := export(docs.ID, 0, 1)
+	if len(page) != 1 || page[0].ChunkID != records[0].ChunkID {
+		t.Fatalf("first page = %d embeddings, want the first", len(page))
+	}
+	rest := export(docs.ID, page[0].Seq, 0)
+	if len(rest) != 1 || rest[0].ChunkID != records[1].ChunkID {
+		t.Errorf("resumed export = %d embeddings, want the second", len(rest))
+	}
+}
+
+func TestChatStageTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		setup   func(env *testEnv)
+		want    error
+		notWant error
+	}{
+		{
+			name:   "embedding",
+			config: "rag:\n  embed_timeout: 50ms\n",
+			setup:  func(env *testEnv) { env.embedder.delay = time.Second },
+			want:   domain.ErrEmbeddingTimeout,
+		},
+		{
+			name:   "search",
+			config: "rag:\n  search_timeout: 1ns\n",
+			want:   domain.ErrSearchTimeout,
+		},
+		{
+			name:   "generation",
+			config: "rag:\n  generation_timeout: 50ms\n",
+			setup:  func(env *testEnv) { env.generator.delay = time.Second },
+			want:   domain.ErrGenerationTimeout,
+		},
+		{
+			// The outer bound is reported as such, not as the stage it cut short
+			name:    "chat",
+			config:  "rag:\n  chat_timeout: 100ms\n",
+			setup:   func(env *testEnv) { env.generator.delay = time.Second },
+			want:    domain.ErrChatTimeout,
+			notWant: domain.ErrGenerationTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, tt.config)
+			collection := env.createCollection(t, "docs")
+			env.upload(t, collection.ID, "widgets.md", []byte("The blue widget is configured in the settings panel."), nil)
+			site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+			if tt.setup != nil {
+				tt.setup(env)
+			}
+
+			_, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: "how is the blue widget configured?"})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Chat err = %v, want %v", err, tt.want)
+			}
+			if tt.notWant != nil && errors.Is(err, tt.notWant) {
+				t.Errorf("Chat err = %v, should not be %v", err, tt.notWant)
+			}
+		})
+	}
+}
+
+func TestChatMinSources(t *testing.T) {
+	tests := []struct {
+		minSources int
+		want       string
+		sources    int
+	}{
+		{1, "answer", 1},
+		{2, domain.DefaultFallbackMessage, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("min_sources=%d", tt.minSources), func(t *testing.T) {
+			env := newTestEnv(t, fmt.Sprintf("rag:\n  min_score: 0.5\n  min_sources: %d\n", tt.minSources))
+			collection := env.createCollection(t, "docs")
+			env.upload(t, collection.ID, "account.md", []byte("Reset your password from the account page."), nil)
+			env.upload(t, collection.ID, "billing.md", []byte("Invoices are emailed monthly."), nil)
+			site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+
+			// Only account.md clears the score threshold
+			resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: "reset your password from the account page"})
+			if err != nil {
+				t.Fatalf("Chat: %v", err)
+			}
+			if resp.Answer != tt.want || len(resp.Sources) != tt.sources {
+				t.Errorf("answer = %q with %d sources, want %q with %d", resp.Answer, len(resp.Sources), tt.want, tt.sources)
+			}
+		})
+	}
+}
+
+func TestChatRewritesFollowUps(t *testing.T) {
+	env := newTestEnv(t, "rag:\n  query_rewrite: true\n")
+	env.generator.reply = func(prompt string) (string, error) {
+		if strings.HasPrefix(prompt, "Rewrite the follow-up question") {
+			return "install the agent on Windows", nil
+		}
+		return "answer", nil
+	}
+	collection := env.createCollection(t, "docs")
+	windows := env.upload(t, collection.ID, "windows.md", []byte("Install the agent on Windows with the MSI installer."), nil)
+	env.upload(t, collection.ID, "linux.md", []byte("Install the agent on Linux with the apt package."), nil)
+	env.upload(t, collection.ID, "billing.md", []byte("Invoices are emailed monthly."), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+
+	first, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: "how do I install the agent on Linux?"})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	followUp := "and what about that other system?"
+	resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: followUp, SessionID: first.SessionID})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+
+	var rewrite string
+	for _, prompt := range env.generator.prompts {
+		if strings.HasPrefix(prompt, "Rewrite the follow-up question") {
+			rewrite = prompt
+		}
+	}
+	if !strings.Contains(rewrite, "User: how do I install the agent on Linux?") || !strings.Contains(rewrite, "Follow-up question: "+followUp) {
+		t.Errorf("rewrite prompt lacks the conversation or follow-up:\n%s", rewrite)
+	}
+	// Retrieval used the standalone query, the answer the original question
+	if len(resp.Sources) == 0 || resp.Sources[0].DocumentID != windows.ID {
+		t.Errorf("sources = %+v, want windows.md first", resp.Sources)
+	}
+	if prompt := env.generator.lastPrompt(); !strings.Contains(prompt, followUp) {
+		t.Errorf("answer prompt lacks the original question:\n%s", prompt)
+	}
+}
+
+func TestDistanceMetricRanking(t *testing.T) {
+	// "near" points the query's way but is short; "long" is ten times longer
+	// at 45 degrees, so it only wins on raw dot products
+	vector := func(x, y float64) []float64 {
+		vec := make([]float64, fakeEmbedderDims)
+		vec[0], vec[1] = x, y
+		return vec
+	}
+	vectors := map[string][]float64{
+		"query":     vector(1, 0),
+		"near text": vector(1, 0.1),
+		"long text": vector(10, 10),
+	}
+
+	tests := []struct {
+		metric    string
+		normalize bool
+		want      []string
+	}{
+		{config.DistanceDot, false, []string{"long.md", "near.md"}},
+		{config.DistanceDot, true, []string{"near.md", "long.md"}},
+		{config.DistanceCosine, false, []string{"near.md", "long.md"}},
+		{config.DistanceCosine, true, []string{"near.md", "long.md"}},
+		{config.DistanceEuclidean, false, []string{"near.md", "long.md"}},
+		{config.DistanceEuclidean, true, []string{"near.md", "long.md"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s normalize=%t", tt.metric, tt.normalize), func(t *testing.T) {
+			env := newTestEnv(t, fmt.Sprintf("rag:\n  distance_metric: %s\n  normalize_embeddings: %t\n", tt.metric, tt.normalize))
+			env.embedder.vectors = vectors
+			collection := env.createCollection(t, "docs")
+			env.upload(t, collection.ID, "near.md", []byte("near text"), nil)
+			env.upload(t, collection.ID, "long.md", []byte("long text"), nil)
+
+			sources, err := env.orchestrator.Search(context.Background(), "query", 2, domain.SearchModeVector, nil)
+			if err != nil {
+				t.Fatalf("search failed: %v", err)
+			}
+			var got []string
+			for _, source := range sources {
+				got = append(got, source.Filename)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ranking = %v, want %v", got, tt.want)
+			}
+			// Normalized, dot products are cosine similarities
+			if tt.normalize && tt.metric != config.DistanceEuclidean && len(sources) > 0 && math.Abs(sources[0].Score-0.995) > 0.01 {
+				t.Errorf("near score = %f, want the cosine similarity 0.995", sources[0].Score)
+			}
+		})
+	}
+}
+
+func TestChunkMetadataFilter(t *testing.T) {
+	env := newTestEnv(t, "rag:\n  chunk_size: 120\n  chunk_overlap: 0\n")
+	collection := env.createCollection(t, "docs")
+	guide := "## Pricing\n\nThe agent costs ten dollars per host each month. Annual plans get two months free.\n\n" +
+		"## Troubleshooting\n\nIf the agent costs too much memory, restart the agent host service. Check the logs for errors.\n"
+	env.upload(t, collection.ID, "guide.md", []byte(guide), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}, FilterableKeys: []string{domain.MetadataKeySection}})
+	question := "agent costs per host"
+
+	sections := func(sources []domain.Source) map[string]bool {
+		found := make(map[string]bool)
+		for _, source := range sources {
+			found[source.Section] = true
+		}
+		return found
+	}
+	all, err := env.orchestrator.Search(context.Background(), question, 5, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := sections(all); !found["Pricing"] || !found["Troubleshooting"] {
+		t.Fatalf("unfiltered search found sections %v, want both", found)
+	}
+
+	filters := map[string]string{domain.MetadataKeySection: "Troubleshooting"}
+	filtered, err := env.orchestrator.Search(context.Background(), question, 5, "", filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found := sections(filtered); len(filtered) == 0 || len(found) != 1 || !found["Troubleshooting"] {
+		t.Errorf("filtered search found sections %v, want only Troubleshooting", found)
+	}
+
+	// Widget chats may filter on the site's filterable keys only
+	resp, err := env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: question, Filters: filters})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if found := sections(resp.Sources); len(resp.Sources) == 0 || len(found) != 1 || !found["Troubleshooting"] {
+		t.Errorf("filtered chat cited sections %v, want only Troubleshooting", found)
+	}
+	_, err = env.chat.Chat(context.Background(), site.ID, &domain.ChatRequest{Message: question, Filters: map[string]string{"author": "me"}})
+	if !errors.Is(err, domain.ErrInvalidRequest) {
+		t.Errorf("chat filtering on a key the site doesn't allow: err = %v, want ErrInvalidRequest", err)
+	}
+}
+
+// A site's small collection is found even when every chunk of a larger
+// collection is closer to the question than its own
+func TestScopedSearchSmallCollection(t *testing.T) {
+	env := newTestEnv(t, "rag:\n  chunk_size: 40\n  chunk_overlap: 0\n")
+	ctx := context.Background()
+	large := env.createCollection(t, "large")
+	small := env.createCollection(t, "small")
+	var notes strings.Builder
+	for i := range 120 {
+		fmt.Fprintf(&notes, "Agent metrics interval note %d.\n\n", i)
+	}
+	env.upload(t, large.ID, "metrics.md", []byte(notes.String()), nil)
+	retention := env.upload(t, small.ID, "retention.md", []byte("Metrics retention is thirty days."), nil)
+
+	// More chunks than the store's candidates for a scoped top 5
+	var stored int
+	if err := env.orchestrator.sqvectCore.GetDB().QueryRowContext(ctx, "SELECT COUNT(*) FROM embeddings").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if candidates := 5 * metricCandidateFactor * scopedCandidateFactor; stored <= candidates {
+		t.Fatalf("stored %d chunks, want more than %d candidates", stored, candidates)
+	}
+
+	const question = "agent metrics interval"
+	sources, err := env.orchestrator.Search(ctx, question, 5, domain.SearchModeVector, map[string]string{domain.MetadataKeyCollectionID: small.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || sources[0].DocumentID != retention.ID {
+		t.Errorf("collection-filtered sources = %+v, want the retention document", sources)
+	}
+
+	site := env.createSite(t, &domain.Site{Name: "small", CollectionIDs: []string{small.ID}})
+	resp, err := env.chat.Chat(ctx, site.ID, &domain.ChatRequest{Message: question, SearchMode: domain.SearchModeVector})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if len(resp.Sources) != 1 || resp.Sources[0].DocumentID != retention.ID {
+		t.Errorf("site sources = %+v, want the retention document", resp.Sources)
+	}
+}
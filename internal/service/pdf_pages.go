@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dslipak/pdf"
+	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// extractPDFPages returns the plain text of each page of a PDF
+func extractPDFPages(path string) (pages []string, err error) {
+	// The parser panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to parse PDF: %v", r)
+		}
+	}()
+
+	r, err := pdf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %w", err)
+	}
+	pages = make([]string, r.NumPage())
+	for i := range pages {
+		page := r.Page(i + 1)
+		if page.V.IsNull() {
+			continue
+		}
+		text, err := page.GetPlainText(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read page %d: %w", i+1, err)
+		}
+		pages[i] = text
+	}
+	return pages, nil
+}
+
+// AnnotatePages records in each chunk of a PDF document the page it starts
+// on, used for citations. Whitespace is collapsed on both sides before
+// matching since the page text and the chunks may break lines differently.
+func (s *OrchestratorService) AnnotatePages(ctx context.Context, docID string, pages []string) error {
+	var source strings.Builder
+	starts := make([]int, len(pages))
+	for i, page := range pages {
+		starts[i] = source.Len()
+		source.WriteString(strings.Join(strings.Fields(page), " "))
+		source.WriteString(" ")
+	}
+	text := source.String()
+
+	embeddings, err := s.sqvectCore.GetByDocID(ctx, docID)
+	if err != nil {
+		return fmt.Errorf("failed to load document chunks: %w", err)
+	}
+
+	db := s.sqvectCore.GetDB()
+	from := 0
+	for _, emb := range embeddings {
+		if !isContentChunk(emb.Metadata) {
+			continue
+		}
+		offset := locateChunk(text, strings.Join(strings.Fields(emb.Content), " "), from)
+		if offset < 0 {
+			continue
+		}
+		from = offset
+		page := sort.Search(len(starts), func(i int) bool { return starts[i] > offset })
+		if _, err := db.ExecContext(ctx, `
+			UPDATE embeddings SET metadata = json_set(COALESCE(metadata, '{}'), '$.page', ?)
+			WHERE id = ?
+		`, page, emb.ID); err != nil {
+			return fmt.Errorf("failed to update chunk metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+// annotatePages reads the pages of a stored PDF upload (at its plaintext
+// path) into its chunks' metadata
+func (s *IngestService) annotatePages(ctx context.Context, document *askdocdomain.Document, path string) error {
+	pages, err := extractPDFPages(path)
+	if err != nil {
+		return err
+	}
+	return s.orchestrator.AnnotatePages(ctx, document.ID, pages)
+}
+
+// chunkPage returns the page recorded in a chunk's metadata, or 0
+func chunkPage(metadata map[string]any) int {
+	switch v := metadata[askdocdomain.MetadataKeyPage].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
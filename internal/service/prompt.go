@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Default answer prompts, used when rag.prompt_template is empty. The
+// streaming prompt asks for a more concise answer.
+const (
+	defaultAnswerPrompt = `Based on the following context, answer the question. If the context doesn't contain relevant information, say so. If an FAQ entry matches the question, give its answer as written.
+
+Context:
+{{.Context}}
+
+Question: {{.Question}}
+
+Answer:`
+
+	defaultStreamPrompt = `Based on the following context, answer the question concisely. If the question relates to previous conversation, use that context as well. If an FAQ entry matches the question, give its answer as written.
+
+Context:
+{{.Context}}
+
+Question: {{.Question}}
+
+Answer:`
+)
+
+// promptData fills an answer prompt template
+type promptData struct {
+	Context  string
+	Question string
+}
+
+// answerPrompts holds the parsed answer prompt templates
+type answerPrompts struct {
+	answer *template.Template
+	stream *template.Template
+}
+
+// newAnswerPrompts parses rag.prompt_template, which replaces both default
+// prompts when set
+func newAnswerPrompts(custom string) (*answerPrompts, error) {
+	if strings.TrimSpace(custom) != "" {
+		t, err := parsePromptTemplate(custom)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rag.prompt_template: %w", err)
+		}
+		return &answerPrompts{answer: t, stream: t}, nil
+	}
+	return &answerPrompts{
+		answer: template.Must(parsePromptTemplate(defaultAnswerPrompt)),
+		stream: template.Must(parsePromptTemplate(defaultStreamPrompt)),
+	}, nil
+}
+
+// ValidatePromptTemplate reports whether rag.prompt_template is usable
+func ValidatePromptTemplate(custom string) error {
+	_, err := newAnswerPrompts(custom)
+	return err
+}
+
+// parsePromptTemplate parses a prompt template and checks that it uses both
+// placeholders and renders
+func parsePromptTemplate(text string) (*template.Template, error) {
+	for _, placeholder := range []string{".Context", ".Question"} {
+		if !strings.Contains(text, placeholder) {
+			return nil, fmt.Errorf("missing {{%s}} placeholder", placeholder)
+		}
+	}
+	t, err := template.New("prompt").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.Execute(&strings.Builder{}, promptData{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// renderPrompt fills t with the retrieved context and question, after the
+// conversation history and the instruction to answer in language, if any
+func renderPrompt(t *template.Template, history, docContext, question, language string) (string, error) {
+	var b strings.Builder
+	b.WriteString(history)
+	b.WriteString(languageInstruction(language))
+	if err := t.Execute(&b, promptData{Context: docContext, Question: question}); err != nil {
+		return "", fmt.Errorf("failed to render prompt: %w", err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/liliang-cn/askdoc/internal/config"
+	ragodomain "github.com/liliang-cn/rago/v2/pkg/domain"
+)
+
+// reranker reorders retrieved chunks with a rerank model behind a
+// Cohere/Jina-style /rerank endpoint
+type reranker struct {
+	client *http.Client
+	url    string
+	apiKey string
+	model  string
+}
+
+// newReranker returns nil when rag.rerank is disabled
+func newReranker(cfg *config.Config) *reranker {
+	rc := cfg.RAG.Rerank
+	if !rc.Enabled {
+		return nil
+	}
+	baseURL := rc.BaseURL
+	if baseURL == "" {
+		baseURL = cfg.LLM.Generation.BaseURL
+	}
+	apiKey := rc.APIKey
+	if apiKey == "" {
+		apiKey = cfg.LLM.Generation.APIKey
+	}
+	return &reranker{
+		client: &http.Client{Timeout: rc.Timeout},
+		url:    strings.TrimRight(baseURL, "/") + "/rerank",
+		apiKey: apiKey,
+		model:  rc.Model,
+	}
+}
+
+type rerankRequest struct {
+	Model     string   `json:"model"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n"`
+}
+
+type rerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+// rerank returns the topK chunks most relevant to query in the model's
+// order. Chunks keep their retrieval scores, so rag.min_score means the same
+// with and without reranking.
+func (r *reranker) rerank(ctx context.Context, query string, chunks []ragodomain.Chunk, topK int) ([]ragodomain.Chunk, error) {
+	docs := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		docs[i] = chunk.Content
+	}
+	body, err := json.Marshal(rerankRequest{Model: r.model, Query: query, Documents: docs, TopN: topK})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rerank request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("rerank request failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result rerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid rerank response: %w", err)
+	}
+
+	// Results are ordered by relevance; skip bad or repeated indexes
+	seen := make(map[int]bool, len(result.Results))
+	ranked := make([]ragodomain.Chunk, 0, topK)
+	for _, res := range result.Results {
+		if res.Index < 0 || res.Index >= len(chunks) || seen[res.Index] {
+			continue
+		}
+		seen[res.Index] = true
+		ranked = append(ranked, chunks[res.Index])
+		if len(ranked) == topK {
+			break
+		}
+	}
+	if len(ranked) == 0 {
+		return nil, fmt.Errorf("rerank response has no results")
+	}
+	return ranked, nil
+}
+
+// rerankChunks reranks candidates down to topK when rag.rerank is enabled,
+// keeping the retrieval order if the rerank call fails
+func (s *OrchestratorService) rerankChunks(ctx context.Context, query string, chunks []ragodomain.Chunk, topK int) []ragodomain.Chunk {
+	if s.reranker != nil && len(chunks) > 1 {
+		ranked, err := s.reranker.rerank(ctx, query, chunks, topK)
+		if err == nil {
+			return ranked
+		}
+		log.Printf("[Rerank] falling back to retrieval order: %v", err)
+	}
+	if len(chunks) > topK {
+		chunks = chunks[:topK]
+	}
+	return chunks
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/liliang-cn/askdoc/internal/config"
+	"github.com/liliang-cn/askdoc/internal/domain"
+	"github.com/liliang-cn/askdoc/internal/repository"
+	ragodomain "github.com/liliang-cn/rago/v2/pkg/domain"
+)
+
+// newTestDB opens a migrated metadata database in a temp directory
+func newTestDB(t *testing.T) *repository.DB {
+	t.Helper()
+	db, err := repository.NewDB(filepath.Join(t.TempDir(), "askdoc.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestConfig loads the default config with data under a temp directory,
+// plus extra YAML
+func newTestConfig(t *testing.T, extra string) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("data_dir: "+dir+"\n"+extra), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if err := cfg.EnsureDataDirs(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// testEnv wires the services over a temp metadata DB and vector store, with
+// a bag-of-words embedder and a scripted generator in place of the LLM
+type testEnv struct {
+	cfg            *config.Config
+	collectionRepo *repository.CollectionRepository
+	documentRepo   *repository.DocumentRepository
+	siteRepo       *repository.SiteRepository
+	sessionRepo    *repository.SessionRepository
+	embedder       *fakeEmbedder
+	generator      *fakeGenerator
+	orchestrator   *OrchestratorService
+	ingest         *IngestService
+	admin          *AdminService
+	chat           *ChatService
+}
+
+func newTestEnv(t *testing.T, extraConfig string) *testEnv {
+	t.Helper()
+	cfg := newTestConfig(t, extraConfig)
+	db, err := repository.NewDB(cfg.Database.Path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	env := &testEnv{
+		cfg:            cfg,
+		collectionRepo: repository.NewCollectionRepository(db),
+		documentRepo:   repository.NewDocumentRepository(db),
+		siteRepo:       repository.NewSiteRepository(db),
+		sessionRepo:    repository.NewSessionRepository(db),
+		embedder:       &fakeEmbedder{},
+		generator:      &fakeGenerator{},
+	}
+	env.orchestrator, err = newOrchestratorService(cfg, env.embedder, env.generator)
+	if err != nil {
+		t.Fatalf("failed to create orchestrator: %v", err)
+	}
+	t.Cleanup(func() { env.orchestrator.Close() })
+
+	env.ingest = NewIngestService(env.collectionRepo, env.documentRepo, cfg, env.orchestrator)
+	t.Cleanup(func() { env.ingest.Shutdown(context.Background()) })
+	env.admin = NewAdminService(cfg, env.collectionRepo, env.documentRepo, env.siteRepo, env.sessionRepo, env.orchestrator)
+	env.chat = NewChatService(cfg, env.siteRepo, env.sessionRepo, env.collectionRepo, env.orchestrator)
+	return env
+}
+
+// createCollection creates a collection named name
+func (env *testEnv) createCollection(t *testing.T, name string) *domain.Collection {
+	t.Helper()
+	collection, err := env.admin.CreateCollection(context.Background(), &domain.CreateCollectionRequest{Name: name})
+	if err != nil {
+		t.Fatalf("failed to create collection: %v", err)
+	}
+	return collection
+}
+
+// createSite creates a site over collections
+func (env *testEnv) createSite(t *testing.T, site *domain.Site) *domain.Site {
+	t.Helper()
+	if err := env.siteRepo.Create(site); err != nil {
+		t.Fatalf("failed to create site: %v", err)
+	}
+	return site
+}
+
+// upload ingests a file into a collection and waits for it to finish
+func (env *testEnv) upload(t *testing.T, collectionID, filename string, content []byte, metadata map[string]any) *domain.Document {
+	t.Helper()
+	doc, err := env.ingest.UploadDocumentContent(context.Background(), collectionID, filename, content, metadata, "", "")
+	if err != nil {
+		t.Fatalf("failed to upload %s: %v", filename, err)
+	}
+	env.waitIngested(t)
+	doc, err = env.orchestrator.GetDocument(context.Background(), doc.ID)
+	if err != nil {
+		t.Fatalf("failed to get %s: %v", filename, err)
+	}
+	return doc
+}
+
+// waitIngested waits for queued ingestion to finish
+func (env *testEnv) waitIngested(t *testing.T) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		env.ingest.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("ingestion did not finish")
+	}
+}
+
+// fakeEmbedderDims is the dimension of fakeEmbedder's vectors
+const fakeEmbedderDims = 64
+
+// fakeEmbedder embeds text as a normalized bag of hashed words, so texts
+// sharing words are similar
+type fakeEmbedder struct {
+	mu      sync.Mutex
+	delay   time.Duration        // waited before each embedding, honoring ctx
+	vectors map[string][]float64 // fixed embeddings of known texts, returned as is
+	errs    []error              // returned by the next calls, one each
+	calls   int
+}
+
+func (e *fakeEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	e.mu.Lock()
+	e.calls++
+	delay := e.delay
+	var err error
+	if len(e.errs) > 0 {
+		err, e.errs = e.errs[0], e.errs[1:]
+	}
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := sleepContext(ctx, delay); err != nil {
+		return nil, err
+	}
+	if vec, ok := e.vectors[strings.TrimSpace(text)]; ok {
+		return slices.Clone(vec), nil
+	}
+
+	vec := make([]float64, fakeEmbedderDims)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		vec[h.Sum32()%fakeEmbedderDims]++
+	}
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm == 0 {
+		vec[0], norm = 1, 1
+	}
+	for i := range vec {
+		vec[i] /= math.Sqrt(norm)
+	}
+	return vec, nil
+}
+
+func (e *fakeEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	vecs := make([][]float64, len(texts))
+	for i, text := range texts {
+		vec, err := e.Embed(ctx, text)
+		if err != nil {
+			return nil, err
+		}
+		vecs[i] = vec
+	}
+	return vecs, nil
+}
+
+func (e *fakeEmbedder) ProviderType() ragodomain.ProviderType { return "fake" }
+
+func (e *fakeEmbedder) Health(ctx context.Context) error { return nil }
+
+// fakeGenerator answers every prompt with reply (or "answer" when nil) and
+// records the prompts it was given
+type fakeGenerator struct {
+	mu      sync.Mutex
+	reply   func(prompt string) (string, error)
+	delay   time.Duration // waited before each reply, honoring ctx
+	prompts []string
+}
+
+func (g *fakeGenerator) Generate(ctx context.Context, prompt string, opts *ragodomain.GenerationOptions) (string, error) {
+	g.mu.Lock()
+	g.prompts = append(g.prompts, prompt)
+	reply, delay := g.reply, g.delay
+	g.mu.Unlock()
+	if err := sleepContext(ctx, delay); err != nil {
+		return "", err
+	}
+	if reply == nil {
+		return "answer", nil
+	}
+	return reply(prompt)
+}
+
+func (g *fakeGenerator) Stream(ctx context.Context, prompt string, opts *ragodomain.GenerationOptions, callback func(string)) error {
+	answer, err := g.Generate(ctx, prompt, opts)
+	if err != nil {
+		return err
+	}
+	callback(answer)
+	return nil
+}
+
+func (g *fakeGenerator) GenerateWithTools(ctx context.Context, messages []ragodomain.Message, tools []ragodomain.ToolDefinition, opts *ragodomain.GenerationOptions) (*ragodomain.GenerationResult, error) {
+	var prompt strings.Builder
+	for _, msg := range messages {
+		prompt.WriteString(msg.Content)
+	}
+	answer, err := g.Generate(ctx, prompt.String(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ragodomain.GenerationResult{Content: answer}, nil
+}
+
+func (g *fakeGenerator) StreamWithTools(ctx context.Context, messages []ragodomain.Message, tools []ragodomain.ToolDefinition, opts *ragodomain.GenerationOptions, callback ragodomain.ToolCallCallback) error {
+	_, err := g.GenerateWithTools(ctx, messages, tools, opts)
+	return err
+}
+
+func (g *fakeGenerator) GenerateStructured(ctx context.Context, prompt string, schema interface{}, opts *ragodomain.GenerationOptions) (*ragodomain.StructuredResult, error) {
+	answer, err := g.Generate(ctx, prompt, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ragodomain.StructuredResult{Raw: answer}, nil
+}
+
+func (g *fakeGenerator) RecognizeIntent(ctx context.Context, request string) (*ragodomain.IntentResult, error) {
+	return &ragodomain.IntentResult{Intent: ragodomain.IntentQuestion}, nil
+}
+
+// lastPrompt returns the most recent prompt, "" if none
+func (g *fakeGenerator) lastPrompt() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.prompts) == 0 {
+		return ""
+	}
+	return g.prompts[len(g.prompts)-1]
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// FindSharedDocument returns the oldest ready, published document with the
+// given content hash that owns its chunks, or nil when there is none
+func (s *OrchestratorService) FindSharedDocument(ctx context.Context, hash, excludeID string) (*askdocdomain.Document, error) {
+	var id string
+	err := s.sqvectCore.GetDB().QueryRowContext(ctx, `
+		SELECT id FROM documents
+		WHERE json_extract(metadata, '$.content_hash') = ?
+			AND json_extract(metadata, '$.status') = ?
+			AND COALESCE(json_extract(metadata, '$.visibility'), ?) = ?
+			AND COALESCE(json_extract(metadata, '$.shared_from'), '') = ''
+			AND json_extract(metadata, '$.deleted_at') IS NULL
+			AND id != ?
+		ORDER BY created_at LIMIT 1
+	`, hash, askdocdomain.DocumentStatusReady, askdocdomain.DocumentVisibilityPublished,
+		askdocdomain.DocumentVisibilityPublished, excludeID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find shared document: %w", err)
+	}
+	return s.GetDocument(ctx, id)
+}
+
+// ShareDocument makes document id a copy of owner: it is marked ready with
+// the owner's chunk count, and the owner's chunks become searchable in id's
+// collection
+func (s *OrchestratorService) ShareDocument(ctx context.Context, id string, owner *askdocdomain.Document) error {
+	if err := s.UpdateDocumentMetadata(ctx, id, map[string]any{
+		askdocdomain.MetadataKeySharedFrom: owner.ID,
+		askdocdomain.MetadataKeyChunkCount: owner.ChunkCount,
+		askdocdomain.MetadataKeyStatus:     askdocdomain.DocumentStatusReady,
+	}); err != nil {
+		return err
+	}
+	return s.syncSharedCollections(ctx, owner.ID)
+}
+
+// ReleaseDocument deletes a document, keeping chunks that other copies still
+// use. Deleting a copy removes its collection from the owner's chunks;
+// deleting an owner with copies hands its chunks to the oldest copy, one
+// that is not in the trash if there is any.
+func (s *OrchestratorService) ReleaseDocument(ctx context.Context, id string) error {
+	doc, err := s.GetDocument(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if doc.SharedFrom != "" {
+		if err := s.DeleteDocument(ctx, id); err != nil {
+			return err
+		}
+		return s.syncSharedCollections(ctx, doc.SharedFrom)
+	}
+
+	copies, err := s.sharedCopies(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(copies) == 0 {
+		return s.DeleteDocument(ctx, id)
+	}
+
+	if i := slices.IndexFunc(copies, func(c sharedCopy) bool { return !c.deletedAt.Valid }); i > 0 {
+		copies[0], copies[i] = copies[i], copies[0]
+	}
+	heir := copies[0]
+	if err := s.UpdateDocumentMetadata(ctx, heir.id, map[string]any{askdocdomain.MetadataKeySharedFrom: ""}); err != nil {
+		return err
+	}
+	for _, c := range copies[1:] {
+		if err := s.UpdateDocumentMetadata(ctx, c.id, map[string]any{askdocdomain.MetadataKeySharedFrom: heir.id}); err != nil {
+			return err
+		}
+	}
+	// The chunks take the heir's collection and trash state
+	if _, err := s.sqvectCore.GetDB().ExecContext(ctx, `
+		UPDATE embeddings SET doc_id = ?, metadata = json_set(COALESCE(metadata, '{}'), '$.collection_id', ?, '$.deleted_at', ?)
+		WHERE doc_id = ?
+	`, heir.id, heir.collectionID, heir.deletedAt, id); err != nil {
+		return fmt.Errorf("failed to move chunks: %w", err)
+	}
+	if err := s.DeleteDocument(ctx, id); err != nil {
+		return err
+	}
+	return s.syncSharedCollections(ctx, heir.id)
+}
+
+// sharedCopy is a document using another document's chunks
+type sharedCopy struct {
+	id           string
+	collectionID string
+	deletedAt    sql.NullString // set while the copy is in the trash
+}
+
+// sharedCopies lists the copies of an owner document, oldest first
+func (s *OrchestratorService) sharedCopies(ctx context.Context, ownerID string) ([]sharedCopy, error) {
+	rows, err := s.sqvectCore.GetDB().QueryContext(ctx, `
+		SELECT id, COALESCE(json_extract(metadata, '$.collection_id'), ''), json_extract(metadata, '$.deleted_at') FROM documents
+		WHERE json_extract(metadata, '$.shared_from') = ?
+		ORDER BY created_at
+	`, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shared copies: %w", err)
+	}
+	defer rows.Close()
+
+	var copies []sharedCopy
+	for rows.Next() {
+		var c sharedCopy
+		if err := rows.Scan(&c.id, &c.collectionID, &c.deletedAt); err != nil {
+			return nil, err
+		}
+		copies = append(copies, c)
+	}
+	return copies, rows.Err()
+}
+
+// syncSharedCollections records on an owner's chunks the collections of its
+// copies outside the trash, so collection-scoped searches find them there too
+func (s *OrchestratorService) syncSharedCollections(ctx context.Context, ownerID string) error {
+	copies, err := s.sharedCopies(ctx, ownerID)
+	if err != nil {
+		return err
+	}
+	var collections []string
+	for _, c := range copies {
+		if c.collectionID != "" && !c.deletedAt.Valid && !slices.Contains(collections, c.collectionID) {
+			collections = append(collections, c.collectionID)
+		}
+	}
+
+	if _, err := s.sqvectCore.GetDB().ExecContext(ctx, `
+		UPDATE embeddings SET metadata = json_set(COALESCE(metadata, '{}'), '$.shared_collections', ?)
+		WHERE doc_id = ?
+	`, strings.Join(collections, ","), ownerID); err != nil {
+		return fmt.Errorf("failed to update chunk metadata: %w", err)
+	}
+	return nil
+}
+
+// chunkInCollection reports whether a chunk belongs to a collection, either
+// directly, unless its document is in the trash, or through a shared copy
+func chunkInCollection(metadata map[string]any, collectionID string) bool {
+	if fmt.Sprint(metadata[askdocdomain.MetadataKeyCollectionID]) == collectionID && deletedAt(metadata) == nil {
+		return true
+	}
+	shared, _ := metadata[askdocdomain.MetadataKeySharedCollections].(string)
+	return shared != "" && slices.Contains(strings.Split(shared, ","), collectionID)
+}
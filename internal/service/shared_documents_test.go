@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+func TestIdenticalUploadsShareChunks(t *testing.T) {
+	env := newTestEnv(t, "ingest:\n  share_identical: true\n")
+	ctx := context.Background()
+	first := env.createCollection(t, "first")
+	second := env.createCollection(t, "second")
+	content := []byte("Restart the agent after changing its proxy settings.")
+
+	owner := env.upload(t, first.ID, "proxy.md", content, nil)
+	env.embedder.mu.Lock()
+	embedded := env.embedder.calls
+	env.embedder.mu.Unlock()
+	shared := env.upload(t, second.ID, "proxy-copy.md", content, nil)
+	if shared.Status != domain.DocumentStatusReady || shared.SharedFrom != owner.ID {
+		t.Fatalf("copy = %s shared from %q, want ready and shared from %s", shared.Status, shared.SharedFrom, owner.ID)
+	}
+	env.embedder.mu.Lock()
+	if env.embedder.calls != embedded {
+		t.Errorf("embedder called %d more times for the copy, want none", env.embedder.calls-embedded)
+	}
+	env.embedder.mu.Unlock()
+
+	chunks := func() int {
+		t.Helper()
+		var n int
+		if err := env.orchestrator.sqvectCore.GetDB().QueryRowContext(ctx, "SELECT COUNT(*) FROM embeddings").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	found := func(collection *domain.Collection) bool {
+		t.Helper()
+		sources, err := env.orchestrator.Search(ctx, "restart agent proxy settings", 5, "",
+			map[string]string{domain.MetadataKeyCollectionID: collection.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(sources) > 0
+	}
+	stored := chunks()
+	if stored != owner.ChunkCount {
+		t.Errorf("stored chunks = %d, want the owner's %d only", stored, owner.ChunkCount)
+	}
+	if !found(first) || !found(second) {
+		t.Fatal("shared chunks are not retrievable from both collections")
+	}
+
+	// Deleting the owner hands its chunks to the copy
+	if err := env.admin.DeleteDocument(ctx, owner.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := chunks(); got != stored {
+		t.Errorf("stored chunks after deleting the owner = %d, want %d", got, stored)
+	}
+	if found(first) || !found(second) {
+		t.Error("after deleting the owner, want the chunks found only in the copy's collection")
+	}
+	if err := env.admin.DeleteDocument(ctx, shared.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := chunks(); got != 0 {
+		t.Errorf("stored chunks after deleting both = %d, want 0", got)
+	}
+}
+
+func TestMergeMovesSharedCopies(t *testing.T) {
+	env := newTestEnv(t, "ingest:\n  share_identical: true\n")
+	ctx := context.Background()
+	owners := env.createCollection(t, "owners")
+	copies := env.createCollection(t, "copies")
+	target := env.createCollection(t, "target")
+	content := []byte("Restart the agent after changing its proxy settings.")
+	owner := env.upload(t, owners.ID, "proxy.md", content, nil)
+	if shared := env.upload(t, copies.ID, "proxy-copy.md", content, nil); shared.SharedFrom != owner.ID {
+		t.Fatalf("copy shared from %q, want %s", shared.SharedFrom, owner.ID)
+	}
+
+	if _, err := env.admin.MergeCollections(ctx, target.ID, copies.ID); err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	for _, tt := range []struct {
+		collection *domain.Collection
+		want       bool
+	}{{owners, true}, {copies, false}, {target, true}} {
+		sources, err := env.orchestrator.Search(ctx, "restart agent proxy settings", 5, "",
+			map[string]string{domain.MetadataKeyCollectionID: tt.collection.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found := len(sources) > 0; found != tt.want {
+			t.Errorf("search scoped to %s found the shared chunks: %t, want %t", tt.collection.Name, found, tt.want)
+		}
+	}
+}
+
+func TestSharedDocumentTags(t *testing.T) {
+	env := newTestEnv(t, "ingest:\n  share_identical: true\n")
+	ctx := context.Background()
+	first := env.createCollection(t, "first")
+	second := env.createCollection(t, "second")
+	untagged := env.createCollection(t, "untagged")
+	content := []byte("Restart the agent after changing its proxy settings.")
+	tags := map[string]any{domain.MetadataKeyTags: "ops"}
+
+	owner := env.upload(t, first.ID, "proxy.md", content, tags)
+	if other := env.upload(t, untagged.ID, "proxy-untagged.md", content, nil); other.SharedFrom != "" {
+		t.Errorf("differently tagged copy shared from %q, want its own chunks", other.SharedFrom)
+	}
+	shared := env.upload(t, second.ID, "proxy-copy.md", content, tags)
+	if shared.SharedFrom != owner.ID {
+		t.Fatalf("copy shared from %q, want %s", shared.SharedFrom, owner.ID)
+	}
+
+	for _, id := range []string{shared.ID, owner.ID} {
+		if _, err := env.admin.SetDocumentTags(ctx, id, []string{"network"}); !errors.Is(err, domain.ErrInvalidRequest) {
+			t.Errorf("retagging %s: err = %v, want ErrInvalidRequest", id, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	mdFenceInfoRe   = regexp.MustCompile("(?m)^\\s{0,3}(?:```|~~~)\\s*([\\w+#.-]+)")
+	adocSourceRe    = regexp.MustCompile(`(?m)^\[source,\s*([\w+#.-]+)`)
+	shebangRe       = regexp.MustCompile(`^#!\s*\S*/(?:env\s+)?(\w+)`)
+	goSignatureRe   = regexp.MustCompile(`(?m)^package \w+$|^func (?:\(\w+ \*?\w+\) )?\w+\(`)
+	pySignatureRe   = regexp.MustCompile(`(?m)^(?:def \w+\(.*\):|class \w+(?:\(.*\))?:|import \w+$|from [\w.]+ import )`)
+	jsSignatureRe   = regexp.MustCompile(`(?m)^(?:const|let) \w+ = |^function \w+\(|=> \{$|^export (?:default |const |function )`)
+	javaSignatureRe = regexp.MustCompile(`(?m)^\s*(?:public|private|protected) (?:static )?(?:class|void|[\w<>]+) \w+`)
+	sqlSignatureRe  = regexp.MustCompile(`(?im)^\s*(?:SELECT .+ FROM |INSERT INTO |CREATE TABLE |UPDATE \w+ SET )`)
+)
+
+// codeExtensions maps source file extensions to highlighting language names
+var codeExtensions = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".js":   "javascript",
+	".ts":   "typescript",
+	".java": "java",
+	".rs":   "rust",
+	".rb":   "ruby",
+	".c":    "c",
+	".h":    "c",
+	".cpp":  "cpp",
+	".cs":   "csharp",
+	".php":  "php",
+	".sh":   "bash",
+	".sql":  "sql",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".json": "json",
+}
+
+// languageAliases normalizes common fence info strings
+var languageAliases = map[string]string{
+	"golang":  "go",
+	"py":      "python",
+	"python3": "python",
+	"js":      "javascript",
+	"ts":      "typescript",
+	"sh":      "bash",
+	"shell":   "bash",
+	"yml":     "yaml",
+	"c++":     "cpp",
+	"c#":      "csharp",
+}
+
+// detectSourceLanguage returns a syntax highlighting hint for a source chunk,
+// or "" when the chunk is prose
+func detectSourceLanguage(filename, fileType, content string) string {
+	if isStructured(fileType) {
+		// CSV and JSON are ingested as "field: value" text, not source
+		return ""
+	}
+	if lang, ok := codeExtensions[strings.ToLower(filepath.Ext(filename))]; ok {
+		return lang
+	}
+
+	switch fileType {
+	case FileTypeMD:
+		if m := mdFenceInfoRe.FindStringSubmatch(content); m != nil {
+			return normalizeLanguage(m[1])
+		}
+		return ""
+	case FileTypeADOC:
+		if m := adocSourceRe.FindStringSubmatch(content); m != nil {
+			return normalizeLanguage(m[1])
+		}
+		return ""
+	case FileTypeTXT:
+		return guessLanguage(content)
+	default:
+		return ""
+	}
+}
+
+// guessLanguage recognizes plain-text chunks that are clearly code
+func guessLanguage(content string) string {
+	trimmed := strings.TrimSpace(content)
+	if m := shebangRe.FindStringSubmatch(trimmed); m != nil {
+		return normalizeLanguage(m[1])
+	}
+
+	switch {
+	case goSignatureRe.MatchString(trimmed):
+		return "go"
+	case pySignatureRe.MatchString(trimmed):
+		return "python"
+	case javaSignatureRe.MatchString(trimmed):
+		return "java"
+	case jsSignatureRe.MatchString(trimmed):
+		return "javascript"
+	case sqlSignatureRe.MatchString(trimmed):
+		return "sql"
+	default:
+		return ""
+	}
+}
+
+func normalizeLanguage(lang string) string {
+	lang = strings.ToLower(lang)
+	if alias, ok := languageAliases[lang]; ok {
+		return alias
+	}
+	return lang
+}
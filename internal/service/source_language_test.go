@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSourceLanguage(t *testing.T) {
+	env := newTestEnv(t, "")
+	collection := env.createCollection(t, "docs")
+	code := env.upload(t, collection.ID, "parsing.md", []byte("Parse the config file:\n\n```python\nimport yaml\nconfig = yaml.safe_load(open(\"config.yaml\"))\n```\n"), nil)
+	prose := env.upload(t, collection.ID, "overview.md", []byte("# Overview\n\nThe service reads its settings at startup."), nil)
+
+	tests := []struct {
+		query string
+		docID string
+		want  string
+	}{
+		{"parse the config file with yaml", code.ID, "python"},
+		{"service reads its settings at startup", prose.ID, ""},
+	}
+	for _, tt := range tests {
+		sources, err := env.orchestrator.Search(context.Background(), tt.query, 1, "", nil)
+		if err != nil {
+			t.Fatalf("search %q: %v", tt.query, err)
+		}
+		if len(sources) == 0 || sources[0].DocumentID != tt.docID {
+			t.Fatalf("search %q returned %+v, want document %s", tt.query, sources, tt.docID)
+		}
+		if sources[0].Language != tt.want {
+			t.Errorf("search %q: language = %q, want %q", tt.query, sources[0].Language, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxStorageCollisions bounds the numbered names tried by createStorageFile
+const maxStorageCollisions = 1000
+
+// safeStoragePath joins elems under root. Each element is reduced to a single
+// safe path component, so source-derived names such as "../../etc/passwd"
+// cannot leave the storage root. All ingestion entry points build paths
+// through it.
+func safeStoragePath(root string, elems ...string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid storage root: %w", err)
+	}
+
+	parts := make([]string, 0, len(elems)+1)
+	parts = append(parts, absRoot)
+	for _, elem := range elems {
+		parts = append(parts, sanitizePathElement(elem))
+	}
+	path := filepath.Join(parts...)
+
+	rel, err := filepath.Rel(absRoot, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("storage path escapes %s", root)
+	}
+	return path, nil
+}
+
+// sanitizePathElement turns an arbitrary name into one path component: path
+// separators and control characters become "_", and leading dots are dropped
+// so the result is never "..", "." or a hidden file
+func sanitizePathElement(name string) string {
+	clean := strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\' || r == ':':
+			return '_'
+		case r < 0x20 || r == 0x7f:
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+	clean = strings.TrimLeft(strings.TrimSpace(clean), ".")
+	if clean == "" {
+		return "_"
+	}
+	return clean
+}
+
+// createStorageFile creates path exclusively. If a file already exists it
+// tries "name-2.ext", "name-3.ext", ... in order and returns the path used.
+func createStorageFile(path string) (*os.File, string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+
+	candidate := path
+	for n := 2; n <= maxStorageCollisions+1; n++ {
+		f, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return f, candidate, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, "", err
+		}
+		candidate = fmt.Sprintf("%s-%d%s", base, n, ext)
+	}
+	return nil, "", fmt.Errorf("too many files named like %s", filepath.Base(path))
+}
+
+// removeStoredDocument deletes the uploaded file of a document from its
+// collection's storage directory, whatever extension it was saved with.
+// A document without a stored file is not an error.
+func removeStoredDocument(root, collectionID, id string) error {
+	dir, err := safeStoragePath(root, collectionID)
+	if err != nil {
+		return err
+	}
+	matches, err := storedDocumentFiles(dir, id)
+	if err != nil {
+		return err
+	}
+	for _, path := range matches {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveStoredDocument moves the uploaded file of a document between two
+// collections' storage directories. A document without a stored file is not
+// an error.
+func moveStoredDocument(root, sourceID, targetID, id string) error {
+	sourceDir, err := safeStoragePath(root, sourceID)
+	if err != nil {
+		return err
+	}
+	targetDir, err := safeStoragePath(root, targetID)
+	if err != nil {
+		return err
+	}
+	matches, err := storedDocumentFiles(sourceDir, id)
+	if err != nil || len(matches) == 0 {
+		return err
+	}
+
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	for _, path := range matches {
+		if err := os.Rename(path, filepath.Join(targetDir, filepath.Base(path))); err != nil {
+			return fmt.Errorf("failed to move %s: %w", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+// storedDocumentFiles returns the files in dir stored for document id, named
+// "<id>.<ext>". Names are compared literally rather than globbed, so IDs
+// containing "*", "?" or "[" match only their own files.
+func storedDocumentFiles(dir, id string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefix := sanitizePathElement(id) + "."
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), prefix) {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRemoveStoredDocumentMatchesLiterally(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "docs")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a*.pdf", "abc.pdf", "a?.txt", "a[b].md", "ab.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"a*", "a?", "a[b]"} {
+		if err := removeStoredDocument(root, "docs", id); err != nil {
+			t.Fatalf("removeStoredDocument(%q): %v", id, err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, entry := range entries {
+		left = append(left, entry.Name())
+	}
+	if want := []string{"ab.md", "abc.pdf"}; !slices.Equal(left, want) {
+		t.Errorf("files left = %v, want %v", left, want)
+	}
+}
+
+func TestMoveStoredDocumentMatchesLiterally(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "docs")
+	if err := os.MkdirAll(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a*.pdf", "abc.pdf"} {
+		if err := os.WriteFile(filepath.Join(source, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := moveStoredDocument(root, "docs", "archive", "a*"); err != nil {
+		t.Fatalf("moveStoredDocument: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "archive", "a*.pdf")); err != nil {
+		t.Errorf("moved file missing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(source, "abc.pdf")); err != nil {
+		t.Errorf("another document's file was moved: %v", err)
+	}
+
+	// A document without a stored file is not an error
+	if err := moveStoredDocument(root, "missing", "archive", "doc"); err != nil {
+		t.Errorf("moveStoredDocument without files: %v", err)
+	}
+}
+
+func TestSafeStoragePathContainsMaliciousNames(t *testing.T) {
+	root := t.TempDir()
+	names := []string{
+		"../../etc/passwd",
+		"..",
+		".",
+		"",
+		"/etc/passwd",
+		`..\..\windows\system32`,
+		"docs/../../../tmp",
+		"C:evil",
+		"name\x00.txt",
+	}
+	for _, name := range names {
+		for _, elems := range [][]string{{name}, {"collection", name}, {name, "doc.md"}} {
+			path, err := safeStoragePath(root, elems...)
+			if err != nil {
+				t.Errorf("safeStoragePath(%q): %v", elems, err)
+				continue
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+				t.Errorf("safeStoragePath(%q) = %s, outside %s", elems, path, root)
+			}
+			if depth := len(strings.Split(rel, string(filepath.Separator))); depth != len(elems) {
+				t.Errorf("safeStoragePath(%q) = %s, %d levels deep, want %d", elems, rel, depth, len(elems))
+			}
+		}
+	}
+}
+
+func TestCreateStorageFileNumbersCollisions(t *testing.T) {
+	dir := t.TempDir()
+	var got []string
+	for i := 0; i < 3; i++ {
+		f, path, err := createStorageFile(filepath.Join(dir, "page.html"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		got = append(got, filepath.Base(path))
+	}
+	if want := []string{"page.html", "page-2.html", "page-3.html"}; !slices.Equal(got, want) {
+		t.Errorf("created %v, want %v", got, want)
+	}
+}
+
+func TestUploadMaliciousFilenameStaysInStorage(t *testing.T) {
+	env := newTestEnv(t, "")
+	collection := env.createCollection(t, "docs")
+	doc := env.upload(t, collection.ID, "../../etc/passwd.md", []byte("root:x:0:0"), nil)
+
+	path := env.ingest.GetStoragePath(doc)
+	rel, err := filepath.Rel(env.cfg.Storage.Documents, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		t.Fatalf("stored at %s, outside %s", path, env.cfg.Storage.Documents)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("stored file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(env.cfg.Storage.Documents), "etc")); !os.IsNotExist(err) {
+		t.Errorf("upload created a directory outside the storage root: %v", err)
+	}
+}
@@ -0,0 +1,302 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	askdocdomain "github.com/liliang-cn/askdoc/internal/domain"
+)
+
+// structuredText is a CSV or JSON file rendered as "field: value" lines, one
+// block per row or record
+type structuredText struct {
+	text    string
+	rows    []structuredRow
+	skipped int // malformed rows or records left out
+
+	buf strings.Builder
+}
+
+// structuredRow is where a row's block starts in the text; index is the
+// 1-based row (CSV, after the header) or record (JSON) number
+type structuredRow struct {
+	offset int
+	index  int
+}
+
+func (t *structuredText) add(index int, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+	if len(t.rows) > 0 {
+		t.buf.WriteString("\n\n")
+	}
+	t.rows = append(t.rows, structuredRow{offset: t.buf.Len(), index: index})
+	t.buf.WriteString(strings.Join(lines, "\n"))
+}
+
+// rowAt returns the row whose block contains offset
+func (t *structuredText) rowAt(offset int) int {
+	i := sort.Search(len(t.rows), func(i int) bool { return t.rows[i].offset > offset })
+	if i == 0 {
+		return 0
+	}
+	return t.rows[i-1].index
+}
+
+// isStructured reports whether a file type is ingested row by row
+func isStructured(fileType string) bool {
+	return fileType == FileTypeCSV || fileType == FileTypeJSON
+}
+
+// structuredFields reads the fields to keep from upload metadata, given as a
+// list or a comma-separated string; none means every field
+func structuredFields(metadata map[string]any) []string {
+	var fields []string
+	switch v := metadata[askdocdomain.MetadataKeyFields].(type) {
+	case string:
+		fields = strings.Split(v, ",")
+	case []string:
+		fields = v
+	case []any:
+		for _, item := range v {
+			fields = append(fields, fmt.Sprint(item))
+		}
+	}
+
+	var kept []string
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field != "" {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+// extractStructured renders a stored CSV or JSON file
+func extractStructured(fileType, path string, fields []string) (*structuredText, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var result *structuredText
+	switch fileType {
+	case FileTypeCSV:
+		result, err = extractCSV(data, fields)
+	case FileTypeJSON:
+		result, err = extractJSON(data, fields)
+	default:
+		return nil, fmt.Errorf("not a structured file type: %s", fileType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.text = result.buf.String()
+	if result.text == "" {
+		return nil, fmt.Errorf("no rows with content (%d malformed rows skipped)", result.skipped)
+	}
+	return result, nil
+}
+
+// extractCSV renders each data row as "column: value" lines, naming columns
+// by the header row. Rows with the wrong number of fields or broken quoting
+// are skipped.
+func extractCSV(data []byte, fields []string) (*structuredText, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	for _, field := range fields {
+		if !slices.Contains(header, field) {
+			return nil, fmt.Errorf("CSV has no column %q", field)
+		}
+	}
+
+	result := &structuredText{}
+	for index := 1; ; index++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			result.skipped++
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		var lines []string
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if value == "" || header[i] == "" || (len(fields) > 0 && !slices.Contains(fields, header[i])) {
+				continue
+			}
+			lines = append(lines, header[i]+": "+value)
+		}
+		result.add(index, lines)
+	}
+	return result, nil
+}
+
+// extractJSON renders each record as "field: value" lines, with nested
+// fields joined by dots. A top-level array holds one record per element and
+// an object is a single record; otherwise each line is read as a record
+// (JSON Lines). Elements that aren't objects and unparsable lines are
+// skipped.
+func extractJSON(data []byte, fields []string) (*structuredText, error) {
+	var records []any
+	skipped := 0
+
+	var top any
+	if err := json.Unmarshal(data, &top); err == nil {
+		switch v := top.(type) {
+		case []any:
+			records = v
+		case map[string]any:
+			records = []any{v}
+		default:
+			return nil, fmt.Errorf("JSON must be an object, an array of objects or JSON Lines")
+		}
+	} else {
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			var record any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				skipped++
+				continue
+			}
+			records = append(records, record)
+		}
+		if len(records) == 0 {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+
+	result := &structuredText{skipped: skipped}
+	for i, record := range records {
+		object, ok := record.(map[string]any)
+		if !ok {
+			result.skipped++
+			continue
+		}
+		values := make(map[string]string)
+		flattenJSON("", object, values)
+
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			if len(fields) == 0 || slices.ContainsFunc(fields, func(field string) bool { return fieldMatches(key, field) }) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		lines := make([]string, 0, len(keys))
+		for _, key := range keys {
+			lines = append(lines, key+": "+values[key])
+		}
+		result.add(i+1, lines)
+	}
+	return result, nil
+}
+
+// flattenJSON collects the non-empty scalar values of v by dotted path.
+// Arrays of scalars are joined with commas; arrays holding objects are
+// indexed, e.g. variants.0.sku.
+func flattenJSON(prefix string, v any, values map[string]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, child := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenJSON(path, child, values)
+		}
+	case []any:
+		scalars := make([]string, 0, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case map[string]any, []any:
+				flattenJSON(prefix+"."+strconv.Itoa(i), item, values)
+			default:
+				if s := jsonScalar(item); s != "" {
+					scalars = append(scalars, s)
+				}
+			}
+		}
+		if len(scalars) > 0 {
+			values[prefix] = strings.Join(scalars, ", ")
+		}
+	default:
+		if s := jsonScalar(v); s != "" {
+			values[prefix] = s
+		}
+	}
+}
+
+func jsonScalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// fieldMatches reports whether a flattened key is field or nested under it
+func fieldMatches(key, field string) bool {
+	return key == field || strings.HasPrefix(key, field+".")
+}
+
+// AnnotateRows records in each chunk of a structured document the row it
+// starts in, so a citation can point back to it
+func (s *OrchestratorService) AnnotateRows(ctx context.Context, docID string, source *structuredText) error {
+	embeddings, err := s.sqvectCore.GetByDocID(ctx, docID)
+	if err != nil {
+		return fmt.Errorf("failed to load document chunks: %w", err)
+	}
+
+	db := s.sqvectCore.GetDB()
+	from := 0
+	for _, emb := range embeddings {
+		if !isContentChunk(emb.Metadata) {
+			continue
+		}
+		offset := locateChunk(source.text, emb.Content, from)
+		if offset < 0 {
+			continue
+		}
+		from = offset
+		if _, err := db.ExecContext(ctx, `
+			UPDATE embeddings SET metadata = json_set(COALESCE(metadata, '{}'), '$.row', ?)
+			WHERE id = ?
+		`, source.rowAt(offset), emb.ID); err != nil {
+			return fmt.Errorf("failed to update chunk metadata: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// expandSynonyms returns the synonyms of terms that appear in query, for
+// appending to it. Each map entry is a group: a question using the term or
+// any of its aliases is expanded with the rest of the group.
+func expandSynonyms(query string, synonyms map[string][]string) []string {
+	if len(synonyms) == 0 {
+		return nil
+	}
+	lower := strings.ToLower(query)
+	seen := make(map[string]bool)
+	var expansions []string
+	for term, aliases := range synonyms {
+		group := append([]string{term}, aliases...)
+		matched := false
+		for _, t := range group {
+			if containsTerm(lower, strings.ToLower(t)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		for _, t := range group {
+			key := strings.ToLower(t)
+			if seen[key] || containsTerm(lower, key) {
+				continue
+			}
+			seen[key] = true
+			expansions = append(expansions, t)
+		}
+	}
+	return expansions
+}
+
+// containsTerm reports whether term occurs in text as whole words; both are
+// lower-case
+func containsTerm(text, term string) bool {
+	if term == "" {
+		return false
+	}
+	for start := 0; ; {
+		i := strings.Index(text[start:], term)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(term)
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (i == 0 || !isWordRune(before)) && (end == len(text) || !isWordRune(after)) {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// withSynonyms appends the synonyms of query's terms to it
+func withSynonyms(query string, synonyms map[string][]string) string {
+	expansions := expandSynonyms(query, synonyms)
+	if len(expansions) == 0 {
+		return query
+	}
+	return query + " (" + strings.Join(expansions, ", ") + ")"
+}
+
+// collectionSynonyms merges the synonym maps of the given collections and
+// reports whether any of them expands embedded queries
+func (s *ChatService) collectionSynonyms(collectionIDs []string) (map[string][]string, bool) {
+	var merged map[string][]string
+	embed := false
+	for _, id := range collectionIDs {
+		collection, err := s.collectionRepo.Get(id)
+		if err != nil {
+			log.Printf("[Chat] failed to load synonyms of collection %s: %v", id, err)
+			continue
+		}
+		if collection == nil || len(collection.Synonyms) == 0 {
+			continue
+		}
+		if merged == nil {
+			merged = make(map[string][]string)
+		}
+		for term, aliases := range collection.Synonyms {
+			merged[term] = append(merged[term], aliases...)
+		}
+		embed = embed || collection.EmbedSynonyms
+	}
+	return merged, embed
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+func TestSynonymsRetrieveCanonicalTerm(t *testing.T) {
+	env := newTestEnv(t, "rag:\n  min_score: 0.2\n")
+	ctx := context.Background()
+	collection := env.createCollection(t, "docs")
+	canonical := env.upload(t, collection.ID, "sso.md", []byte("Single sign-on is configured in the identity panel."), nil)
+	env.upload(t, collection.ID, "billing.md", []byte("Billing invoices are emailed monthly."), nil)
+	site := env.createSite(t, &domain.Site{Name: "docs", CollectionIDs: []string{collection.ID}})
+
+	sources := func(mode string) []domain.Source {
+		t.Helper()
+		resp, err := env.chat.Chat(ctx, site.ID, &domain.ChatRequest{Message: "How do I set up SSO?", SearchMode: mode})
+		if err != nil {
+			t.Fatalf("Chat: %v", err)
+		}
+		return resp.Sources
+	}
+	if got := sources(domain.SearchModeHybrid); len(got) != 0 {
+		t.Fatalf("sources without synonyms = %+v, want none", got)
+	}
+
+	// Keyword matching expands the question with the collection's synonyms
+	if _, err := env.admin.UpdateCollection(ctx, collection.ID, &domain.UpdateCollectionRequest{
+		Synonyms: map[string][]string{"SSO": {"single sign-on"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sources(domain.SearchModeHybrid); len(got) != 1 || got[0].DocumentID != canonical.ID {
+		t.Errorf("hybrid sources with synonyms = %+v, want the single sign-on document", got)
+	}
+	if got := sources(domain.SearchModeVector); len(got) != 0 {
+		t.Errorf("vector sources without embed_synonyms = %+v, want none", got)
+	}
+
+	// embed_synonyms expands the embedded question too
+	embed := true
+	if _, err := env.admin.UpdateCollection(ctx, collection.ID, &domain.UpdateCollectionRequest{EmbedSynonyms: &embed}); err != nil {
+		t.Fatal(err)
+	}
+	if got := sources(domain.SearchModeVector); len(got) != 1 || got[0].DocumentID != canonical.ID {
+		t.Errorf("vector sources with embed_synonyms = %+v, want the single sign-on document", got)
+	}
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/liliang-cn/askdoc/internal/domain"
+)
+
+const (
+	// urlFetchTimeout bounds fetching a page, redirects included
+	urlFetchTimeout = 30 * time.Second
+	// urlFetchMaxRedirects is how many redirects a fetch follows
+	urlFetchMaxRedirects = 3
+	// urlFetchMaxBody caps a fetched page when storage.max_file_size is unlimited
+	urlFetchMaxBody = 10 << 20
+)
+
+// errBlockedAddress is returned for URLs resolving to addresses that must not
+// be fetched server-side
+var errBlockedAddress = errors.New("url resolves to a private or loopback address")
+
+// urlFetchClient fetches pages for ingestion. Addresses are checked after DNS
+// resolution, on every connection, so redirects and rebinding can't reach
+// internal hosts; environment proxies are ignored for the same reason.
+var urlFetchClient = &http.Client{
+	Timeout: urlFetchTimeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return errBlockedAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) > urlFetchMaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", urlFetchMaxRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// blockedNetworks are ranges publicIP rejects beyond those net.IP classifies:
+// "this network" (which reaches the local host on Linux), carrier-grade NAT,
+// and NAT64 prefixes, which embed arbitrary IPv4 addresses
+var blockedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "64:ff9b::/96", "64:ff9b:1::/48"} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// publicIP reports whether ip is a routable public address
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// IngestURL fetches a web page and ingests its readable text into a
+// collection, with the URL as the document's filename
+func (s *IngestService) IngestURL(ctx context.Context, collectionID, rawURL string, metadata map[string]any) (*domain.Document, error) {
+	if s.orchestrator == nil {
+		return nil, fmt.Errorf("orchestrator not available")
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http or https URL", domain.ErrInvalidRequest)
+	}
+	pageURL := u.String()
+
+	collection, err := s.collectionRepo.Get(collectionID)
+	if err != nil {
+		return nil, err
+	}
+	if collection == nil {
+		return nil, domain.ErrNotFound
+	}
+
+	docMeta := make(map[string]any, len(metadata)+1)
+	for k, v := range metadata {
+		docMeta[k] = v
+	}
+	docMeta[domain.MetadataKeySourceURL] = pageURL
+	if err := normalizeMetadataTags(docMeta); err != nil {
+		return nil, err
+	}
+
+	text, size, err := s.fetchPageText(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	ingestMeta := make(map[string]any, len(docMeta)+8)
+	for k, v := range docMeta {
+		ingestMeta[k] = v
+	}
+	ingestMeta[domain.MetadataKeyCollectionID] = collectionID
+	ingestMeta[domain.MetadataKeyFilename] = pageURL
+	ingestMeta[domain.MetadataKeyFileType] = FileTypeHTML
+	ingestMeta[domain.MetadataKeyFileSize] = size
+	ingestMeta[domain.MetadataKeyStatus] = domain.DocumentStatusReady
+	ingestMeta[domain.MetadataKeyVisibility] = domain.DocumentVisibilityPublished
+	chunkSize, chunkOverlap := collectionChunking(s.cfg, collection)
+	ingestMeta[domain.MetadataKeyChunkSize] = chunkSize
+	ingestMeta[domain.MetadataKeyChunkOverlap] = chunkOverlap
+
+	resp, err := s.orchestrator.IngestText(ctx, text, pageURL, chunkSize, chunkOverlap, ingestMeta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ingest %s: %w", pageURL, err)
+	}
+	if err := s.orchestrator.UpdateDocumentMetadata(ctx, resp.DocumentID, map[string]any{
+		domain.MetadataKeyChunkCount: resp.ChunkCount,
+	}); err != nil {
+		log.Printf("[Ingest] Failed to record chunk count of %s: %v", resp.DocumentID, err)
+	}
+
+	if err := s.collectionRepo.UpdateDocumentCount(collectionID, 1); err != nil {
+		return nil, err
+	}
+	if err := s.collectionRepo.BumpVersion(collectionID); err != nil {
+		log.Printf("[Ingest] BumpVersion failed: %v", err)
+	}
+	if err := s.collectionRepo.SetLastIngested(collectionID, time.Now()); err != nil {
+		log.Printf("[Ingest] SetLastIngested failed: %v", err)
+	}
+	log.Printf("[Ingest] Ingested %s into collection %s (%d chunks)", pageURL, collectionID, resp.ChunkCount)
+
+	document := &domain.Document{
+		ID:           resp.DocumentID,
+		CollectionID: collectionID,
+		Filename:     pageURL,
+		FileType:     FileTypeHTML,
+		FileSize:     size,
+		Status:       domain.DocumentStatusReady,
+		Visibility:   domain.DocumentVisibilityPublished,
+		Tags:         domain.ParseTags(docMeta),
+		ChunkCount:   resp.ChunkCount,
+		Metadata:     docMeta,
+	}
+	s.recordDocument(document)
+	return document, nil
+}
+
+// fetchPageText downloads an HTML or plain text page and returns its
+// readable text and size in bytes
+func (s *IngestService) fetchPageText(ctx context.Context, pageURL string) (string, int64, error) {
+	limit := s.cfg.Storage.MaxFileSize
+	if limit <= 0 {
+		limit = urlFetchMaxBody
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %v", domain.ErrInvalidRequest, err)
+	}
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9")
+
+	resp, err := urlFetchClient.Do(req)
+	if err != nil {
+		if errors.Is(err, errBlockedAddress) {
+			return "", 0, fmt.Errorf("%w: %v", domain.ErrInvalidRequest, errBlockedAddress)
+		}
+		return "", 0, fmt.Errorf("%w: %v", domain.ErrFetchFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", 0, fmt.Errorf("%w: %s returned %s", domain.ErrFetchFailed, pageURL, resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	isHTML := mediaType == "text/html" || mediaType == "application/xhtml+xml"
+	if !isHTML && mediaType != "text/plain" {
+		return "", 0, fmt.Errorf("%w: unsupported content type %q", domain.ErrFetchFailed, mediaType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %v", domain.ErrFetchFailed, err)
+	}
+	if int64(len(body)) > limit {
+		return "", 0, fmt.Errorf("%w: page exceeds %d bytes", domain.ErrInvalidRequest, limit)
+	}
+
+	text := strings.TrimSpace(string(body))
+	if isHTML {
+		if text, err = readHTMLMainContent(bytes.NewReader(body)); err != nil {
+			return "", 0, fmt.Errorf("%w: %v", domain.ErrInvalidRequest, err)
+		}
+	}
+	if text == "" {
+		return "", 0, fmt.Errorf("%w: page has no text", domain.ErrInvalidRequest)
+	}
+	return text, int64(len(body)), nil
+}
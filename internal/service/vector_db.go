@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"modernc.org/sqlite"
+)
+
+// sqvect opens the vector store with mattn/go-sqlite3's _busy_timeout DSN
+// parameter, which modernc.org/sqlite ignores, so an upload writing while
+// another document is ingested failed with SQLITE_BUSY instead of waiting
+// for the write lock. Apply it as a pragma on every connection that asks
+// for it.
+func init() {
+	sqlite.RegisterConnectionHook(func(conn sqlite.ExecQuerierContext, dsn string) error {
+		ms, ok := busyTimeoutParam(dsn)
+		if !ok {
+			return nil
+		}
+		_, err := conn.ExecContext(context.Background(), "PRAGMA busy_timeout = "+strconv.Itoa(ms), nil)
+		return err
+	})
+}
+
+// busyTimeoutParam reads the _busy_timeout parameter of a DSN
+func busyTimeoutParam(dsn string) (int, bool) {
+	_, query, ok := strings.Cut(dsn, "?")
+	if !ok {
+		return 0, false
+	}
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return 0, false
+	}
+	ms, err := strconv.Atoi(params.Get("_busy_timeout"))
+	if err != nil || ms <= 0 {
+		return 0, false
+	}
+	return ms, true
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/liliang-cn/askdoc/internal/config"
+	ragodomain "github.com/liliang-cn/rago/v2/pkg/domain"
+)
+
+// metricCandidateFactor widens the vector index's cosine candidate set before
+// it is filtered or re-ranked with another metric
+const metricCandidateFactor = 4
+
+// normalizingEmbedder L2-normalizes every embedding. Ingestion and queries
+// share one embedder, so both sides are normalized consistently.
+type normalizingEmbedder struct {
+	ragodomain.EmbedderProvider
+}
+
+func (e *normalizingEmbedder) Embed(ctx context.Context, text string) ([]float64, error) {
+	vec, err := e.EmbedderProvider.Embed(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeVector(vec), nil
+}
+
+func (e *normalizingEmbedder) EmbedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	vecs, err := e.EmbedderProvider.EmbedBatch(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	for i, vec := range vecs {
+		vecs[i] = normalizeVector(vec)
+	}
+	return vecs, nil
+}
+
+// normalizeVector scales vec to unit length in place; zero vectors are left as is
+func normalizeVector(vec []float64) []float64 {
+	var sum float64
+	for _, v := range vec {
+		sum += v * v
+	}
+	if sum == 0 {
+		return vec
+	}
+	norm := math.Sqrt(sum)
+	for i := range vec {
+		vec[i] /= norm
+	}
+	return vec
+}
+
+// vectorSimilarity scores a against b with rag.distance_metric; higher is
+// always more similar. Euclidean scores are 1/(1+distance), in (0, 1], so
+// rag.min_score thresholds them like cosine scores and the default of 0
+// keeps every chunk.
+func vectorSimilarity(metric string, a, b []float64) float64 {
+	if len(a) != len(b) {
+		return math.Inf(-1)
+	}
+
+	switch metric {
+	case config.DistanceDot:
+		var dot float64
+		for i := range a {
+			dot += a[i] * b[i]
+		}
+		return dot
+	case config.DistanceEuclidean:
+		var sum float64
+		for i := range a {
+			d := a[i] - b[i]
+			sum += d * d
+		}
+		return 1 / (1 + math.Sqrt(sum))
+	default:
+		var dot, na, nb float64
+		for i := range a {
+			dot += a[i] * b[i]
+			na += a[i] * a[i]
+			nb += b[i] * b[i]
+		}
+		if na == 0 || nb == 0 {
+			return 0
+		}
+		return dot / (math.Sqrt(na) * math.Sqrt(nb))
+	}
+}
+
+// rankChunks re-scores chunks against query with metric and keeps the best topK
+func rankChunks(metric string, query []float64, chunks []ragodomain.Chunk, topK int) []ragodomain.Chunk {
+	for i := range chunks {
+		if len(chunks[i].Vector) > 0 {
+			chunks[i].Score = vectorSimilarity(metric, query, chunks[i].Vector)
+		}
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].Score > chunks[j].Score
+	})
+	if len(chunks) > topK {
+		chunks = chunks[:topK]
+	}
+	return chunks
+}
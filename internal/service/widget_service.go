@@ -69,11 +69,73 @@ func (s *WidgetService) GetWidgetConfig(ctx context.Context, siteID string, requ
 	}, nil
 }
 
+// SiteRateLimit returns the site's requests-per-hour limit, or 0 when the
+// site doesn't exist so the global limit applies
+func (s *WidgetService) SiteRateLimit(siteID string) int {
+	site, err := s.siteRepo.Get(siteID)
+	if err != nil || site == nil {
+		return 0
+	}
+	return site.RateLimit
+}
+
+// ValidSiteKey reports whether key opens the site's widget endpoints.
+// Unknown sites pass so the handlers can report them as not found.
+func (s *WidgetService) ValidSiteKey(siteID, key string) bool {
+	site, err := s.siteRepo.Get(siteID)
+	if err != nil {
+		return false
+	}
+	if site == nil {
+		return true
+	}
+	return site.AcceptsWidgetKey(key)
+}
+
+// SiteAllowsOrigin reports whether the site accepts browser requests from
+// origin. Unknown sites pass so the handlers can report them as not found.
+func (s *WidgetService) SiteAllowsOrigin(siteID, origin string) bool {
+	site, err := s.siteRepo.Get(siteID)
+	if err != nil {
+		return false
+	}
+	if site == nil {
+		return true
+	}
+	return site.AllowsOrigin(origin)
+}
+
 // Chat handles a chat message
 func (s *WidgetService) Chat(ctx context.Context, siteID string, req *domain.ChatRequest) (*domain.ChatResponse, error) {
 	return s.chatService.Chat(ctx, siteID, req)
 }
 
+// SessionHistory returns a session's messages, oldest first. Sessions of
+// other sites are reported as not found.
+func (s *WidgetService) SessionHistory(ctx context.Context, siteID, sessionID string) ([]*domain.Message, error) {
+	session, err := s.sessionRepo.Get(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.SiteID != siteID {
+		return nil, domain.ErrNotFound
+	}
+
+	messages, err := s.sessionRepo.GetMessages(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	if messages == nil {
+		messages = []*domain.Message{}
+	}
+	return messages, nil
+}
+
+// Feedback records a rating of one of the site's answers
+func (s *WidgetService) Feedback(ctx context.Context, siteID string, req *domain.FeedbackRequest) (*domain.Feedback, error) {
+	return s.chatService.SubmitFeedback(ctx, siteID, req)
+}
+
 // ChatStream handles a streaming chat message
 func (s *WidgetService) ChatStream(ctx context.Context, siteID string, req *domain.ChatRequest) (<-chan domain.StreamChunk, error) {
 	return s.chatService.ChatStream(ctx, siteID, req)
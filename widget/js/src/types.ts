@@ -28,22 +28,32 @@ export interface WidgetConfig {
 export interface ChatRequest {
   session_id?: string;
   message: string;
+  clean_sources?: boolean;
+  external_user_id?: string;
+  session_metadata?: Record<string, unknown>;
+  model?: string;
+  filters?: Record<string, string>;
 }
 
 export interface ChatResponse {
   session_id: string;
   answer: string;
   sources?: Source[];
+  disclaimer?: string;
+  knowledge_cutoff?: string;
 }
 
 export interface Source {
   document_id: string;
   filename: string;
   content: string;
+  raw_content?: string;
+  language?: string;
   score: number;
 }
 
 export interface StreamChunk {
-  type: 'thinking' | 'content' | 'sources' | 'done' | 'error';
+  type: 'thinking' | 'content' | 'sources' | 'disclaimer' | 'done' | 'error';
   content?: string;
+  knowledge_cutoff?: string;
 }